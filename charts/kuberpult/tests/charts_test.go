@@ -618,6 +618,70 @@ ingress:
 			},
 			ExpectedMissing: []core.EnvVar{},
 		},
+		{
+			Name: "Manifest schemas from a config map",
+			Values: `
+git:
+  url: "testURL"
+ingress:
+  domainName: "kuberpult-example.com"
+cd:
+  manifestSchemas:
+    configMap: "schemas"
+`,
+			ExpectedEnvs: []core.EnvVar{
+				{
+					Name:  "KUBERPULT_MANIFEST_SCHEMA_DIR",
+					Value: "/manifest-schemas",
+				},
+			},
+			ExpectedMissing: []core.EnvVar{},
+		},
+		{
+			Name: "Manifest schemas from a volume",
+			Values: `
+git:
+  url: "testURL"
+ingress:
+  domainName: "kuberpult-example.com"
+cd:
+  manifestSchemas:
+    volume:
+      persistentVolumeClaim:
+        claimName: schemas
+`,
+			ExpectedEnvs: []core.EnvVar{
+				{
+					Name:  "KUBERPULT_MANIFEST_SCHEMA_DIR",
+					Value: "/manifest-schemas",
+				},
+			},
+			ExpectedMissing: []core.EnvVar{},
+		},
+		{
+			Name: "Manifest schemas from a directory in the image",
+			Values: `
+git:
+  url: "testURL"
+ingress:
+  domainName: "kuberpult-example.com"
+cd:
+  manifestSchemas:
+    dir: "/schemas"
+`,
+			ExpectedEnvs: []core.EnvVar{
+				{
+					Name:  "KUBERPULT_MANIFEST_SCHEMA_DIR",
+					Value: "/schemas",
+				},
+			},
+			ExpectedMissing: []core.EnvVar{
+				{
+					Name:  "KUBERPULT_MANIFEST_SCHEMA_DIR",
+					Value: "/manifest-schemas",
+				},
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -99,6 +99,18 @@ func prepareHttpRequest(url string, authParams kutil.AuthenticationParameters, p
 		}
 	}
 
+	for key, value := range parsedArgs.Labels {
+		if err := writer.WriteField(fmt.Sprintf("labels[%s]", key), value); err != nil {
+			return nil, fmt.Errorf("error writing label %s, error: %w", key, err)
+		}
+	}
+
+	for app, minVersion := range parsedArgs.Dependencies {
+		if err := writer.WriteField(fmt.Sprintf("dependencies[%s]", app), fmt.Sprintf("%d", minVersion)); err != nil {
+			return nil, fmt.Errorf("error writing dependency %s, error: %w", app, err)
+		}
+	}
+
 	if err := writer.Close(); err != nil {
 		return nil, fmt.Errorf("error closing the writer, error: %w", err)
 	}
@@ -526,6 +526,58 @@ func TestRequestCreation(t *testing.T) {
 			},
 			responseCode: http.StatusOK,
 		},
+		{
+			name: "labels are set",
+			params: ReleaseParameters{
+				Application: "potato",
+				Manifests: map[string][]byte{
+					"development": []byte("some development manifest"),
+				},
+				Labels: map[string]string{
+					"risk":      "low",
+					"build-url": "https://ci.example.com/1",
+				},
+			},
+			expectedMultipartFormValue: map[string][]string{
+				"application":       {"potato"},
+				"labels[risk]":      {"low"},
+				"labels[build-url]": {"https://ci.example.com/1"},
+			},
+			expectedMultipartFormFile: map[string][]simpleMultipartFormFileHeader{
+				"manifests[development]": {
+					{
+						filename: "development-manifest",
+						content:  "some development manifest",
+					},
+				},
+			},
+			responseCode: http.StatusOK,
+		},
+		{
+			name: "dependencies are set",
+			params: ReleaseParameters{
+				Application: "potato",
+				Manifests: map[string][]byte{
+					"development": []byte("some development manifest"),
+				},
+				Dependencies: map[string]uint64{
+					"potato-db-migrator": 12,
+				},
+			},
+			expectedMultipartFormValue: map[string][]string{
+				"application":                      {"potato"},
+				"dependencies[potato-db-migrator]": {"12"},
+			},
+			expectedMultipartFormFile: map[string][]simpleMultipartFormFileHeader{
+				"manifests[development]": {
+					{
+						filename: "development-manifest",
+						content:  "some development manifest",
+					},
+				},
+			},
+			responseCode: http.StatusOK,
+		},
 	}
 
 	for _, tc := range tcs {
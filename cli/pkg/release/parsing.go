@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/freiheit-com/kuberpult/cli/pkg/cli_utils"
@@ -42,6 +43,8 @@ type commandLineArguments struct {
 	sourceMessage    cli_utils.RepeatedString
 	version          cli_utils.RepeatedInt
 	displayVersion   cli_utils.RepeatedString
+	labels           cli_utils.RepeatedString
+	dependencies     cli_utils.RepeatedString
 	skipSignatures   bool
 	signatures       cli_utils.RepeatedString
 }
@@ -165,6 +168,33 @@ func argsValid(cmdArgs *commandLineArguments) (result bool, errorMessage string)
 		}
 	}
 
+	labelKeys := map[string]bool{}
+	for _, label := range cmdArgs.labels.Values {
+		key, _, found := strings.Cut(label, "=")
+		if !found || key == "" {
+			return false, fmt.Sprintf("the --label arg must have the form key=value, got %q", label)
+		}
+		if labelKeys[key] {
+			return false, fmt.Sprintf("the --label arg must be set at most once per key, got %q twice", key)
+		}
+		labelKeys[key] = true
+	}
+
+	dependencyApps := map[string]bool{}
+	for _, dependency := range cmdArgs.dependencies.Values {
+		app, minVersion, found := strings.Cut(dependency, "=")
+		if !found || app == "" {
+			return false, fmt.Sprintf("the --dependency arg must have the form application=version, got %q", dependency)
+		}
+		if version, err := strconv.ParseUint(minVersion, 10, 64); err != nil || version == 0 {
+			return false, fmt.Sprintf("the version of the --dependency arg must be a positive integer, got %q", dependency)
+		}
+		if dependencyApps[app] {
+			return false, fmt.Sprintf("the --dependency arg must be set at most once per application, got %q twice", app)
+		}
+		dependencyApps[app] = true
+	}
+
 	if cmdArgs.skipSignatures {
 		if len(cmdArgs.signatures.Values) > 0 {
 			return false, "--signature args are not allowed when --skip_signatures is set"
@@ -190,6 +220,8 @@ func readArgs(args []string) (*commandLineArguments, error) {
 	fs.Var(&cmdArgs.sourceMessage, "source_message", "the source commit message (must not be set more than once)")
 	fs.Var(&cmdArgs.version, "version", "the release version (must be a positive integer)")
 	fs.Var(&cmdArgs.displayVersion, "display_version", "display version (must be a string between 1 and characters long)")
+	fs.Var(&cmdArgs.labels, "label", "a label of the release in the form key=value, e.g. the build url (can be set multiple times)")
+	fs.Var(&cmdArgs.dependencies, "dependency", "an application that must be deployed in at least the given version before this release is deployed, in the form application=version (can be set multiple times)")
 	fs.BoolVar(&cmdArgs.skipSignatures, "skip_signatures", false, "if set to true, then the command line does not accept the --signature args")
 	fs.Var(&cmdArgs.signatures, "signature", "the name of the file containing the signature of the manifest to be deployed (must be set immediately after --manifest)")
 
@@ -255,6 +287,21 @@ func convertToParams(cmdArgs commandLineArguments) (*ReleaseParameters, error) {
 	if len(cmdArgs.displayVersion.Values) == 1 {
 		rp.DisplayVersion = &cmdArgs.displayVersion.Values[0]
 	}
+	if len(cmdArgs.labels.Values) > 0 {
+		rp.Labels = make(map[string]string)
+		for _, label := range cmdArgs.labels.Values {
+			key, value, _ := strings.Cut(label, "=")
+			rp.Labels[key] = value
+		}
+	}
+	if len(cmdArgs.dependencies.Values) > 0 {
+		rp.Dependencies = make(map[string]uint64)
+		for _, dependency := range cmdArgs.dependencies.Values {
+			app, minVersion, _ := strings.Cut(dependency, "=")
+			version, _ := strconv.ParseUint(minVersion, 10, 64)
+			rp.Dependencies[app] = version
+		}
+	}
 	for i := range cmdArgs.environments.Values {
 		manifestFile := cmdArgs.manifests.Values[i]
 		environment := cmdArgs.environments.Values[i]
@@ -598,6 +598,89 @@ func TestReadArgs(t *testing.T) {
 				msg: "the --display_version arg must be at most 15 characters long",
 			},
 		},
+		{
+			name: "labels are specified",
+			args: []string{"--skip_signatures", "--application", "potato", "--environment", "production", "--manifest", "manifest-file.yaml", "--label", "risk=low", "--label", "build-url=https://ci.example.com/1"},
+			expectedCmdArgs: &commandLineArguments{
+				skipSignatures: true,
+				application: cli_utils.RepeatedString{
+					Values: []string{
+						"potato",
+					},
+				},
+				environments: cli_utils.RepeatedString{
+					Values: []string{
+						"production",
+					},
+				},
+				manifests: cli_utils.RepeatedString{
+					Values: []string{
+						"manifest-file.yaml",
+					},
+				},
+				labels: cli_utils.RepeatedString{
+					Values: []string{
+						"risk=low",
+						"build-url=https://ci.example.com/1",
+					},
+				},
+			},
+		},
+		{
+			name: "--label is specified without value",
+			args: []string{"--skip_signatures", "--application", "potato", "--environment", "production", "--manifest", "manifest-file.yaml", "--label", "risk"},
+			expectedError: errMatcher{
+				msg: "the --label arg must have the form key=value, got \"risk\"",
+			},
+		},
+		{
+			name: "--label is specified twice for the same key",
+			args: []string{"--skip_signatures", "--application", "potato", "--environment", "production", "--manifest", "manifest-file.yaml", "--label", "risk=low", "--label", "risk=high"},
+			expectedError: errMatcher{
+				msg: "the --label arg must be set at most once per key, got \"risk\" twice",
+			},
+		},
+		{
+			name: "dependencies are specified",
+			args: []string{"--skip_signatures", "--application", "potato", "--environment", "production", "--manifest", "manifest-file.yaml", "--dependency", "potato-db-migrator=12"},
+			expectedCmdArgs: &commandLineArguments{
+				skipSignatures: true,
+				application: cli_utils.RepeatedString{
+					Values: []string{
+						"potato",
+					},
+				},
+				environments: cli_utils.RepeatedString{
+					Values: []string{
+						"production",
+					},
+				},
+				manifests: cli_utils.RepeatedString{
+					Values: []string{
+						"manifest-file.yaml",
+					},
+				},
+				dependencies: cli_utils.RepeatedString{
+					Values: []string{
+						"potato-db-migrator=12",
+					},
+				},
+			},
+		},
+		{
+			name: "--dependency is specified without version",
+			args: []string{"--skip_signatures", "--application", "potato", "--environment", "production", "--manifest", "manifest-file.yaml", "--dependency", "potato-db-migrator=latest"},
+			expectedError: errMatcher{
+				msg: "the version of the --dependency arg must be a positive integer, got \"potato-db-migrator=latest\"",
+			},
+		},
+		{
+			name: "--dependency is specified twice for the same application",
+			args: []string{"--skip_signatures", "--application", "potato", "--environment", "production", "--manifest", "manifest-file.yaml", "--dependency", "potato-db-migrator=1", "--dependency", "potato-db-migrator=2"},
+			expectedError: errMatcher{
+				msg: "the --dependency arg must be set at most once per application, got \"potato-db-migrator\" twice",
+			},
+		},
 	}
 
 	for _, tc := range tcs {
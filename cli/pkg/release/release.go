@@ -34,6 +34,8 @@ type ReleaseParameters struct {
 	SourceMessage    *string
 	Version          *uint64
 	DisplayVersion   *string
+	Labels           map[string]string
+	Dependencies     map[string]uint64 // key is the name of the application and value is its minimum version
 }
 
 // calls the Release endpoint with the specified parameters
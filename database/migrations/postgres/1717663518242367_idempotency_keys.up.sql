@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    userEmail VARCHAR, -- keys are only unique per user
+    idempotencyKey VARCHAR, -- this key is provided by the API caller
+    created TIMESTAMP,
+    requestHash VARCHAR,
+    response VARCHAR, -- empty while the batch is processed
+    PRIMARY KEY(userEmail, idempotencyKey)
+);
@@ -39,6 +39,13 @@ const (
 	PermissionCreateEnvironment            = "CreateEnvironment"
 	PermissionDeleteEnvironmentApplication = "DeleteEnvironmentApplication"
 	PermissionDeployReleaseTrain           = "DeployReleaseTrain"
+	// Allows deleting locks of other users when the lock ownership policy is enabled.
+	PermissionDeleteAnyLock = "DeleteAnyLock"
+	// Allows deleting releases that are deployed or queued.
+	PermissionForceDeleteRelease = "ForceDeleteRelease"
+	// Allows deleting environments. Deleting an environment that still has deployed applications
+	// additionally requires the DeleteEnvironmentApplication permission for these applications.
+	PermissionDeleteEnvironment = "DeleteEnvironment"
 	// The default permission template.
 	PermissionTemplate = "p,role:%s,%s,%s:%s,%s,allow"
 )
@@ -49,6 +56,9 @@ type RBACConfig struct {
 	DexEnabled bool
 	// The RBAC policies. The key is a permission or group, for example: "Developer, CreateLock, development:development, *, allow"
 	Policy *RBACPolicies
+	// Indicates if locks can only be deleted by their creator, the members of the owning team
+	// and roles with the DeleteAnyLock permission. Only used if Dex is enabled.
+	LockOwnership bool
 }
 
 // Inits the RBAC Config struct
@@ -64,7 +74,10 @@ func initPolicyConfig() policyConfig {
 			PermissionDeployUndeploy,
 			PermissionCreateEnvironment,
 			PermissionDeleteEnvironmentApplication,
-			PermissionDeployReleaseTrain},
+			PermissionDeployReleaseTrain,
+			PermissionDeleteAnyLock,
+			PermissionForceDeleteRelease,
+			PermissionDeleteEnvironment},
 	}
 }
 
@@ -142,9 +155,16 @@ type RBACGroup struct {
 	Role  string
 }
 
+// Struct to store the membership of a role in a team.
+type RBACTeam struct {
+	Team string
+	Role string
+}
+
 type RBACPolicies struct {
 	Groups      map[string]RBACGroup
 	Permissions map[string]Permission
+	Teams       map[string]RBACTeam
 }
 
 func ValidateRbacPermission(line string) (p Permission, err error) {
@@ -204,6 +224,27 @@ func ValidateRbacGroup(line string) (p RBACGroup, err error) {
 	}, nil
 }
 
+func ValidateRbacTeam(line string) (p RBACTeam, err error) {
+	// Verifies if all fields are specified
+	c := strings.Split(line, ",")
+	if len(c) != 3 {
+		return p, fmt.Errorf("3 fields are expected but %d were specified", len(c))
+	}
+	team := c[1]
+	if !valid.TeamName(team) {
+		return p, fmt.Errorf("invalid team %s", team)
+	}
+	// Permission role
+	if !strings.Contains(c[2], "role:") {
+		return p, fmt.Errorf("the format for teams expects the prefix `role:` for a team's role")
+	}
+	role := c[2][5:]
+	return RBACTeam{
+		Role: role,
+		Team: team,
+	}, nil
+}
+
 func ReadRbacPolicy(dexEnabled bool, DexRbacPolicyPath string) (policy *RBACPolicies, err error) {
 	if !dexEnabled {
 		return nil, nil
@@ -216,7 +257,7 @@ func ReadRbacPolicy(dexEnabled bool, DexRbacPolicyPath string) (policy *RBACPoli
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-	policy = &RBACPolicies{Permissions: map[string]Permission{}, Groups: map[string]RBACGroup{}}
+	policy = &RBACPolicies{Permissions: map[string]Permission{}, Groups: map[string]RBACGroup{}, Teams: map[string]RBACTeam{}}
 	for scanner.Scan() {
 		// Trim spaces from policy
 		line := strings.ReplaceAll(scanner.Text(), " ", "")
@@ -232,6 +273,12 @@ func ReadRbacPolicy(dexEnabled bool, DexRbacPolicyPath string) (policy *RBACPoli
 				return nil, err
 			}
 			policy.Groups[line] = g
+		} else if len(line) > 0 && line[0] == 't' {
+			t, err := ValidateRbacTeam(line)
+			if err != nil {
+				return nil, err
+			}
+			policy.Teams[line] = t
 		}
 	}
 	if len(policy.Permissions) == 0 {
@@ -299,6 +346,26 @@ func CheckUserPermissions(rbacConfig RBACConfig, user *User, env, team, envGroup
 	}
 }
 
+// Checks if the user may delete a lock according to the lock ownership policy.
+// A lock can be deleted by the user who created it, by members of the team owning the lock
+// and by roles with the DeleteAnyLock permission. Environment locks are not owned by any team.
+func CheckUserCanDeleteLock(rbacConfig RBACConfig, user *User, env, team, envGroup, application, lockCreatorEmail string) error {
+	if !rbacConfig.DexEnabled || !rbacConfig.LockOwnership {
+		return nil
+	}
+	if lockCreatorEmail != "" && user.Email == lockCreatorEmail {
+		return nil
+	}
+	if team != "" && rbacConfig.Policy != nil {
+		for _, t := range rbacConfig.Policy.Teams {
+			if t.Team == team && t.Role == user.DexAuthContext.Role {
+				return nil
+			}
+		}
+	}
+	return CheckUserPermissions(rbacConfig, user, env, team, envGroup, application, PermissionDeleteAnyLock)
+}
+
 // Helper function to parse the scopes
 func ReadScopes(s string) (scopes []string) {
 	replacer := strings.NewReplacer(" ", "")
@@ -127,6 +127,116 @@ func TestValidateRbacGroup(t *testing.T) {
 	}
 }
 
+func TestValidateRbacTeam(t *testing.T) {
+	tcs := []struct {
+		Name     string
+		Team     string
+		WantErr  error
+		WantTeam RBACTeam
+	}{
+		{
+			Name: "Validating RBAC team works as expected",
+			Team: "t,sre-team,role:Developer",
+			WantTeam: RBACTeam{
+				Role: "Developer",
+				Team: "sre-team",
+			},
+		},
+		{
+			Name:    "Invalid team name",
+			Team:    "t,SRE Team,role:Developer",
+			WantErr: errMatcher{"invalid team SRE Team"},
+		},
+		{
+			Name:    "Missing role prefix",
+			Team:    "t,sre-team,Developer",
+			WantErr: errMatcher{"the format for teams expects the prefix `role:` for a team's role"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			team, err := ValidateRbacTeam(tc.Team)
+			if diff := cmp.Diff(tc.WantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.WantTeam, team); diff != "" {
+				t.Errorf("%s: unexpected result diff : %v", tc.Name, diff)
+			}
+		})
+	}
+}
+
+func TestCheckUserCanDeleteLock(t *testing.T) {
+	policy := &RBACPolicies{
+		Permissions: map[string]Permission{
+			"p,role:Admin,DeleteAnyLock,production:production,*,allow": {Role: "Admin"},
+		},
+		Teams: map[string]RBACTeam{
+			"t,sre-team,role:SRE": {Team: "sre-team", Role: "SRE"},
+		},
+	}
+	tcs := []struct {
+		Name             string
+		rbacConfig       RBACConfig
+		user             *User
+		team             string
+		lockCreatorEmail string
+		WantError        error
+	}{
+		{
+			Name:             "Lock ownership disabled",
+			rbacConfig:       RBACConfig{DexEnabled: true, Policy: policy, LockOwnership: false},
+			user:             &User{Email: "other@example.com", DexAuthContext: &DexAuthContext{Role: "Developer"}},
+			lockCreatorEmail: "creator@example.com",
+		},
+		{
+			Name:             "Creator can delete the lock",
+			rbacConfig:       RBACConfig{DexEnabled: true, Policy: policy, LockOwnership: true},
+			user:             &User{Email: "creator@example.com", DexAuthContext: &DexAuthContext{Role: "Developer"}},
+			lockCreatorEmail: "creator@example.com",
+		},
+		{
+			Name:             "Team member can delete the lock",
+			rbacConfig:       RBACConfig{DexEnabled: true, Policy: policy, LockOwnership: true},
+			user:             &User{Email: "sre@example.com", DexAuthContext: &DexAuthContext{Role: "SRE"}},
+			team:             "sre-team",
+			lockCreatorEmail: "creator@example.com",
+		},
+		{
+			Name:             "Role with override permission can delete the lock",
+			rbacConfig:       RBACConfig{DexEnabled: true, Policy: policy, LockOwnership: true},
+			user:             &User{Email: "admin@example.com", DexAuthContext: &DexAuthContext{Role: "Admin"}},
+			lockCreatorEmail: "creator@example.com",
+		},
+		{
+			Name:             "Other users cannot delete the lock",
+			rbacConfig:       RBACConfig{DexEnabled: true, Policy: policy, LockOwnership: true},
+			user:             &User{Name: "other", Email: "other@example.com", DexAuthContext: &DexAuthContext{Role: "SRE"}},
+			team:             "other-team",
+			lockCreatorEmail: "creator@example.com",
+			WantError: PermissionError{
+				User:        "other",
+				Role:        "SRE",
+				Action:      PermissionDeleteAnyLock,
+				Environment: "production",
+				Team:        "other-team",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := CheckUserCanDeleteLock(tc.rbacConfig, tc.user, "production", tc.team, "production", "app1", tc.lockCreatorEmail)
+			if diff := cmp.Diff(tc.WantError, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestCheckUserPermissions(t *testing.T) {
 	tcs := []struct {
 		Name        string
@@ -20,6 +20,12 @@ type EnvironmentConfig struct {
 	Upstream         *EnvironmentConfigUpstream `json:"upstream,omitempty"`
 	ArgoCd           *EnvironmentConfigArgoCd   `json:"argocd,omitempty"`
 	EnvironmentGroup *string                    `json:"environmentGroup,omitempty"`
+	// FreezeWindows are recurring periods in which the environment behaves as if it was locked.
+	FreezeWindows []FreezeWindow `json:"freezeWindows,omitempty"`
+	// AutoRollback lets the rollout-service roll back new versions that stay unhealthy.
+	AutoRollback *EnvironmentConfigAutoRollback `json:"autoRollback,omitempty"`
+	// Promotion lets the rollout-service deploy versions that are healthy in the upstream environment.
+	Promotion *EnvironmentConfigPromotion `json:"promotion,omitempty"`
 }
 
 type EnvironmentConfigUpstream struct {
@@ -59,6 +65,21 @@ type ArgoCdSyncWindow struct {
 	Apps     []string `json:"applications,omitempty"`
 }
 
+type EnvironmentConfigAutoRollback struct {
+	UnhealthyDuration string `json:"unhealthyDuration"` // go duration format, e.g. "15m"
+}
+
+type EnvironmentConfigPromotion struct {
+	SoakTime string `json:"soakTime"` // go duration format, e.g. "2h"
+}
+
+// FreezeWindow starts at every point in time matched by Schedule and lasts for Duration.
+type FreezeWindow struct {
+	Schedule string `json:"schedule"` // crontab format, e.g. "0 16 * * 5" for every Friday 16:00 (UTC)
+	Duration string `json:"duration"` // go duration format, e.g. "64h"
+	Message  string `json:"message,omitempty"`
+}
+
 type ArgoCdIgnoreDifference struct {
 	Group                 string   `json:"group,omitempty"`
 	Kind                  string   `json:"kind"`
@@ -243,21 +243,35 @@ func WithTransactionT[T any](h *DBHandler, ctx context.Context, f DBFunctionT[T]
 type EventType string
 
 const (
-	EvtCreateApplicationVersion         EventType = "CreateApplicationVersion"
-	EvtDeployApplicationVersion         EventType = "DeployApplicationVersion"
-	EvtCreateUndeployApplicationVersion EventType = "CreateUndeployApplicationVersion"
-	EvtUndeployApplication              EventType = "UndeployApplication"
-	EvtDeleteEnvFromApp                 EventType = "DeleteEnvFromApp"
-	EvtCreateEnvironmentLock            EventType = "CreateEnvironmentLock"
-	EvtDeleteEnvironmentLock            EventType = "DeleteEnvironmentLock"
-	EvtCreateEnvironmentTeamLock        EventType = "CreateEnvironmentTeamLock"
-	EvtDeleteEnvironmentTeamLock        EventType = "DeleteEnvironmentTeamLock"
-	EvtCreateEnvironmentGroupLock       EventType = "CreateEnvironmentGroupLock"
-	EvtDeleteEnvironmentGroupLock       EventType = "DeleteEnvironmentGroupLock"
-	EvtCreateEnvironment                EventType = "CreateEnvironment"
-	EvtCreateEnvironmentApplicationLock EventType = "CreateEnvironmentApplicationLock"
-	EvtDeleteEnvironmentApplicationLock EventType = "DeleteEnvironmentApplicationLock"
-	EvtReleaseTrain                     EventType = "ReleaseTrain"
+	EvtCreateApplicationVersion           EventType = "CreateApplicationVersion"
+	EvtDeployApplicationVersion           EventType = "DeployApplicationVersion"
+	EvtCreateUndeployApplicationVersion   EventType = "CreateUndeployApplicationVersion"
+	EvtUndeployApplication                EventType = "UndeployApplication"
+	EvtDeleteEnvFromApp                   EventType = "DeleteEnvFromApp"
+	EvtCreateEnvironmentLock              EventType = "CreateEnvironmentLock"
+	EvtDeleteEnvironmentLock              EventType = "DeleteEnvironmentLock"
+	EvtCreateEnvironmentTeamLock          EventType = "CreateEnvironmentTeamLock"
+	EvtDeleteEnvironmentTeamLock          EventType = "DeleteEnvironmentTeamLock"
+	EvtCreateEnvironmentGroupLock         EventType = "CreateEnvironmentGroupLock"
+	EvtDeleteEnvironmentGroupLock         EventType = "DeleteEnvironmentGroupLock"
+	EvtCreateEnvironment                  EventType = "CreateEnvironment"
+	EvtCreateEnvironmentApplicationLock   EventType = "CreateEnvironmentApplicationLock"
+	EvtDeleteEnvironmentApplicationLock   EventType = "DeleteEnvironmentApplicationLock"
+	EvtReleaseTrain                       EventType = "ReleaseTrain"
+	EvtCreateEnvironmentSelectorLock      EventType = "CreateEnvironmentSelectorLock"
+	EvtDeleteEnvironmentSelectorLock      EventType = "DeleteEnvironmentSelectorLock"
+	EvtCreateEnvironmentGroupSelectorLock EventType = "CreateEnvironmentGroupSelectorLock"
+	EvtDeleteEnvironmentGroupSelectorLock EventType = "DeleteEnvironmentGroupSelectorLock"
+	EvtPinApplicationVersion              EventType = "PinApplicationVersion"
+	EvtSetApplicationRetentionPolicy      EventType = "SetApplicationRetentionPolicy"
+	EvtDeleteApplicationVersion           EventType = "DeleteApplicationVersion"
+	EvtCreateScheduledDeployment          EventType = "CreateScheduledDeployment"
+	EvtCancelScheduledDeployment          EventType = "CancelScheduledDeployment"
+	EvtExecuteScheduledDeployment         EventType = "ExecuteScheduledDeployment"
+	EvtRollbackApplication                EventType = "RollbackApplication"
+	EvtDeleteEnvironment                  EventType = "DeleteEnvironment"
+	EvtUpdateEnvironmentConfig            EventType = "UpdateEnvironmentConfig"
+	EvtCloneEnvironment                   EventType = "CloneEnvironment"
 )
 
 // DBWriteEslEventInternal writes one event to the event-sourcing-light table, taking arbitrary data as input
@@ -454,6 +468,104 @@ func (h *DBHandler) DBWriteDeploymentEvent(ctx context.Context, transaction *sql
 	return h.writeEvent(ctx, transaction, uuid, event.EventTypeDeployment, sourceCommitHash, jsonToInsert)
 }
 
+func (h *DBHandler) DBWriteLockCreatedEvent(ctx context.Context, transaction *sql.Tx, uuid, email string, lockCreated *event.LockCreated) error {
+	metadata := event.Metadata{
+		AuthorEmail: email,
+		Uuid:        uuid,
+	}
+	jsonToInsert, err := json.Marshal(event.DBEventGo{
+		EventData:     lockCreated,
+		EventMetadata: metadata,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error marshalling lock created event to Json. Error: %v\n", err)
+	}
+	// lock events do not belong to any commit
+	return h.writeEvent(ctx, transaction, uuid, event.EventTypeLockCreated, "", jsonToInsert)
+}
+
+func (h *DBHandler) DBWriteLockDeletedEvent(ctx context.Context, transaction *sql.Tx, uuid, email string, lockDeleted *event.LockDeleted) error {
+	metadata := event.Metadata{
+		AuthorEmail: email,
+		Uuid:        uuid,
+	}
+	jsonToInsert, err := json.Marshal(event.DBEventGo{
+		EventData:     lockDeleted,
+		EventMetadata: metadata,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error marshalling lock deleted event to Json. Error: %v\n", err)
+	}
+	// lock events do not belong to any commit
+	return h.writeEvent(ctx, transaction, uuid, event.EventTypeLockDeleted, "", jsonToInsert)
+}
+
+func (h *DBHandler) DBWriteEnvironmentConfigUpdatedEvent(ctx context.Context, transaction *sql.Tx, uuid, email string, configUpdated *event.EnvironmentConfigUpdated) error {
+	metadata := event.Metadata{
+		AuthorEmail: email,
+		Uuid:        uuid,
+	}
+	jsonToInsert, err := json.Marshal(event.DBEventGo{
+		EventData:     configUpdated,
+		EventMetadata: metadata,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error marshalling environment config updated event to Json. Error: %v\n", err)
+	}
+	// environment config events do not belong to any commit
+	return h.writeEvent(ctx, transaction, uuid, event.EventTypeEnvConfigUpdated, "", jsonToInsert)
+}
+
+// DBSelectLockEvents returns all lock created and lock deleted events in the given time range, oldest first.
+func (h *DBHandler) DBSelectLockEvents(ctx context.Context, transaction *sql.Tx, from, to time.Time) ([]EventRow, error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "DBSelectLockEvents")
+	defer span.Finish()
+
+	query := h.AdaptQuery("SELECT uuid, timestamp, commitHash, eventType, json FROM events WHERE eventType IN (?, ?) AND timestamp >= (?) AND timestamp <= (?) ORDER BY timestamp ASC;")
+	span.SetTag("query", query)
+
+	rows, err := transaction.QueryContext(ctx, query, event.EventTypeLockCreated, event.EventTypeLockDeleted, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying DB. Error: %w\n", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.FromContext(ctx).Sugar().Warnf("row closing error: %v", err)
+		}
+	}(rows)
+
+	var result []EventRow
+
+	for rows.Next() {
+		var row = EventRow{
+			Uuid:       "",
+			Timestamp:  time.Unix(0, 0), //will be overwritten, prevents CI linter from complaining from missing fields
+			CommitHash: "",
+			EventType:  "",
+			EventJson:  "",
+		}
+		err := rows.Scan(&row.Uuid, &row.Timestamp, &row.CommitHash, &row.EventType, &row.EventJson)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning events row from DB. Error: %w\n", err)
+		}
+
+		result = append(result, row)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("events: row closing error: %v\n", err)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("events: row has error: %v\n", err)
+	}
+	return result, nil
+}
+
 func (h *DBHandler) DBSelectAllEventsForCommit(ctx context.Context, commitHash string) ([]EventRow, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "DBSelectAllEvents")
 	defer span.Finish()
@@ -562,6 +674,8 @@ type Deployment struct {
 type DeploymentMetadata struct {
 	DeployedByName  string
 	DeployedByEmail string
+	// set if the deployment is a rollback, the version that was deployed before
+	RolledBackVersion *int64 `json:",omitempty"`
 }
 
 type AllDeployments []Deployment
@@ -650,6 +764,67 @@ func (h *DBHandler) DBSelectDeployment(ctx context.Context, tx *sql.Tx, appSelec
 	}, nil
 }
 
+// DBSelectDeploymentHistory returns all deployments of the app on the env, the latest first.
+// Undeployments are included with a nil Version.
+func (h *DBHandler) DBSelectDeploymentHistory(ctx context.Context, tx *sql.Tx, appSelector string, envSelector string) ([]Deployment, error) {
+	selectQuery := h.AdaptQuery(
+		"SELECT eslVersion, created, releaseVersion, appName, envName, metadata" +
+			" FROM deployments " +
+			" WHERE appName=? AND envName=? " +
+			" ORDER BY eslVersion DESC;")
+	rows, err := tx.QueryContext(
+		ctx,
+		selectQuery,
+		appSelector,
+		envSelector,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not query deployments table from DB. Error: %w\n", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.FromContext(ctx).Sugar().Warnf("deployments: row closing error: %v", err)
+		}
+	}(rows)
+	result := []Deployment{}
+	for rows.Next() {
+		//exhaustruct:ignore
+		var row = DBDeployment{}
+		var releaseVersion sql.NullInt64
+		err := rows.Scan(&row.EslVersion, &row.Created, &releaseVersion, &row.App, &row.Env, &row.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning deployments row from DB. Error: %w\n", err)
+		}
+		if releaseVersion.Valid {
+			row.ReleaseVersion = &releaseVersion.Int64
+		}
+		//exhaustruct:ignore
+		var resultJson = DeploymentMetadata{}
+		err = json.Unmarshal(([]byte)(row.Metadata), &resultJson)
+		if err != nil {
+			return nil, fmt.Errorf("Error during json unmarshal in deployments. Error: %w. Data: %s\n", err, row.Metadata)
+		}
+		result = append(result, Deployment{
+			EslVersion: row.EslVersion,
+			Created:    row.Created,
+			App:        row.App,
+			Env:        row.Env,
+			Version:    row.ReleaseVersion,
+			Metadata:   resultJson,
+		})
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("deployments: row closing error: %v\n", err)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("deployments: row has error: %v\n", err)
+	}
+	return result, nil
+}
+
 func (h *DBHandler) DBSelectAnyDeployment(ctx context.Context, tx *sql.Tx) (*DBDeployment, error) {
 	selectQuery := h.AdaptQuery(fmt.Sprintf(
 		"SELECT eslVersion, created, releaseVersion, appName, envName" +
@@ -816,3 +991,135 @@ type EventRow struct {
 	EventType  event.EventType
 	EventJson  string
 }
+
+type IdempotencyKey struct {
+	// keys are only unique per user
+	UserEmail string
+	Key       string
+	Created   time.Time
+	// sha256 of the request, to detect that the key was used for a different request
+	RequestHash string
+	Response    string // json, empty while the batch is processed
+}
+
+// DBSelectIdempotencyKey returns the stored key, or nil if there is none that was created after the given time.
+func (h *DBHandler) DBSelectIdempotencyKey(ctx context.Context, tx *sql.Tx, userEmail, key string, createdAfter time.Time) (*IdempotencyKey, error) {
+	selectQuery := h.AdaptQuery(
+		"SELECT userEmail, idempotencyKey, created, requestHash, response" +
+			" FROM idempotency_keys " +
+			" WHERE userEmail=? AND idempotencyKey=? AND created>? " +
+			" LIMIT 1;")
+	rows, err := tx.QueryContext(
+		ctx,
+		selectQuery,
+		userEmail,
+		key,
+		createdAfter.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not query idempotency_keys table from DB. Error: %w\n", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.FromContext(ctx).Sugar().Warnf("idempotency_keys: row closing error: %v", err)
+		}
+	}(rows)
+	var result *IdempotencyKey = nil
+	if rows.Next() {
+		//exhaustruct:ignore
+		row := IdempotencyKey{}
+		err := rows.Scan(&row.UserEmail, &row.Key, &row.Created, &row.RequestHash, &row.Response)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning idempotency_keys row from DB. Error: %w\n", err)
+		}
+		result = &row
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("idempotency_keys: row closing error: %v\n", err)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("idempotency_keys: row has error: %v\n", err)
+	}
+	return result, nil
+}
+
+// DBReserveIdempotencyKey removes all keys that were created before the given time and stores the key.
+// It returns false if the key is stored already, e.g. because the same batch is processed concurrently.
+func (h *DBHandler) DBReserveIdempotencyKey(ctx context.Context, tx *sql.Tx, key IdempotencyKey, expiredBefore time.Time) (bool, error) {
+	if h == nil {
+		return false, nil
+	}
+	if tx == nil {
+		return false, fmt.Errorf("DBReserveIdempotencyKey: no transaction provided")
+	}
+	span, _ := tracer.StartSpanFromContext(ctx, "DBReserveIdempotencyKey")
+	defer span.Finish()
+
+	deleteQuery := h.AdaptQuery("DELETE FROM idempotency_keys WHERE created<=?;")
+	_, err := tx.Exec(deleteQuery, expiredBefore.UTC())
+	if err != nil {
+		return false, fmt.Errorf("could not delete expired idempotency keys from DB. Error: %w\n", err)
+	}
+
+	insertQuery := h.AdaptQuery(
+		"INSERT INTO idempotency_keys (userEmail, idempotencyKey, created, requestHash, response) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING;")
+	span.SetTag("query", insertQuery)
+	result, err := tx.Exec(
+		insertQuery,
+		key.UserEmail,
+		key.Key,
+		key.Created.UTC(),
+		key.RequestHash,
+		key.Response)
+	if err != nil {
+		return false, fmt.Errorf("could not write idempotency key into DB. Error: %w\n", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not write idempotency key into DB. Error: %w\n", err)
+	}
+	return inserted == 1, nil
+}
+
+// DBUpdateIdempotencyKeyResponse stores the response of the batch of a reserved key.
+func (h *DBHandler) DBUpdateIdempotencyKeyResponse(ctx context.Context, tx *sql.Tx, userEmail, key, response string) error {
+	if h == nil {
+		return nil
+	}
+	if tx == nil {
+		return fmt.Errorf("DBUpdateIdempotencyKeyResponse: no transaction provided")
+	}
+	span, _ := tracer.StartSpanFromContext(ctx, "DBUpdateIdempotencyKeyResponse")
+	defer span.Finish()
+
+	updateQuery := h.AdaptQuery("UPDATE idempotency_keys SET response=? WHERE userEmail=? AND idempotencyKey=?;")
+	span.SetTag("query", updateQuery)
+	_, err := tx.Exec(updateQuery, response, userEmail, key)
+	if err != nil {
+		return fmt.Errorf("could not update idempotency key in DB. Error: %w\n", err)
+	}
+	return nil
+}
+
+// DBDeleteIdempotencyKey removes a reserved key, so that the batch can be retried with the same key.
+func (h *DBHandler) DBDeleteIdempotencyKey(ctx context.Context, tx *sql.Tx, userEmail, key string) error {
+	if h == nil {
+		return nil
+	}
+	if tx == nil {
+		return fmt.Errorf("DBDeleteIdempotencyKey: no transaction provided")
+	}
+	span, _ := tracer.StartSpanFromContext(ctx, "DBDeleteIdempotencyKey")
+	defer span.Finish()
+
+	deleteQuery := h.AdaptQuery("DELETE FROM idempotency_keys WHERE userEmail=? AND idempotencyKey=?;")
+	span.SetTag("query", deleteQuery)
+	_, err := tx.Exec(deleteQuery, userEmail, key)
+	if err != nil {
+		return fmt.Errorf("could not delete idempotency key from DB. Error: %w\n", err)
+	}
+	return nil
+}
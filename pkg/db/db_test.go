@@ -165,6 +165,7 @@ func TestDeploymentStorage(t *testing.T) {
 				Application:                 "test-app",
 				SourceTrainUpstream:         nil,
 				SourceTrainEnvironmentGroup: nil,
+				RolledBackVersion:           nil,
 			},
 			metadata: event.Metadata{
 				AuthorEmail: "test@email.com",
@@ -412,6 +413,138 @@ func TestReadWriteDeployment(t *testing.T) {
 	}
 }
 
+func TestDeploymentHistory(t *testing.T) {
+	ctx := testutil.MakeTestContext()
+	dbHandler := setupDB(t)
+	err := dbHandler.WithTransaction(ctx, func(ctx context.Context, transaction *sql.Tx) error {
+		deployments := []Deployment{
+			{App: "app-a", Env: "dev", Version: version(1)},
+			{App: "app-b", Env: "dev", Version: version(5)},
+			{App: "app-a", Env: "dev", Version: version(2)},
+			{App: "app-a", Env: "prod", Version: version(1)},
+			{App: "app-a", Env: "dev", Version: version(1), Metadata: DeploymentMetadata{RolledBackVersion: version(2)}},
+		}
+		eslVersions := map[string]EslId{}
+		for _, deployment := range deployments {
+			key := deployment.App + "/" + deployment.Env
+			if err := dbHandler.DBWriteDeployment(ctx, transaction, deployment, eslVersions[key]); err != nil {
+				return err
+			}
+			eslVersions[key]++
+		}
+
+		actual, err := dbHandler.DBSelectDeploymentHistory(ctx, transaction, "app-a", "dev")
+		if err != nil {
+			return err
+		}
+		expected := []Deployment{
+			{App: "app-a", Env: "dev", EslVersion: 3, Version: version(1), Metadata: DeploymentMetadata{RolledBackVersion: version(2)}},
+			{App: "app-a", Env: "dev", EslVersion: 2, Version: version(2)},
+			{App: "app-a", Env: "dev", EslVersion: 1, Version: version(1)},
+		}
+		if diff := cmp.Diff(expected, actual, cmpopts.IgnoreFields(Deployment{}, "Created")); diff != "" {
+			t.Fatalf("deployment history mismatch (-want, +got):\n%s", diff)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction error: %v", err)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := testutil.MakeTestContext()
+	dbHandler := setupDB(t)
+	created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	key := IdempotencyKey{
+		UserEmail:   "user@example.com",
+		Key:         "key-1",
+		Created:     created,
+		RequestHash: "hash-1",
+		Response:    "",
+	}
+	err := dbHandler.WithTransaction(ctx, func(ctx context.Context, transaction *sql.Tx) error {
+		reserved, err := dbHandler.DBReserveIdempotencyKey(ctx, transaction, key, created.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			t.Errorf("expected the key to be reserved")
+		}
+		// the key can only be reserved once
+		reserved, err = dbHandler.DBReserveIdempotencyKey(ctx, transaction, key, created.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if reserved {
+			t.Errorf("expected the key to be reserved only once")
+		}
+		// the same key of another user is independent
+		otherUser := key
+		otherUser.UserEmail = "other@example.com"
+		reserved, err = dbHandler.DBReserveIdempotencyKey(ctx, transaction, otherUser, created.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			t.Errorf("expected the key of another user to be reserved")
+		}
+		if err := dbHandler.DBUpdateIdempotencyKeyResponse(ctx, transaction, "user@example.com", "key-1", "{}"); err != nil {
+			return err
+		}
+		actual, err := dbHandler.DBSelectIdempotencyKey(ctx, transaction, "user@example.com", "key-1", created.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		expected := key
+		expected.Response = "{}"
+		if diff := cmp.Diff(&expected, actual); diff != "" {
+			t.Errorf("idempotency key mismatch (-want, +got):\n%s", diff)
+		}
+		// the key is expired
+		actual, err = dbHandler.DBSelectIdempotencyKey(ctx, transaction, "user@example.com", "key-1", created.Add(time.Second))
+		if err != nil {
+			return err
+		}
+		if actual != nil {
+			t.Errorf("expected no idempotency key, got %v", actual)
+		}
+		// deleted keys can be reserved again
+		if err := dbHandler.DBDeleteIdempotencyKey(ctx, transaction, "other@example.com", "key-1"); err != nil {
+			return err
+		}
+		actual, err = dbHandler.DBSelectIdempotencyKey(ctx, transaction, "other@example.com", "key-1", time.Time{})
+		if err != nil {
+			return err
+		}
+		if actual != nil {
+			t.Errorf("expected the deleted idempotency key to be removed, got %v", actual)
+		}
+		// reserving another key removes the expired key
+		other := IdempotencyKey{
+			UserEmail:   "user@example.com",
+			Key:         "key-2",
+			Created:     created.Add(time.Hour),
+			RequestHash: "hash-2",
+			Response:    "",
+		}
+		if _, err := dbHandler.DBReserveIdempotencyKey(ctx, transaction, other, created.Add(time.Second)); err != nil {
+			return err
+		}
+		actual, err = dbHandler.DBSelectIdempotencyKey(ctx, transaction, "user@example.com", "key-1", time.Time{})
+		if err != nil {
+			return err
+		}
+		if actual != nil {
+			t.Errorf("expected the expired idempotency key to be removed, got %v", actual)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction error: %v", err)
+	}
+}
+
 // setupDB returns a new DBHandler with a tmp directory every time, so tests can are completely independent
 func setupDB(t *testing.T) *DBHandler {
 	dir, err := testutil.CreateMigrationsPath()
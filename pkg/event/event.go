@@ -24,8 +24,11 @@ import (
 	"github.com/freiheit-com/kuberpult/pkg/uuid"
 	"github.com/go-git/go-billy/v5"
 	"github.com/onokonem/sillyQueueServer/timeuuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"io/fs"
 	"slices"
+	"strconv"
+	"time"
 )
 
 type EventType string
@@ -35,6 +38,10 @@ const (
 	EventTypeLockPreventeDeployment EventType = "lock-prevented-deployment"
 	EventTypeReplaceBy              EventType = "replaced-by"
 	EventTypeNewRelease             EventType = "new-release"
+	EventTypeLockCreated            EventType = "lock-created"
+	EventTypeLockDeleted            EventType = "lock-deleted"
+	EventTypeScheduledDeployment    EventType = "scheduled-deployment"
+	EventTypeEnvConfigUpdated       EventType = "environment-config-updated"
 )
 
 type eventType struct {
@@ -71,6 +78,10 @@ type Deployment struct {
 	Environment                 string  `fs:"environment" json:"Environment"`
 	SourceTrainEnvironmentGroup *string `fs:"source_train_environment_group" json:"SourceTrainEnvironmentGroup"`
 	SourceTrainUpstream         *string `fs:"source_train_upstream" json:"SourceTrainUpstream"`
+	// Set if the deployment is a rollback, the version that was deployed before.
+	RolledBackVersion *string `fs:"rolled_back_version" json:"RolledBackVersion"`
+	// Set for automatic deployments, why the deployment happened.
+	Reason *string `fs:"reason" json:"Reason"`
 }
 
 func (_ *Deployment) eventType() string {
@@ -91,11 +102,19 @@ func (ev *Deployment) toProto(trg *api.Event) {
 		}
 		releaseTrainSource.UpstreamEnvironment = *ev.SourceTrainUpstream
 	}
+	var rolledBackVersion *uint64
+	if ev.RolledBackVersion != nil {
+		if version, err := strconv.ParseUint(*ev.RolledBackVersion, 10, 64); err == nil {
+			rolledBackVersion = &version
+		}
+	}
 	trg.EventType = &api.Event_DeploymentEvent{
 		DeploymentEvent: &api.DeploymentEvent{
 			Application:        ev.Application,
 			TargetEnvironment:  ev.Environment,
 			ReleaseTrainSource: releaseTrainSource,
+			RolledBackVersion:  rolledBackVersion,
+			Reason:             ev.Reason,
 		},
 	}
 }
@@ -153,6 +172,154 @@ func (ev *ReplacedBy) toProto(trg *api.Event) {
 	}
 }
 
+// LockCreated is an event that denotes that an environment, application, team or selector lock
+// has been created. Application, Team and Selector are empty for environment locks.
+type LockCreated struct {
+	Environment string  `fs:"environment" json:"Environment"`
+	Application string  `fs:"application" json:"Application"`
+	Team        string  `fs:"team" json:"Team"`
+	Selector    string  `fs:"selector" json:"Selector"`
+	LockId      string  `fs:"lock_id" json:"LockId"`
+	Message     string  `fs:"message" json:"Message"`
+	AuthorName  string  `fs:"author_name" json:"AuthorName"`
+	AuthorEmail string  `fs:"author_email" json:"AuthorEmail"`
+	ExpiresAt   *string `fs:"expires_at" json:"ExpiresAt"` // RFC3339
+}
+
+func (_ *LockCreated) eventType() string {
+	return string(EventTypeLockCreated)
+}
+
+func (ev *LockCreated) toProto(trg *api.Event) {
+	var expiresAt *timestamppb.Timestamp
+	if ev.ExpiresAt != nil {
+		if t, err := time.Parse(time.RFC3339, *ev.ExpiresAt); err == nil {
+			expiresAt = timestamppb.New(t)
+		}
+	}
+	trg.EventType = &api.Event_LockCreatedEvent{
+		LockCreatedEvent: &api.LockCreatedEvent{
+			Environment: ev.Environment,
+			Application: ev.Application,
+			Team:        ev.Team,
+			Selector:    ev.Selector,
+			LockId:      ev.LockId,
+			Message:     ev.Message,
+			CreatedBy: &api.Actor{
+				Name:  ev.AuthorName,
+				Email: ev.AuthorEmail,
+			},
+			ExpiresAt: expiresAt,
+		},
+	}
+}
+
+// LockDeleted is an event that denotes that an environment, application, team or selector lock
+// has been deleted, either by a user or because it expired.
+type LockDeleted struct {
+	Environment string `fs:"environment" json:"Environment"`
+	Application string `fs:"application" json:"Application"`
+	Team        string `fs:"team" json:"Team"`
+	Selector    string `fs:"selector" json:"Selector"`
+	LockId      string `fs:"lock_id" json:"LockId"`
+	AuthorName  string `fs:"author_name" json:"AuthorName"`
+	AuthorEmail string `fs:"author_email" json:"AuthorEmail"`
+}
+
+func (_ *LockDeleted) eventType() string {
+	return string(EventTypeLockDeleted)
+}
+
+func (ev *LockDeleted) toProto(trg *api.Event) {
+	trg.EventType = &api.Event_LockDeletedEvent{
+		LockDeletedEvent: &api.LockDeletedEvent{
+			Environment: ev.Environment,
+			Application: ev.Application,
+			Team:        ev.Team,
+			Selector:    ev.Selector,
+			LockId:      ev.LockId,
+			DeletedBy: &api.Actor{
+				Name:  ev.AuthorName,
+				Email: ev.AuthorEmail,
+			},
+		},
+	}
+}
+
+// Outcomes of a ScheduledDeployment event
+const (
+	ScheduledDeploymentOutcomeDeployed = "deployed"
+	ScheduledDeploymentOutcomeQueued   = "queued"
+	ScheduledDeploymentOutcomeFailed   = "failed"
+)
+
+// ScheduledDeployment is an event that denotes that a scheduled deployment of the release was due and has been executed.
+type ScheduledDeployment struct {
+	Environment string `fs:"environment" json:"Environment"`
+	Application string `fs:"application" json:"Application"`
+	ScheduleId  string `fs:"schedule_id" json:"ScheduleId"`
+	Outcome     string `fs:"outcome" json:"Outcome"`
+	Message     string `fs:"message" json:"Message"`
+	AuthorName  string `fs:"author_name" json:"AuthorName"`
+	AuthorEmail string `fs:"author_email" json:"AuthorEmail"`
+}
+
+func (_ *ScheduledDeployment) eventType() string {
+	return string(EventTypeScheduledDeployment)
+}
+
+func (ev *ScheduledDeployment) toProto(trg *api.Event) {
+	var outcome api.ScheduledDeploymentEvent_Outcome
+	switch ev.Outcome {
+	case ScheduledDeploymentOutcomeQueued:
+		outcome = api.ScheduledDeploymentEvent_QUEUED
+	case ScheduledDeploymentOutcomeFailed:
+		outcome = api.ScheduledDeploymentEvent_FAILED
+	default:
+		outcome = api.ScheduledDeploymentEvent_DEPLOYED
+	}
+	trg.EventType = &api.Event_ScheduledDeploymentEvent{
+		ScheduledDeploymentEvent: &api.ScheduledDeploymentEvent{
+			Environment: ev.Environment,
+			Application: ev.Application,
+			ScheduleId:  ev.ScheduleId,
+			Outcome:     outcome,
+			Message:     ev.Message,
+			ScheduledBy: &api.Actor{
+				Name:  ev.AuthorName,
+				Email: ev.AuthorEmail,
+			},
+		},
+	}
+}
+
+// EnvironmentConfigUpdated is an event that denotes that the config of an environment has been changed.
+type EnvironmentConfigUpdated struct {
+	Environment string `fs:"environment" json:"Environment"`
+	Before      string `fs:"before" json:"Before"` // json
+	After       string `fs:"after" json:"After"`   // json
+	AuthorName  string `fs:"author_name" json:"AuthorName"`
+	AuthorEmail string `fs:"author_email" json:"AuthorEmail"`
+}
+
+func (_ *EnvironmentConfigUpdated) eventType() string {
+	return string(EventTypeEnvConfigUpdated)
+}
+
+func (ev *EnvironmentConfigUpdated) toProto(trg *api.Event) {
+	trg.EventType = &api.Event_EnvironmentConfigUpdatedEvent{
+		EnvironmentConfigUpdatedEvent: &api.EnvironmentConfigUpdatedEvent{
+			Environment: ev.Environment,
+			Before:      ev.Before,
+			After:       ev.After,
+			UpdatedBy: &api.Actor{
+				Name:  ev.AuthorName,
+				Email: ev.AuthorEmail,
+			},
+		},
+	}
+}
+
 // Event is a commit-releated event
 type Event interface {
 	eventType() string
@@ -179,6 +346,18 @@ func Read(fs billy.Filesystem, eventDir string) (Event, error) {
 	case "replaced-by":
 		//exhaustruct:ignore
 		result = &ReplacedBy{}
+	case "lock-created":
+		//exhaustruct:ignore
+		result = &LockCreated{}
+	case "lock-deleted":
+		//exhaustruct:ignore
+		result = &LockDeleted{}
+	case "scheduled-deployment":
+		//exhaustruct:ignore
+		result = &ScheduledDeployment{}
+	case "environment-config-updated":
+		//exhaustruct:ignore
+		result = &EnvironmentConfigUpdated{}
 	default:
 		return nil, fmt.Errorf("unknown event type: %q", tp.EventType)
 	}
@@ -205,6 +384,18 @@ func UnMarshallEvent(eventType EventType, eventJson string) (DBEventGo, error) {
 	case "replaced-by":
 		//exhaustruct:ignore
 		generalEvent.EventData = &ReplacedBy{}
+	case "lock-created":
+		//exhaustruct:ignore
+		generalEvent.EventData = &LockCreated{}
+	case "lock-deleted":
+		//exhaustruct:ignore
+		generalEvent.EventData = &LockDeleted{}
+	case "scheduled-deployment":
+		//exhaustruct:ignore
+		generalEvent.EventData = &ScheduledDeployment{}
+	case "environment-config-updated":
+		//exhaustruct:ignore
+		generalEvent.EventData = &EnvironmentConfigUpdated{}
 	default:
 		return DBEventGo{}, fmt.Errorf("unknown event type: %q", eventType)
 	}
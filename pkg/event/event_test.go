@@ -61,6 +61,22 @@ func Test_roundtrip(t *testing.T) {
 				SourceTrainUpstream:         ptr("B"),
 			},
 		},
+		{
+			Name: "deployment-rollback",
+			Event: &Deployment{
+				Application:       "app1",
+				Environment:       "env1",
+				RolledBackVersion: ptr("7"),
+			},
+		},
+		{
+			Name: "deployment-reason",
+			Event: &Deployment{
+				Application: "app1",
+				Environment: "env1",
+				Reason:      ptr("promoted from staging"),
+			},
+		},
 		{
 			Name: "lock-prevented-deployment",
 			Event: &LockPreventedDeployment{
@@ -70,6 +86,50 @@ func Test_roundtrip(t *testing.T) {
 				LockType:    "application",
 			},
 		},
+		{
+			Name: "lock-created",
+			Event: &LockCreated{
+				Environment: "env",
+				Application: "app",
+				LockId:      "l1",
+				Message:     "msg",
+				AuthorName:  "test",
+				AuthorEmail: "test@example.com",
+				ExpiresAt:   ptr("2024-07-01T10:00:00Z"),
+			},
+		},
+		{
+			Name: "lock-deleted",
+			Event: &LockDeleted{
+				Environment: "env",
+				Team:        "team",
+				LockId:      "l1",
+				AuthorName:  "test",
+				AuthorEmail: "test@example.com",
+			},
+		},
+		{
+			Name: "scheduled-deployment",
+			Event: &ScheduledDeployment{
+				Environment: "env",
+				Application: "app",
+				ScheduleId:  "s1",
+				Outcome:     ScheduledDeploymentOutcomeFailed,
+				Message:     "locked",
+				AuthorName:  "test",
+				AuthorEmail: "test@example.com",
+			},
+		},
+		{
+			Name: "environment-config-updated",
+			Event: &EnvironmentConfigUpdated{
+				Environment: "env",
+				Before:      `{"upstream":{"latest":true}}`,
+				After:       `{"upstream":{"environment":"dev"}}`,
+				AuthorName:  "test",
+				AuthorEmail: "test@example.com",
+			},
+		},
 	} {
 		test := test
 		t.Run(test.Name, func(t *testing.T) {
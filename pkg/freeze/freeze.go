@@ -0,0 +1,110 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package freeze
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/robfig/cron/v3"
+)
+
+// Freeze is one occurrence of a config.FreezeWindow.
+type Freeze struct {
+	// Window is the index of the freeze window in the config.
+	Window  int
+	Start   time.Time
+	End     time.Time
+	Message string
+}
+
+// IsActive returns true if the given time is within the freeze.
+func (f *Freeze) IsActive(now time.Time) bool {
+	return !now.Before(f.Start) && now.Before(f.End)
+}
+
+func parseWindow(window config.FreezeWindow) (cron.Schedule, time.Duration, error) {
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid freeze window schedule %q: %w", window.Schedule, err)
+	}
+	duration, err := time.ParseDuration(window.Duration)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid freeze window duration %q: %w", window.Duration, err)
+	}
+	if duration <= 0 {
+		return nil, 0, fmt.Errorf("invalid freeze window duration %q: must be positive", window.Duration)
+	}
+	return schedule, duration, nil
+}
+
+// ValidateWindows returns an error if any of the freeze windows cannot be parsed.
+func ValidateWindows(windows []config.FreezeWindow) error {
+	for _, window := range windows {
+		if _, _, err := parseWindow(window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFreezes returns for every freeze window the occurrence that is active at the given time,
+// or, if there is none, the next upcoming occurrence.
+// The result has the same order as the freeze windows, windows that never match are skipped.
+func GetFreezes(windows []config.FreezeWindow, now time.Time) ([]Freeze, error) {
+	result := []Freeze{}
+	for i, window := range windows {
+		schedule, duration, err := parseWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		// Schedules are evaluated in UTC, unless they start with "CRON_TZ=".
+		// The first start after (now - duration) is either within the last `duration` (then the freeze is active),
+		// or it is in the future (then it is the next upcoming freeze):
+		start := schedule.Next(now.UTC().Add(-duration))
+		if start.IsZero() {
+			// the schedule never matches, e.g. "0 0 30 2 *"
+			continue
+		}
+		result = append(result, Freeze{
+			Window:  i,
+			Start:   start,
+			End:     start.Add(duration),
+			Message: window.Message,
+		})
+	}
+	return result, nil
+}
+
+// WindowsFromApi converts the freeze windows of an api.EnvironmentConfig,
+// so that clients of the overview can find out which freezes are active.
+func WindowsFromApi(windows []*api.EnvironmentConfig_FreezeWindow) []config.FreezeWindow {
+	if len(windows) == 0 {
+		return nil
+	}
+	result := make([]config.FreezeWindow, 0, len(windows))
+	for _, window := range windows {
+		result = append(result, config.FreezeWindow{
+			Schedule: window.Schedule,
+			Duration: window.Duration,
+			Message:  window.Message,
+		})
+	}
+	return result
+}
@@ -0,0 +1,155 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fridayEvening is a Friday, 17:00 UTC
+var fridayEvening = time.Date(2024, time.May, 3, 17, 0, 0, 0, time.UTC)
+
+var weekendFreeze = config.FreezeWindow{
+	Schedule: "0 16 * * 5",
+	Duration: "64h",
+	Message:  "weekend",
+}
+
+func TestGetFreezes(t *testing.T) {
+	tcs := []struct {
+		Name            string
+		FreezeWindows   []config.FreezeWindow
+		Now             time.Time
+		ExpectedFreezes []Freeze
+		ExpectedActive  []bool
+		ExpectedError   string
+	}{
+		{
+			Name:            "no freeze windows",
+			FreezeWindows:   nil,
+			Now:             fridayEvening,
+			ExpectedFreezes: []Freeze{},
+			ExpectedActive:  []bool{},
+		},
+		{
+			Name:          "active freeze",
+			FreezeWindows: []config.FreezeWindow{weekendFreeze},
+			Now:           fridayEvening,
+			ExpectedFreezes: []Freeze{
+				{
+					Start:   time.Date(2024, time.May, 3, 16, 0, 0, 0, time.UTC),
+					End:     time.Date(2024, time.May, 6, 8, 0, 0, 0, time.UTC),
+					Message: "weekend",
+				},
+			},
+			ExpectedActive: []bool{true},
+		},
+		{
+			Name:          "upcoming freeze",
+			FreezeWindows: []config.FreezeWindow{weekendFreeze},
+			Now:           time.Date(2024, time.May, 6, 8, 0, 0, 0, time.UTC),
+			ExpectedFreezes: []Freeze{
+				{
+					Start:   time.Date(2024, time.May, 10, 16, 0, 0, 0, time.UTC),
+					End:     time.Date(2024, time.May, 13, 8, 0, 0, 0, time.UTC),
+					Message: "weekend",
+				},
+			},
+			ExpectedActive: []bool{false},
+		},
+		{
+			Name: "yearly freeze over new year",
+			FreezeWindows: []config.FreezeWindow{
+				{Schedule: "0 0 20 12 *", Duration: "336h", Message: ""},
+			},
+			Now: time.Date(2025, time.January, 2, 12, 0, 0, 0, time.UTC),
+			ExpectedFreezes: []Freeze{
+				{
+					Start:   time.Date(2024, time.December, 20, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2025, time.January, 3, 0, 0, 0, 0, time.UTC),
+					Message: "",
+				},
+			},
+			ExpectedActive: []bool{true},
+		},
+		{
+			Name: "window that never matches",
+			FreezeWindows: []config.FreezeWindow{
+				{Schedule: "0 0 30 2 *", Duration: "1h", Message: "never"},
+				weekendFreeze,
+			},
+			Now: fridayEvening,
+			ExpectedFreezes: []Freeze{
+				{
+					Window:  1,
+					Start:   time.Date(2024, time.May, 3, 16, 0, 0, 0, time.UTC),
+					End:     time.Date(2024, time.May, 6, 8, 0, 0, 0, time.UTC),
+					Message: "weekend",
+				},
+			},
+			ExpectedActive: []bool{true},
+		},
+		{
+			Name: "invalid schedule",
+			FreezeWindows: []config.FreezeWindow{
+				{Schedule: "every friday", Duration: "1h", Message: ""},
+			},
+			Now:           fridayEvening,
+			ExpectedError: "invalid freeze window schedule \"every friday\": expected exactly 5 fields, found 2: [every friday]",
+		},
+		{
+			Name: "invalid duration",
+			FreezeWindows: []config.FreezeWindow{
+				{Schedule: "0 16 * * 5", Duration: "-1h", Message: ""},
+			},
+			Now:           fridayEvening,
+			ExpectedError: "invalid freeze window duration \"-1h\": must be positive",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			freezes, err := GetFreezes(tc.FreezeWindows, tc.Now)
+			if tc.ExpectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got none", tc.ExpectedError)
+				}
+				if diff := cmp.Diff(tc.ExpectedError, err.Error()); diff != "" {
+					t.Fatalf("error mismatch (-want, +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedFreezes, freezes); diff != "" {
+				t.Errorf("freezes mismatch (-want, +got):\n%s", diff)
+			}
+			active := []bool{}
+			for i := range freezes {
+				active = append(active, freezes[i].IsActive(tc.Now))
+			}
+			if diff := cmp.Diff(tc.ExpectedActive, active); diff != "" {
+				t.Errorf("active mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+// Package manifestpolicy contains checks that are applied to manifests before they are stored in a release.
+package manifestpolicy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// Mode decides what happens with manifests that contain plaintext secrets.
+type Mode string
+
+const (
+	// ModeOff disables the check.
+	ModeOff Mode = "off"
+	// ModeReject rejects releases that contain plaintext secrets.
+	ModeReject Mode = "reject"
+	// ModeRedact removes the plaintext secret data from the manifests.
+	ModeRedact Mode = "redact"
+)
+
+// DefaultAllowedKinds are the kinds that are allowed to carry secret data,
+// because their data is either encrypted or only a reference to an external store.
+var DefaultAllowedKinds = []string{"SealedSecret", "ExternalSecret"}
+
+const (
+	// The core kubernetes Secret always contains plaintext data, so it can never be allowed.
+	secretApiVersion = "v1"
+	secretKind       = "Secret"
+)
+
+// secretDataFields are the fields of a kubernetes Secret that contain the secret values.
+var secretDataFields = []string{"data", "stringData"}
+
+// SecretPolicy detects kubernetes Secrets that contain plaintext data.
+// The zero value is a disabled policy.
+type SecretPolicy struct {
+	Mode Mode
+	// AllowedKinds may carry secret data. All other kinds named "Secret" or "...Secret" are checked.
+	AllowedKinds []string
+}
+
+// Violation describes a document in a manifest that contains plaintext secret data.
+type Violation struct {
+	Document int
+	Kind     string
+	Name     string
+	Field    string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("document %d (%s %q) contains plaintext secret data in %q", v.Document, v.Kind, v.Name, v.Field)
+}
+
+// ParseSecretPolicy parses the mode and a comma separated list of allowed kinds.
+// The allowed kinds are added to DefaultAllowedKinds.
+func ParseSecretPolicy(mode string, allowedKinds string) (SecretPolicy, error) {
+	policy := SecretPolicy{
+		Mode:         ModeOff,
+		AllowedKinds: slices.Clone(DefaultAllowedKinds),
+	}
+	switch Mode(mode) {
+	case "", ModeOff:
+	case ModeReject, ModeRedact:
+		policy.Mode = Mode(mode)
+	default:
+		return policy, fmt.Errorf("invalid secret policy mode %q, must be one of %q, %q or %q", mode, ModeOff, ModeReject, ModeRedact)
+	}
+	for _, kind := range strings.Split(allowedKinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" && !slices.Contains(policy.AllowedKinds, kind) {
+			if kind == secretKind {
+				return policy, fmt.Errorf("invalid allowed secret kind %q, kubernetes Secrets cannot be allowed", kind)
+			}
+			policy.AllowedKinds = append(policy.AllowedKinds, kind)
+		}
+	}
+	return policy, nil
+}
+
+// isSecretKind returns whether documents of this kind are checked for secret data.
+// These are kubernetes Secrets and the kinds named like a Secret of other api groups, unless they are allowed.
+func (p SecretPolicy) isSecretKind(apiVersion, kind string) bool {
+	if apiVersion == secretApiVersion && kind == secretKind {
+		return true
+	}
+	return strings.HasSuffix(kind, secretKind) && !slices.Contains(p.AllowedKinds, kind)
+}
+
+// Enabled returns whether manifests need to be checked at all.
+func (p SecretPolicy) Enabled() bool {
+	return p.Mode == ModeReject || p.Mode == ModeRedact
+}
+
+// Check returns all documents in the manifest that contain plaintext secret data.
+func (p SecretPolicy) Check(manifest string) ([]Violation, error) {
+	documents, err := parseDocuments(manifest)
+	if err != nil {
+		return nil, err
+	}
+	result := []Violation{}
+	for index, document := range documents {
+		result = append(result, p.checkDocument(index, document)...)
+	}
+	return result, nil
+}
+
+// Redact removes the plaintext secret data from all documents in the manifest.
+// The manifest is returned unchanged if it does not contain any plaintext secrets.
+func (p SecretPolicy) Redact(manifest string) (string, []Violation, error) {
+	documents, err := parseDocuments(manifest)
+	if err != nil {
+		return manifest, nil, err
+	}
+	result := []Violation{}
+	for index, document := range documents {
+		violations := p.checkDocument(index, document)
+		for _, violation := range violations {
+			removeKey(document.Content[0], violation.Field)
+		}
+		result = append(result, violations...)
+	}
+	if len(result) == 0 {
+		return manifest, result, nil
+	}
+	var buf bytes.Buffer
+	encoder := yaml3.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return manifest, nil, fmt.Errorf("could not encode redacted manifest: %w", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return manifest, nil, fmt.Errorf("could not encode redacted manifest: %w", err)
+	}
+	return buf.String(), result, nil
+}
+
+func (p SecretPolicy) checkDocument(index int, document *yaml3.Node) []Violation {
+	if len(document.Content) != 1 || document.Content[0].Kind != yaml3.MappingNode {
+		return nil
+	}
+	object := document.Content[0]
+	kind := scalarValue(lookupKey(object, "kind"))
+	if !p.isSecretKind(scalarValue(lookupKey(object, "apiVersion")), kind) {
+		return nil
+	}
+	name := scalarValue(lookupKey(lookupKey(object, "metadata"), "name"))
+	result := []Violation{}
+	for _, field := range secretDataFields {
+		value := lookupKey(object, field)
+		if value == nil || len(value.Content) == 0 {
+			continue
+		}
+		result = append(result, Violation{
+			Document: index,
+			Kind:     kind,
+			Name:     name,
+			Field:    field,
+		})
+	}
+	return result
+}
+
+func parseDocuments(manifest string) ([]*yaml3.Node, error) {
+	documents := []*yaml3.Node{}
+	decoder := yaml3.NewDecoder(strings.NewReader(manifest))
+	for {
+		//exhaustruct:ignore
+		document := &yaml3.Node{}
+		if err := decoder.Decode(document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return documents, nil
+			}
+			return nil, fmt.Errorf("invalid yaml: %w", err)
+		}
+		documents = append(documents, document)
+	}
+}
+
+func lookupKey(mapping *yaml3.Node, key string) *yaml3.Node {
+	if mapping == nil || mapping.Kind != yaml3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func removeKey(mapping *yaml3.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func scalarValue(node *yaml3.Node) string {
+	if node == nil || node.Kind != yaml3.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
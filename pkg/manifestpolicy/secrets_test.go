@@ -0,0 +1,278 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package manifestpolicy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const plaintextSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: db-password
+data:
+  password: aHVudGVyMg==
+`
+
+const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`
+
+const sealedSecret = `apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: db-password
+spec:
+  encryptedData:
+    password: AgBy3i4OJSWK
+`
+
+func TestParseSecretPolicy(t *testing.T) {
+	tcs := []struct {
+		Name           string
+		Mode           string
+		AllowedKinds   string
+		ExpectedPolicy SecretPolicy
+		ExpectedError  string
+	}{
+		{
+			Name:           "empty mode is off",
+			ExpectedPolicy: SecretPolicy{Mode: ModeOff, AllowedKinds: DefaultAllowedKinds},
+		},
+		{
+			Name:           "custom kinds are added to the default kinds",
+			Mode:           "reject",
+			AllowedKinds:   "SealedSecret, VaultSecret,",
+			ExpectedPolicy: SecretPolicy{Mode: ModeReject, AllowedKinds: []string{"SealedSecret", "ExternalSecret", "VaultSecret"}},
+		},
+		{
+			Name:          "kubernetes secrets cannot be allowed",
+			Mode:          "reject",
+			AllowedKinds:  "VaultSecret,Secret",
+			ExpectedError: `invalid allowed secret kind "Secret", kubernetes Secrets cannot be allowed`,
+		},
+		{
+			Name:          "invalid mode",
+			Mode:          "warn",
+			ExpectedError: `invalid secret policy mode "warn", must be one of "off", "reject" or "redact"`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			policy, err := ParseSecretPolicy(tc.Mode, tc.AllowedKinds)
+			if tc.ExpectedError != "" {
+				if err == nil || err.Error() != tc.ExpectedError {
+					t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.ExpectedPolicy, policy); diff != "" {
+				t.Errorf("policy mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSecretPolicyCheck(t *testing.T) {
+	tcs := []struct {
+		Name               string
+		Manifest           string
+		ExpectedViolations []Violation
+		ExpectedError      string
+	}{
+		{
+			Name:               "no secrets",
+			Manifest:           configMap,
+			ExpectedViolations: []Violation{},
+		},
+		{
+			Name:     "plaintext secret after another document",
+			Manifest: configMap + "---\n" + plaintextSecret,
+			ExpectedViolations: []Violation{
+				{Document: 1, Kind: "Secret", Name: "db-password", Field: "data"},
+			},
+		},
+		{
+			Name: "secret with data and stringData",
+			Manifest: plaintextSecret + `stringData:
+  user: admin
+`,
+			ExpectedViolations: []Violation{
+				{Document: 0, Kind: "Secret", Name: "db-password", Field: "data"},
+				{Document: 0, Kind: "Secret", Name: "db-password", Field: "stringData"},
+			},
+		},
+		{
+			Name: "secret without data",
+			Manifest: `apiVersion: v1
+kind: Secret
+metadata:
+  name: empty
+data: {}
+`,
+			ExpectedViolations: []Violation{},
+		},
+		{
+			Name:               "sealed secrets are allowed",
+			Manifest:           sealedSecret,
+			ExpectedViolations: []Violation{},
+		},
+		{
+			Name: "secrets of other api groups are checked",
+			Manifest: `apiVersion: example.com/v1
+kind: Secret
+metadata:
+  name: custom
+data:
+  reference: vault://db-password
+`,
+			ExpectedViolations: []Violation{
+				{Document: 0, Kind: "Secret", Name: "custom", Field: "data"},
+			},
+		},
+		{
+			Name: "other kinds ending with Secret are checked",
+			Manifest: `apiVersion: v1
+kind: VaultSecret
+metadata:
+  name: custom
+data:
+  reference: vault://db-password
+`,
+			ExpectedViolations: []Violation{
+				{Document: 0, Kind: "VaultSecret", Name: "custom", Field: "data"},
+			},
+		},
+		{
+			Name: "allowed kinds are not checked",
+			Manifest: `apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: custom
+data:
+  - secretKey: password
+`,
+			ExpectedViolations: []Violation{},
+		},
+		{
+			Name: "kinds that are not named like a secret are not checked",
+			Manifest: `apiVersion: v1
+kind: SecretStore
+metadata:
+  name: custom
+data:
+  reference: vault://db-password
+`,
+			ExpectedViolations: []Violation{},
+		},
+		{
+			Name:          "invalid yaml",
+			Manifest:      "kind: [",
+			ExpectedError: "invalid yaml: yaml: line 1: did not find expected node content",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			policy := SecretPolicy{Mode: ModeReject, AllowedKinds: DefaultAllowedKinds}
+			violations, err := policy.Check(tc.Manifest)
+			if tc.ExpectedError != "" {
+				if err == nil || err.Error() != tc.ExpectedError {
+					t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.ExpectedViolations, violations); diff != "" {
+				t.Errorf("violations mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSecretPolicyCheckConfiguredKinds(t *testing.T) {
+	policy, err := ParseSecretPolicy("reject", "VaultSecret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	violations, err := policy.Check(`apiVersion: v1
+kind: VaultSecret
+metadata:
+  name: custom
+data:
+  reference: vault://db-password
+---
+` + plaintextSecret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Violation{
+		{Document: 1, Kind: "Secret", Name: "db-password", Field: "data"},
+	}
+	if diff := cmp.Diff(expected, violations); diff != "" {
+		t.Errorf("violations mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestSecretPolicyRedact(t *testing.T) {
+	tcs := []struct {
+		Name             string
+		Manifest         string
+		ExpectedManifest string
+	}{
+		{
+			Name:             "manifest without secrets is unchanged",
+			Manifest:         "# keep me\n" + configMap,
+			ExpectedManifest: "# keep me\n" + configMap,
+		},
+		{
+			Name:     "secret data is removed",
+			Manifest: configMap + "---\n" + plaintextSecret,
+			ExpectedManifest: configMap + `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db-password
+`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			policy := SecretPolicy{Mode: ModeRedact, AllowedKinds: DefaultAllowedKinds}
+			manifest, _, err := policy.Redact(tc.Manifest)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.ExpectedManifest, manifest); diff != "" {
+				t.Errorf("manifest mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -52,6 +52,9 @@ func MapEnvironmentsToGroups(envs map[string]config.EnvironmentConfig) []*api.En
 				Argocd:           nil,
 				Upstream:         TransformUpstream(env.Upstream),
 				EnvironmentGroup: &groupNameCopy,
+				FreezeWindows:    TransformFreezeWindows(env.FreezeWindows),
+				AutoRollback:     TransformAutoRollback(env.AutoRollback),
+				Promotion:        TransformPromotion(env.Promotion),
 			},
 			Locks:        map[string]*api.Lock{},
 			Applications: map[string]*api.Environment_Application{},
@@ -320,6 +323,36 @@ func TransformUpstream(upstream *config.EnvironmentConfigUpstream) *api.Environm
 	return nil
 }
 
+func TransformFreezeWindows(freezeWindows []config.FreezeWindow) []*api.EnvironmentConfig_FreezeWindow {
+	var result []*api.EnvironmentConfig_FreezeWindow
+	for _, freezeWindow := range freezeWindows {
+		result = append(result, &api.EnvironmentConfig_FreezeWindow{
+			Schedule: freezeWindow.Schedule,
+			Duration: freezeWindow.Duration,
+			Message:  freezeWindow.Message,
+		})
+	}
+	return result
+}
+
+func TransformAutoRollback(autoRollback *config.EnvironmentConfigAutoRollback) *api.EnvironmentConfig_AutoRollback {
+	if autoRollback == nil {
+		return nil
+	}
+	return &api.EnvironmentConfig_AutoRollback{
+		UnhealthyDuration: autoRollback.UnhealthyDuration,
+	}
+}
+
+func TransformPromotion(promotion *config.EnvironmentConfigPromotion) *api.EnvironmentConfig_Promotion {
+	if promotion == nil {
+		return nil
+	}
+	return &api.EnvironmentConfig_Promotion{
+		SoakTime: promotion.SoakTime,
+	}
+}
+
 func TransformSyncWindows(syncWindows []config.ArgoCdSyncWindow, appName string) ([]*api.Environment_Application_ArgoCD_SyncWindow, error) {
 	var envAppSyncWindows []*api.Environment_Application_ArgoCD_SyncWindow
 	for _, syncWindow := range syncWindows {
@@ -0,0 +1,204 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+)
+
+// ValidateEnvironmentConfigs checks the upstream graph of all environments.
+// It reports upstreams that do not exist, upstreams that lead back to the same environment
+// and groups whose environments have their upstreams in different groups.
+// The result is sorted, an empty result means that the configs are valid.
+func ValidateEnvironmentConfigs(envs map[string]config.EnvironmentConfig) []*api.EnvironmentConfigProblem {
+	envNames := make([]string, 0, len(envs))
+	for envName := range envs {
+		envNames = append(envNames, envName)
+	}
+	sort.Strings(envNames)
+
+	problems := []*api.EnvironmentConfigProblem{}
+	problems = append(problems, findDanglingUpstreams(envs, envNames)...)
+	problems = append(problems, findUpstreamCycles(envs, envNames)...)
+	problems = append(problems, findConflictingGroupUpstreams(envs, envNames)...)
+	return problems
+}
+
+// ProblemsOfEnvironment returns the problems that involve the given environment.
+func ProblemsOfEnvironment(problems []*api.EnvironmentConfigProblem, envName string) []*api.EnvironmentConfigProblem {
+	result := []*api.EnvironmentConfigProblem{}
+	for _, problem := range problems {
+		for _, env := range problem.Environments {
+			if env == envName {
+				result = append(result, problem)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// ProblemsError combines the messages of the problems into one error.
+// Returns nil if there are no problems.
+func ProblemsError(problems []*api.EnvironmentConfigProblem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, problem.Message)
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// upstreamEnvironment returns the name of the upstream environment, or "" if the environment
+// has no upstream environment. With "latest", the upstream environment is ignored.
+func upstreamEnvironment(env config.EnvironmentConfig) string {
+	if env.Upstream == nil || env.Upstream.Latest {
+		return ""
+	}
+	return env.Upstream.Environment
+}
+
+func findDanglingUpstreams(envs map[string]config.EnvironmentConfig, envNames []string) []*api.EnvironmentConfigProblem {
+	problems := []*api.EnvironmentConfigProblem{}
+	for _, envName := range envNames {
+		upstream := upstreamEnvironment(envs[envName])
+		if upstream == "" {
+			continue
+		}
+		if _, ok := envs[upstream]; !ok {
+			problems = append(problems, &api.EnvironmentConfigProblem{
+				Kind:         api.EnvironmentConfigProblem_KIND_DANGLING_UPSTREAM,
+				Environments: []string{envName},
+				Message:      fmt.Sprintf("environment %q has upstream %q, which does not exist", envName, upstream),
+			})
+		}
+	}
+	return problems
+}
+
+func findUpstreamCycles(envs map[string]config.EnvironmentConfig, envNames []string) []*api.EnvironmentConfigProblem {
+	problems := []*api.EnvironmentConfigProblem{}
+	// every environment has at most one upstream, so following the upstreams from each environment
+	// and remembering where we have been finds every cycle exactly once
+	done := map[string]bool{}
+	for _, start := range envNames {
+		path := []string{}
+		positionInPath := map[string]int{}
+		current := start
+		for {
+			if done[current] {
+				break
+			}
+			if position, ok := positionInPath[current]; ok {
+				problems = append(problems, upstreamCycleProblem(path[position:]))
+				break
+			}
+			if _, ok := envs[current]; !ok {
+				break
+			}
+			positionInPath[current] = len(path)
+			path = append(path, current)
+			current = upstreamEnvironment(envs[current])
+			if current == "" {
+				break
+			}
+		}
+		for _, envName := range path {
+			done[envName] = true
+		}
+	}
+	return problems
+}
+
+func upstreamCycleProblem(cycle []string) *api.EnvironmentConfigProblem {
+	// start the cycle at the first environment by name, so the message does not depend on where we started
+	first := 0
+	for i, envName := range cycle {
+		if envName < cycle[first] {
+			first = i
+		}
+	}
+	ordered := append(append([]string{}, cycle[first:]...), cycle[:first]...)
+	// the environments point to their upstream, so the arrows point upstream
+	message := fmt.Sprintf("upstream cycle: %s -> %s", strings.Join(ordered, " -> "), ordered[0])
+	sorted := append([]string{}, cycle...)
+	sort.Strings(sorted)
+	return &api.EnvironmentConfigProblem{
+		Kind:         api.EnvironmentConfigProblem_KIND_UPSTREAM_CYCLE,
+		Environments: sorted,
+		Message:      message,
+	}
+}
+
+func findConflictingGroupUpstreams(envs map[string]config.EnvironmentConfig, envNames []string) []*api.EnvironmentConfigProblem {
+	groups := map[string][]string{}
+	groupNames := []string{}
+	for _, envName := range envNames {
+		groupName := DeriveGroupName(envs[envName], envName)
+		if _, ok := groups[groupName]; !ok {
+			groupNames = append(groupNames, groupName)
+		}
+		groups[groupName] = append(groups[groupName], envName)
+	}
+	sort.Strings(groupNames)
+
+	problems := []*api.EnvironmentConfigProblem{}
+	for _, groupName := range groupNames {
+		groupEnvs := groups[groupName]
+		upstreams := map[string]bool{}
+		descriptions := make([]string, 0, len(groupEnvs))
+		for _, envName := range groupEnvs {
+			upstream := describeGroupUpstream(envs, envs[envName])
+			upstreams[upstream] = true
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", envName, upstream))
+		}
+		if len(upstreams) < 2 {
+			continue
+		}
+		problems = append(problems, &api.EnvironmentConfigProblem{
+			Kind:         api.EnvironmentConfigProblem_KIND_CONFLICTING_GROUP_UPSTREAMS,
+			Environments: groupEnvs,
+			Message:      fmt.Sprintf("environments of group %q have conflicting upstreams: %s", groupName, strings.Join(descriptions, ", ")),
+		})
+	}
+	return problems
+}
+
+// describeGroupUpstream describes where an environment gets its versions from on the level of groups,
+// because the environments of one group may have different upstream environments of the same upstream group.
+func describeGroupUpstream(envs map[string]config.EnvironmentConfig, env config.EnvironmentConfig) string {
+	if env.Upstream != nil && env.Upstream.Latest {
+		return "latest"
+	}
+	upstream := upstreamEnvironment(env)
+	if upstream == "" {
+		return "no upstream"
+	}
+	upstreamConfig, ok := envs[upstream]
+	if !ok {
+		return fmt.Sprintf("upstream group %q", upstream)
+	}
+	return fmt.Sprintf("upstream group %q", DeriveGroupName(upstreamConfig, upstream))
+}
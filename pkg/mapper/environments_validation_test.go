@@ -0,0 +1,156 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package mapper
+
+import (
+	"testing"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func makeConfigLatest(group *string) config.EnvironmentConfig {
+	return config.EnvironmentConfig{
+		Upstream:         &config.EnvironmentConfigUpstream{Latest: true},
+		EnvironmentGroup: group,
+	}
+}
+
+func makeConfigUpstream(upstream string, group *string) config.EnvironmentConfig {
+	return config.EnvironmentConfig{
+		Upstream:         &config.EnvironmentConfigUpstream{Environment: upstream},
+		EnvironmentGroup: group,
+	}
+}
+
+func TestValidateEnvironmentConfigs(t *testing.T) {
+	tcs := []struct {
+		Name             string
+		InputEnvs        map[string]config.EnvironmentConfig
+		ExpectedProblems []*api.EnvironmentConfigProblem
+	}{
+		{
+			Name: "valid chain of groups",
+			InputEnvs: map[string]config.EnvironmentConfig{
+				nameDevDe:     makeConfigLatest(&nameDev),
+				nameDevFr:     makeConfigLatest(&nameDev),
+				nameStagingDe: makeConfigUpstream(nameDevDe, &nameStaging),
+				nameStagingFr: makeConfigUpstream(nameDevFr, &nameStaging),
+				nameProdDe:    makeConfigUpstream(nameStagingDe, &nameProd),
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{},
+		},
+		{
+			Name: "latest wins over the upstream environment",
+			InputEnvs: map[string]config.EnvironmentConfig{
+				nameDev: {
+					Upstream: &config.EnvironmentConfigUpstream{Latest: true, Environment: nameDev},
+				},
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{},
+		},
+		{
+			Name: "dangling upstream",
+			InputEnvs: map[string]config.EnvironmentConfig{
+				nameDev:  makeConfigLatest(nil),
+				nameProd: makeConfigUpstream(nameStaging, nil),
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_DANGLING_UPSTREAM,
+					Environments: []string{nameProd},
+					Message:      `environment "prod" has upstream "staging", which does not exist`,
+				},
+			},
+		},
+		{
+			Name: "environment is its own upstream",
+			InputEnvs: map[string]config.EnvironmentConfig{
+				nameDev: makeConfigUpstream(nameDev, nil),
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_UPSTREAM_CYCLE,
+					Environments: []string{nameDev},
+					Message:      "upstream cycle: dev -> dev",
+				},
+			},
+		},
+		{
+			Name: "cycle is reported once, starting with the first environment by name",
+			InputEnvs: map[string]config.EnvironmentConfig{
+				nameTest:    makeConfigUpstream(nameStaging, nil),
+				nameStaging: makeConfigUpstream(nameProd, nil),
+				nameProd:    makeConfigUpstream(nameTest, nil),
+				nameCanary:  makeConfigUpstream(nameProd, nil),
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_UPSTREAM_CYCLE,
+					Environments: []string{nameProd, nameStaging, nameTest},
+					Message:      "upstream cycle: prod -> test -> staging -> prod",
+				},
+			},
+		},
+		{
+			Name: "environments of one group with upstreams in different groups",
+			InputEnvs: map[string]config.EnvironmentConfig{
+				nameDevDe:     makeConfigLatest(&nameDev),
+				nameTestDe:    makeConfigLatest(&nameTest),
+				nameStagingDe: makeConfigUpstream(nameDevDe, &nameStaging),
+				nameStagingFr: makeConfigUpstream(nameTestDe, &nameStaging),
+				nameStagingUS: makeConfigLatest(&nameStaging),
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_CONFLICTING_GROUP_UPSTREAMS,
+					Environments: []string{nameStagingDe, nameStagingFr, nameStagingUS},
+					Message:      `environments of group "staging" have conflicting upstreams: staging-de (upstream group "dev"), staging-fr (upstream group "test"), staging-us (latest)`,
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		opts := cmpopts.IgnoreUnexported(api.EnvironmentConfigProblem{})
+		t.Run(tc.Name, func(t *testing.T) {
+			actualProblems := ValidateEnvironmentConfigs(tc.InputEnvs)
+			if diff := cmp.Diff(tc.ExpectedProblems, actualProblems, opts); diff != "" {
+				t.Fatalf("problems mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProblemsError(t *testing.T) {
+	envs := map[string]config.EnvironmentConfig{
+		nameDev:  makeConfigUpstream(nameProd, nil),
+		nameProd: makeConfigUpstream(nameDev, nil),
+		nameTest: makeConfigUpstream(nameWhoKnows, nil),
+	}
+	problems := ValidateEnvironmentConfigs(envs)
+
+	err := ProblemsError(ProblemsOfEnvironment(problems, nameDev))
+	expected := "upstream cycle: dev -> prod -> dev"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+	if err := ProblemsError(ProblemsOfEnvironment(problems, nameStaging)); err != nil {
+		t.Fatalf("expected no error for an environment without problems, got %v", err)
+	}
+}
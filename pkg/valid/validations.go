@@ -31,6 +31,9 @@ const (
 	EnvNameRegExp                  = AppNameRegExp
 	SHA1CommitIDLength             = 40
 	commitIDPrefixRegExp           = `^[0-9a-fA-F]*$`
+	LabelKeyRegExp                 = `\A[a-zA-Z0-9](?:[a-zA-Z0-9._-]*[a-zA-Z0-9])?\z`
+	MaxLabelKeyLength              = 63
+	MaxLabelValueLength            = 256
 )
 
 var (
@@ -38,6 +41,7 @@ var (
 	teamNameRx        = regexp.MustCompile(TeamNameRegExp)
 	envNameRx         = regexp.MustCompile(EnvNameRegExp)
 	commitIDPrefixRx  = regexp.MustCompile(commitIDPrefixRegExp)
+	labelKeyRx        = regexp.MustCompile(LabelKeyRegExp)
 	MaxAppNameLen     = setupMaxAppNameLen()
 )
 
@@ -67,6 +71,11 @@ func LockId(lockId string) bool {
 	return len(lockId) < 100 && len(lockId) > 1 && lockId != ".." && lockId != "." && !strings.ContainsAny(lockId, "/")
 }
 
+// Scheduled deployments are stored like locks, so their ids must be valid file names as well
+func ScheduleId(scheduleId string) bool {
+	return LockId(scheduleId)
+}
+
 func SHA1CommitID(commitID string) bool {
 	if len(commitID) != SHA1CommitIDLength {
 		return false
@@ -77,3 +86,8 @@ func SHA1CommitID(commitID string) bool {
 func SHA1CommitIDPrefix(prefix string) bool {
 	return commitIDPrefixRx.MatchString(prefix)
 }
+
+// Label keys are used like kubernetes label names, values can be any (short) string
+func ReleaseLabel(key, value string) bool {
+	return len(key) <= MaxLabelKeyLength && labelKeyRx.MatchString(key) && len(value) <= MaxLabelValueLength
+}
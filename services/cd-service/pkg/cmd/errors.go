@@ -16,7 +16,10 @@ Copyright freiheit.com*/
 
 package cmd
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type releaseVersionsLimitError struct {
 	limit uint
@@ -40,3 +43,12 @@ func (s deploymentTypeConfigError) Error() string {
 	}
 	return "invalid configuration"
 }
+
+type intervalConfigError struct {
+	name     string
+	interval time.Duration
+}
+
+func (s intervalConfigError) Error() string {
+	return fmt.Sprintf("%s: %s, must be positive", s.name, s.interval)
+}
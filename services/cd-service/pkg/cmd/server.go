@@ -36,9 +36,11 @@ import (
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/auth"
 	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 	"github.com/freiheit-com/kuberpult/pkg/setup"
 	"github.com/freiheit-com/kuberpult/pkg/tracing"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/schema"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/service"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	"github.com/kelseyhightower/envconfig"
@@ -96,11 +98,19 @@ type Config struct {
 	DbAuthProxyPort            string        `default:"5432" split_words:"true"`
 	DbMigrationsLocation       string        `default:"" split_words:"true"`
 	DexDefaultRoleEnabled      bool          `default:"false" split_words:"true"`
+	DexLockOwnershipEnabled    bool          `default:"false" split_words:"true"`
 	DbWriteEslTableOnly        bool          `default:"false" split_words:"true"`
 	ReleaseVersionsLimit       uint          `default:"20" split_words:"true"`
 	GarbageCollectionFrequency uint          `default:"20" split_words:"true"`
 	DeploymentType             string        `default:"k8s" split_words:"true"` // either k8s or cloudrun
 	CloudRunServer             string        `default:"" split_words:"true"`
+	LockExpiryCheckInterval    time.Duration `default:"1m" split_words:"true"`
+	DeploymentScheduleInterval time.Duration `default:"1m" split_words:"true"`
+	EnvironmentExpiryInterval  time.Duration `default:"1m" split_words:"true"`
+	ManifestSchemaDir          string        `default:"" split_words:"true"`
+	SecretPolicy               string        `default:"off" split_words:"true"`
+	SecretPolicyAllowedKinds   string        `default:"" split_words:"true"`
+	BatchIdempotencyWindow     time.Duration `default:"24h" split_words:"true"`
 }
 
 func (c *Config) storageBackend() repository.StorageBackend {
@@ -222,6 +232,11 @@ func RunServer() {
 				zap.String("details", err.Error()),
 			)
 		}
+		if err := checkIntervals(c); err != nil {
+			logger.FromContext(ctx).Fatal("cd.config",
+				zap.String("details", err.Error()),
+			)
+		}
 		var cloudRunClient *cloudrun.CloudRunClient = nil
 		if c.DeploymentType == "cloudrun" {
 			cloudRunClient, err = cloudrun.InitCloudRunClient(c.CloudRunServer)
@@ -229,6 +244,17 @@ func RunServer() {
 				logger.FromContext(ctx).Fatal("Unable to initialize CloudRunService", zap.Error(err))
 			}
 		}
+		var manifestValidator *schema.Validator = nil
+		if c.ManifestSchemaDir != "" {
+			manifestValidator, err = schema.NewValidator(c.ManifestSchemaDir)
+			if err != nil {
+				logger.FromContext(ctx).Fatal("Unable to load manifest schemas", zap.Error(err))
+			}
+		}
+		secretPolicy, err := manifestpolicy.ParseSecretPolicy(c.SecretPolicy, c.SecretPolicyAllowedKinds)
+		if err != nil {
+			logger.FromContext(ctx).Fatal("cd.config", zap.Error(err))
+		}
 		var dbHandler *db.DBHandler = nil
 		if c.DbOption != "NO_DB" {
 			var dbCfg db.DBConfig
@@ -303,6 +329,7 @@ func RunServer() {
 			ArgoCdGenerateFiles:    c.ArgoCdGenerateFiles,
 			DBHandler:              dbHandler,
 			CloudRunClient:         cloudRunClient,
+			ManifestValidator:      manifestValidator,
 		}
 		repo, repoQueue, err := repository.New2(ctx, cfg)
 		if err != nil {
@@ -353,11 +380,14 @@ func RunServer() {
 					api.RegisterBatchServiceServer(srv, &service.BatchServer{
 						Repository: repo,
 						RBACConfig: auth.RBACConfig{
-							DexEnabled: c.DexEnabled,
-							Policy:     dexRbacPolicy,
+							DexEnabled:    c.DexEnabled,
+							Policy:        dexRbacPolicy,
+							LockOwnership: c.DexLockOwnershipEnabled,
 						},
 						Config: service.BatchServerConfig{
-							WriteCommitData: c.GitWriteCommitData,
+							WriteCommitData:   c.GitWriteCommitData,
+							SecretPolicy:      secretPolicy,
+							IdempotencyWindow: c.BatchIdempotencyWindow,
 						},
 					})
 
@@ -373,8 +403,17 @@ func RunServer() {
 					api.RegisterReleaseTrainPrognosisServiceServer(srv, &service.ReleaseTrainPrognosisServer{
 						Repository: repo,
 						RBACConfig: auth.RBACConfig{
-							DexEnabled: c.DexEnabled,
-							Policy:     dexRbacPolicy,
+							DexEnabled:    c.DexEnabled,
+							Policy:        dexRbacPolicy,
+							LockOwnership: c.DexLockOwnershipEnabled,
+						},
+					})
+					api.RegisterDeploymentBlockerServiceServer(srv, &service.DeploymentBlockerServer{
+						Repository: repo,
+						RBACConfig: auth.RBACConfig{
+							DexEnabled:    c.DexEnabled,
+							Policy:        dexRbacPolicy,
+							LockOwnership: c.DexLockOwnershipEnabled,
 						},
 					})
 					reflection.Register(srv)
@@ -399,6 +438,49 @@ func RunServer() {
 					Name:     "push queue",
 					Run:      repoQueue,
 				},
+				{
+					Shutdown: nil,
+					Name:     "lock expiry",
+					Run: func(ctx context.Context, reporter *setup.HealthReporter) error {
+						reporter.ReportReady("deleting expired locks")
+						repository.RegularlyDeleteExpiredLocks(ctx, repo, c.LockExpiryCheckInterval, auth.User{
+							Email:          c.GitCommitterEmail,
+							Name:           c.GitCommitterName,
+							DexAuthContext: nil,
+						})
+						return nil
+					},
+				},
+				{
+					Shutdown: nil,
+					Name:     "scheduled deployments",
+					Run: func(ctx context.Context, reporter *setup.HealthReporter) error {
+						reporter.ReportReady("executing scheduled deployments")
+						repository.RegularlyExecuteScheduledDeployments(ctx, repo, c.DeploymentScheduleInterval, auth.User{
+							Email:          c.GitCommitterEmail,
+							Name:           c.GitCommitterName,
+							DexAuthContext: nil,
+						}, auth.RBACConfig{
+							DexEnabled:    c.DexEnabled,
+							Policy:        dexRbacPolicy,
+							LockOwnership: c.DexLockOwnershipEnabled,
+						}, c.GitWriteCommitData)
+						return nil
+					},
+				},
+				{
+					Shutdown: nil,
+					Name:     "environment expiry",
+					Run: func(ctx context.Context, reporter *setup.HealthReporter) error {
+						reporter.ReportReady("deleting expired environments")
+						repository.RegularlyDeleteExpiredEnvironments(ctx, repo, c.EnvironmentExpiryInterval, auth.User{
+							Email:          c.GitCommitterEmail,
+							Name:           c.GitCommitterName,
+							DexAuthContext: nil,
+						})
+						return nil
+					},
+				},
 			},
 			Shutdown: func(ctx context.Context) error {
 				close(shutdownCh)
@@ -420,6 +502,20 @@ func checkReleaseVersionLimit(limit uint) error {
 	return nil
 }
 
+// checkIntervals rejects intervals of background jobs that cannot be used for a ticker.
+func checkIntervals(c Config) error {
+	for _, interval := range []intervalConfigError{
+		{name: "KUBERPULT_LOCK_EXPIRY_CHECK_INTERVAL", interval: c.LockExpiryCheckInterval},
+		{name: "KUBERPULT_DEPLOYMENT_SCHEDULE_INTERVAL", interval: c.DeploymentScheduleInterval},
+		{name: "KUBERPULT_ENVIRONMENT_EXPIRY_INTERVAL", interval: c.EnvironmentExpiryInterval},
+	} {
+		if interval.interval <= 0 {
+			return interval
+		}
+	}
+	return nil
+}
+
 func checkDeploymentType(c Config) error {
 	if c.DeploymentType != "k8s" && c.DeploymentType != "cloudrun" {
 		return deploymentTypeConfigError{deploymentTypeInvalid: true, cloudrunServerMissing: false}
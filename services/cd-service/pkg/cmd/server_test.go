@@ -18,6 +18,7 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -130,3 +131,48 @@ func TestCheckDeploymentType(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckIntervals(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		config        Config
+		expectedError error
+	}{
+		{
+			name: "positive intervals",
+			config: Config{
+				LockExpiryCheckInterval:    time.Minute,
+				DeploymentScheduleInterval: time.Minute,
+				EnvironmentExpiryInterval:  time.Minute,
+			},
+			expectedError: nil,
+		},
+		{
+			name: "lock expiry check interval is zero",
+			config: Config{
+				LockExpiryCheckInterval:    0,
+				DeploymentScheduleInterval: time.Minute,
+				EnvironmentExpiryInterval:  time.Minute,
+			},
+			expectedError: intervalConfigError{name: "KUBERPULT_LOCK_EXPIRY_CHECK_INTERVAL", interval: 0},
+		},
+		{
+			name: "environment expiry interval is negative",
+			config: Config{
+				LockExpiryCheckInterval:    time.Minute,
+				DeploymentScheduleInterval: time.Minute,
+				EnvironmentExpiryInterval:  -time.Minute,
+			},
+			expectedError: intervalConfigError{name: "KUBERPULT_ENVIRONMENT_EXPIRY_INTERVAL", interval: -time.Minute},
+		},
+	} {
+		tc := test
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkIntervals(tc.config)
+			if diff := cmp.Diff(tc.expectedError, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/valid"
+)
+
+const fieldDependencies = "dependencies"
+
+// ReleaseDependency declares that a release can only be deployed to an environment
+// if Application is deployed there in at least MinVersion.
+type ReleaseDependency struct {
+	Application string `json:"app"`
+	MinVersion  uint64 `json:"minVersion"`
+}
+
+func ValidateReleaseDependencies(application string, dependencies []ReleaseDependency) error {
+	seen := map[string]bool{}
+	for _, dependency := range dependencies {
+		if !valid.ApplicationName(dependency.Application) {
+			return fmt.Errorf("invalid dependency: invalid application name %q", dependency.Application)
+		}
+		if dependency.Application == application {
+			return fmt.Errorf("invalid dependency: application %q cannot depend on itself", application)
+		}
+		if seen[dependency.Application] {
+			return fmt.Errorf("invalid dependency: application %q is declared more than once", dependency.Application)
+		}
+		if dependency.MinVersion == 0 {
+			return fmt.Errorf("invalid dependency: minimum version of application %q must be at least 1", dependency.Application)
+		}
+		seen[dependency.Application] = true
+	}
+	return nil
+}
+
+// sortDependencies returns the dependencies sorted by application, so that the stored file is stable.
+func sortDependencies(dependencies []ReleaseDependency) []ReleaseDependency {
+	result := make([]ReleaseDependency, len(dependencies))
+	copy(result, dependencies)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Application < result[j].Application
+	})
+	return result
+}
+
+func formatDependencies(dependencies []ReleaseDependency) string {
+	required := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		required = append(required, fmt.Sprintf("%q >= %d", dependency.Application, dependency.MinVersion))
+	}
+	return strings.Join(required, ", ")
+}
+
+// GetApplicationReleaseDependencies returns nil if the release has no dependencies.
+func (s *State) GetApplicationReleaseDependencies(application string, version uint64) ([]ReleaseDependency, error) {
+	file := s.Filesystem.Join(releasesDirectoryWithVersion(s.Filesystem, application, version), fieldDependencies)
+	var dependencies []ReleaseDependency
+	if err := decodeJsonFile(s.Filesystem, file, &dependencies); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read dependencies of release %d of application %q: %w", version, application, err)
+	}
+	return dependencies, nil
+}
+
+// GetUnmetDependencies returns the dependencies of the release that are not deployed in the required version in the environment.
+func (s *State) GetUnmetDependencies(ctx context.Context, transaction *sql.Tx, environment, application string, version uint64) ([]ReleaseDependency, error) {
+	return s.getUnmetDependencies(ctx, transaction, environment, application, version, nil)
+}
+
+// getUnmetDependencies is like GetUnmetDependencies, but versions in plannedVersions take precedence over the deployed versions.
+func (s *State) getUnmetDependencies(ctx context.Context, transaction *sql.Tx, environment, application string, version uint64, plannedVersions map[string]uint64) ([]ReleaseDependency, error) {
+	dependencies, err := s.GetApplicationReleaseDependencies(application, version)
+	if err != nil {
+		return nil, err
+	}
+	var result []ReleaseDependency = nil
+	for _, dependency := range dependencies {
+		if planned, ok := plannedVersions[dependency.Application]; ok {
+			if planned < dependency.MinVersion {
+				result = append(result, dependency)
+			}
+			continue
+		}
+		deployed, err := s.GetEnvironmentApplicationVersion(ctx, environment, dependency.Application, transaction)
+		if err != nil {
+			return nil, err
+		}
+		if deployed == nil || *deployed < dependency.MinVersion {
+			result = append(result, dependency)
+		}
+	}
+	return result, nil
+}
+
+func ReleaseDependenciesFromProto(dependencies []*api.ReleaseDependency) []ReleaseDependency {
+	if len(dependencies) == 0 {
+		return nil
+	}
+	result := make([]ReleaseDependency, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		result = append(result, ReleaseDependency{
+			Application: dependency.Application,
+			MinVersion:  dependency.MinVersion,
+		})
+	}
+	return result
+}
+
+func ReleaseDependenciesToProto(dependencies []ReleaseDependency) []*api.ReleaseDependency {
+	if len(dependencies) == 0 {
+		return nil
+	}
+	result := make([]*api.ReleaseDependency, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		result = append(result, &api.ReleaseDependency{
+			Application: dependency.Application,
+			MinVersion:  dependency.MinVersion,
+		})
+	}
+	return result
+}
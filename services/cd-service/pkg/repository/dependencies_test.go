@@ -0,0 +1,285 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	appBilling  = "billing"
+	appMigrator = "billing-db-migrator"
+)
+
+func TestValidateReleaseDependencies(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		Dependencies  []ReleaseDependency
+		ExpectedError string
+	}{
+		{
+			Name:          "valid dependencies",
+			Dependencies:  []ReleaseDependency{{Application: appMigrator, MinVersion: 3}},
+			ExpectedError: "",
+		},
+		{
+			Name:          "invalid application name",
+			Dependencies:  []ReleaseDependency{{Application: "Billing DB", MinVersion: 3}},
+			ExpectedError: `invalid dependency: invalid application name "Billing DB"`,
+		},
+		{
+			Name:          "dependency on itself",
+			Dependencies:  []ReleaseDependency{{Application: appBilling, MinVersion: 3}},
+			ExpectedError: `invalid dependency: application "billing" cannot depend on itself`,
+		},
+		{
+			Name: "duplicate dependency",
+			Dependencies: []ReleaseDependency{
+				{Application: appMigrator, MinVersion: 3},
+				{Application: appMigrator, MinVersion: 4},
+			},
+			ExpectedError: `invalid dependency: application "billing-db-migrator" is declared more than once`,
+		},
+		{
+			Name:          "version zero",
+			Dependencies:  []ReleaseDependency{{Application: appMigrator, MinVersion: 0}},
+			ExpectedError: `invalid dependency: minimum version of application "billing-db-migrator" must be at least 1`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateReleaseDependencies(appBilling, tc.Dependencies)
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if diff := cmp.Diff(tc.ExpectedError, actual); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeployApplicationVersionDependencies(t *testing.T) {
+	tcs := []struct {
+		Name                   string
+		Transformers           []Transformer
+		ExpectedError          string
+		ExpectedBillingVersion *uint64
+	}{
+		{
+			Name: "release is not deployed automatically before its dependency",
+			Transformers: []Transformer{
+				&CreateApplicationVersion{
+					Application:  appBilling,
+					Version:      1,
+					Manifests:    map[string]string{envAcceptance: "billing"},
+					Dependencies: []ReleaseDependency{{Application: appMigrator, MinVersion: 1}},
+				},
+			},
+			ExpectedError:          "",
+			ExpectedBillingVersion: nil,
+		},
+		{
+			Name: "release is deployed automatically after its dependency",
+			Transformers: []Transformer{
+				&CreateApplicationVersion{
+					Application: appMigrator,
+					Version:     1,
+					Manifests:   map[string]string{envAcceptance: "migrator"},
+				},
+				&CreateApplicationVersion{
+					Application:  appBilling,
+					Version:      1,
+					Manifests:    map[string]string{envAcceptance: "billing"},
+					Dependencies: []ReleaseDependency{{Application: appMigrator, MinVersion: 1}},
+				},
+			},
+			ExpectedError:          "",
+			ExpectedBillingVersion: ptr.Uint64(1),
+		},
+		{
+			Name: "manual deployment fails if the dependency is too old",
+			Transformers: []Transformer{
+				&CreateApplicationVersion{
+					Application: appMigrator,
+					Version:     1,
+					Manifests:   map[string]string{envAcceptance: "migrator"},
+				},
+				&CreateApplicationVersion{
+					Application:  appBilling,
+					Version:      1,
+					Manifests:    map[string]string{envAcceptance: "billing"},
+					Dependencies: []ReleaseDependency{{Application: appMigrator, MinVersion: 2}},
+				},
+				&DeployApplicationVersion{
+					Application:   appBilling,
+					Environment:   envAcceptance,
+					Version:       1,
+					LockBehaviour: api.LockBehavior_FAIL,
+				},
+			},
+			ExpectedError:          `release 1 of application "billing" cannot be deployed to environment "acceptance": it requires "billing-db-migrator" >= 2`,
+			ExpectedBillingVersion: nil,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx, &CreateEnvironment{
+				Environment: envAcceptance,
+				Config:      testutil.MakeEnvConfigLatest(nil),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, tc.Transformers...)
+			if tc.ExpectedError != "" {
+				var unmetErr *UnmetDependenciesError
+				if !errors.As(err, &unmetErr) {
+					t.Fatalf("expected an UnmetDependenciesError, got %v", err)
+				}
+				if diff := cmp.Diff(tc.ExpectedError, unmetErr.Error()); diff != "" {
+					t.Errorf("error mismatch (-want, +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := repo.State().GetEnvironmentApplicationVersion(ctx, envAcceptance, appBilling, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedBillingVersion, actual); diff != "" {
+				t.Errorf("deployed version mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReleaseTrainDependencies(t *testing.T) {
+	tcs := []struct {
+		Name              string
+		Transformers      []Transformer
+		ExpectedPrognoses map[string]ReleaseTrainApplicationPrognosis
+	}{
+		{
+			Name:         "dependency is deployed by the same release train",
+			Transformers: []Transformer{},
+			ExpectedPrognoses: map[string]ReleaseTrainApplicationPrognosis{
+				appBilling: {
+					SkipCause:         nil,
+					FirstLockMessage:  "",
+					Version:           1,
+					UnmetDependencies: nil,
+				},
+				appMigrator: {
+					SkipCause:         nil,
+					FirstLockMessage:  "",
+					Version:           1,
+					UnmetDependencies: nil,
+				},
+			},
+		},
+		{
+			Name: "dependency is locked",
+			Transformers: []Transformer{
+				&CreateEnvironmentApplicationLock{
+					Environment: envProduction,
+					Application: appMigrator,
+					LockId:      "l1",
+					Message:     "migration is broken",
+				},
+			},
+			ExpectedPrognoses: map[string]ReleaseTrainApplicationPrognosis{
+				appBilling: {
+					SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
+						SkipCause: api.ReleaseTrainAppSkipCause_APP_HAS_UNMET_DEPENDENCIES,
+					},
+					FirstLockMessage:  "",
+					Version:           0,
+					UnmetDependencies: []ReleaseDependency{{Application: appMigrator, MinVersion: 1}},
+				},
+				appMigrator: {
+					SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
+						SkipCause: api.ReleaseTrainAppSkipCause_APP_IS_LOCKED,
+					},
+					FirstLockMessage:  "migration is broken",
+					Version:           0,
+					UnmetDependencies: nil,
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envAcceptance,
+					Config:      testutil.MakeEnvConfigLatest(nil),
+				},
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      testutil.MakeEnvConfigUpstream(envAcceptance, nil),
+				},
+				&CreateApplicationVersion{
+					Application: appMigrator,
+					Version:     1,
+					Manifests:   map[string]string{envAcceptance: "migrator", envProduction: "migrator"},
+				},
+				&CreateApplicationVersion{
+					Application:  appBilling,
+					Version:      1,
+					Manifests:    map[string]string{envAcceptance: "billing", envProduction: "billing"},
+					Dependencies: []ReleaseDependency{{Application: appMigrator, MinVersion: 1}},
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tc.Transformers) > 0 {
+				if err := repo.Apply(ctx, tc.Transformers...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			releaseTrain := &ReleaseTrain{
+				Target: envProduction,
+				Repo:   repo,
+			}
+			prognosis := releaseTrain.Prognosis(ctx, repo.State(), nil)
+			if prognosis.Error != nil {
+				t.Fatal(prognosis.Error)
+			}
+			if diff := cmp.Diff(tc.ExpectedPrognoses, prognosis.EnvironmentPrognoses[envProduction].AppsPrognoses); diff != "" {
+				t.Errorf("prognosis mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
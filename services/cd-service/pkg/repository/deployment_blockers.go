@@ -0,0 +1,226 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/mapper"
+	"github.com/freiheit-com/kuberpult/pkg/sorting"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GetDeploymentBlockers evaluates the same rules as DeployApplicationVersion (and the upstream rules of release trains)
+// and returns everything that prevents the given release from being deployed to the environment.
+// It does not change the state.
+func (s *State) GetDeploymentBlockers(
+	ctx context.Context,
+	transaction *sql.Tx,
+	environment, application string,
+	version uint64,
+	now time.Time,
+	RBACConfig auth.RBACConfig,
+) ([]*api.DeploymentBlocker, error) {
+	result := []*api.DeploymentBlocker{}
+	envConfigs, err := s.GetEnvironmentConfigs()
+	if err != nil {
+		return nil, err
+	}
+	envConfig, ok := envConfigs[environment]
+	if !ok {
+		// without an environment, none of the other rules can be evaluated:
+		return append(result, newDeploymentBlocker(api.DeploymentBlockerKind_ENVIRONMENT_NOT_FOUND, fmt.Sprintf("environment %q does not exist", environment))), nil
+	}
+
+	if err := s.checkUserPermissions(ctx, environment, application, auth.PermissionDeployRelease, "", RBACConfig); err != nil {
+		var permissionError auth.PermissionError
+		if !errors.As(err, &permissionError) {
+			return nil, err
+		}
+		result = append(result, newDeploymentBlocker(api.DeploymentBlockerKind_MISSING_PERMISSION, permissionError.Error()))
+	}
+
+	if _, err := s.GetApplicationRelease(application, version); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		result = append(result, newDeploymentBlocker(api.DeploymentBlockerKind_RELEASE_NOT_FOUND, fmt.Sprintf("release %d of application %q does not exist", version, application)))
+	} else {
+		manifest, err := s.getReleaseManifestPath(application, version, environment)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.Filesystem.Stat(manifest); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			result = append(result, newDeploymentBlocker(api.DeploymentBlockerKind_MANIFEST_NOT_FOUND, fmt.Sprintf("release %d of application %q has no manifest for environment %q", version, application, environment)))
+		}
+		unmet, err := s.GetUnmetDependencies(ctx, transaction, environment, application, version)
+		if err != nil {
+			return nil, err
+		}
+		if len(unmet) > 0 {
+			unmetErr := &UnmetDependenciesError{
+				Environment:  environment,
+				Application:  application,
+				Version:      version,
+				Dependencies: unmet,
+			}
+			result = append(result, newDeploymentBlocker(api.DeploymentBlockerKind_UNMET_DEPENDENCIES, unmetErr.Error()))
+		}
+	}
+
+	envLocks, err := s.GetEnvironmentLocks(environment)
+	if err != nil {
+		return nil, err
+	}
+	groupEnvs := []string{}
+	if envConfig.EnvironmentGroup != nil {
+		for envName, config := range envConfigs {
+			if mapper.DeriveGroupName(config, envName) == *envConfig.EnvironmentGroup {
+				groupEnvs = append(groupEnvs, envName)
+			}
+		}
+	}
+	for _, lockId := range sorting.SortKeys(envLocks) {
+		lock := envLocks[lockId]
+		isGroupLock, err := s.isEnvironmentGroupLock(groupEnvs, lockId)
+		if err != nil {
+			return nil, err
+		}
+		if isGroupLock {
+			result = append(result, lockToDeploymentBlocker(api.DeploymentBlockerKind_ENVIRONMENT_GROUP_LOCK, lockId, lock,
+				fmt.Sprintf("environment group %q is locked: %s", *envConfig.EnvironmentGroup, lock.Message)))
+		} else {
+			result = append(result, lockToDeploymentBlocker(api.DeploymentBlockerKind_ENVIRONMENT_LOCK, lockId, lock,
+				fmt.Sprintf("environment %q is locked: %s", environment, lock.Message)))
+		}
+	}
+
+	freezeLocks, err := getFreezeLocks(envConfig, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, lockId := range sorting.SortKeys(freezeLocks) {
+		lock := freezeLocks[lockId]
+		result = append(result, lockToDeploymentBlocker(api.DeploymentBlockerKind_FREEZE_WINDOW, lockId, lock,
+			fmt.Sprintf("environment %q is frozen: %s", environment, lock.Message)))
+	}
+
+	appLocks, err := s.GetEnvironmentApplicationLocks(environment, application)
+	if err != nil {
+		return nil, err
+	}
+	for _, lockId := range sorting.SortKeys(appLocks) {
+		lock := appLocks[lockId]
+		result = append(result, lockToDeploymentBlocker(api.DeploymentBlockerKind_APPLICATION_LOCK, lockId, lock,
+			fmt.Sprintf("application %q is locked on environment %q: %s", application, environment, lock.Message)))
+	}
+
+	selectorLocks, err := s.GetSelectorLocksForApplication(environment, application)
+	if err != nil {
+		return nil, err
+	}
+	for _, lockId := range sorting.SortKeys(selectorLocks) {
+		selectorLock := selectorLocks[lockId]
+		result = append(result, lockToDeploymentBlocker(api.DeploymentBlockerKind_SELECTOR_LOCK, lockId, selectorLock.Lock,
+			fmt.Sprintf("applications matching %q are locked on environment %q: %s", selectorLock.Selector, environment, selectorLock.Lock.Message)))
+	}
+
+	team, err := s.GetTeamName(application)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if team != "" {
+		teamLocks, err := s.GetEnvironmentTeamLocks(environment, team)
+		if err != nil {
+			return nil, err
+		}
+		for _, lockId := range sorting.SortKeys(teamLocks) {
+			lock := teamLocks[lockId]
+			result = append(result, lockToDeploymentBlocker(api.DeploymentBlockerKind_TEAM_LOCK, lockId, lock,
+				fmt.Sprintf("team %q is locked on environment %q: %s", team, environment, lock.Message)))
+		}
+	}
+
+	// environments without upstream are deployed manually, so there is nothing that release trains could block
+	if envConfig.Upstream != nil && !envConfig.Upstream.Latest && envConfig.Upstream.Environment != "" {
+		upstreamEnv := envConfig.Upstream.Environment
+		upstreamVersion, err := s.GetEnvironmentApplicationVersion(ctx, upstreamEnv, application, transaction)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if upstreamVersion == nil || *upstreamVersion != version {
+			result = append(result, newDeploymentBlocker(api.DeploymentBlockerKind_UPSTREAM_MISMATCH, fmt.Sprintf("release %d is not deployed on the upstream environment %q, so release trains will not deploy it", version, upstreamEnv)))
+		}
+	}
+	return result, nil
+}
+
+// isEnvironmentGroupLock returns true if every environment of the group has a lock with this id.
+// That is how CreateEnvironmentGroupLock stores group locks.
+func (s *State) isEnvironmentGroupLock(groupEnvs []string, lockId string) (bool, error) {
+	if len(groupEnvs) < 2 {
+		return false, nil
+	}
+	for _, env := range groupEnvs {
+		if _, err := s.Filesystem.Stat(s.GetEnvLockDir(env, lockId)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func newDeploymentBlocker(kind api.DeploymentBlockerKind, message string) *api.DeploymentBlocker {
+	return &api.DeploymentBlocker{
+		Kind:      kind,
+		Message:   message,
+		LockId:    "",
+		CreatedBy: nil,
+		CreatedAt: nil,
+		ExpiresAt: nil,
+	}
+}
+
+func lockToDeploymentBlocker(kind api.DeploymentBlockerKind, lockId string, lock Lock, message string) *api.DeploymentBlocker {
+	var expiresAt *timestamppb.Timestamp
+	if lock.ExpiresAt != nil {
+		expiresAt = timestamppb.New(*lock.ExpiresAt)
+	}
+	return &api.DeploymentBlocker{
+		Kind:    kind,
+		Message: message,
+		LockId:  lockId,
+		CreatedBy: &api.Actor{
+			Name:  lock.CreatedBy.Name,
+			Email: lock.CreatedBy.Email,
+		},
+		CreatedAt: timestamppb.New(lock.CreatedAt),
+		ExpiresAt: expiresAt,
+	}
+}
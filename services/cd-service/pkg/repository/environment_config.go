@@ -0,0 +1,190 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/mapper"
+	"github.com/onokonem/sillyQueueServer/timeuuid"
+)
+
+// environmentConfigFields are the fields of an environment config that can be updated with UpdateEnvironmentConfig.
+// The names are the ones of the api.
+var environmentConfigFields = map[string]func(trg *config.EnvironmentConfig, src config.EnvironmentConfig){
+	"upstream": func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		trg.Upstream = src.Upstream
+	},
+	"argocd": func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		trg.ArgoCd = src.ArgoCd
+	},
+	"argocd.destination": updateArgoCdField(func(trg, src *config.EnvironmentConfigArgoCd) {
+		trg.Destination = src.Destination
+	}),
+	"argocd.sync_windows": updateArgoCdField(func(trg, src *config.EnvironmentConfigArgoCd) {
+		trg.SyncWindows = src.SyncWindows
+	}),
+	"argocd.access_list": updateArgoCdField(func(trg, src *config.EnvironmentConfigArgoCd) {
+		trg.ClusterResourceWhitelist = src.ClusterResourceWhitelist
+	}),
+	"argocd.application_annotations": updateArgoCdField(func(trg, src *config.EnvironmentConfigArgoCd) {
+		trg.ApplicationAnnotations = src.ApplicationAnnotations
+	}),
+	"argocd.ignore_differences": updateArgoCdField(func(trg, src *config.EnvironmentConfigArgoCd) {
+		trg.IgnoreDifferences = src.IgnoreDifferences
+	}),
+	"argocd.sync_options": updateArgoCdField(func(trg, src *config.EnvironmentConfigArgoCd) {
+		trg.SyncOptions = src.SyncOptions
+	}),
+	"environment_group": func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		trg.EnvironmentGroup = src.EnvironmentGroup
+	},
+	"freeze_windows": func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		trg.FreezeWindows = src.FreezeWindows
+	},
+	"auto_rollback": func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		trg.AutoRollback = src.AutoRollback
+	},
+	"promotion": func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		trg.Promotion = src.Promotion
+	},
+}
+
+// updateArgoCdField updates one field of the argocd config. A missing argocd config is treated like an empty one.
+func updateArgoCdField(update func(trg, src *config.EnvironmentConfigArgoCd)) func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+	return func(trg *config.EnvironmentConfig, src config.EnvironmentConfig) {
+		//exhaustruct:ignore
+		argoCd := config.EnvironmentConfigArgoCd{}
+		if trg.ArgoCd != nil {
+			argoCd = *trg.ArgoCd
+		}
+		//exhaustruct:ignore
+		srcArgoCd := config.EnvironmentConfigArgoCd{}
+		if src.ArgoCd != nil {
+			srcArgoCd = *src.ArgoCd
+		}
+		update(&argoCd, &srcArgoCd)
+		trg.ArgoCd = &argoCd
+	}
+}
+
+// ValidateEnvironmentConfigFields returns an error if fields is empty or contains fields that cannot be updated.
+func ValidateEnvironmentConfigFields(fields []string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+	for _, field := range fields {
+		if _, ok := environmentConfigFields[field]; !ok {
+			supported := make([]string, 0, len(environmentConfigFields))
+			for name := range environmentConfigFields {
+				supported = append(supported, name)
+			}
+			sort.Strings(supported)
+			return fmt.Errorf("unknown field %q, supported fields are %s", field, strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+// updateEnvironmentConfig returns a copy of current with the fields replaced by the ones of update.
+func updateEnvironmentConfig(current, update config.EnvironmentConfig, fields []string) (config.EnvironmentConfig, error) {
+	if err := ValidateEnvironmentConfigFields(fields); err != nil {
+		return current, err
+	}
+	result := current
+	for _, field := range fields {
+		environmentConfigFields[field](&result, update)
+	}
+	return result, nil
+}
+
+// validateEnvironmentUpstreams returns an error if giving the environment this config would break the upstreams:
+// a cycle of upstreams through the environment, or a group of the environment with upstreams in different groups.
+// Upstream environments that do not exist yet are accepted unless requireExistingUpstream is set, because environments are often created before their upstream.
+// An environment that is its own upstream is accepted as well, release trains to it do not change anything.
+func validateEnvironmentUpstreams(envConfigs map[string]config.EnvironmentConfig, environment string, envConfig config.EnvironmentConfig, requireExistingUpstream bool) error {
+	configs := make(map[string]config.EnvironmentConfig, len(envConfigs)+1)
+	for env, c := range envConfigs {
+		configs[env] = c
+	}
+	configs[environment] = envConfig
+	rejected := []*api.EnvironmentConfigProblem{}
+	for _, problem := range mapper.ProblemsOfEnvironment(mapper.ValidateEnvironmentConfigs(configs), environment) {
+		switch problem.Kind {
+		case api.EnvironmentConfigProblem_KIND_UPSTREAM_CYCLE:
+			if len(problem.Environments) > 1 {
+				rejected = append(rejected, problem)
+			}
+		case api.EnvironmentConfigProblem_KIND_CONFLICTING_GROUP_UPSTREAMS:
+			rejected = append(rejected, problem)
+		case api.EnvironmentConfigProblem_KIND_DANGLING_UPSTREAM:
+			if requireExistingUpstream {
+				rejected = append(rejected, problem)
+			}
+		}
+	}
+	return mapper.ProblemsError(rejected)
+}
+
+// EnvironmentConfigHash identifies a version of an environment config, so that updates can detect concurrent changes.
+func EnvironmentConfigHash(envConfig config.EnvironmentConfig) (string, error) {
+	data, err := json.Marshal(envConfig)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// The config history of an environment has one event directory per update.
+func environmentConfigHistoryDirectory(state *State, environment string) string {
+	return state.Filesystem.Join(environmentHistoryDirectory(state, environment), "config")
+}
+
+func (s *State) writeEnvironmentConfigUpdatedEvent(ctx context.Context, transaction *sql.Tx, environment string, before, after []byte) error {
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	ev := &event.EnvironmentConfigUpdated{
+		Environment: environment,
+		Before:      string(before),
+		After:       string(after),
+		AuthorName:  user.Name,
+		AuthorEmail: user.Email,
+	}
+	eventUuid := timeuuid.UUIDFromTime(getTimeNow(ctx)).String()
+	if s.DBHandler.ShouldUseOtherTables() {
+		return s.DBHandler.DBWriteEnvironmentConfigUpdatedEvent(ctx, transaction, eventUuid, user.Email, ev)
+	}
+	eventDir := s.Filesystem.Join(environmentConfigHistoryDirectory(s, environment), eventUuid)
+	if err := event.Write(s.Filesystem, eventDir, ev); err != nil {
+		return fmt.Errorf("could not write environment config event for environment %s with uuid %s, error: %w", environment, eventUuid, err)
+	}
+	return nil
+}
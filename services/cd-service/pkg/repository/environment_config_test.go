@@ -0,0 +1,427 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpdateEnvironmentConfig(t *testing.T) {
+	productionConfig := config.EnvironmentConfig{
+		Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+		ArgoCd: &config.EnvironmentConfigArgoCd{
+			Destination:            config.ArgoCdDestination{Server: "localhost:8080"},
+			ApplicationAnnotations: map[string]string{"owner": "team"},
+		},
+	}
+	currentHash, err := EnvironmentConfigHash(productionConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		Name               string
+		Update             config.EnvironmentConfig
+		Fields             []string
+		PreviousConfigHash string
+		ExpectedError      string
+		ExpectedConfig     config.EnvironmentConfig
+	}{
+		{
+			Name: "update only the sync windows",
+			Update: config.EnvironmentConfig{
+				ArgoCd: &config.EnvironmentConfigArgoCd{
+					SyncWindows: []config.ArgoCdSyncWindow{{Schedule: "0 0 * * *", Duration: "1h", Kind: "deny"}},
+				},
+			},
+			Fields:             []string{"argocd.sync_windows"},
+			PreviousConfigHash: currentHash,
+			ExpectedConfig: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+				ArgoCd: &config.EnvironmentConfigArgoCd{
+					Destination:            config.ArgoCdDestination{Server: "localhost:8080"},
+					SyncWindows:            []config.ArgoCdSyncWindow{{Schedule: "0 0 * * *", Duration: "1h", Kind: "deny"}},
+					ApplicationAnnotations: map[string]string{"owner": "team"},
+				},
+			},
+		},
+		{
+			Name: "update the upstream without a previous config hash",
+			Update: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance},
+			},
+			Fields: []string{"upstream"},
+			ExpectedConfig: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance},
+				ArgoCd:   productionConfig.ArgoCd,
+			},
+		},
+		{
+			Name:          "remove the argocd config",
+			Fields:        []string{"argocd"},
+			ExpectedError: "",
+			ExpectedConfig: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+			},
+		},
+		{
+			Name: "config was changed in the meantime",
+			Update: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance},
+			},
+			Fields:             []string{"upstream"},
+			PreviousConfigHash: "stale",
+			ExpectedError:      `cannot update environment "production": the config was changed in the meantime`,
+			ExpectedConfig:     productionConfig,
+		},
+		{
+			Name: "upstream does not exist",
+			Update: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"},
+			},
+			Fields:         []string{"upstream"},
+			ExpectedError:  `cannot update environment "production": upstream environment "staging" does not exist`,
+			ExpectedConfig: productionConfig,
+		},
+		{
+			Name:           "unknown field",
+			Fields:         []string{"argocd.unknown"},
+			ExpectedError:  `cannot update environment "production": unknown field "argocd.unknown"`,
+			ExpectedConfig: productionConfig,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envAcceptance,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      productionConfig,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &UpdateEnvironmentConfig{
+				Environment:        envProduction,
+				Config:             tc.Update,
+				Fields:             tc.Fields,
+				PreviousConfigHash: tc.PreviousConfigHash,
+			})
+			if tc.ExpectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+				t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+			}
+			state := repo.State()
+			actual, err := state.GetEnvironmentConfig(envProduction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedConfig, *actual); diff != "" {
+				t.Errorf("environment config mismatch (-want, +got):\n%s", diff)
+			}
+			historyDir := environmentConfigHistoryDirectory(state, envProduction)
+			events, _ := state.Filesystem.ReadDir(historyDir)
+			if tc.ExpectedError != "" {
+				if len(events) != 0 {
+					t.Errorf("expected no events, got %d", len(events))
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected one event, got %d", len(events))
+			}
+			ev, err := event.Read(state.Filesystem, state.Filesystem.Join(historyDir, events[0].Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			updated, ok := ev.(*event.EnvironmentConfigUpdated)
+			if !ok {
+				t.Fatalf("expected an environment config updated event, got %T", ev)
+			}
+			if !strings.Contains(updated.Before, `"server": "localhost:8080"`) || updated.AuthorEmail != "testmail@example.com" {
+				t.Errorf("unexpected event %+v", updated)
+			}
+		})
+	}
+}
+
+func TestUpdateEnvironmentConfigRendersArgoCdApps(t *testing.T) {
+	repo := setupRepositoryTest(t)
+	ctx := testutil.MakeTestContext()
+	err := repo.Apply(ctx, &CreateEnvironment{
+		Environment: envProduction,
+		Config: config.EnvironmentConfig{
+			Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+			ArgoCd: &config.EnvironmentConfigArgoCd{
+				Destination: config.ArgoCdDestination{Server: "localhost:8080"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootApp := "argocd/v1alpha1/" + envProduction + ".yaml"
+	before, err := util.ReadFile(repo.State().Filesystem, rootApp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(before), "production-namespace") {
+		t.Fatalf("expected the argocd apps to be rendered without the namespace, got:\n%s", before)
+	}
+
+	namespace := "production-namespace"
+	changes, applyErr := repo.(*repository).ApplyTransformers(ctx, nil, &UpdateEnvironmentConfig{
+		Environment: envProduction,
+		Config: config.EnvironmentConfig{
+			ArgoCd: &config.EnvironmentConfigArgoCd{
+				Destination: config.ArgoCdDestination{Server: "localhost:8080", Namespace: &namespace},
+			},
+		},
+		Fields: []string{"argocd.destination"},
+	})
+	if applyErr != nil {
+		t.Fatal(applyErr)
+	}
+	after, err := util.ReadFile(repo.State().Filesystem, rootApp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(after), "namespace: production-namespace") {
+		t.Errorf("expected the argocd apps to be rendered with the new namespace, got:\n%s", after)
+	}
+	if diff := cmp.Diff([]RootApp{{Env: envProduction}}, changes.UpdatedRootApps); diff != "" {
+		t.Errorf("updated root apps mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestValidateEnvironmentConfigFields(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		Fields        []string
+		ExpectedError string
+	}{
+		{
+			Name:          "supported fields",
+			Fields:        []string{"upstream", "argocd.sync_windows", "promotion"},
+			ExpectedError: "",
+		},
+		{
+			Name:          "no fields",
+			Fields:        nil,
+			ExpectedError: "no fields to update",
+		},
+		{
+			Name:          "unknown field",
+			Fields:        []string{"upstream", "argocd.syncWindows"},
+			ExpectedError: `unknown field "argocd.syncWindows"`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateEnvironmentConfigFields(tc.Fields)
+			if tc.ExpectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+				t.Errorf("expected error %q, got %v", tc.ExpectedError, err)
+			}
+		})
+	}
+}
+
+func TestCreateEnvironmentUpstreams(t *testing.T) {
+	productionGroup := "production"
+	tcs := []struct {
+		Name          string
+		Environment   string
+		Config        config.EnvironmentConfig
+		ExpectedError string
+	}{
+		{
+			Name:        "upstream in the same group as the other environments of the group",
+			Environment: "production-ca",
+			Config: config.EnvironmentConfig{
+				Upstream:         &config.EnvironmentConfigUpstream{Environment: envAcceptance},
+				EnvironmentGroup: &productionGroup,
+			},
+		},
+		{
+			Name:        "upstream that does not exist yet",
+			Environment: "production-ca",
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: "acceptance-ca"},
+			},
+		},
+		{
+			Name:        "upstream cycle",
+			Environment: "staging",
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: "canary"},
+			},
+			ExpectedError: `cannot create environment "staging": upstream cycle: canary -> staging -> canary`,
+		},
+		{
+			Name:        "conflicting upstreams in one group",
+			Environment: "production-ca",
+			Config: config.EnvironmentConfig{
+				Upstream:         &config.EnvironmentConfigUpstream{Latest: true},
+				EnvironmentGroup: &productionGroup,
+			},
+			ExpectedError: `cannot create environment "production-ca": environments of group "production" have conflicting upstreams: production (upstream group "acceptance"), production-ca (latest)`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envAcceptance,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance}},
+				},
+				&CreateEnvironment{
+					Environment: "canary",
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"}},
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &CreateEnvironment{
+				Environment: tc.Environment,
+				Config:      tc.Config,
+			})
+			if tc.ExpectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+				t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+			}
+			envConfigs, err := repo.State().GetEnvironmentConfigs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := envConfigs[tc.Environment]; ok {
+				t.Fatalf("expected environment %q not to be created", tc.Environment)
+			}
+		})
+	}
+}
+
+func TestCreateEnvironmentRequireExistingUpstream(t *testing.T) {
+	tcs := []struct {
+		Name                    string
+		Environment             string
+		Config                  config.EnvironmentConfig
+		RequireExistingUpstream bool
+		ExpectedError           string
+	}{
+		{
+			Name:        "upstream that does not exist is accepted by default",
+			Environment: envProduction,
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"},
+			},
+		},
+		{
+			Name:        "own upstream is accepted by default",
+			Environment: envProduction,
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envProduction},
+			},
+		},
+		{
+			Name:        "upstream that does not exist is rejected if required",
+			Environment: envProduction,
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"},
+			},
+			RequireExistingUpstream: true,
+			ExpectedError:           `cannot create environment "production": environment "production" has upstream "staging", which does not exist`,
+		},
+		{
+			Name:        "upstream that exists is accepted if required",
+			Environment: envProduction,
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance},
+			},
+			RequireExistingUpstream: true,
+		},
+		{
+			Name:        "own upstream is accepted if an existing upstream is required",
+			Environment: envProduction,
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envProduction},
+			},
+			RequireExistingUpstream: true,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx, &CreateEnvironment{
+				Environment: envAcceptance,
+				Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &CreateEnvironment{
+				Environment:             tc.Environment,
+				Config:                  tc.Config,
+				RequireExistingUpstream: tc.RequireExistingUpstream,
+			})
+			if tc.ExpectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+				t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+			}
+		})
+	}
+}
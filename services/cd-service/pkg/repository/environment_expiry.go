@@ -0,0 +1,178 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+)
+
+// GetEnvironmentExpiry returns when the environment is deleted, or nil if it does not expire.
+// Only cloned environments can expire, see CloneEnvironment.
+func (s *State) GetEnvironmentExpiry(environment string) (*time.Time, error) {
+	expiresAtFile := s.Filesystem.Join("environments", environment, fieldExpiresAt)
+	cnt, err := readFile(s.Filesystem, expiresAtFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(cnt)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry of environment %q: %w", environment, err)
+	}
+	return &expiresAt, nil
+}
+
+// getEnvironmentCloner returns the user who cloned the environment with an expiry date,
+// or nil if the user is not recorded.
+func (s *State) getEnvironmentCloner(environment string) (*auth.User, error) {
+	envDir := s.Filesystem.Join("environments", environment)
+	email, err := readFile(s.Filesystem, s.Filesystem.Join(envDir, "created_by_email"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	name, err := readFile(s.Filesystem, s.Filesystem.Join(envDir, "created_by_name"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &auth.User{
+		DexAuthContext: nil,
+		Email:          string(email),
+		Name:           string(name),
+	}, nil
+}
+
+// getReleaseManifestPath returns the path of the manifest of the release for the environment.
+// Releases only contain manifests for the environments that existed when they were created, so for clones
+// the manifest of the environment they were cloned from is used instead, see CloneEnvironment.
+// If there is no manifest, the path of the environment's own manifest is returned.
+func (s *State) getReleaseManifestPath(application string, version uint64, environment string) (string, error) {
+	fs := s.Filesystem
+	releaseDir := releasesDirectoryWithVersion(fs, application, version)
+	manifest := fs.Join(releaseDir, "environments", environment, "manifests.yaml")
+	visited := map[string]bool{}
+	for env := environment; !visited[env]; {
+		visited[env] = true
+		path := fs.Join(releaseDir, "environments", env, "manifests.yaml")
+		if _, err := fs.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		source, err := readFile(fs, fs.Join("environments", env, fieldClonedFrom))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			return "", err
+		}
+		env = string(source)
+	}
+	return manifest, nil
+}
+
+// GetExpiredEnvironmentTransformers returns one DeleteEnvironment transformer for every environment that is expired at the given time.
+// Applications that are still deployed on these environments are undeployed.
+func (s *State) GetExpiredEnvironmentTransformers(now time.Time, authentication Authentication) ([]*DeleteEnvironment, error) {
+	result := []*DeleteEnvironment{}
+	envs, err := names(s.Filesystem, "environments")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, err
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		expiresAt, err := s.GetEnvironmentExpiry(env)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt == nil || now.Before(*expiresAt) {
+			continue
+		}
+		result = append(result, &DeleteEnvironment{
+			Authentication: authentication,
+			Environment:    env,
+			Force:          true,
+		})
+	}
+	return result, nil
+}
+
+// DeleteExpiredEnvironments removes all environments that are expired now.
+// Every deletion is attributed to the user who cloned the environment and chose the expiry date,
+// or to the given user if the cloning user is not recorded.
+// No permissions are checked, because cloning with an expiry date already requires the permission to delete the environment.
+func DeleteExpiredEnvironments(ctx context.Context, repo Repository, user auth.User) error {
+	state := repo.State()
+	transformers, err := state.GetExpiredEnvironmentTransformers(time.Now(), Authentication{
+		RBACConfig: auth.RBACConfig{
+			DexEnabled:    false,
+			Policy:        nil,
+			LockOwnership: false,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range transformers {
+		author := user
+		cloner, err := state.getEnvironmentCloner(t.Environment)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if cloner != nil {
+			author = *cloner
+		}
+		if err := repo.Apply(auth.WriteUserToContext(ctx, author), t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RegularlyDeleteExpiredEnvironments calls DeleteExpiredEnvironments in the given interval until the context is done.
+func RegularlyDeleteExpiredEnvironments(ctx context.Context, repo Repository, interval time.Duration, user auth.User) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := DeleteExpiredEnvironments(ctx, repo, user); err != nil {
+				logger.FromContext(ctx).Sugar().Warnf("could not delete expired environments: %v", err)
+			}
+		}
+	}
+}
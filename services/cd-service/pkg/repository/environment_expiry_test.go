@@ -0,0 +1,317 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCloneEnvironment(t *testing.T) {
+	stagingConfig := config.EnvironmentConfig{
+		Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+		ArgoCd: &config.EnvironmentConfigArgoCd{
+			Destination: config.ArgoCdDestination{
+				Server:    "localhost:8080",
+				Namespace: ptr.FromString("staging"),
+			},
+		},
+	}
+	tcs := []struct {
+		Name             string
+		Clone            CloneEnvironment
+		ExpectedError    string
+		ExpectedConfig   config.EnvironmentConfig
+		ExpectedVersions map[string]*uint64
+	}{
+		{
+			Name: "clone the config with another namespace",
+			Clone: CloneEnvironment{
+				SourceEnvironment:    "staging",
+				Environment:          "preview",
+				DestinationNamespace: ptr.FromString("preview"),
+			},
+			ExpectedConfig: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+				ArgoCd: &config.EnvironmentConfigArgoCd{
+					Destination: config.ArgoCdDestination{
+						Server:    "localhost:8080",
+						Namespace: ptr.FromString("preview"),
+					},
+				},
+			},
+			ExpectedVersions: map[string]*uint64{"app1": nil, "app2": nil},
+		},
+		{
+			Name: "copy the deployments of all applications",
+			Clone: CloneEnvironment{
+				SourceEnvironment: "staging",
+				Environment:       "preview",
+				CopyDeployments:   true,
+			},
+			ExpectedConfig:   stagingConfig,
+			ExpectedVersions: map[string]*uint64{"app1": ptr.Uint64(1), "app2": ptr.Uint64(2)},
+		},
+		{
+			Name: "copy the deployments of selected applications",
+			Clone: CloneEnvironment{
+				SourceEnvironment: "staging",
+				Environment:       "preview",
+				CopyDeployments:   true,
+				Applications:      []string{"app2"},
+			},
+			ExpectedConfig:   stagingConfig,
+			ExpectedVersions: map[string]*uint64{"app1": nil, "app2": ptr.Uint64(2)},
+		},
+		{
+			Name: "selected application is not deployed",
+			Clone: CloneEnvironment{
+				SourceEnvironment: "staging",
+				Environment:       "preview",
+				CopyDeployments:   true,
+				Applications:      []string{"app3"},
+			},
+			ExpectedError: `cannot clone environment "staging": application "app3" is not deployed there`,
+		},
+		{
+			Name: "environment already exists",
+			Clone: CloneEnvironment{
+				SourceEnvironment: "staging",
+				Environment:       "staging",
+			},
+			ExpectedError: `cannot clone environment "staging": environment "staging" already exists`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: "staging",
+					Config:      stagingConfig,
+				},
+				&CreateApplicationVersion{
+					Application: "app1",
+					Version:     1,
+					Manifests:   map[string]string{"staging": "app1"},
+				},
+				&CreateApplicationVersion{
+					Application: "app2",
+					Version:     2,
+					Manifests:   map[string]string{"staging": "app2"},
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &tc.Clone)
+			if tc.ExpectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+					t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := repo.State()
+			configs, err := state.GetEnvironmentConfigs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedConfig, configs["preview"]); diff != "" {
+				t.Errorf("config mismatch (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(stagingConfig, configs["staging"]); diff != "" {
+				t.Errorf("the config of the source environment was changed (-want, +got):\n%s", diff)
+			}
+			versions := map[string]*uint64{}
+			for app := range tc.ExpectedVersions {
+				versions[app], err = state.GetEnvironmentApplicationVersion(ctx, "preview", app, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if diff := cmp.Diff(tc.ExpectedVersions, versions); diff != "" {
+				t.Errorf("deployed versions mismatch (-want, +got):\n%s", diff)
+			}
+			for app, version := range tc.ExpectedVersions {
+				if version == nil {
+					continue
+				}
+				// the manifest of the source environment is deployed, the release is not changed
+				manifest, err := util.ReadFile(state.Filesystem, "environments/preview/applications/"+app+"/manifests/manifests.yaml")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(manifest) != app {
+					t.Errorf("expected the manifest of staging to be deployed for %s, got %q", app, manifest)
+				}
+				releaseEnvs, err := state.Filesystem.ReadDir(state.Filesystem.Join(releasesDirectoryWithVersion(state.Filesystem, app, *version), "environments"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(releaseEnvs) != 1 || releaseEnvs[0].Name() != "staging" {
+					t.Errorf("expected the release of %s to only contain the manifest of staging, got %v", app, releaseEnvs)
+				}
+			}
+		})
+	}
+}
+
+func TestCloneEnvironmentWithExpiryPermissions(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		Permissions   map[string]auth.Permission
+		ExpectedError string
+	}{
+		{
+			Name: "the permission to delete the new environment is checked for its group",
+			Permissions: map[string]auth.Permission{
+				"p,role:developer,CreateEnvironment,*:*,*,allow":              {Role: "developer"},
+				"p,role:developer,DeleteEnvironment,previews:preview,*,allow": {Role: "developer"},
+			},
+		},
+		{
+			Name: "the permission to delete environments of another group is not enough",
+			Permissions: map[string]auth.Permission{
+				"p,role:developer,CreateEnvironment,*:*,*,allow":             {Role: "developer"},
+				"p,role:developer,DeleteEnvironment,staging:preview,*,allow": {Role: "developer"},
+			},
+			ExpectedError: "DeleteEnvironment",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			err := repo.Apply(testutil.MakeTestContext(), &CreateEnvironment{
+				Environment: "staging",
+				Config: config.EnvironmentConfig{
+					Upstream:         &config.EnvironmentConfigUpstream{Latest: true},
+					EnvironmentGroup: ptr.FromString("previews"),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(testutil.MakeTestContextDexEnabled(), &CloneEnvironment{
+				Authentication: Authentication{RBACConfig: auth.RBACConfig{
+					DexEnabled: true,
+					Policy:     &auth.RBACPolicies{Permissions: tc.Permissions},
+				}},
+				SourceEnvironment: "staging",
+				Environment:       "preview",
+				ExpiresAt:         ptrTime(time.Now().Add(time.Hour)),
+			})
+			if tc.ExpectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+					t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expiry, err := repo.State().GetEnvironmentExpiry("preview")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expiry == nil {
+				t.Errorf("expected the clone to expire")
+			}
+		})
+	}
+}
+
+func TestDeleteExpiredEnvironments(t *testing.T) {
+	// the environments are cloned in the past, so that expiry dates which were in the future back then are expired now
+	creationTime := time.Unix(1000, 0).UTC()
+	repo := setupRepositoryTest(t)
+	ctx := WithTimeNow(testutil.MakeTestContext(), creationTime)
+	err := repo.Apply(ctx,
+		&CreateEnvironment{
+			Environment: "staging",
+			Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+		},
+		&CreateApplicationVersion{
+			Application: "app",
+			Version:     1,
+			Manifests:   map[string]string{"staging": "app"},
+		},
+		&CloneEnvironment{SourceEnvironment: "staging", Environment: "preview-expired", CopyDeployments: true, ExpiresAt: ptrTime(creationTime.Add(time.Hour))},
+		&CloneEnvironment{SourceEnvironment: "staging", Environment: "preview-active", ExpiresAt: ptrTime(time.Now().Add(24 * time.Hour))},
+		&CloneEnvironment{SourceEnvironment: "staging", Environment: "preview-forever", ExpiresAt: nil},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DeleteExpiredEnvironments(testutil.MakeTestContext(), repo, auth.User{
+		Email:          "kuberpult@example.com",
+		Name:           "kuberpult",
+		DexAuthContext: nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := repo.State().GetEnvironmentConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs := []string{}
+	for env := range configs {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	if diff := cmp.Diff([]string{"preview-active", "preview-forever", "staging"}, envs); diff != "" {
+		t.Errorf("environments mismatch (-want, +got):\n%s", diff)
+	}
+	// the release is neither changed by the clone nor by its deletion
+	state := repo.State()
+	if _, err := state.Filesystem.Stat("applications/app/releases/1/environments/preview-expired"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no manifests of the deleted environment in the release, got %v", err)
+	}
+	if _, err := state.Filesystem.Stat("applications/app/releases/1/environments/staging/manifests.yaml"); err != nil {
+		t.Errorf("expected the manifests of staging to be kept, got %v", err)
+	}
+	// the deletion is attributed to the user who cloned the environment
+	if author := state.Commit.Author().Email; author != "testmail@example.com" {
+		t.Errorf("expected the deletion to be committed by the cloning user, got %q", author)
+	}
+	cloner, err := state.getEnvironmentCloner("preview-forever")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloner != nil {
+		t.Errorf("expected no cloning user to be recorded without an expiry date, got %v", cloner)
+	}
+}
@@ -17,6 +17,8 @@ Copyright freiheit.com*/
 package repository
 
 import (
+	"fmt"
+
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"google.golang.org/protobuf/proto"
 )
@@ -68,6 +70,19 @@ func GetCreateReleaseAlreadyExistsSame() *CreateReleaseError {
 	}
 }
 
+func GetCreateReleaseInvalidManifest(errors []*api.ManifestValidationError) *CreateReleaseError {
+	response := api.CreateReleaseResponseInvalidManifest{
+		Errors: errors,
+	}
+	return &CreateReleaseError{
+		response: api.CreateReleaseResponse{
+			Response: &api.CreateReleaseResponse_InvalidManifest{
+				InvalidManifest: &response,
+			},
+		},
+	}
+}
+
 func GetCreateReleaseAlreadyExistsDifferent(firstDifferingField api.DifferingField, diff string) *CreateReleaseError {
 	response := api.CreateReleaseResponseAlreadyExistsDifferent{
 		FirstDifferingField: firstDifferingField,
@@ -108,6 +123,20 @@ func GetCreateReleaseAppNameTooLong(appName string, regExp string, maxLen uint32
 	}
 }
 
+// UnmetDependenciesError is returned when a release is deployed before its dependencies are deployed in the environment.
+type UnmetDependenciesError struct {
+	Environment  string
+	Application  string
+	Version      uint64
+	Dependencies []ReleaseDependency
+}
+
+func (e *UnmetDependenciesError) Error() string {
+	return fmt.Sprintf("release %d of application %q cannot be deployed to environment %q: it requires %s", e.Version, e.Application, e.Environment, formatDependencies(e.Dependencies))
+}
+
+var _ error = (*UnmetDependenciesError)(nil)
+
 type LockedError struct {
 	EnvironmentApplicationLocks map[string]Lock
 	EnvironmentLocks            map[string]Lock
@@ -0,0 +1,66 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/freeze"
+)
+
+// FreezeLockPrefix is the prefix of the lock ids that represent active freeze windows.
+// Those locks do not exist in the repository, they are derived from the environment config.
+const FreezeLockPrefix = "freeze-window-"
+
+// ValidateFreezeWindows returns an error if any of the freeze windows cannot be parsed.
+func ValidateFreezeWindows(envConfig config.EnvironmentConfig) error {
+	return freeze.ValidateWindows(envConfig.FreezeWindows)
+}
+
+// getFreezeLocks returns the freeze windows that are active at the given time as environment locks,
+// so that they are honored like any other environment lock.
+func getFreezeLocks(envConfig config.EnvironmentConfig, now time.Time) (map[string]Lock, error) {
+	freezes, err := freeze.GetFreezes(envConfig.FreezeWindows, now)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]Lock{}
+	for i := range freezes {
+		occurrence := freezes[i]
+		if !occurrence.IsActive(now) {
+			continue
+		}
+		message := occurrence.Message
+		if message == "" {
+			message = fmt.Sprintf("deployment freeze until %s", occurrence.End.UTC().Format(time.RFC3339))
+		}
+		end := occurrence.End
+		// the id stays the same as long as the freeze window keeps its position in the config
+		result[fmt.Sprintf("%s%d", FreezeLockPrefix, occurrence.Window)] = Lock{
+			Message: message,
+			CreatedBy: Actor{
+				Name:  "",
+				Email: "",
+			},
+			CreatedAt: occurrence.Start,
+			ExpiresAt: &end,
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,161 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fridayEvening is a Friday, 17:00 UTC
+var fridayEvening = time.Date(2024, time.May, 3, 17, 0, 0, 0, time.UTC)
+
+var weekendFreeze = config.FreezeWindow{
+	Schedule: "0 16 * * 5",
+	Duration: "64h",
+	Message:  "weekend",
+}
+
+func TestDeployDuringFreeze(t *testing.T) {
+	firstVersion := uint64(1)
+	tcs := []struct {
+		Name                  string
+		Now                   time.Time
+		LockBehaviour         api.LockBehavior
+		ExpectLockedError     bool
+		ExpectedVersion       *uint64
+		ExpectedQueuedVersion *uint64
+	}{
+		{
+			Name:                  "deployment fails during freeze",
+			Now:                   fridayEvening,
+			LockBehaviour:         api.LockBehavior_FAIL,
+			ExpectLockedError:     true,
+			ExpectedVersion:       nil,
+			ExpectedQueuedVersion: nil,
+		},
+		{
+			Name:                  "deployment is queued during freeze",
+			Now:                   fridayEvening,
+			LockBehaviour:         api.LockBehavior_RECORD,
+			ExpectLockedError:     false,
+			ExpectedVersion:       nil,
+			ExpectedQueuedVersion: &firstVersion,
+		},
+		{
+			Name:                  "freeze is ignored",
+			Now:                   fridayEvening,
+			LockBehaviour:         api.LockBehavior_IGNORE,
+			ExpectLockedError:     false,
+			ExpectedVersion:       &firstVersion,
+			ExpectedQueuedVersion: nil,
+		},
+		{
+			Name:                  "deployment outside of freeze",
+			Now:                   fridayEvening.Add(-2 * time.Hour),
+			LockBehaviour:         api.LockBehavior_FAIL,
+			ExpectLockedError:     false,
+			ExpectedVersion:       &firstVersion,
+			ExpectedQueuedVersion: nil,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := WithTimeNow(testutil.MakeTestContext(), tc.Now)
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config: config.EnvironmentConfig{
+						Upstream:      &config.EnvironmentConfigUpstream{Environment: envAcceptance, Latest: false},
+						FreezeWindows: []config.FreezeWindow{weekendFreeze},
+					},
+				},
+				&CreateApplicationVersion{
+					Application: "app",
+					Manifests: map[string]string{
+						envProduction: "production",
+					},
+					WriteCommitData: true,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &DeployApplicationVersion{
+				Environment:   envProduction,
+				Application:   "app",
+				Version:       1,
+				LockBehaviour: tc.LockBehaviour,
+			})
+			var lockedErr *LockedError
+			if errors.As(err, &lockedErr) != tc.ExpectLockedError {
+				t.Fatalf("expected locked error: %t, got: %v", tc.ExpectLockedError, err)
+			}
+			if tc.ExpectLockedError {
+				if _, ok := lockedErr.EnvironmentLocks[FreezeLockPrefix+"0"]; !ok {
+					t.Errorf("expected freeze lock in locked error, got %v", lockedErr.EnvironmentLocks)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			state := repo.State()
+			version, err := state.GetEnvironmentApplicationVersion(ctx, envProduction, "app", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedVersion, version); diff != "" {
+				t.Errorf("version mismatch (-want, +got):\n%s", diff)
+			}
+			queuedVersion, err := state.GetQueuedVersion(envProduction, "app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedQueuedVersion, queuedVersion); diff != "" {
+				t.Errorf("queued version mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFreezeLockIdsUseTheWindowIndex(t *testing.T) {
+	envConfig := config.EnvironmentConfig{
+		FreezeWindows: []config.FreezeWindow{
+			// never matches, so GetFreezes skips it
+			{Schedule: "0 0 30 2 *", Duration: "1h", Message: "never"},
+			weekendFreeze,
+		},
+	}
+	locks, err := getFreezeLocks(envConfig, fridayEvening)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for id := range locks {
+		ids = append(ids, id)
+	}
+	if diff := cmp.Diff([]string{FreezeLockPrefix + "1"}, ids); diff != "" {
+		t.Errorf("lock ids mismatch (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,166 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+)
+
+// GetExpiredLockTransformers returns one Delete*Lock transformer for every environment,
+// application, team and selector lock that is expired at the given time.
+// Environment group locks are stored as environment locks, so they are covered as well.
+func (s *State) GetExpiredLockTransformers(now time.Time, authentication Authentication) ([]Transformer, error) {
+	result := []Transformer{}
+	envs, err := names(s.Filesystem, "environments")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, err
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		envLocks, err := s.GetEnvironmentLocks(env)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("could not read locks of environment %q: %w", env, err)
+		}
+		for _, lockId := range expiredLockIds(envLocks, now) {
+			result = append(result, &DeleteEnvironmentLock{
+				Authentication: authentication,
+				Environment:    env,
+				LockId:         lockId,
+			})
+		}
+
+		apps, err := names(s.Filesystem, s.Filesystem.Join("environments", env, "applications"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		sort.Strings(apps)
+		for _, app := range apps {
+			appLocks, err := s.GetEnvironmentApplicationLocks(env, app)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("could not read locks of application %q on environment %q: %w", app, env, err)
+			}
+			for _, lockId := range expiredLockIds(appLocks, now) {
+				result = append(result, &DeleteEnvironmentApplicationLock{
+					Authentication: authentication,
+					Environment:    env,
+					Application:    app,
+					LockId:         lockId,
+				})
+			}
+		}
+
+		teams, err := names(s.Filesystem, s.Filesystem.Join("environments", env, "teams"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		sort.Strings(teams)
+		for _, team := range teams {
+			teamLocks, err := s.GetEnvironmentTeamLocks(env, team)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("could not read locks of team %q on environment %q: %w", team, env, err)
+			}
+			for _, lockId := range expiredLockIds(teamLocks, now) {
+				result = append(result, &DeleteEnvironmentTeamLock{
+					Authentication: authentication,
+					Environment:    env,
+					Team:           team,
+					LockId:         lockId,
+				})
+			}
+		}
+
+		selectorLocks, err := s.GetEnvironmentSelectorLocks(env)
+		if err != nil {
+			return nil, fmt.Errorf("could not read selector locks on environment %q: %w", env, err)
+		}
+		locks := make(map[string]Lock, len(selectorLocks))
+		for lockId, selectorLock := range selectorLocks {
+			locks[lockId] = selectorLock.Lock
+		}
+		for _, lockId := range expiredLockIds(locks, now) {
+			result = append(result, &DeleteEnvironmentSelectorLock{
+				Authentication: authentication,
+				Environment:    env,
+				LockId:         lockId,
+			})
+		}
+	}
+	return result, nil
+}
+
+func expiredLockIds(locks map[string]Lock, now time.Time) []string {
+	result := []string{}
+	for lockId, lock := range locks {
+		if lock.IsExpired(now) {
+			result = append(result, lockId)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// DeleteExpiredLocks removes all locks that are expired now.
+// Every lock is removed with its own transformer, so that one failing deletion
+// (e.g. because the lock was removed manually in the meantime) does not block the others.
+// The sweeper acts on behalf of the lock creator who chose the expiry date, so no permissions are checked.
+func DeleteExpiredLocks(ctx context.Context, repo Repository, user auth.User) error {
+	transformers, err := repo.State().GetExpiredLockTransformers(time.Now(), Authentication{
+		RBACConfig: auth.RBACConfig{
+			DexEnabled:    false,
+			Policy:        nil,
+			LockOwnership: false,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ctx = auth.WriteUserToContext(ctx, user)
+	var errs []error
+	for _, t := range transformers {
+		if err := repo.Apply(ctx, t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RegularlyDeleteExpiredLocks calls DeleteExpiredLocks in the given interval until the context is done.
+func RegularlyDeleteExpiredLocks(ctx context.Context, repo Repository, interval time.Duration, user auth.User) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := DeleteExpiredLocks(ctx, repo, user); err != nil {
+				logger.FromContext(ctx).Sugar().Warnf("could not delete expired locks: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateLockWithExpiryInThePastWritesNothing(t *testing.T) {
+	timeNow := time.Unix(1000, 0).UTC()
+	repo := setupRepositoryTest(t)
+	fs := repo.State().Filesystem
+	ctx := WithTimeNow(testutil.MakeTestContext(), timeNow)
+	err := createLock(ctx, fs, "l1", "hotfix", ptrTime(timeNow.Add(-time.Hour)))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := fs.Stat("locks/l1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no lock directory to be written, got %v", err)
+	}
+}
+
+func TestCreateLockWithExpiry(t *testing.T) {
+	timeNow := time.Unix(1000, 0).UTC()
+	tcs := []struct {
+		Name              string
+		ExpiresAt         *time.Time
+		ExpectedExpiresAt *time.Time
+		ExpectedError     string
+	}{
+		{
+			Name:              "lock without expiry",
+			ExpiresAt:         nil,
+			ExpectedExpiresAt: nil,
+		},
+		{
+			Name:              "lock with expiry",
+			ExpiresAt:         ptrTime(timeNow.Add(time.Hour)),
+			ExpectedExpiresAt: ptrTime(timeNow.Add(time.Hour)),
+		},
+		{
+			Name:          "lock with expiry in the past",
+			ExpiresAt:     ptrTime(timeNow.Add(-time.Hour)),
+			ExpectedError: "error at index 1 of transformer batch: rpc error: code = InvalidArgument desc = error: cannot create lock \"l1\": expiry date 1970-01-01T00:16:40Z is not in the future",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := WithTimeNow(testutil.MakeTestContext(), timeNow)
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: "dev",
+				},
+				&CreateEnvironmentLock{
+					Environment: "dev",
+					LockId:      "l1",
+					Message:     "hotfix",
+					ExpiresAt:   tc.ExpiresAt,
+				},
+			)
+			if tc.ExpectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got none", tc.ExpectedError)
+				}
+				if diff := cmp.Diff(tc.ExpectedError, err.Error()); diff != "" {
+					t.Fatalf("error mismatch (-want, +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			locks, err := repo.State().GetEnvironmentLocks("dev")
+			if err != nil {
+				t.Fatal(err)
+			}
+			lock, ok := locks["l1"]
+			if !ok {
+				t.Fatalf("lock l1 not found in %v", locks)
+			}
+			if diff := cmp.Diff(tc.ExpectedExpiresAt, lock.ExpiresAt); diff != "" {
+				t.Errorf("expiry mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeleteExpiredLocks(t *testing.T) {
+	// the locks are created in the past, so that expiry dates which were in the future back then are expired now
+	creationTime := time.Unix(1000, 0).UTC()
+	expired := ptrTime(creationTime.Add(time.Hour))
+	notExpired := ptrTime(time.Now().Add(24 * time.Hour))
+	repo := setupRepositoryTest(t)
+	ctx := WithTimeNow(testutil.MakeTestContext(), creationTime)
+	err := repo.Apply(ctx,
+		&CreateEnvironment{
+			Environment: "dev",
+		},
+		&CreateApplicationVersion{
+			Application: "app",
+			Manifests: map[string]string{
+				"dev": "dev",
+			},
+			WriteCommitData: true,
+			Team:            "sre-team",
+		},
+		&CreateEnvironmentLock{Environment: "dev", LockId: "env-expired", Message: "m", ExpiresAt: expired},
+		&CreateEnvironmentLock{Environment: "dev", LockId: "env-active", Message: "m", ExpiresAt: notExpired},
+		&CreateEnvironmentLock{Environment: "dev", LockId: "env-forever", Message: "m", ExpiresAt: nil},
+		&CreateEnvironmentApplicationLock{Environment: "dev", Application: "app", LockId: "app-expired", Message: "m", ExpiresAt: expired},
+		&CreateEnvironmentApplicationLock{Environment: "dev", Application: "app", LockId: "app-active", Message: "m", ExpiresAt: notExpired},
+		&CreateEnvironmentTeamLock{Environment: "dev", Team: "sre-team", LockId: "team-expired", Message: "m", ExpiresAt: expired},
+		&CreateEnvironmentTeamLock{Environment: "dev", Team: "sre-team", LockId: "team-forever", Message: "m", ExpiresAt: nil},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DeleteExpiredLocks(testutil.MakeTestContext(), repo, auth.User{
+		Email:          "kuberpult@example.com",
+		Name:           "kuberpult",
+		DexAuthContext: nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := repo.State()
+	envLocks, err := state.GetEnvironmentLocks("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appLocks, err := state.GetEnvironmentApplicationLocks("dev", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamLocks, err := state.GetEnvironmentTeamLocks("dev", "sre-team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{}
+	for _, locks := range []map[string]Lock{envLocks, appLocks, teamLocks} {
+		for lockId := range locks {
+			actual = append(actual, lockId)
+		}
+	}
+	sort.Strings(actual)
+	expected := []string{"app-active", "env-active", "env-forever", "team-forever"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("remaining locks mismatch (-want, +got):\n%s", diff)
+	}
+
+	transformers, err := repo.State().GetExpiredLockTransformers(time.Now(), Authentication{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transformers) != 0 {
+		t.Errorf("expected no expired locks to be left, got %d", len(transformers))
+	}
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
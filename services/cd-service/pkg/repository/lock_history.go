@@ -0,0 +1,184 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/uuid"
+	"github.com/onokonem/sillyQueueServer/timeuuid"
+)
+
+// The history of an environment is stored outside of the environment directory, so that it is kept when the environment is deleted.
+func environmentHistoryDirectory(state *State, environment string) string {
+	return state.Filesystem.Join("environment-history", environment)
+}
+
+// The lock history of an environment has one event directory per created or deleted lock.
+func lockHistoryDirectory(state *State, environment string) string {
+	return state.Filesystem.Join(environmentHistoryDirectory(state, environment), "locks")
+}
+
+func (s *State) writeLockCreatedEvent(ctx context.Context, transaction *sql.Tx, environment, application, team, selector, lockId, message string, expiresAt *time.Time) error {
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	var expiresAtString *string
+	if expiresAt != nil {
+		formatted := expiresAt.UTC().Format(time.RFC3339)
+		expiresAtString = &formatted
+	}
+	return s.writeLockEvent(ctx, transaction, environment, &event.LockCreated{
+		Environment: environment,
+		Application: application,
+		Team:        team,
+		Selector:    selector,
+		LockId:      lockId,
+		Message:     message,
+		AuthorName:  user.Name,
+		AuthorEmail: user.Email,
+		ExpiresAt:   expiresAtString,
+	})
+}
+
+func (s *State) writeLockDeletedEvent(ctx context.Context, transaction *sql.Tx, environment, application, team, selector, lockId string) error {
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return s.writeLockEvent(ctx, transaction, environment, &event.LockDeleted{
+		Environment: environment,
+		Application: application,
+		Team:        team,
+		Selector:    selector,
+		LockId:      lockId,
+		AuthorName:  user.Name,
+		AuthorEmail: user.Email,
+	})
+}
+
+func (s *State) writeLockEvent(ctx context.Context, transaction *sql.Tx, environment string, ev event.Event) error {
+	// The id is derived from the time of the transformer, so that the history matches the created_at of the locks.
+	// Lock events are not related to any commit, so they don't use the uuid generator of the commit events.
+	eventUuid := timeuuid.UUIDFromTime(getTimeNow(ctx)).String()
+	if s.DBHandler.ShouldUseOtherTables() {
+		switch e := ev.(type) {
+		case *event.LockCreated:
+			return s.DBHandler.DBWriteLockCreatedEvent(ctx, transaction, eventUuid, e.AuthorEmail, e)
+		case *event.LockDeleted:
+			return s.DBHandler.DBWriteLockDeletedEvent(ctx, transaction, eventUuid, e.AuthorEmail, e)
+		default:
+			return fmt.Errorf("unexpected lock event type %T", ev)
+		}
+	}
+	eventDir := s.Filesystem.Join(lockHistoryDirectory(s, environment), eventUuid)
+	if err := event.Write(s.Filesystem, eventDir, ev); err != nil {
+		return fmt.Errorf("could not write lock event for environment %s with uuid %s, error: %w", environment, eventUuid, err)
+	}
+	return nil
+}
+
+// GetLockHistory returns all lock created and lock deleted events of the environment between from and to, oldest first.
+// If application or team is set, only the events of the locks of this application or team are returned.
+func (s *State) GetLockHistory(ctx context.Context, transaction *sql.Tx, environment string, application, team *string, from, to time.Time) ([]*api.Event, error) {
+	result := []*api.Event{}
+	inRange := func(eventId timeuuid.UUID) bool {
+		createdAt := uuid.GetTime(&eventId).AsTime()
+		return !createdAt.Before(from) && !createdAt.After(to)
+	}
+
+	historyDir := lockHistoryDirectory(s, environment)
+	eventDirs, err := s.Filesystem.ReadDir(historyDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read lock history directory '%s': %w", historyDir, err)
+	}
+	for _, eventDir := range eventDirs {
+		if !eventDir.IsDir() {
+			continue
+		}
+		eventId, err := timeuuid.ParseUUID(eventDir.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not read lock event directory '%s' not a UUID: %w", s.Filesystem.Join(historyDir, eventDir.Name()), err)
+		}
+		if !inRange(eventId) {
+			continue
+		}
+		ev, err := event.Read(s.Filesystem, s.Filesystem.Join(historyDir, eventDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if lockEventMatches(ev, environment, application, team) {
+			result = append(result, event.ToProto(eventId, ev))
+		}
+	}
+
+	if s.DBHandler.ShouldUseOtherTables() {
+		rows, err := s.DBHandler.DBSelectLockEvents(ctx, transaction, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("could not read lock events from DB: %w", err)
+		}
+		for _, row := range rows {
+			ev, err := event.UnMarshallEvent(row.EventType, row.EventJson)
+			if err != nil {
+				return nil, fmt.Errorf("error processing lock event from DB: %w", err)
+			}
+			eventId, err := timeuuid.ParseUUID(row.Uuid)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse UUID: '%s'. Error: %w", row.Uuid, err)
+			}
+			if lockEventMatches(ev.EventData, environment, application, team) {
+				result = append(result, event.ToProto(eventId, ev.EventData))
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.AsTime().Before(result[j].CreatedAt.AsTime())
+	})
+	return result, nil
+}
+
+func lockEventMatches(ev event.Event, environment string, application, team *string) bool {
+	var evEnvironment, evApplication, evTeam string
+	switch e := ev.(type) {
+	case *event.LockCreated:
+		evEnvironment, evApplication, evTeam = e.Environment, e.Application, e.Team
+	case *event.LockDeleted:
+		evEnvironment, evApplication, evTeam = e.Environment, e.Application, e.Team
+	default:
+		return false
+	}
+	if evEnvironment != environment {
+		return false
+	}
+	if application != nil && evApplication != *application {
+		return false
+	}
+	if team != nil && evTeam != *team {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,198 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGetLockHistory(t *testing.T) {
+	createdAt := time.Unix(1000, 0).UTC()
+	deletedAt := time.Unix(2000, 0).UTC()
+	creator := &api.Actor{Name: "test tester", Email: "testmail@example.com"}
+	remover := &api.Actor{Name: "remover", Email: "remover@example.com"}
+
+	envLockCreated := &api.Event{
+		CreatedAt: timestamppb.New(createdAt),
+		EventType: &api.Event_LockCreatedEvent{LockCreatedEvent: &api.LockCreatedEvent{
+			Environment: "dev", LockId: "env-lock", Message: "env", CreatedBy: creator,
+		}},
+	}
+	appLockCreated := &api.Event{
+		CreatedAt: timestamppb.New(createdAt),
+		EventType: &api.Event_LockCreatedEvent{LockCreatedEvent: &api.LockCreatedEvent{
+			Environment: "dev", Application: "app", LockId: "app-lock", Message: "app", CreatedBy: creator,
+			ExpiresAt: timestamppb.New(createdAt.Add(time.Hour)),
+		}},
+	}
+	teamLockCreated := &api.Event{
+		CreatedAt: timestamppb.New(createdAt),
+		EventType: &api.Event_LockCreatedEvent{LockCreatedEvent: &api.LockCreatedEvent{
+			Environment: "dev", Team: "team", LockId: "team-lock", Message: "team", CreatedBy: creator,
+		}},
+	}
+	envLockDeleted := &api.Event{
+		CreatedAt: timestamppb.New(deletedAt),
+		EventType: &api.Event_LockDeletedEvent{LockDeletedEvent: &api.LockDeletedEvent{
+			Environment: "dev", LockId: "env-lock", DeletedBy: remover,
+		}},
+	}
+	appLockDeleted := &api.Event{
+		CreatedAt: timestamppb.New(deletedAt),
+		EventType: &api.Event_LockDeletedEvent{LockDeletedEvent: &api.LockDeletedEvent{
+			Environment: "dev", Application: "app", LockId: "app-lock", DeletedBy: remover,
+		}},
+	}
+
+	tcs := []struct {
+		Name           string
+		Application    *string
+		Team           *string
+		From           time.Time
+		To             time.Time
+		ExpectedEvents []*api.Event
+	}{
+		{
+			Name:           "whole history of the environment",
+			From:           time.Unix(0, 0),
+			To:             deletedAt,
+			ExpectedEvents: []*api.Event{envLockCreated, appLockCreated, teamLockCreated, envLockDeleted, appLockDeleted},
+		},
+		{
+			Name:           "history of an application",
+			Application:    ptr.FromString("app"),
+			From:           time.Unix(0, 0),
+			To:             deletedAt,
+			ExpectedEvents: []*api.Event{appLockCreated, appLockDeleted},
+		},
+		{
+			Name:           "history of a team",
+			Team:           ptr.FromString("team"),
+			From:           time.Unix(0, 0),
+			To:             deletedAt,
+			ExpectedEvents: []*api.Event{teamLockCreated},
+		},
+		{
+			Name:           "only deletions",
+			From:           createdAt.Add(time.Second),
+			To:             deletedAt,
+			ExpectedEvents: []*api.Event{envLockDeleted, appLockDeleted},
+		},
+		{
+			Name:           "nothing happened in the time range",
+			From:           time.Unix(0, 0),
+			To:             createdAt.Add(-time.Second),
+			ExpectedEvents: []*api.Event{},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			err := repo.Apply(WithTimeNow(testutil.MakeTestContext(), createdAt),
+				&CreateEnvironment{
+					Environment: "dev",
+				},
+				&CreateApplicationVersion{
+					Application: "app",
+					Manifests: map[string]string{
+						"dev": "dev",
+					},
+					Team: "team",
+				},
+				&CreateEnvironmentLock{Environment: "dev", LockId: "env-lock", Message: "env"},
+				&CreateEnvironmentApplicationLock{Environment: "dev", Application: "app", LockId: "app-lock", Message: "app", ExpiresAt: ptrTime(createdAt.Add(time.Hour))},
+				&CreateEnvironmentTeamLock{Environment: "dev", Team: "team", LockId: "team-lock", Message: "team"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			removerCtx := auth.WriteUserToContext(testutil.MakeTestContext(), auth.User{
+				Email:          remover.Email,
+				Name:           remover.Name,
+				DexAuthContext: nil,
+			})
+			err = repo.Apply(WithTimeNow(removerCtx, deletedAt),
+				&DeleteEnvironmentLock{Environment: "dev", LockId: "env-lock"},
+				&DeleteEnvironmentApplicationLock{Environment: "dev", Application: "app", LockId: "app-lock"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			events, err := repo.State().GetLockHistory(testutil.MakeTestContext(), nil, "dev", tc.Application, tc.Team, tc.From, tc.To)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedEvents, events, protocmp.Transform(), protocmp.IgnoreFields(&api.Event{}, "uuid")); diff != "" {
+				t.Errorf("lock history mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEnvironmentHistorySurvivesDeletion(t *testing.T) {
+	repo := setupRepositoryTest(t)
+	ctx := testutil.MakeTestContext()
+	err := repo.Apply(ctx,
+		&CreateEnvironment{
+			Environment: "dev",
+		},
+		&CreateEnvironmentLock{Environment: "dev", LockId: "env-lock", Message: "env"},
+		&UpdateEnvironmentConfig{
+			Environment: "dev",
+			Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+			Fields:      []string{"upstream"},
+		},
+		&DeleteEnvironment{Environment: "dev"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := repo.State()
+	envConfigs, err := state.GetEnvironmentConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := envConfigs["dev"]; ok {
+		t.Fatal("expected the environment to be deleted")
+	}
+	events, err := state.GetLockHistory(ctx, nil, "dev", nil, nil, time.Unix(0, 0), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].GetLockCreatedEvent().GetLockId() != "env-lock" {
+		t.Errorf("expected the lock history to be kept, got %v", events)
+	}
+	configEvents, err := state.Filesystem.ReadDir(environmentConfigHistoryDirectory(state, "dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configEvents) != 1 {
+		t.Errorf("expected the config history to be kept, got %d events", len(configEvents))
+	}
+}
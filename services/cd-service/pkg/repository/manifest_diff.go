@@ -0,0 +1,99 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ManifestDiff is a unified diff between the manifests of two releases.
+// The manifests are canonicalized first, so that formatting changes are not part of the diff.
+type ManifestDiff struct {
+	FromVersion uint64
+	ToVersion   uint64
+	Diff        string
+}
+
+// GetReleaseManifestDiff compares the manifests of two releases of an application for one environment.
+func (s *State) GetReleaseManifestDiff(application, environment string, fromVersion, toVersion uint64) (*ManifestDiff, error) {
+	return s.diffManifests(application, environment, fromVersion, environment, toVersion)
+}
+
+// GetEnvironmentManifestDiff compares the manifests that are deployed on two environments.
+// If the application is not deployed on an environment, the version is 0 and the manifest is empty.
+func (s *State) GetEnvironmentManifestDiff(ctx context.Context, transaction *sql.Tx, application, fromEnvironment, toEnvironment string) (*ManifestDiff, error) {
+	fromVersion, err := s.GetEnvironmentApplicationVersion(ctx, fromEnvironment, application, transaction)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := s.GetEnvironmentApplicationVersion(ctx, toEnvironment, application, transaction)
+	if err != nil {
+		return nil, err
+	}
+	var from, to uint64
+	if fromVersion != nil {
+		from = *fromVersion
+	}
+	if toVersion != nil {
+		to = *toVersion
+	}
+	return s.diffManifests(application, fromEnvironment, from, toEnvironment, to)
+}
+
+func (s *State) diffManifests(application, fromEnvironment string, fromVersion uint64, toEnvironment string, toVersion uint64) (*ManifestDiff, error) {
+	from, err := s.readCanonicalManifest(application, fromEnvironment, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.readCanonicalManifest(application, toEnvironment, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestDiff{
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Diff: unifiedDiff(
+			fmt.Sprintf("%s/%d/manifests.yaml", fromEnvironment, fromVersion),
+			fmt.Sprintf("%s/%d/manifests.yaml", toEnvironment, toVersion),
+			from,
+			to,
+		),
+	}, nil
+}
+
+// readCanonicalManifest returns an empty manifest for version 0 or if the release has no manifest for the environment.
+func (s *State) readCanonicalManifest(application, environment string, version uint64) (string, error) {
+	if version == 0 {
+		return "", nil
+	}
+	manifests, err := s.GetApplicationReleaseManifests(application, version)
+	if err != nil {
+		return "", err
+	}
+	manifest, ok := manifests[environment]
+	if !ok || manifest.Content == "" {
+		return "", nil
+	}
+	canonical := canonicalizeYaml(manifest.Content)
+	if canonical == yamlParsingError {
+		// invalid yaml can still be compared as text
+		return manifest.Content, nil
+	}
+	return canonical, nil
+}
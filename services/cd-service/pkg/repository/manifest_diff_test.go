@@ -0,0 +1,111 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"testing"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetManifestDiff(t *testing.T) {
+	repo := setupRepositoryTest(t)
+	ctx := testutil.MakeTestContext()
+	err := repo.Apply(ctx,
+		&CreateEnvironment{
+			Environment: envAcceptance,
+			Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+		},
+		&CreateEnvironment{
+			Environment: envProduction,
+			Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance}},
+		},
+		&CreateApplicationVersion{
+			Version:     1,
+			Application: "test",
+			Manifests: map[string]string{
+				envAcceptance: "replicas: 1\n",
+				envProduction: "replicas: 1\n",
+			},
+		},
+		&DeployApplicationVersion{
+			Environment:   envProduction,
+			Application:   "test",
+			Version:       1,
+			LockBehaviour: api.LockBehavior_FAIL,
+		},
+		&CreateApplicationVersion{
+			Version:     2,
+			Application: "test",
+			Manifests: map[string]string{
+				// formatting changes are not part of the diff
+				envAcceptance: "replicas:   2\n",
+				envProduction: "replicas:   1\n",
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := repo.State()
+
+	t.Run("releases", func(t *testing.T) {
+		actual, err := state.GetReleaseManifestDiff("test", envAcceptance, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &ManifestDiff{
+			FromVersion: 1,
+			ToVersion:   2,
+			Diff:        "--- acceptance/1/manifests.yaml\n+++ acceptance/2/manifests.yaml\n@@ -1 +1 @@\n-replicas: 1\n+replicas: 2\n",
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("diff mismatch (-want, +got):\n%s", diff)
+		}
+	})
+	t.Run("releases without changes", func(t *testing.T) {
+		actual, err := state.GetReleaseManifestDiff("test", envProduction, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &ManifestDiff{
+			FromVersion: 1,
+			ToVersion:   2,
+			Diff:        "",
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("diff mismatch (-want, +got):\n%s", diff)
+		}
+	})
+	t.Run("environments", func(t *testing.T) {
+		actual, err := state.GetEnvironmentManifestDiff(ctx, nil, "test", envProduction, envAcceptance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &ManifestDiff{
+			FromVersion: 1,
+			ToVersion:   2,
+			Diff:        "--- production/1/manifests.yaml\n+++ acceptance/2/manifests.yaml\n@@ -1 +1 @@\n-replicas: 1\n+replicas: 2\n",
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("diff mismatch (-want, +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/config"
+)
+
+// ValidatePromotion returns an error if the promotion policy of the environment config is invalid.
+// Versions are promoted from the upstream environment, so the environment must have one.
+func ValidatePromotion(envConfig config.EnvironmentConfig) error {
+	if envConfig.Promotion == nil {
+		return nil
+	}
+	if envConfig.Upstream == nil || envConfig.Upstream.Environment == "" {
+		return fmt.Errorf("promotion requires an upstream environment")
+	}
+	soakTime, err := time.ParseDuration(envConfig.Promotion.SoakTime)
+	if err != nil {
+		return fmt.Errorf("invalid promotion soak time %q: %w", envConfig.Promotion.SoakTime, err)
+	}
+	if soakTime < 0 {
+		return fmt.Errorf("invalid promotion soak time %q: must not be negative", envConfig.Promotion.SoakTime)
+	}
+	return nil
+}
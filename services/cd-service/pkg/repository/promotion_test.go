@@ -0,0 +1,101 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"testing"
+
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidatePromotion(t *testing.T) {
+	upstream := &config.EnvironmentConfigUpstream{
+		Environment: "staging",
+		Latest:      false,
+	}
+	tcs := []struct {
+		Name          string
+		Upstream      *config.EnvironmentConfigUpstream
+		Promotion     *config.EnvironmentConfigPromotion
+		ExpectedError string
+	}{
+		{
+			Name:      "no policy",
+			Upstream:  nil,
+			Promotion: nil,
+		},
+		{
+			Name:     "valid policy",
+			Upstream: upstream,
+			Promotion: &config.EnvironmentConfigPromotion{
+				SoakTime: "2h",
+			},
+		},
+		{
+			Name:     "zero soak time",
+			Upstream: upstream,
+			Promotion: &config.EnvironmentConfigPromotion{
+				SoakTime: "0s",
+			},
+		},
+		{
+			Name: "latest upstream",
+			Upstream: &config.EnvironmentConfigUpstream{
+				Environment: "",
+				Latest:      true,
+			},
+			Promotion: &config.EnvironmentConfigPromotion{
+				SoakTime: "2h",
+			},
+			ExpectedError: "promotion requires an upstream environment",
+		},
+		{
+			Name:     "invalid soak time",
+			Upstream: upstream,
+			Promotion: &config.EnvironmentConfigPromotion{
+				SoakTime: "later",
+			},
+			ExpectedError: "invalid promotion soak time \"later\": time: invalid duration \"later\"",
+		},
+		{
+			Name:     "negative soak time",
+			Upstream: upstream,
+			Promotion: &config.EnvironmentConfigPromotion{
+				SoakTime: "-1h",
+			},
+			ExpectedError: "invalid promotion soak time \"-1h\": must not be negative",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			//exhaustruct:ignore
+			err := ValidatePromotion(config.EnvironmentConfig{
+				Upstream:  tc.Upstream,
+				Promotion: tc.Promotion,
+			})
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if diff := cmp.Diff(tc.ExpectedError, actual); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -41,6 +41,17 @@ type transformerBatch struct {
 	ctx          context.Context
 	transformers []Transformer
 	result       chan error
+	// optional, only set for batches that are applied asynchronously
+	progress BatchProgress
+}
+
+// BatchProgress is notified when a batch in the queue makes progress.
+// Whether the batch failed is still reported on the result channel.
+type BatchProgress interface {
+	// Applying is called when the transformers of the batch are applied
+	Applying()
+	// Pushed is called with the id of the pushed commit that contains the batch
+	Pushed(commitId string)
 }
 
 func (t *transformerBatch) finish(err error) {
@@ -51,12 +62,13 @@ func (t *transformerBatch) finish(err error) {
 	}
 }
 
-func (q *queue) add(ctx context.Context, transformers []Transformer) <-chan error {
+func (q *queue) add(ctx context.Context, progress BatchProgress, transformers []Transformer) <-chan error {
 	resultChannel := make(chan error, 1)
 	e := transformerBatch{
 		ctx:          ctx,
 		transformers: transformers,
 		result:       resultChannel,
+		progress:     progress,
 	}
 
 	defer q.GaugeQueueSize(ctx)
@@ -54,6 +54,7 @@ import (
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/cloudrun"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/fs"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/notify"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/schema"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/sqlitestore"
 	"go.uber.org/zap"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -71,8 +72,10 @@ const DdMetricsKey contextKey = "ddMetrics"
 // A Repository provides a multiple reader / single writer access to a git repository.
 type Repository interface {
 	Apply(ctx context.Context, transformers ...Transformer) error
+	ApplyAsync(ctx context.Context, progress BatchProgress, transformers ...Transformer) <-chan error
 	Push(ctx context.Context, pushAction func() error) error
 	ApplyTransformersInternal(ctx context.Context, transaction *sql.Tx, transformers ...Transformer) ([]string, *State, []*TransformerResult, *TransformerBatchApplyError)
+	ApplyTransformersDryRun(ctx context.Context, transaction *sql.Tx, transformers ...Transformer) ([]string, []*TransformerResult, *TransformerBatchApplyError)
 	State() *State
 	StateAt(oid *git.Oid) (*State, error)
 	Notify() *notify.Notify
@@ -217,6 +220,8 @@ type RepositoryConfig struct {
 
 	DBHandler      *db.DBHandler
 	CloudRunClient *cloudrun.CloudRunClient
+	// if set, the manifests of new releases are validated against kubernetes schemas
+	ManifestValidator *schema.Validator
 }
 
 func openOrCreate(path string, storageBackend StorageBackend) (*git.Repository, error) {
@@ -521,6 +526,9 @@ func (r *repository) applyTransformerBatches(transformerBatches []transformerBat
 	var changes = &TransformerResult{}
 	for i := 0; i < len(transformerBatches); {
 		e := transformerBatches[i]
+		if e.progress != nil {
+			e.progress.Applying()
+		}
 		subChanges, applyErr := r.ApplyTransformers(e.ctx, transaction, e.transformers...)
 		changes.Combine(subChanges)
 		if applyErr != nil {
@@ -631,6 +639,15 @@ func DefaultPushActionCallback(pushOptions git.PushOptions, r *repository) PushA
 
 type PushUpdateFunc func(string, *bool) git.PushUpdateReferenceCallback
 
+func hasProgress(transformerBatches []transformerBatch) bool {
+	for _, el := range transformerBatches {
+		if el.progress != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *repository) ProcessQueueOnce(ctx context.Context, e transformerBatch, callback PushUpdateFunc, pushAction PushActionCallbackFunc) {
 	logger := logger.FromContext(ctx)
 
@@ -659,7 +676,17 @@ func (r *repository) ProcessQueueOnce(ctx context.Context, e transformerBatch, c
 
 	transformerBatches := []transformerBatch{e}
 	defer func() {
+		pushedCommitId := ""
+		if err == nil && hasProgress(transformerBatches) {
+			// only asynchronous batches need the commit id, so the state is not read for the others
+			if state, stateErr := r.StateAt(nil); stateErr == nil && state.Commit != nil {
+				pushedCommitId = state.Commit.Id().String()
+			}
+		}
 		for _, el := range transformerBatches {
+			if err == nil && el.progress != nil {
+				el.progress.Pushed(pushedCommitId)
+			}
 			el.finish(err)
 		}
 	}()
@@ -798,6 +825,12 @@ func (r *repository) sendWebhookToArgoCd(ctx context.Context, logger *zap.Logger
 		modified = append(modified, manifestFilename)
 		logger.Info(fmt.Sprintf("ArgoWebhookUrl: adding modified: %s", manifestFilename))
 	}
+	for i := range changes.UpdatedRootApps {
+		change := changes.UpdatedRootApps[i]
+		rootAppFilename := fmt.Sprintf("argocd/%s/%s.yaml", "v1alpha1", change.Env)
+		modified = append(modified, rootAppFilename)
+		logger.Info(fmt.Sprintf("ArgoWebhookUrl: adding modified: %s", rootAppFilename))
+	}
 	var deleted = []string{}
 	for i := range changes.DeletedRootApps {
 		change := changes.DeletedRootApps[i]
@@ -994,38 +1027,58 @@ func (r *repository) ApplyTransformersInternal(ctx context.Context, transaction
 	if state, err := r.StateAt(nil); err != nil {
 		return nil, nil, nil, &TransformerBatchApplyError{TransformerError: fmt.Errorf("%s: %w", "failure in StateAt", err), Index: -1}
 	} else {
-		var changes []*TransformerResult = nil
-		commitMsg := []string{}
-		ctxWithTime := WithTimeNow(ctx, time.Now())
-		for i, t := range transformers {
-			if r.DB != nil && transaction == nil {
-				applyErr := TransformerBatchApplyError{
-					TransformerError: errors.New("no transaction provided, but DB enabled"),
-					Index:            i,
-				}
-				return nil, nil, nil, &applyErr
+		commitMsg, changes, applyErr := r.applyTransformersToState(ctx, transaction, state, transformers...)
+		if applyErr != nil {
+			return nil, nil, nil, applyErr
+		}
+		return commitMsg, state, changes, nil
+	}
+}
+
+// ApplyTransformersDryRun applies the transformers like ApplyTransformersInternal, but to a state without
+// the clients that change anything outside of the manifest repository and the database, e.g. nothing is deployed to Cloud Run.
+// The caller must roll back the transaction.
+func (r *repository) ApplyTransformersDryRun(ctx context.Context, transaction *sql.Tx, transformers ...Transformer) ([]string, []*TransformerResult, *TransformerBatchApplyError) {
+	state, err := r.StateAt(nil)
+	if err != nil {
+		return nil, nil, &TransformerBatchApplyError{TransformerError: fmt.Errorf("%s: %w", "failure in StateAt", err), Index: -1}
+	}
+	state.CloudRunClient = nil
+	return r.applyTransformersToState(ctx, transaction, state, transformers...)
+}
+
+func (r *repository) applyTransformersToState(ctx context.Context, transaction *sql.Tx, state *State, transformers ...Transformer) ([]string, []*TransformerResult, *TransformerBatchApplyError) {
+	var changes []*TransformerResult = nil
+	commitMsg := []string{}
+	ctxWithTime := WithTimeNow(ctx, time.Now())
+	for i, t := range transformers {
+		if r.DB != nil && transaction == nil {
+			applyErr := TransformerBatchApplyError{
+				TransformerError: errors.New("no transaction provided, but DB enabled"),
+				Index:            i,
 			}
-			logger.FromContext(ctx).Info("writing esl event...")
-			err = r.DB.DBWriteEslEventInternal(ctx, t.GetDBEventType(), transaction, t)
-			if err != nil {
-				return nil, nil, nil, &TransformerBatchApplyError{
-					TransformerError: err,
-					Index:            i,
-				}
+			return nil, nil, &applyErr
+		}
+		logger.FromContext(ctx).Info("writing esl event...")
+		err := r.DB.DBWriteEslEventInternal(ctx, t.GetDBEventType(), transaction, t)
+		if err != nil {
+			return nil, nil, &TransformerBatchApplyError{
+				TransformerError: err,
+				Index:            i,
 			}
-			if msg, subChanges, err := RunTransformer(ctxWithTime, t, state, transaction); err != nil {
-				applyErr := TransformerBatchApplyError{
-					TransformerError: err,
-					Index:            i,
-				}
-				return nil, nil, nil, &applyErr
-			} else {
-				commitMsg = append(commitMsg, msg)
-				changes = append(changes, subChanges)
+		}
+		if msg, subChanges, err := RunTransformer(ctxWithTime, t, state, transaction); err != nil {
+			applyErr := TransformerBatchApplyError{
+				TransformerError: err,
+				Index:            i,
 			}
+			return nil, nil, &applyErr
+		} else {
+			commitMsg = append(commitMsg, msg)
+			changes = append(changes, subChanges)
 		}
-		return commitMsg, state, changes, nil
 	}
+	return commitMsg, changes, nil
 }
 
 type AppEnv struct {
@@ -1042,6 +1095,8 @@ type RootApp struct {
 type TransformerResult struct {
 	ChangedApps     []AppEnv
 	DeletedRootApps []RootApp
+	// Root apps that are rendered with a changed argocd config of their environment.
+	UpdatedRootApps []RootApp
 	Commits         *CommitIds
 }
 
@@ -1076,6 +1131,7 @@ func (r *TransformerResult) Combine(other *TransformerResult) {
 		a := other.DeletedRootApps[i]
 		r.AddRootApp(a.Env)
 	}
+	r.UpdatedRootApps = append(r.UpdatedRootApps, other.UpdatedRootApps...)
 	if r.Commits == nil {
 		r.Commits = other.Commits
 	}
@@ -1235,7 +1291,13 @@ func (r *repository) Apply(ctx context.Context, transformers ...Transformer) err
 }
 
 func (r *repository) applyDeferred(ctx context.Context, transformers ...Transformer) <-chan error {
-	return r.queue.add(ctx, transformers)
+	return r.queue.add(ctx, nil, transformers)
+}
+
+// ApplyAsync adds the transformers to the queue and returns immediately.
+// The batch is not canceled when ctx is done, so the caller can return before the batch is pushed.
+func (r *repository) ApplyAsync(ctx context.Context, progress BatchProgress, transformers ...Transformer) <-chan error {
+	return r.queue.add(context.WithoutCancel(ctx), progress, transformers)
 }
 
 // Push returns an 'error' for typing reasons, really it is always a git.GitError
@@ -1366,6 +1428,7 @@ func (r *repository) StateAt(oid *git.Oid) (*State, error) {
 						ReleaseVersionsLimit:   r.config.ReleaseVersionsLimit,
 						DBHandler:              r.DB,
 						CloudRunClient:         r.config.CloudRunClient,
+						ManifestValidator:      r.config.ManifestValidator,
 					}, nil
 				}
 			}
@@ -1391,6 +1454,7 @@ func (r *repository) StateAt(oid *git.Oid) (*State, error) {
 		ReleaseVersionsLimit:   r.config.ReleaseVersionsLimit,
 		DBHandler:              r.DB,
 		CloudRunClient:         r.config.CloudRunClient,
+		ManifestValidator:      r.config.ManifestValidator,
 	}, nil
 }
 
@@ -1482,8 +1546,9 @@ type State struct {
 	EnvironmentConfigsPath string
 	ReleaseVersionsLimit   uint
 	// DbHandler will be nil if the DB is disabled
-	DBHandler      *db.DBHandler
-	CloudRunClient *cloudrun.CloudRunClient
+	DBHandler         *db.DBHandler
+	CloudRunClient    *cloudrun.CloudRunClient
+	ManifestValidator *schema.Validator
 }
 
 func (s *State) Releases(application string) ([]uint64, error) {
@@ -1528,6 +1593,13 @@ type Lock struct {
 	Message   string
 	CreatedBy Actor
 	CreatedAt time.Time
+	// ExpiresAt is nil for locks that never expire
+	ExpiresAt *time.Time
+}
+
+// IsExpired returns true if the lock has an expiry date that is not after the given time
+func (l *Lock) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(now)
 }
 
 func readLock(fs billy.Filesystem, lockDir string) (*Lock, error) {
@@ -1538,6 +1610,7 @@ func readLock(fs billy.Filesystem, lockDir string) (*Lock, error) {
 			Email: "",
 		},
 		CreatedAt: time.Time{},
+		ExpiresAt: nil,
 	}
 
 	if cnt, err := readFile(fs, fs.Join(lockDir, "message")); err != nil {
@@ -1576,6 +1649,18 @@ func readLock(fs billy.Filesystem, lockDir string) (*Lock, error) {
 		}
 	}
 
+	if cnt, err := readFile(fs, fs.Join(lockDir, fieldExpiresAt)); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		if expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(cnt))); err != nil {
+			return nil, err
+		} else {
+			lock.ExpiresAt = &expiresAt
+		}
+	}
+
 	return lock, nil
 }
 
@@ -1651,20 +1736,49 @@ func (s *State) GetEnvironmentTeamLocks(environment, team string) (map[string]Lo
 		return result, nil
 	}
 }
-func (s *State) GetDeploymentMetaData(ctx context.Context, environment, application string) (string, time.Time, error) {
+
+// DeploymentMetaData describes the current deployment of an application on an environment.
+type DeploymentMetaData struct {
+	DeployAuthor string
+	// Zero if unknown.
+	DeployTime time.Time
+	// Set if the deployment was a rollback, the version that was rolled back.
+	RolledBackVersion *uint64
+}
+
+func (s *State) GetDeploymentMetaData(ctx context.Context, environment, application string) (DeploymentMetaData, error) {
 	if s.DBHandler.ShouldUseOtherTables() {
 		result, err := db.WithTransactionT(s.DBHandler, ctx, func(ctx context.Context, transaction *sql.Tx) (*db.Deployment, error) {
 			return s.DBHandler.DBSelectDeployment(ctx, transaction, application, environment)
 		})
-		if err != nil {
-			return "", time.Time{}, err
+		//exhaustruct:ignore
+		metaData := DeploymentMetaData{}
+		if err != nil || result == nil {
+			return metaData, err
 		}
-		if result != nil {
-			return result.Metadata.DeployedByEmail, result.Created, nil
+		metaData.DeployAuthor = result.Metadata.DeployedByEmail
+		metaData.DeployTime = result.Created
+		if result.Metadata.RolledBackVersion != nil {
+			rolledBackVersion := uint64(*result.Metadata.RolledBackVersion)
+			metaData.RolledBackVersion = &rolledBackVersion
 		}
-		return "", time.Time{}, err
+		return metaData, nil
+	}
+	author, deployedAt, err := s.GetDeploymentMetaDataFromRepo(environment, application)
+	if err != nil {
+		//exhaustruct:ignore
+		return DeploymentMetaData{}, err
+	}
+	rolledBackVersion, err := s.getDeploymentRolledBackVersionFromRepo(environment, application)
+	if err != nil {
+		//exhaustruct:ignore
+		return DeploymentMetaData{}, err
 	}
-	return s.GetDeploymentMetaDataFromRepo(environment, application)
+	return DeploymentMetaData{
+		DeployAuthor:      author,
+		DeployTime:        deployedAt,
+		RolledBackVersion: rolledBackVersion,
+	}, nil
 }
 
 func (s *State) GetDeploymentMetaDataFromRepo(environment, application string) (string, time.Time, error) {
@@ -1836,14 +1950,8 @@ func (s *State) GetEnvironmentConfigsAndValidate(ctx context.Context) (map[strin
 	if len(envConfigs) == 0 {
 		logger.Warn("No environment configurations found. Check git settings like the branch name. Kuberpult cannot operate without environments.")
 	}
-	for envName, env := range envConfigs {
-		if env.Upstream == nil || env.Upstream.Environment == "" {
-			continue
-		}
-		upstreamEnv := env.Upstream.Environment
-		if !envExists(envConfigs, upstreamEnv) {
-			logger.Warn(fmt.Sprintf("The environment '%s' has upstream '%s' configured, but the environment '%s' does not exist.", envName, upstreamEnv, upstreamEnv))
-		}
+	for _, problem := range mapper.ValidateEnvironmentConfigs(envConfigs) {
+		logger.Warn(fmt.Sprintf("Invalid environment configuration: %s", problem.Message))
 	}
 	envGroups := mapper.MapEnvironmentsToGroups(envConfigs)
 	for _, group := range envGroups {
@@ -2027,6 +2135,12 @@ type Release struct {
 	SourceMessage   string
 	CreatedAt       time.Time
 	DisplayVersion  string
+	// arbitrary metadata provided by the CI, e.g. the build url
+	Labels map[string]string
+	// pinned releases are never deleted by the cleanup of old releases
+	Pinned bool
+	// other applications that must be deployed before this release can be deployed to an environment
+	Dependencies []ReleaseDependency
 }
 
 func (rel *Release) ToProto() *api.Release {
@@ -2042,6 +2156,9 @@ func (rel *Release) ToProto() *api.Release {
 		UndeployVersion: rel.UndeployVersion,
 		CreatedAt:       timestamppb.New(rel.CreatedAt),
 		DisplayVersion:  rel.DisplayVersion,
+		Labels:          rel.Labels,
+		Pinned:          rel.Pinned,
+		Dependencies:    ReleaseDependenciesToProto(rel.Dependencies),
 	}
 }
 
@@ -2071,6 +2188,17 @@ func (s *State) IsUndeployVersion(application string, version uint64) (bool, err
 	return true, nil
 }
 
+func (s *State) IsPinnedVersion(application string, version uint64) (bool, error) {
+	base := releasesDirectoryWithVersion(s.Filesystem, application, version)
+	if _, err := readFile(s.Filesystem, s.Filesystem.Join(base, "pinned")); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
 func (s *State) GetApplicationRelease(application string, version uint64) (*Release, error) {
 	base := releasesDirectoryWithVersion(s.Filesystem, application, version)
 	_, err := s.Filesystem.Stat(base)
@@ -2085,6 +2213,9 @@ func (s *State) GetApplicationRelease(application string, version uint64) (*Rele
 		SourceMessage:   "",
 		CreatedAt:       time.Time{},
 		DisplayVersion:  "",
+		Labels:          nil,
+		Pinned:          false,
+		Dependencies:    nil,
 	}
 	if cnt, err := readFile(s.Filesystem, s.Filesystem.Join(base, "source_commit_id")); err != nil {
 		if !os.IsNotExist(err) {
@@ -2120,6 +2251,11 @@ func (s *State) GetApplicationRelease(application string, version uint64) (*Rele
 		return nil, err
 	}
 	release.UndeployVersion = isUndeploy
+	isPinned, err := s.IsPinnedVersion(application, version)
+	if err != nil {
+		return nil, err
+	}
+	release.Pinned = isPinned
 	if cnt, err := readFile(s.Filesystem, s.Filesystem.Join(base, "created_at")); err != nil {
 		if !os.IsNotExist(err) {
 			return nil, err
@@ -2131,6 +2267,20 @@ func (s *State) GetApplicationRelease(application string, version uint64) (*Rele
 			release.CreatedAt = releaseTime
 		}
 	}
+	if cnt, err := readFile(s.Filesystem, s.Filesystem.Join(base, "labels")); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		if err := json.Unmarshal(cnt, &release.Labels); err != nil {
+			return nil, fmt.Errorf("could not parse labels of release %d of application %q: %w", version, application, err)
+		}
+	}
+	dependencies, err := s.GetApplicationReleaseDependencies(application, version)
+	if err != nil {
+		return nil, err
+	}
+	release.Dependencies = dependencies
 	return &release, nil
 }
 
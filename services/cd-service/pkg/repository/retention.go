@@ -0,0 +1,177 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+)
+
+const fieldRetentionPolicy = "retention_policy"
+
+// RetentionPolicy overrides the cleanup of old releases for one application.
+// Deployed and pinned releases are never deleted.
+type RetentionPolicy struct {
+	// Number of releases to keep up to and including the oldest deployed release. Overrides the global ReleaseVersionsLimit.
+	MaxCount *uint `json:"maxCount,omitempty"`
+	// Releases older than this duration (e.g. "720h") are deleted, even if they are within MaxCount.
+	MaxAge string `json:"maxAge,omitempty"`
+	// The newest releases of every environment that are always kept, even if they are beyond MaxCount or MaxAge.
+	KeepPerEnvironment uint `json:"keepPerEnvironment,omitempty"`
+}
+
+func ValidateRetentionPolicy(policy RetentionPolicy) error {
+	if policy.MaxCount != nil && *policy.MaxCount == 0 {
+		return fmt.Errorf("invalid retention policy: maxCount must be at least 1")
+	}
+	if policy.MaxAge != "" {
+		maxAge, err := time.ParseDuration(policy.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid retention policy: maxAge %q: %w", policy.MaxAge, err)
+		}
+		if maxAge <= 0 {
+			return fmt.Errorf("invalid retention policy: maxAge %q must be positive", policy.MaxAge)
+		}
+	}
+	return nil
+}
+
+// GetApplicationRetentionPolicy returns nil if the application has no retention policy.
+func (s *State) GetApplicationRetentionPolicy(application string) (*RetentionPolicy, error) {
+	file := s.Filesystem.Join(applicationDirectory(s.Filesystem, application), fieldRetentionPolicy)
+	//exhaustruct:ignore
+	policy := RetentionPolicy{}
+	if err := decodeJsonFile(s.Filesystem, file, &policy); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read retention policy of application %q: %w", application, err)
+	}
+	return &policy, nil
+}
+
+// GetApplicationVersionsToCleanup returns the releases that will be deleted by the next cleanup.
+func (s *State) GetApplicationVersionsToCleanup(ctx context.Context, transaction *sql.Tx, application string) ([]uint64, error) {
+	return findOldApplicationVersions(WithTimeNow(ctx, time.Now()), transaction, s, application)
+}
+
+// apply returns the releases that should be deleted.
+// candidates are the releases beyond MaxCount, kept are the other releases that are older than the oldest deployed release.
+func (p *RetentionPolicy) apply(ctx context.Context, state *State, application string, envConfigs map[string]config.EnvironmentConfig, candidates, kept []uint64) ([]uint64, error) {
+	result := append([]uint64{}, candidates...)
+	if p.MaxAge != "" {
+		maxAge, err := time.ParseDuration(p.MaxAge)
+		if err != nil {
+			return nil, err
+		}
+		now := getTimeNow(ctx)
+		for _, version := range kept {
+			release, err := state.GetApplicationRelease(application, version)
+			if err != nil {
+				return nil, err
+			}
+			// releases without a creation date are kept, because their age is unknown
+			if !release.CreatedAt.IsZero() && now.Sub(release.CreatedAt) > maxAge {
+				result = append(result, version)
+			}
+		}
+	}
+	if p.KeepPerEnvironment == 0 || len(result) == 0 {
+		return result, nil
+	}
+	keep, err := state.newestVersionsPerEnvironment(application, envConfigs, p.KeepPerEnvironment)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []uint64{}
+	for _, version := range result {
+		if !keep[version] {
+			filtered = append(filtered, version)
+		}
+	}
+	return filtered, nil
+}
+
+// newestVersionsPerEnvironment returns the newest n releases that have a manifest for each environment.
+func (s *State) newestVersionsPerEnvironment(application string, envConfigs map[string]config.EnvironmentConfig, n uint) (map[uint64]bool, error) {
+	versions, err := s.GetApplicationReleases(application)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+	result := map[uint64]bool{}
+	for env := range envConfigs {
+		var count uint = 0
+		for _, version := range versions {
+			if count >= n {
+				break
+			}
+			envDir := s.Filesystem.Join(releasesDirectoryWithVersion(s.Filesystem, application, version), "environments", env)
+			if _, err := s.Filesystem.Stat(envDir); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+			result[version] = true
+			count++
+		}
+	}
+	return result, nil
+}
+
+func RetentionPolicyFromProto(policy *api.RetentionPolicy) *RetentionPolicy {
+	if policy == nil {
+		return nil
+	}
+	result := &RetentionPolicy{
+		MaxCount:           nil,
+		MaxAge:             policy.MaxAge,
+		KeepPerEnvironment: uint(policy.KeepPerEnvironment),
+	}
+	if policy.MaxCount != nil {
+		maxCount := uint(*policy.MaxCount)
+		result.MaxCount = &maxCount
+	}
+	return result
+}
+
+func (p *RetentionPolicy) ToProto() *api.RetentionPolicy {
+	if p == nil {
+		return nil
+	}
+	result := &api.RetentionPolicy{
+		MaxCount:           nil,
+		MaxAge:             p.MaxAge,
+		KeepPerEnvironment: uint64(p.KeepPerEnvironment),
+	}
+	if p.MaxCount != nil {
+		maxCount := uint64(*p.MaxCount)
+		result.MaxCount = &maxCount
+	}
+	return result
+}
@@ -0,0 +1,156 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateRetentionPolicy(t *testing.T) {
+	var zero uint = 0
+	var three uint = 3
+	tcs := []struct {
+		Name          string
+		Policy        RetentionPolicy
+		ExpectedError string
+	}{
+		{
+			Name:          "valid policy",
+			Policy:        RetentionPolicy{MaxCount: &three, MaxAge: "720h", KeepPerEnvironment: 2},
+			ExpectedError: "",
+		},
+		{
+			Name:          "empty policy",
+			Policy:        RetentionPolicy{MaxCount: nil, MaxAge: "", KeepPerEnvironment: 0},
+			ExpectedError: "",
+		},
+		{
+			Name:          "max count must not be zero",
+			Policy:        RetentionPolicy{MaxCount: &zero, MaxAge: "", KeepPerEnvironment: 0},
+			ExpectedError: "invalid retention policy: maxCount must be at least 1",
+		},
+		{
+			Name:          "max age must be a duration",
+			Policy:        RetentionPolicy{MaxCount: nil, MaxAge: "30 days", KeepPerEnvironment: 0},
+			ExpectedError: "invalid retention policy: maxAge \"30 days\": time: unknown unit \" days\" in duration \"30 days\"",
+		},
+		{
+			Name:          "max age must be positive",
+			Policy:        RetentionPolicy{MaxCount: nil, MaxAge: "-1h", KeepPerEnvironment: 0},
+			ExpectedError: "invalid retention policy: maxAge \"-1h\" must be positive",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateRetentionPolicy(tc.Policy)
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if diff := cmp.Diff(tc.ExpectedError, actual); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetApplicationVersionsToCleanup(t *testing.T) {
+	var one uint = 1
+	tcs := []struct {
+		Name             string
+		Policy           *RetentionPolicy
+		ExpectedVersions []uint64
+	}{
+		{
+			Name:             "no policy uses the global limit",
+			Policy:           nil,
+			ExpectedVersions: nil,
+		},
+		{
+			Name:             "max count",
+			Policy:           &RetentionPolicy{MaxCount: &one, MaxAge: "", KeepPerEnvironment: 0},
+			ExpectedVersions: []uint64{1, 2, 3},
+		},
+		{
+			Name:             "max count keeps the newest releases per environment",
+			Policy:           &RetentionPolicy{MaxCount: &one, MaxAge: "", KeepPerEnvironment: 2},
+			ExpectedVersions: []uint64{1, 2},
+		},
+		{
+			Name:             "max age",
+			Policy:           &RetentionPolicy{MaxCount: nil, MaxAge: "1h", KeepPerEnvironment: 0},
+			ExpectedVersions: []uint64{1, 2, 3},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			// the releases are created a day ago
+			ctx := WithTimeNow(testutil.MakeTestContext(), time.Now().Add(-24*time.Hour))
+			transformers := []Transformer{
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config: config.EnvironmentConfig{
+						Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance, Latest: false},
+					},
+				},
+				&CreateEnvironment{
+					Environment: envAcceptance,
+					Config: config.EnvironmentConfig{
+						Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+					},
+				},
+			}
+			for v := 1; v <= 4; v++ {
+				transformers = append(transformers, &CreateApplicationVersion{
+					Application: "test",
+					Manifests: map[string]string{
+						envProduction: "productionmanifest",
+					},
+					WriteCommitData: true,
+				})
+			}
+			transformers = append(transformers, &DeployApplicationVersion{
+				Environment:   envProduction,
+				Application:   "test",
+				Version:       4,
+				LockBehaviour: api.LockBehavior_FAIL,
+			}, &SetApplicationRetentionPolicy{
+				Application: "test",
+				Policy:      tc.Policy,
+			})
+			if err := repo.Apply(ctx, transformers...); err != nil {
+				t.Fatal(err)
+			}
+			actual, err := repo.State().GetApplicationVersionsToCleanup(testutil.MakeTestContext(), nil, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedVersions, actual); diff != "" {
+				t.Errorf("versions mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
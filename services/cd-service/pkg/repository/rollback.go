@@ -0,0 +1,214 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/valid"
+	"github.com/onokonem/sillyQueueServer/timeuuid"
+)
+
+// Written next to the version symlink of a deployment that was a rollback, contains the version that was rolled back.
+const fieldRolledBackVersion = "rolled_back_version"
+
+// ValidateAutoRollback returns an error if the auto rollback policy of the environment config is invalid.
+func ValidateAutoRollback(envConfig config.EnvironmentConfig) error {
+	if envConfig.AutoRollback == nil {
+		return nil
+	}
+	duration, err := time.ParseDuration(envConfig.AutoRollback.UnhealthyDuration)
+	if err != nil {
+		return fmt.Errorf("invalid auto rollback unhealthy duration %q: %w", envConfig.AutoRollback.UnhealthyDuration, err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("invalid auto rollback unhealthy duration %q: must be positive", envConfig.AutoRollback.UnhealthyDuration)
+	}
+	return nil
+}
+
+// DeploymentHistoryEntry is one deployment of an application to an environment.
+type DeploymentHistoryEntry struct {
+	Version uint64
+	// Set if the deployment was a rollback, the version that was rolled back.
+	RolledBackVersion *uint64
+}
+
+// GetDeploymentHistory returns the deployments of the application to the environment, the latest deployment first.
+// A version shows up once for each time it was deployed.
+// Without the database, the history is read from the deployment events, so it only contains deployments with commit data.
+func (s *State) GetDeploymentHistory(ctx context.Context, transaction *sql.Tx, environment, application string) ([]DeploymentHistoryEntry, error) {
+	if s.DBHandler.ShouldUseOtherTables() {
+		deployments, err := s.DBHandler.DBSelectDeploymentHistory(ctx, transaction, application, environment)
+		if err != nil {
+			return nil, err
+		}
+		result := []DeploymentHistoryEntry{}
+		for _, deployment := range deployments {
+			if deployment.Version == nil {
+				continue
+			}
+			entry := DeploymentHistoryEntry{
+				Version:           uint64(*deployment.Version),
+				RolledBackVersion: nil,
+			}
+			if deployment.Metadata.RolledBackVersion != nil {
+				rolledBackVersion := uint64(*deployment.Metadata.RolledBackVersion)
+				entry.RolledBackVersion = &rolledBackVersion
+			}
+			result = append(result, entry)
+		}
+		return result, nil
+	}
+	return s.getDeploymentHistoryFromEvents(environment, application)
+}
+
+func (s *State) getDeploymentHistoryFromEvents(environment, application string) ([]DeploymentHistoryEntry, error) {
+	type deployment struct {
+		eventId timeuuid.UUID
+		entry   DeploymentHistoryEntry
+	}
+	fs := s.Filesystem
+	releases, err := s.GetApplicationReleases(application)
+	if err != nil {
+		return nil, err
+	}
+	deployments := []deployment{}
+	// several releases can share a commit, each event is only counted once
+	seen := map[string]bool{}
+	for _, version := range releases {
+		commitId, err := readFile(fs, fs.Join(releasesDirectoryWithVersion(fs, application, version), fieldSourceCommitId))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if !valid.SHA1CommitID(string(commitId)) {
+			// events are only written for valid commit ids
+			continue
+		}
+		eventsDir := fs.Join(commitDirectory(fs, string(commitId)), "events")
+		eventDirs, err := fs.ReadDir(eventsDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("could not read events directory '%s': %w", eventsDir, err)
+		}
+		for _, eventDir := range eventDirs {
+			if !eventDir.IsDir() || seen[eventDir.Name()] {
+				continue
+			}
+			seen[eventDir.Name()] = true
+			eventId, err := timeuuid.ParseUUID(eventDir.Name())
+			if err != nil {
+				return nil, fmt.Errorf("could not read event directory '%s' not a UUID: %w", fs.Join(eventsDir, eventDir.Name()), err)
+			}
+			ev, err := event.Read(fs, fs.Join(eventsDir, eventDir.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if d, ok := ev.(*event.Deployment); ok && d.Application == application && d.Environment == environment {
+				entry := DeploymentHistoryEntry{
+					Version:           version,
+					RolledBackVersion: nil,
+				}
+				if d.RolledBackVersion != nil {
+					rolledBackVersion, err := strconv.ParseUint(*d.RolledBackVersion, 10, 64)
+					if err != nil {
+						return nil, fmt.Errorf("invalid rolled back version in event '%s': %w", fs.Join(eventsDir, eventDir.Name()), err)
+					}
+					entry.RolledBackVersion = &rolledBackVersion
+				}
+				deployments = append(deployments, deployment{
+					eventId: eventId,
+					entry:   entry,
+				})
+			}
+		}
+	}
+	sort.SliceStable(deployments, func(i, j int) bool {
+		return deployments[i].eventId.Time().After(deployments[j].eventId.Time())
+	})
+	result := make([]DeploymentHistoryEntry, 0, len(deployments))
+	for _, d := range deployments {
+		result = append(result, d.entry)
+	}
+	return result, nil
+}
+
+// GetRollbackVersion returns the version that a rollback of the application on the environment deploys:
+// the version that was deployed before the current one, no matter if it is older or newer.
+// Versions that were rolled back are skipped, so that repeated rollbacks walk back the history instead of toggling between two versions.
+// Versions that can no longer be deployed are skipped as well.
+// Returns nil if there is no such version.
+func (s *State) GetRollbackVersion(ctx context.Context, transaction *sql.Tx, environment, application string, current uint64) (*uint64, error) {
+	history, err := s.GetDeploymentHistory(ctx, transaction, environment, application)
+	if err != nil {
+		return nil, err
+	}
+	skipped := map[uint64]bool{current: true}
+	for _, deployment := range history {
+		if deployment.RolledBackVersion != nil {
+			skipped[*deployment.RolledBackVersion] = true
+		}
+		version := deployment.Version
+		if skipped[version] {
+			continue
+		}
+		// the release might have been cleaned up or no longer be deployable to this environment
+		manifest := s.Filesystem.Join(manifestDirectoryWithReleasesVersion(s.Filesystem, application, version), environment, "manifests.yaml")
+		if _, err := s.Filesystem.Stat(manifest); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				skipped[version] = true
+				continue
+			}
+			return nil, err
+		}
+		if undeploy, err := s.IsUndeployVersion(application, version); err != nil {
+			return nil, err
+		} else if undeploy {
+			skipped[version] = true
+			continue
+		}
+		return &version, nil
+	}
+	return nil, nil
+}
+
+func (s *State) getDeploymentRolledBackVersionFromRepo(environment, application string) (*uint64, error) {
+	content, err := readFile(s.Filesystem, s.Filesystem.Join(environmentApplicationDirectory(s.Filesystem, environment, application), fieldRolledBackVersion))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	version, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rolled back version for app %s on env %s: %w", application, environment, err)
+	}
+	return &version, nil
+}
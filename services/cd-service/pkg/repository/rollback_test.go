@@ -0,0 +1,327 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/freiheit-com/kuberpult/pkg/uuid"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRollbackApplication(t *testing.T) {
+	deploy := func(version uint64) Transformer {
+		return &DeployApplicationVersion{
+			Environment:     envProduction,
+			Application:     "app",
+			Version:         version,
+			LockBehaviour:   api.LockBehavior_FAIL,
+			WriteCommitData: true,
+		}
+	}
+	rollback := &RollbackApplication{
+		Environment:     envProduction,
+		Application:     "app",
+		LockBehaviour:   api.LockBehavior_FAIL,
+		WriteCommitData: true,
+	}
+	tcs := []struct {
+		Name                      string
+		Deployments               []Transformer
+		Rollbacks                 []Transformer
+		ExpectedError             string
+		ExpectedVersion           *uint64
+		ExpectedRolledBackVersion *uint64
+	}{
+		{
+			Name:                      "rollback to the previous version",
+			Deployments:               []Transformer{deploy(1), deploy(2), deploy(3)},
+			Rollbacks:                 []Transformer{rollback},
+			ExpectedVersion:           ptr.Uint64(2),
+			ExpectedRolledBackVersion: ptr.Uint64(3),
+		},
+		{
+			Name:                      "repeated rollbacks walk back the history",
+			Deployments:               []Transformer{deploy(1), deploy(2), deploy(3)},
+			Rollbacks:                 []Transformer{rollback, rollback},
+			ExpectedVersion:           ptr.Uint64(1),
+			ExpectedRolledBackVersion: ptr.Uint64(2),
+		},
+		{
+			Name:                      "versions that were never deployed are skipped",
+			Deployments:               []Transformer{deploy(1), deploy(3)},
+			Rollbacks:                 []Transformer{rollback},
+			ExpectedVersion:           ptr.Uint64(1),
+			ExpectedRolledBackVersion: ptr.Uint64(3),
+		},
+		{
+			Name:                      "rollback to a newer version that was deployed before",
+			Deployments:               []Transformer{deploy(1), deploy(3), deploy(2)},
+			Rollbacks:                 []Transformer{rollback},
+			ExpectedVersion:           ptr.Uint64(3),
+			ExpectedRolledBackVersion: ptr.Uint64(2),
+		},
+		{
+			Name:                      "redeploying a rolled back version allows to roll it back again",
+			Deployments:               []Transformer{deploy(1), deploy(2), deploy(3)},
+			Rollbacks:                 []Transformer{rollback, deploy(3), rollback},
+			ExpectedVersion:           ptr.Uint64(2),
+			ExpectedRolledBackVersion: ptr.Uint64(3),
+		},
+		{
+			Name:                      "rollback after a rollback does not return to the rolled back version",
+			Deployments:               []Transformer{deploy(1), deploy(3), deploy(2)},
+			Rollbacks:                 []Transformer{rollback, rollback},
+			ExpectedVersion:           ptr.Uint64(1),
+			ExpectedRolledBackVersion: ptr.Uint64(3),
+		},
+		{
+			Name:                      "a deployment after a rollback is not a rollback",
+			Deployments:               []Transformer{deploy(1), deploy(2)},
+			Rollbacks:                 []Transformer{rollback, deploy(3)},
+			ExpectedVersion:           ptr.Uint64(3),
+			ExpectedRolledBackVersion: nil,
+		},
+		{
+			Name:          "no other version was deployed",
+			Deployments:   []Transformer{deploy(2), deploy(3)},
+			Rollbacks:     []Transformer{rollback, rollback},
+			ExpectedError: "error at index 1 of transformer batch: rpc error: code = InvalidArgument desc = error: cannot roll back app \"app\" on \"production\": no other version than 2 was deployed before",
+		},
+		{
+			Name:        "another version is deployed",
+			Deployments: []Transformer{deploy(1), deploy(2)},
+			Rollbacks: []Transformer{
+				&RollbackApplication{
+					Environment:     envProduction,
+					Application:     "app",
+					LockBehaviour:   api.LockBehavior_FAIL,
+					WriteCommitData: true,
+					Version:         ptr.Uint64(1),
+				},
+			},
+			ExpectedError: "error at index 0 of transformer batch: rpc error: code = InvalidArgument desc = error: cannot roll back version 1 of app \"app\" on \"production\": version 2 is deployed",
+		},
+		{
+			Name:          "nothing is deployed",
+			Deployments:   []Transformer{},
+			Rollbacks:     []Transformer{rollback},
+			ExpectedError: "error at index 0 of transformer batch: rpc error: code = InvalidArgument desc = error: cannot roll back app \"app\" on \"production\": no version is deployed",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			setup := []Transformer{
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      testutil.MakeEnvConfigUpstream(envAcceptance, nil),
+				},
+			}
+			for version := uint64(1); version <= 3; version++ {
+				setup = append(setup, &CreateApplicationVersion{
+					Application: "app",
+					Version:     version,
+					Manifests: map[string]string{
+						envProduction: fmt.Sprintf("production %d", version),
+					},
+					SourceCommitId:  fmt.Sprintf("%040d", version),
+					WriteCommitData: true,
+				})
+			}
+			if err := repo.Apply(ctx, append(setup, tc.Deployments...)...); err != nil {
+				t.Fatal(err)
+			}
+			err := repo.Apply(ctx, tc.Rollbacks...)
+			if tc.ExpectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got none", tc.ExpectedError)
+				}
+				if diff := cmp.Diff(tc.ExpectedError, err.Error()); diff != "" {
+					t.Fatalf("error mismatch (-want, +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := repo.State()
+			version, err := state.GetEnvironmentApplicationVersion(ctx, envProduction, "app", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedVersion, version); diff != "" {
+				t.Errorf("deployed version mismatch (-want, +got):\n%s", diff)
+			}
+			deployment, err := state.GetDeploymentMetaData(ctx, envProduction, "app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedRolledBackVersion, deployment.RolledBackVersion); diff != "" {
+				t.Errorf("rolled back version mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRollbackDeploymentEvent(t *testing.T) {
+	const commitId = "cafe1cafe2cafe1cafe2cafe1cafe2cafe1cafe2"
+	repo := setupRepositoryTest(t)
+	ctx := testutil.MakeTestContext()
+	transformers := []Transformer{
+		&CreateEnvironment{
+			Environment: envProduction,
+			Config:      testutil.MakeEnvConfigUpstream(envAcceptance, nil),
+		},
+		&CreateApplicationVersion{
+			Application: "app",
+			Version:     1,
+			Manifests: map[string]string{
+				envProduction: "production 1",
+			},
+			SourceCommitId:  commitId,
+			WriteCommitData: true,
+		},
+		&CreateApplicationVersion{
+			Application: "app",
+			Version:     2,
+			Manifests: map[string]string{
+				envProduction: "production 2",
+			},
+			SourceCommitId:  "cafe3cafe4cafe3cafe4cafe3cafe4cafe3cafe4",
+			WriteCommitData: true,
+		},
+		&DeployApplicationVersion{
+			Environment:     envProduction,
+			Application:     "app",
+			Version:         1,
+			WriteCommitData: true,
+		},
+		&DeployApplicationVersion{
+			Environment:     envProduction,
+			Application:     "app",
+			Version:         2,
+			WriteCommitData: true,
+		},
+		&RollbackApplication{
+			Environment:     envProduction,
+			Application:     "app",
+			WriteCommitData: true,
+		},
+	}
+	if err := repo.Apply(ctx, transformers...); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := repo.State().Filesystem
+	eventsDir := fs.Join(commitDirectory(fs, commitId), "events")
+	eventDirs, err := fs.ReadDir(eventsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the directory names are not ordered by time
+	sort.Slice(eventDirs, func(i, j int) bool {
+		return uuid.TimeFromUUID(eventDirs[i].Name()).AsTime().Before(uuid.TimeFromUUID(eventDirs[j].Name()).AsTime())
+	})
+	deployments := []*event.Deployment{}
+	for _, eventDir := range eventDirs {
+		ev, err := event.Read(fs, fs.Join(eventsDir, eventDir.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, ok := ev.(*event.Deployment); ok {
+			deployments = append(deployments, d)
+		}
+	}
+	expected := []*event.Deployment{
+		{
+			Application:                 "app",
+			Environment:                 envProduction,
+			SourceTrainEnvironmentGroup: nil,
+			SourceTrainUpstream:         nil,
+			RolledBackVersion:           nil,
+		},
+		{
+			Application:                 "app",
+			Environment:                 envProduction,
+			SourceTrainEnvironmentGroup: nil,
+			SourceTrainUpstream:         nil,
+			RolledBackVersion:           ptr.FromString("2"),
+		},
+	}
+	if diff := cmp.Diff(expected, deployments); diff != "" {
+		t.Errorf("deployment events mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestValidateAutoRollback(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		AutoRollback  *config.EnvironmentConfigAutoRollback
+		ExpectedError string
+	}{
+		{
+			Name:         "no policy",
+			AutoRollback: nil,
+		},
+		{
+			Name: "valid policy",
+			AutoRollback: &config.EnvironmentConfigAutoRollback{
+				UnhealthyDuration: "15m",
+			},
+		},
+		{
+			Name: "invalid duration",
+			AutoRollback: &config.EnvironmentConfigAutoRollback{
+				UnhealthyDuration: "soon",
+			},
+			ExpectedError: "invalid auto rollback unhealthy duration \"soon\": time: invalid duration \"soon\"",
+		},
+		{
+			Name: "zero duration",
+			AutoRollback: &config.EnvironmentConfigAutoRollback{
+				UnhealthyDuration: "0s",
+			},
+			ExpectedError: "invalid auto rollback unhealthy duration \"0s\": must be positive",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			//exhaustruct:ignore
+			err := ValidateAutoRollback(config.EnvironmentConfig{
+				AutoRollback: tc.AutoRollback,
+			})
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if diff := cmp.Diff(tc.ExpectedError, actual); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
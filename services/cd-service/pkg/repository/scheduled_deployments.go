@@ -0,0 +1,231 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+	billy "github.com/go-git/go-billy/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ScheduledDeployment deploys a release to an environment once DeployAt is reached.
+// It is stored as a json file in environments/<env>/applications/<app>/scheduled_deployments/<id>.
+type ScheduledDeployment struct {
+	Id             string           `json:"-"`
+	Environment    string           `json:"-"`
+	Application    string           `json:"-"`
+	Version        uint64           `json:"version"`
+	DeployAt       time.Time        `json:"deployAt"`
+	LockBehaviour  api.LockBehavior `json:"lockBehaviour"`
+	CreatedByName  string           `json:"createdByName"`
+	CreatedByEmail string           `json:"createdByEmail"`
+	// The role of the creator, the deployment is executed with the permissions of this role if RBAC is enabled.
+	CreatedByRole string    `json:"createdByRole,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func (d *ScheduledDeployment) ToProto() *api.ScheduledDeployment {
+	return &api.ScheduledDeployment{
+		ScheduleId:   d.Id,
+		Environment:  d.Environment,
+		Application:  d.Application,
+		Version:      d.Version,
+		DeployAt:     timestamppb.New(d.DeployAt),
+		LockBehavior: d.LockBehaviour,
+		CreatedBy: &api.Actor{
+			Name:  d.CreatedByName,
+			Email: d.CreatedByEmail,
+		},
+		CreatedAt: timestamppb.New(d.CreatedAt),
+	}
+}
+
+func scheduledDeploymentsDirectory(fs billy.Filesystem, environment, application string) string {
+	return fs.Join(environmentApplicationDirectory(fs, environment, application), "scheduled_deployments")
+}
+
+// GetScheduledDeployment returns nil if there is no scheduled deployment with this id.
+func (s *State) GetScheduledDeployment(environment, application, scheduleId string) (*ScheduledDeployment, error) {
+	file := s.Filesystem.Join(scheduledDeploymentsDirectory(s.Filesystem, environment, application), scheduleId)
+	//exhaustruct:ignore
+	result := ScheduledDeployment{}
+	if err := decodeJsonFile(s.Filesystem, file, &result); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read scheduled deployment %q of application %q on environment %q: %w", scheduleId, application, environment, err)
+	}
+	result.Id = scheduleId
+	result.Environment = environment
+	result.Application = application
+	return &result, nil
+}
+
+func (s *State) getEnvironmentApplicationScheduledDeployments(environment, application string) ([]*ScheduledDeployment, error) {
+	ids, err := names(s.Filesystem, scheduledDeploymentsDirectory(s.Filesystem, environment, application))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := make([]*ScheduledDeployment, 0, len(ids))
+	for _, id := range ids {
+		scheduled, err := s.GetScheduledDeployment(environment, application, id)
+		if err != nil {
+			return nil, err
+		}
+		if scheduled != nil {
+			result = append(result, scheduled)
+		}
+	}
+	return result, nil
+}
+
+// GetScheduledDeployments returns the scheduled deployments of the application, ordered by due time.
+// If environment is set, only the scheduled deployments to this environment are returned.
+func (s *State) GetScheduledDeployments(application string, environment *string) ([]*ScheduledDeployment, error) {
+	var envs []string
+	if environment != nil {
+		envs = []string{*environment}
+	} else {
+		var err error
+		envs, err = names(s.Filesystem, "environments")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	result := []*ScheduledDeployment{}
+	for _, env := range envs {
+		scheduled, err := s.getEnvironmentApplicationScheduledDeployments(env, application)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, scheduled...)
+	}
+	sortScheduledDeployments(result)
+	return result, nil
+}
+
+func sortScheduledDeployments(scheduled []*ScheduledDeployment) {
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		a, b := scheduled[i], scheduled[j]
+		if !a.DeployAt.Equal(b.DeployAt) {
+			return a.DeployAt.Before(b.DeployAt)
+		}
+		if a.Environment != b.Environment {
+			return a.Environment < b.Environment
+		}
+		if a.Application != b.Application {
+			return a.Application < b.Application
+		}
+		return a.Id < b.Id
+	})
+}
+
+// GetDueScheduledDeploymentTransformers returns one ExecuteScheduledDeployment transformer
+// for every scheduled deployment that is due at the given time, the oldest first.
+func (s *State) GetDueScheduledDeploymentTransformers(now time.Time, authentication Authentication, writeCommitData bool) ([]*ExecuteScheduledDeployment, error) {
+	envs, err := names(s.Filesystem, "environments")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*ExecuteScheduledDeployment{}, nil
+		}
+		return nil, err
+	}
+	due := []*ScheduledDeployment{}
+	for _, env := range envs {
+		apps, err := names(s.Filesystem, s.Filesystem.Join("environments", env, "applications"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, app := range apps {
+			scheduled, err := s.getEnvironmentApplicationScheduledDeployments(env, app)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range scheduled {
+				if !d.DeployAt.After(now) {
+					due = append(due, d)
+				}
+			}
+		}
+	}
+	sortScheduledDeployments(due)
+	result := make([]*ExecuteScheduledDeployment, 0, len(due))
+	for _, d := range due {
+		result = append(result, &ExecuteScheduledDeployment{
+			Authentication:  authentication,
+			Environment:     d.Environment,
+			Application:     d.Application,
+			ScheduleId:      d.Id,
+			WriteCommitData: writeCommitData,
+			Failure:         "",
+		})
+	}
+	return result, nil
+}
+
+// ExecuteDueScheduledDeployments deploys all scheduled deployments that are due now.
+// Every scheduled deployment is executed with its own transformer, so that one failing deployment does not block the others.
+// The deployments are executed with the permissions of the users that scheduled them, because their permissions could have changed since.
+// A deployment that fails with an unexpected error is recorded as failed and removed, so that it is not retried on every run.
+func ExecuteDueScheduledDeployments(ctx context.Context, repo Repository, user auth.User, rbacConfig auth.RBACConfig, writeCommitData bool) error {
+	transformers, err := repo.State().GetDueScheduledDeploymentTransformers(time.Now(), Authentication{
+		RBACConfig: rbacConfig,
+	}, writeCommitData)
+	if err != nil {
+		return err
+	}
+	ctx = auth.WriteUserToContext(ctx, user)
+	var errs []error
+	for _, t := range transformers {
+		if err := repo.Apply(ctx, t); err != nil {
+			errs = append(errs, err)
+			t.Failure = err.Error()
+			if err := repo.Apply(ctx, t); err != nil {
+				errs = append(errs, fmt.Errorf("could not mark scheduled deployment %q as failed: %w", t.ScheduleId, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RegularlyExecuteScheduledDeployments calls ExecuteDueScheduledDeployments in the given interval until the context is done.
+func RegularlyExecuteScheduledDeployments(ctx context.Context, repo Repository, interval time.Duration, user auth.User, rbacConfig auth.RBACConfig, writeCommitData bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ExecuteDueScheduledDeployments(ctx, repo, user, rbacConfig, writeCommitData); err != nil {
+				logger.FromContext(ctx).Sugar().Warnf("could not execute scheduled deployments: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,451 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateScheduledDeployment(t *testing.T) {
+	timeNow := time.Unix(1000, 0).UTC()
+	tcs := []struct {
+		Name          string
+		Transformers  []Transformer
+		ExpectedError string
+		Expected      []*ScheduledDeployment
+	}{
+		{
+			Name: "deployment is scheduled",
+			Transformers: []Transformer{
+				&CreateScheduledDeployment{
+					Environment:   envProduction,
+					Application:   "app",
+					ScheduleId:    "s1",
+					Version:       1,
+					DeployAt:      timeNow.Add(time.Hour),
+					LockBehaviour: api.LockBehavior_FAIL,
+				},
+			},
+			Expected: []*ScheduledDeployment{
+				{
+					Id:             "s1",
+					Environment:    envProduction,
+					Application:    "app",
+					Version:        1,
+					DeployAt:       timeNow.Add(time.Hour),
+					LockBehaviour:  api.LockBehavior_FAIL,
+					CreatedByName:  "test tester",
+					CreatedByEmail: "testmail@example.com",
+					CreatedAt:      timeNow,
+				},
+			},
+		},
+		{
+			Name: "scheduled deployment with the same id is replaced",
+			Transformers: []Transformer{
+				&CreateScheduledDeployment{
+					Environment:   envProduction,
+					Application:   "app",
+					ScheduleId:    "s1",
+					Version:       1,
+					DeployAt:      timeNow.Add(2 * time.Hour),
+					LockBehaviour: api.LockBehavior_RECORD,
+				},
+				&CreateScheduledDeployment{
+					Environment:   envProduction,
+					Application:   "app",
+					ScheduleId:    "s1",
+					Version:       1,
+					DeployAt:      timeNow.Add(time.Hour),
+					LockBehaviour: api.LockBehavior_IGNORE,
+				},
+			},
+			Expected: []*ScheduledDeployment{
+				{
+					Id:             "s1",
+					Environment:    envProduction,
+					Application:    "app",
+					Version:        1,
+					DeployAt:       timeNow.Add(time.Hour),
+					LockBehaviour:  api.LockBehavior_IGNORE,
+					CreatedByName:  "test tester",
+					CreatedByEmail: "testmail@example.com",
+					CreatedAt:      timeNow,
+				},
+			},
+		},
+		{
+			Name: "cancelled deployment is removed",
+			Transformers: []Transformer{
+				&CreateScheduledDeployment{
+					Environment: envProduction,
+					Application: "app",
+					ScheduleId:  "s1",
+					Version:     1,
+					DeployAt:    timeNow.Add(time.Hour),
+				},
+				&CancelScheduledDeployment{
+					Environment: envProduction,
+					Application: "app",
+					ScheduleId:  "s1",
+				},
+			},
+			Expected: []*ScheduledDeployment{},
+		},
+		{
+			Name: "deployment in the past",
+			Transformers: []Transformer{
+				&CreateScheduledDeployment{
+					Environment: envProduction,
+					Application: "app",
+					ScheduleId:  "s1",
+					Version:     1,
+					DeployAt:    timeNow.Add(-time.Hour),
+				},
+			},
+			ExpectedError: "error at index 0 of transformer batch: rpc error: code = InvalidArgument desc = error: cannot schedule deployment \"s1\": 1970-01-01T00:16:40Z is not in the future",
+		},
+		{
+			Name: "release without manifest for the environment",
+			Transformers: []Transformer{
+				&CreateScheduledDeployment{
+					Environment: envProduction,
+					Application: "app",
+					ScheduleId:  "s1",
+					Version:     2,
+					DeployAt:    timeNow.Add(time.Hour),
+				},
+			},
+			ExpectedError: "error at index 0 of transformer batch: rpc error: code = InvalidArgument desc = error: cannot schedule deployment \"s1\": release 2 of app \"app\" has no manifest for environment \"production\"",
+		},
+		{
+			Name: "cancel unknown deployment",
+			Transformers: []Transformer{
+				&CancelScheduledDeployment{
+					Environment: envProduction,
+					Application: "app",
+					ScheduleId:  "s1",
+				},
+			},
+			ExpectedError: "error at index 0 of transformer batch: rpc error: code = InvalidArgument desc = error: scheduled deployment \"s1\" of app \"app\" to \"production\" does not exist",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := WithTimeNow(testutil.MakeTestContext(), timeNow)
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      testutil.MakeEnvConfigUpstream(envAcceptance, nil),
+				},
+				&CreateApplicationVersion{
+					Application: "app",
+					Version:     1,
+					Manifests: map[string]string{
+						envProduction: "production",
+					},
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, tc.Transformers...)
+			if tc.ExpectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got none", tc.ExpectedError)
+				}
+				if diff := cmp.Diff(tc.ExpectedError, err.Error()); diff != "" {
+					t.Fatalf("error mismatch (-want, +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := repo.State().GetScheduledDeployments("app", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.Expected, actual); diff != "" {
+				t.Errorf("scheduled deployments mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecuteDueScheduledDeployments(t *testing.T) {
+	const commitId = "cafe1cafe2cafe1cafe2cafe1cafe2cafe1cafe2"
+	// the deployments are scheduled in the past, so that they are due now
+	creationTime := time.Unix(1000, 0).UTC()
+	tcs := []struct {
+		Name             string
+		DeployAt         time.Time
+		LockBehaviour    api.LockBehavior
+		Locked           bool
+		CreatorRole      string
+		RBACPolicy       map[string]auth.Permission
+		ExpectedVersion  *uint64
+		ExpectedQueued   *uint64
+		ExpectedOutcome  string
+		ExpectedSchedule bool
+	}{
+		{
+			Name:            "due deployment is deployed",
+			DeployAt:        creationTime.Add(time.Hour),
+			LockBehaviour:   api.LockBehavior_FAIL,
+			ExpectedVersion: ptr.Uint64(1),
+			ExpectedOutcome: event.ScheduledDeploymentOutcomeDeployed,
+		},
+		{
+			Name:            "locked deployment is queued",
+			DeployAt:        creationTime.Add(time.Hour),
+			LockBehaviour:   api.LockBehavior_RECORD,
+			Locked:          true,
+			ExpectedQueued:  ptr.Uint64(1),
+			ExpectedOutcome: event.ScheduledDeploymentOutcomeQueued,
+		},
+		{
+			Name:            "locked deployment fails",
+			DeployAt:        creationTime.Add(time.Hour),
+			LockBehaviour:   api.LockBehavior_FAIL,
+			Locked:          true,
+			ExpectedOutcome: event.ScheduledDeploymentOutcomeFailed,
+		},
+		{
+			Name:            "locks are ignored",
+			DeployAt:        creationTime.Add(time.Hour),
+			LockBehaviour:   api.LockBehavior_IGNORE,
+			Locked:          true,
+			ExpectedVersion: ptr.Uint64(1),
+			ExpectedOutcome: event.ScheduledDeploymentOutcomeDeployed,
+		},
+		{
+			Name:          "deployment is executed with the permissions of the creator",
+			DeployAt:      creationTime.Add(time.Hour),
+			LockBehaviour: api.LockBehavior_FAIL,
+			CreatorRole:   "developer",
+			RBACPolicy: map[string]auth.Permission{
+				"p,role:developer,DeployRelease,production:*,app,allow": {Role: "developer"},
+			},
+			ExpectedVersion: ptr.Uint64(1),
+			ExpectedOutcome: event.ScheduledDeploymentOutcomeDeployed,
+		},
+		{
+			Name:          "deployment fails if the creator is not allowed to deploy",
+			DeployAt:      creationTime.Add(time.Hour),
+			LockBehaviour: api.LockBehavior_FAIL,
+			CreatorRole:   "developer",
+			RBACPolicy: map[string]auth.Permission{
+				"p,role:admin,DeployRelease,production:*,app,allow": {Role: "admin"},
+			},
+			ExpectedOutcome: event.ScheduledDeploymentOutcomeFailed,
+		},
+		{
+			Name:             "deployment that is not due is kept",
+			DeployAt:         time.Now().Add(24 * time.Hour),
+			LockBehaviour:    api.LockBehavior_FAIL,
+			ExpectedSchedule: true,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := WithTimeNow(testutil.MakeTestContextDexEnabledUser(tc.CreatorRole), creationTime)
+			transformers := []Transformer{
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      testutil.MakeEnvConfigUpstream(envAcceptance, nil),
+				},
+				&CreateApplicationVersion{
+					Application: "app",
+					Version:     1,
+					Manifests: map[string]string{
+						envProduction: "production",
+					},
+					SourceCommitId:  commitId,
+					WriteCommitData: true,
+				},
+				&CreateScheduledDeployment{
+					Environment:   envProduction,
+					Application:   "app",
+					ScheduleId:    "s1",
+					Version:       1,
+					DeployAt:      tc.DeployAt,
+					LockBehaviour: tc.LockBehaviour,
+				},
+			}
+			if tc.Locked {
+				transformers = append(transformers, &CreateEnvironmentLock{
+					Environment: envProduction,
+					LockId:      "l1",
+					Message:     "freeze",
+				})
+			}
+			if err := repo.Apply(ctx, transformers...); err != nil {
+				t.Fatal(err)
+			}
+
+			rbacConfig := auth.RBACConfig{DexEnabled: false}
+			if tc.RBACPolicy != nil {
+				rbacConfig = auth.RBACConfig{DexEnabled: true, Policy: &auth.RBACPolicies{Permissions: tc.RBACPolicy}}
+			}
+			err := ExecuteDueScheduledDeployments(testutil.MakeTestContext(), repo, auth.User{
+				Email:          "kuberpult@example.com",
+				Name:           "kuberpult",
+				DexAuthContext: nil,
+			}, rbacConfig, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state := repo.State()
+			version, err := state.GetEnvironmentApplicationVersion(ctx, envProduction, "app", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedVersion, version); diff != "" {
+				t.Errorf("deployed version mismatch (-want, +got):\n%s", diff)
+			}
+			queued, err := state.GetQueuedVersion(envProduction, "app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedQueued, queued); diff != "" {
+				t.Errorf("queued version mismatch (-want, +got):\n%s", diff)
+			}
+			scheduled, err := state.GetScheduledDeployment(envProduction, "app", "s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (scheduled != nil) != tc.ExpectedSchedule {
+				t.Errorf("expected scheduled deployment to exist: %t, got: %v", tc.ExpectedSchedule, scheduled)
+			}
+
+			outcomes := []string{}
+			eventsDir := state.Filesystem.Join(commitDirectory(state.Filesystem, commitId), "events")
+			eventDirs, err := state.Filesystem.ReadDir(eventsDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, eventDir := range eventDirs {
+				ev, err := event.Read(state.Filesystem, state.Filesystem.Join(eventsDir, eventDir.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if scheduledEvent, ok := ev.(*event.ScheduledDeployment); ok {
+					outcomes = append(outcomes, scheduledEvent.Outcome)
+				}
+			}
+			expectedOutcomes := []string{}
+			if tc.ExpectedOutcome != "" {
+				expectedOutcomes = append(expectedOutcomes, tc.ExpectedOutcome)
+			}
+			if diff := cmp.Diff(expectedOutcomes, outcomes); diff != "" {
+				t.Errorf("scheduled deployment event mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecuteScheduledDeploymentWithFailure(t *testing.T) {
+	const commitId = "cafe1cafe2cafe1cafe2cafe1cafe2cafe1cafe2"
+	creationTime := time.Unix(1000, 0).UTC()
+	repo := setupRepositoryTest(t)
+	ctx := WithTimeNow(testutil.MakeTestContext(), creationTime)
+	err := repo.Apply(ctx,
+		&CreateEnvironment{
+			Environment: envProduction,
+			Config:      testutil.MakeEnvConfigUpstream(envAcceptance, nil),
+		},
+		&CreateApplicationVersion{
+			Application: "app",
+			Version:     1,
+			Manifests: map[string]string{
+				envProduction: "production",
+			},
+			SourceCommitId:  commitId,
+			WriteCommitData: true,
+		},
+		&CreateScheduledDeployment{
+			Environment:   envProduction,
+			Application:   "app",
+			ScheduleId:    "s1",
+			Version:       1,
+			DeployAt:      creationTime.Add(time.Hour),
+			LockBehaviour: api.LockBehavior_FAIL,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.Apply(testutil.MakeTestContext(), &ExecuteScheduledDeployment{
+		Environment:     envProduction,
+		Application:     "app",
+		ScheduleId:      "s1",
+		WriteCommitData: true,
+		Failure:         "something went wrong",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := repo.State()
+	version, err := state.GetEnvironmentApplicationVersion(ctx, envProduction, "app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != nil {
+		t.Errorf("expected no deployment, got version %d", *version)
+	}
+	scheduled, err := state.GetScheduledDeployment(envProduction, "app", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheduled != nil {
+		t.Errorf("expected failed scheduled deployment to be removed, got %v", scheduled)
+	}
+	eventsDir := state.Filesystem.Join(commitDirectory(state.Filesystem, commitId), "events")
+	eventDirs, err := state.Filesystem.ReadDir(eventsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := []string{}
+	for _, eventDir := range eventDirs {
+		ev, err := event.Read(state.Filesystem, state.Filesystem.Join(eventsDir, eventDir.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scheduledEvent, ok := ev.(*event.ScheduledDeployment); ok && scheduledEvent.Outcome == event.ScheduledDeploymentOutcomeFailed {
+			failures = append(failures, scheduledEvent.Message)
+		}
+	}
+	if diff := cmp.Diff([]string{"something went wrong"}, failures); diff != "" {
+		t.Errorf("failure event mismatch (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,150 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/freiheit-com/kuberpult/pkg/valid"
+)
+
+const (
+	fieldSelector = "selector"
+	// The only label that applications have for now.
+	selectorLabelTeam = "team"
+)
+
+// SelectorLockPrefix is the prefix of the lock ids of selector locks when they are combined with application locks,
+// so that a selector lock never hides an application lock with the same id.
+const SelectorLockPrefix = "selector-lock-"
+
+// SelectorLock locks all applications of an environment that match the selector.
+type SelectorLock struct {
+	Lock     Lock
+	Selector string
+}
+
+func (s *State) GetSelectorLocksDir(environment string) string {
+	return s.Filesystem.Join("environments", environment, "selectors", "locks")
+}
+
+// ValidateSelector checks that the selector is either a pattern for application names like "payment-*",
+// or a label like "team=payments".
+// Applications have no other labels than their team, so any other label (e.g. "tier=critical") is rejected
+// instead of creating a lock that never matches.
+func ValidateSelector(selector string) error {
+	if selector == "" {
+		return fmt.Errorf("selector must not be empty")
+	}
+	if key, value, isLabel := strings.Cut(selector, "="); isLabel {
+		if key != selectorLabelTeam {
+			return fmt.Errorf("invalid selector %q: unknown label %q, applications only have the label %q (use %q or a name pattern like \"payment-*\")", selector, key, selectorLabelTeam, selectorLabelTeam+"=<team>")
+		}
+		if !valid.TeamName(value) {
+			return fmt.Errorf("invalid selector %q: invalid team %q", selector, value)
+		}
+		return nil
+	}
+	if _, err := path.Match(selector, ""); err != nil {
+		return fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return nil
+}
+
+// selectorMatches returns true if the application with the given team matches the selector.
+// The selector must be valid.
+func selectorMatches(selector, application, team string) bool {
+	if key, value, isLabel := strings.Cut(selector, "="); isLabel {
+		return key == selectorLabelTeam && value == team
+	}
+	matched, err := path.Match(selector, application)
+	return err == nil && matched
+}
+
+func (s *State) GetEnvironmentSelectorLocks(environment string) (map[string]SelectorLock, error) {
+	base := s.GetSelectorLocksDir(environment)
+	entries, err := s.Filesystem.ReadDir(base)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]SelectorLock{}, nil
+		}
+		return nil, err
+	}
+	result := make(map[string]SelectorLock, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			return nil, fmt.Errorf("error getting selector locks: found file in the locks directory")
+		}
+		lockDir := s.Filesystem.Join(base, e.Name())
+		lock, err := readLock(s.Filesystem, lockDir)
+		if err != nil {
+			return nil, err
+		}
+		selector, err := readFile(s.Filesystem, s.Filesystem.Join(lockDir, fieldSelector))
+		if err != nil {
+			return nil, err
+		}
+		result[e.Name()] = SelectorLock{
+			Lock:     *lock,
+			Selector: string(selector),
+		}
+	}
+	return result, nil
+}
+
+// GetSelectorLocksForApplication returns the selector locks of the environment that match the application.
+func (s *State) GetSelectorLocksForApplication(environment, application string) (map[string]SelectorLock, error) {
+	selectorLocks, err := s.GetEnvironmentSelectorLocks(environment)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]SelectorLock{}
+	if len(selectorLocks) == 0 {
+		return result, nil
+	}
+	team, err := s.GetApplicationTeamOwner(application)
+	if err != nil {
+		return nil, err
+	}
+	for lockId, selectorLock := range selectorLocks {
+		if selectorMatches(selectorLock.Selector, application, team) {
+			result[lockId] = selectorLock
+		}
+	}
+	return result, nil
+}
+
+// getApplicationLocksWithSelectorLocks returns the application locks together with the matching selector locks,
+// because both have the same effect on deployments. The ids of selector locks are prefixed with SelectorLockPrefix.
+func (s *State) getApplicationLocksWithSelectorLocks(environment, application string) (map[string]Lock, error) {
+	appLocks, err := s.GetEnvironmentApplicationLocks(environment, application)
+	if err != nil {
+		return nil, err
+	}
+	selectorLocks, err := s.GetSelectorLocksForApplication(environment, application)
+	if err != nil {
+		return nil, err
+	}
+	for lockId, selectorLock := range selectorLocks {
+		appLocks[SelectorLockPrefix+lockId] = selectorLock.Lock
+	}
+	return appLocks, nil
+}
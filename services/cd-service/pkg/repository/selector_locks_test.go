@@ -0,0 +1,291 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateSelector(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		Selector      string
+		ExpectedError string
+	}{
+		{
+			Name:     "application name pattern",
+			Selector: "payment-*",
+		},
+		{
+			Name:     "team label",
+			Selector: "team=payments",
+		},
+		{
+			Name:          "empty selector",
+			Selector:      "",
+			ExpectedError: "selector must not be empty",
+		},
+		{
+			Name:          "unknown label",
+			Selector:      "tier=backend",
+			ExpectedError: "invalid selector \"tier=backend\": unknown label \"tier\", applications only have the label \"team\" (use \"team=<team>\" or a name pattern like \"payment-*\")",
+		},
+		{
+			Name:          "invalid pattern",
+			Selector:      "payment-[",
+			ExpectedError: "invalid selector \"payment-[\": syntax error in pattern",
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateSelector(tc.Selector)
+			actualError := ""
+			if err != nil {
+				actualError = err.Error()
+			}
+			if diff := cmp.Diff(tc.ExpectedError, actualError); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	tcs := []struct {
+		Name        string
+		Selector    string
+		Application string
+		Team        string
+		Expected    bool
+	}{
+		{
+			Name:        "pattern matches",
+			Selector:    "payment-*",
+			Application: "payment-service",
+			Team:        "",
+			Expected:    true,
+		},
+		{
+			Name:        "pattern does not match",
+			Selector:    "payment-*",
+			Application: "checkout",
+			Team:        "payments",
+			Expected:    false,
+		},
+		{
+			Name:        "team matches",
+			Selector:    "team=payments",
+			Application: "checkout",
+			Team:        "payments",
+			Expected:    true,
+		},
+		{
+			Name:        "team does not match",
+			Selector:    "team=payments",
+			Application: "payment-service",
+			Team:        "",
+			Expected:    false,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := selectorMatches(tc.Selector, tc.Application, tc.Team)
+			if actual != tc.Expected {
+				t.Errorf("expected %t, got %t", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeployWithSelectorLock(t *testing.T) {
+	tcs := []struct {
+		Name              string
+		Selector          string
+		Application       string
+		Team              string
+		DeleteLock        bool
+		ExpectLockedError bool
+	}{
+		{
+			Name:              "matching application is locked",
+			Selector:          "payment-*",
+			Application:       "payment-service",
+			Team:              "",
+			ExpectLockedError: true,
+		},
+		{
+			Name:              "application of matching team is locked",
+			Selector:          "team=payments",
+			Application:       "checkout",
+			Team:              "payments",
+			ExpectLockedError: true,
+		},
+		{
+			Name:              "other application is not locked",
+			Selector:          "payment-*",
+			Application:       "checkout",
+			Team:              "payments",
+			ExpectLockedError: false,
+		},
+		{
+			Name:              "deleted lock does not block",
+			Selector:          "payment-*",
+			Application:       "payment-service",
+			Team:              "",
+			DeleteLock:        true,
+			ExpectLockedError: false,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config: config.EnvironmentConfig{
+						Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance, Latest: false},
+					},
+				},
+				&CreateApplicationVersion{
+					Application: tc.Application,
+					Manifests: map[string]string{
+						envProduction: "production",
+					},
+					Team:            tc.Team,
+					WriteCommitData: true,
+				},
+				&CreateEnvironmentSelectorLock{
+					Environment: envProduction,
+					Selector:    tc.Selector,
+					LockId:      "l1",
+					Message:     "no payment deployments",
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.DeleteLock {
+				err = repo.Apply(ctx, &DeleteEnvironmentSelectorLock{
+					Environment: envProduction,
+					LockId:      "l1",
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = repo.Apply(ctx, &DeployApplicationVersion{
+				Environment:   envProduction,
+				Application:   tc.Application,
+				Version:       1,
+				LockBehaviour: api.LockBehavior_FAIL,
+			})
+			var lockedErr *LockedError
+			if errors.As(err, &lockedErr) != tc.ExpectLockedError {
+				t.Fatalf("expected locked error: %t, got: %v", tc.ExpectLockedError, err)
+			}
+			if tc.ExpectLockedError {
+				if _, ok := lockedErr.EnvironmentApplicationLocks[SelectorLockPrefix+"l1"]; !ok {
+					t.Errorf("expected selector lock in locked error, got %v", lockedErr.EnvironmentApplicationLocks)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSelectorLockDoesNotHideApplicationLockWithSameId(t *testing.T) {
+	repo := setupRepositoryTest(t)
+	ctx := testutil.MakeTestContext()
+	err := repo.Apply(ctx,
+		&CreateEnvironment{
+			Environment: envProduction,
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance, Latest: false},
+			},
+		},
+		&CreateApplicationVersion{
+			Application: "payment-service",
+			Manifests: map[string]string{
+				envProduction: "production",
+			},
+			WriteCommitData: true,
+		},
+		&CreateEnvironmentApplicationLock{
+			Environment: envProduction,
+			Application: "payment-service",
+			LockId:      "l1",
+			Message:     "app lock",
+		},
+		&CreateEnvironmentSelectorLock{
+			Environment: envProduction,
+			Selector:    "payment-*",
+			LockId:      "l1",
+			Message:     "selector lock",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locks, err := repo.State().getApplicationLocksWithSelectorLocks(envProduction, "payment-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := map[string]string{}
+	for lockId, lock := range locks {
+		actual[lockId] = lock.Message
+	}
+	expected := map[string]string{
+		"l1":                      "app lock",
+		SelectorLockPrefix + "l1": "selector lock",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("locks mismatch (-want, +got):\n%s", diff)
+	}
+
+	// deleting the selector lock must keep the application lock
+	err = repo.Apply(ctx, &DeleteEnvironmentSelectorLock{
+		Environment: envProduction,
+		LockId:      "l1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Apply(ctx, &DeployApplicationVersion{
+		Environment:   envProduction,
+		Application:   "payment-service",
+		Version:       1,
+		LockBehaviour: api.LockBehavior_FAIL,
+	})
+	var lockedErr *LockedError
+	if !errors.As(err, &lockedErr) {
+		t.Fatalf("expected locked error, got: %v", err)
+	}
+	if _, ok := lockedErr.EnvironmentApplicationLocks["l1"]; !ok {
+		t.Errorf("expected application lock in locked error, got %v", lockedErr.EnvironmentApplicationLocks)
+	}
+}
@@ -39,6 +39,13 @@ func (fr *failingRepository) Apply(ctx context.Context, transformers ...reposito
 	return fr.err
 }
 
+func (fr *failingRepository) ApplyAsync(ctx context.Context, progress repository.BatchProgress, transformers ...repository.Transformer) <-chan error {
+	result := make(chan error, 1)
+	result <- fr.err
+	close(result)
+	return result
+}
+
 func (fr *failingRepository) Push(ctx context.Context, pushAction func() error) error {
 	return fr.err
 }
@@ -47,6 +54,10 @@ func (fr *failingRepository) ApplyTransformersInternal(ctx context.Context, tran
 	return nil, nil, nil, &repository.TransformerBatchApplyError{TransformerError: fr.err, Index: 0}
 }
 
+func (fr *failingRepository) ApplyTransformersDryRun(ctx context.Context, transaction *sql.Tx, transformers ...repository.Transformer) ([]string, []*repository.TransformerResult, *repository.TransformerBatchApplyError) {
+	return nil, nil, &repository.TransformerBatchApplyError{TransformerError: fr.err, Index: 0}
+}
+
 func (fr *failingRepository) State() *repository.State {
 	//exhaustruct:ignore
 	return &repository.State{}
@@ -17,6 +17,7 @@ Copyright freiheit.com*/
 package repository
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -26,6 +27,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"reflect"
 	"slices"
 	"sort"
 	"strconv"
@@ -52,11 +54,13 @@ import (
 	"github.com/freiheit-com/kuberpult/pkg/valid"
 
 	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 
 	yaml3 "gopkg.in/yaml.v3"
 
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/schema"
 	billy "github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/util"
 	"github.com/hexops/gotextdiff"
@@ -71,8 +75,11 @@ const (
 	fieldSourceMessage    = "source_message"
 	fieldSourceCommitId   = "source_commit_id"
 	fieldDisplayVersion   = "display_version"
+	fieldLabels           = "labels"
 	fieldSourceRepoUrl    = "sourceRepoUrl" // urgh, inconsistent
 	fieldCreatedAt        = "created_at"
+	fieldExpiresAt        = "expires_at"
+	fieldClonedFrom       = "cloned_from"
 	fieldTeam             = "team"
 	fieldNextCommidId     = "nextCommit"
 	fieldPreviousCommitId = "previousCommit"
@@ -193,11 +200,11 @@ func UpdateDatadogMetrics(ctx context.Context, state *State, repo Repository, ch
 			for _, app := range entries {
 				GaugeEnvAppLockMetric(filesystem, env, app.Name())
 
-				_, deployedAtTimeUtc, err := state.GetDeploymentMetaData(ctx, env, app.Name())
+				deployment, err := state.GetDeploymentMetaData(ctx, env, app.Name())
 				if err != nil {
 					return err
 				}
-				timeDiff := now.Sub(deployedAtTimeUtc)
+				timeDiff := now.Sub(deployment.DeployTime)
 				err = GaugeDeploymentMetric(ctx, env, app.Name(), timeDiff.Minutes())
 				if err != nil {
 					return err
@@ -262,12 +269,15 @@ type TransformerContext interface {
 	Execute(t Transformer, transaction *sql.Tx) error
 	AddAppEnv(app string, env string, team string)
 	DeleteEnvFromApp(app string, env string)
+	DeleteRootApp(env string)
+	UpdateRootApp(env string)
 }
 
 func RunTransformer(ctx context.Context, t Transformer, s *State, transaction *sql.Tx) (string, *TransformerResult, error) {
 	runner := transformerRunner{
 		ChangedApps:     nil,
 		DeletedRootApps: nil,
+		UpdatedRootApps: nil,
 		Commits:         nil,
 		Context:         ctx,
 		State:           s,
@@ -283,6 +293,7 @@ func RunTransformer(ctx context.Context, t Transformer, s *State, transaction *s
 	return commitMsg, &TransformerResult{
 		ChangedApps:     runner.ChangedApps,
 		DeletedRootApps: runner.DeletedRootApps,
+		UpdatedRootApps: runner.UpdatedRootApps,
 		Commits:         runner.Commits,
 	}, nil
 }
@@ -297,6 +308,7 @@ type transformerRunner struct {
 	Stack           [][]string
 	ChangedApps     []AppEnv
 	DeletedRootApps []RootApp
+	UpdatedRootApps []RootApp
 	Commits         *CommitIds
 }
 
@@ -340,19 +352,35 @@ func (r *transformerRunner) DeleteEnvFromApp(app string, env string) {
 	})
 }
 
+func (r *transformerRunner) DeleteRootApp(env string) {
+	r.DeletedRootApps = append(r.DeletedRootApps, RootApp{
+		Env: env,
+	})
+}
+
+func (r *transformerRunner) UpdateRootApp(env string) {
+	r.UpdatedRootApps = append(r.UpdatedRootApps, RootApp{
+		Env: env,
+	})
+}
+
 type CreateApplicationVersion struct {
 	Authentication  `json:"-"`
-	Version         uint64            `json:"version"`
-	Application     string            `json:"app"`
-	Manifests       map[string]string `json:"manifests"`
-	SourceCommitId  string            `json:"sourceCommitId"`
-	SourceAuthor    string            `json:"sourceCommitAuthor"`
-	SourceMessage   string            `json:"sourceCommitMessage"`
-	SourceRepoUrl   string            `json:"sourceRepoUrl"`
-	Team            string            `json:"team"`
-	DisplayVersion  string            `json:"displayVersion"`
-	WriteCommitData bool              `json:"writeCommitData"`
-	PreviousCommit  string            `json:"previousCommit"`
+	Version         uint64              `json:"version"`
+	Application     string              `json:"app"`
+	Manifests       map[string]string   `json:"manifests"`
+	SourceCommitId  string              `json:"sourceCommitId"`
+	SourceAuthor    string              `json:"sourceCommitAuthor"`
+	SourceMessage   string              `json:"sourceCommitMessage"`
+	SourceRepoUrl   string              `json:"sourceRepoUrl"`
+	Team            string              `json:"team"`
+	DisplayVersion  string              `json:"displayVersion"`
+	WriteCommitData bool                `json:"writeCommitData"`
+	PreviousCommit  string              `json:"previousCommit"`
+	Labels          map[string]string   `json:"labels,omitempty"`
+	Dependencies    []ReleaseDependency `json:"dependencies,omitempty"`
+	// SecretPolicy is only enforced by the cd-service, the manifests in the event log already comply with it.
+	SecretPolicy manifestpolicy.SecretPolicy `json:"-"`
 }
 
 func (c *CreateApplicationVersion) GetDBEventType() db.EventType {
@@ -403,6 +431,16 @@ func (c *CreateApplicationVersion) Transform(
 	if !valid.ApplicationName(c.Application) {
 		return "", GetCreateReleaseAppNameTooLong(c.Application, valid.AppNameRegExp, uint32(valid.MaxAppNameLen))
 	}
+	if c.SecretPolicy.Enabled() {
+		if violations := checkSecrets(c.SecretPolicy, c.Manifests); len(violations) > 0 {
+			return "", GetCreateReleaseInvalidManifest(violations)
+		}
+	}
+	if state.ManifestValidator != nil {
+		if validationErrors := validateManifests(state.ManifestValidator, c.Manifests); len(validationErrors) > 0 {
+			return "", GetCreateReleaseInvalidManifest(validationErrors)
+		}
+	}
 	if state.DBHandler.ShouldUseOtherTables() {
 		allApps, err := state.DBHandler.DBSelectAllApplications(ctx, transaction)
 		if err != nil {
@@ -474,6 +512,25 @@ func (c *CreateApplicationVersion) Transform(
 			return "", GetCreateReleaseGeneralFailure(err)
 		}
 	}
+	if len(c.Labels) > 0 {
+		// json.Marshal sorts the keys, so the file content is stable
+		labels, err := json.Marshal(c.Labels)
+		if err != nil {
+			return "", GetCreateReleaseGeneralFailure(err)
+		}
+		if err := util.WriteFile(fs, fs.Join(releaseDir, fieldLabels), labels, 0666); err != nil {
+			return "", GetCreateReleaseGeneralFailure(err)
+		}
+	}
+	if len(c.Dependencies) > 0 {
+		dependencies, err := json.Marshal(sortDependencies(c.Dependencies))
+		if err != nil {
+			return "", GetCreateReleaseGeneralFailure(err)
+		}
+		if err := util.WriteFile(fs, fs.Join(releaseDir, fieldDependencies), dependencies, 0666); err != nil {
+			return "", GetCreateReleaseGeneralFailure(err)
+		}
+	}
 	if err := util.WriteFile(fs, fs.Join(releaseDir, fieldCreatedAt), []byte(getTimeNow(ctx).Format(time.RFC3339)), 0666); err != nil {
 		return "", GetCreateReleaseGeneralFailure(err)
 	}
@@ -559,20 +616,25 @@ func (c *CreateApplicationVersion) Transform(
 		t.AddAppEnv(c.Application, env, teamOwner)
 		if hasUpstream && config.Upstream.Latest && isLatest {
 			d := &DeployApplicationVersion{
-				SourceTrain:     nil,
-				Environment:     env,
-				Application:     c.Application,
-				Version:         version, // the train should queue deployments, instead of giving up:
-				LockBehaviour:   api.LockBehavior_RECORD,
-				Authentication:  c.Authentication,
-				WriteCommitData: c.WriteCommitData,
-				Author:          c.SourceAuthor,
+				SourceTrain:       nil,
+				Environment:       env,
+				Application:       c.Application,
+				Version:           version, // the train should queue deployments, instead of giving up:
+				LockBehaviour:     api.LockBehavior_RECORD,
+				Authentication:    c.Authentication,
+				WriteCommitData:   c.WriteCommitData,
+				Author:            c.SourceAuthor,
+				RolledBackVersion: nil,
+				Reason:            "",
 			}
 			err := t.Execute(d, transaction)
 			if err != nil {
 				_, ok := err.(*LockedError)
+				_, unmet := err.(*UnmetDependenciesError)
 				if ok {
 					continue // LockedErrors are expected
+				} else if unmet {
+					continue // the release can be deployed once its dependencies are deployed
 				} else {
 					return "", GetCreateReleaseGeneralFailure(err)
 				}
@@ -758,6 +820,34 @@ func (c *CreateApplicationVersion) sameAsExisting(state *State, version uint64)
 			return GetCreateReleaseAlreadyExistsDifferent(api.DifferingField_DISPLAY_VERSION, createUnifiedDiff(existingDisplayVersionStr, c.DisplayVersion, ""))
 		}
 	}
+	if len(c.Labels) > 0 {
+		existingLabels, err := util.ReadFile(fs, fs.Join(releaseDir, fieldLabels))
+		if err != nil {
+			return GetCreateReleaseAlreadyExistsDifferent(api.DifferingField_LABELS, "")
+		}
+		labels, err := json.Marshal(c.Labels)
+		if err != nil {
+			return err
+		}
+		existingLabelsStr := string(existingLabels)
+		if existingLabelsStr != string(labels) {
+			return GetCreateReleaseAlreadyExistsDifferent(api.DifferingField_LABELS, createUnifiedDiff(existingLabelsStr, string(labels), ""))
+		}
+	}
+	if len(c.Dependencies) > 0 {
+		existingDependencies, err := util.ReadFile(fs, fs.Join(releaseDir, fieldDependencies))
+		if err != nil {
+			return GetCreateReleaseAlreadyExistsDifferent(api.DifferingField_DEPENDENCIES, "")
+		}
+		dependencies, err := json.Marshal(sortDependencies(c.Dependencies))
+		if err != nil {
+			return err
+		}
+		existingDependenciesStr := string(existingDependencies)
+		if existingDependenciesStr != string(dependencies) {
+			return GetCreateReleaseAlreadyExistsDifferent(api.DifferingField_DEPENDENCIES, createUnifiedDiff(existingDependenciesStr, string(dependencies), ""))
+		}
+	}
 	if c.Team != "" {
 		existingTeam, err := util.ReadFile(fs, fs.Join(appDir, fieldTeam))
 		if err != nil {
@@ -799,6 +889,62 @@ func (n *RawNode) UnmarshalYAML(node *yaml3.Node) error {
 	return nil
 }
 
+func validateManifests(validator *schema.Validator, manifests map[string]string) []*api.ManifestValidationError {
+	envs := make([]string, 0, len(manifests))
+	for env := range manifests {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	result := []*api.ManifestValidationError{}
+	for _, env := range envs {
+		for _, validationError := range validator.Validate(manifests[env]) {
+			result = append(result, &api.ManifestValidationError{
+				Environment: env,
+				Document:    uint32(validationError.Document),
+				Kind:        validationError.Kind,
+				Name:        validationError.Name,
+				Field:       validationError.Field,
+				Message:     validationError.Message,
+			})
+		}
+	}
+	return result
+}
+
+func checkSecrets(policy manifestpolicy.SecretPolicy, manifests map[string]string) []*api.ManifestValidationError {
+	envs := make([]string, 0, len(manifests))
+	for env := range manifests {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	result := []*api.ManifestValidationError{}
+	for _, env := range envs {
+		violations, err := policy.Check(manifests[env])
+		if err != nil {
+			result = append(result, &api.ManifestValidationError{
+				Environment: env,
+				Document:    0,
+				Kind:        "",
+				Name:        "",
+				Field:       "",
+				Message:     fmt.Sprintf("manifest could not be checked for secrets: %v", err),
+			})
+			continue
+		}
+		for _, violation := range violations {
+			result = append(result, &api.ManifestValidationError{
+				Environment: env,
+				Document:    uint32(violation.Document),
+				Kind:        violation.Kind,
+				Name:        violation.Name,
+				Field:       violation.Field,
+				Message:     fmt.Sprintf("plaintext secret data is not allowed, use one of %s instead", strings.Join(policy.AllowedKinds, ", ")),
+			})
+		}
+	}
+	return result
+}
+
 func canonicalizeYaml(unformatted string) string {
 	var target RawNode
 	if errDeserial := yaml3.Unmarshal([]byte(unformatted), &target); errDeserial != nil {
@@ -812,11 +958,12 @@ func canonicalizeYaml(unformatted string) string {
 }
 
 func createUnifiedDiff(existingValue string, requestValue string, prefix string) string {
-	existingValueStr := string(existingValue)
-	existingFilename := fmt.Sprintf("%sexisting", prefix)
-	requestFilename := fmt.Sprintf("%srequest", prefix)
-	edits := myers.ComputeEdits(diffspan.URIFromPath(existingFilename), existingValueStr, string(requestValue))
-	return fmt.Sprint(gotextdiff.ToUnified(existingFilename, requestFilename, existingValueStr, edits))
+	return unifiedDiff(fmt.Sprintf("%sexisting", prefix), fmt.Sprintf("%srequest", prefix), existingValue, requestValue)
+}
+
+func unifiedDiff(fromFilename, toFilename, from, to string) string {
+	edits := myers.ComputeEdits(diffspan.URIFromPath(fromFilename), from, to)
+	return fmt.Sprint(gotextdiff.ToUnified(fromFilename, toFilename, from, edits))
 }
 
 func isLatestsVersion(state *State, application string, version uint64) (bool, error) {
@@ -909,10 +1056,12 @@ func (c *CreateUndeployApplicationVersion) Transform(
 				Application: c.Application,
 				Version:     lastRelease + 1,
 				// the train should queue deployments, instead of giving up:
-				LockBehaviour:   api.LockBehavior_RECORD,
-				Authentication:  c.Authentication,
-				WriteCommitData: c.WriteCommitData,
-				Author:          "",
+				LockBehaviour:     api.LockBehavior_RECORD,
+				Authentication:    c.Authentication,
+				WriteCommitData:   c.WriteCommitData,
+				Author:            "",
+				RolledBackVersion: nil,
+				Reason:            "",
 			}
 			err := t.Execute(d, transaction)
 			if err != nil {
@@ -928,6 +1077,20 @@ func (c *CreateUndeployApplicationVersion) Transform(
 	return fmt.Sprintf("created undeploy-version %d of '%v'", lastRelease+1, c.Application), nil
 }
 
+// removeReleaseCommit removes the commit data written by writeCommitData for the release in releaseDir.
+func removeReleaseCommit(fs billy.Filesystem, releaseDir, application string) error {
+	dat, err := util.ReadFile(fs, fs.Join(releaseDir, fieldSourceCommitId))
+	if err != nil {
+		// not a problem, might be the undeploy commit or the commit has was not specified in CreateApplicationVersion
+		return nil
+	}
+	commitID := string(dat)
+	if !valid.SHA1CommitID(commitID) {
+		return nil
+	}
+	return removeCommit(fs, commitID, application)
+}
+
 func removeCommit(fs billy.Filesystem, commitID, application string) error {
 	errorTemplate := func(message string, err error) error {
 		return fmt.Errorf("while removing applicaton %s from commit %s and error was encountered, message: %s, error %w", application, commitID, message, err)
@@ -1204,10 +1367,39 @@ func findOldApplicationVersions(ctx context.Context, transaction *sql.Tx, state
 		return versions[i] >= oldestDeployedVersion
 	})
 
-	if positionOfOldestVersion < (int(state.ReleaseVersionsLimit) - 1) {
+	policy, err := state.GetApplicationRetentionPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(state.ReleaseVersionsLimit)
+	if policy != nil && policy.MaxCount != nil {
+		limit = int(*policy.MaxCount)
+	}
+	candidates := []uint64{}
+	if positionOfOldestVersion >= limit-1 {
+		candidates = versions[0 : positionOfOldestVersion-(limit-1)]
+	}
+	if policy != nil {
+		candidates, err = policy.apply(ctx, state, name, envConfigs, candidates, versions[len(candidates):positionOfOldestVersion])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(candidates) == 0 {
 		return nil, nil
 	}
-	return versions[0 : positionOfOldestVersion-(int(state.ReleaseVersionsLimit)-1)], err
+	oldVersions := []uint64{}
+	for _, version := range candidates {
+		// pinned versions are kept, e.g. as the last known good version to roll back to
+		isPinned, err := state.IsPinnedVersion(name, version)
+		if err != nil {
+			return nil, err
+		}
+		if !isPinned {
+			oldVersions = append(oldVersions, version)
+		}
+	}
+	return oldVersions, nil
 }
 
 func (c *CleanupOldApplicationVersions) Transform(
@@ -1231,19 +1423,8 @@ func (c *CleanupOldApplicationVersions) Transform(
 			return "", wrapFileError(err, releasesDir, "CleanupOldApplicationVersions: could not stat")
 		}
 
-		{
-			commitIDFile := fs.Join(releasesDir, fieldSourceCommitId)
-			dat, err := util.ReadFile(fs, commitIDFile)
-			if err != nil {
-				// not a problem, might be the undeploy commit or the commit has was not specified in CreateApplicationVersion
-			} else {
-				commitID := string(dat)
-				if valid.SHA1CommitID(commitID) {
-					if err := removeCommit(fs, commitID, c.Application); err != nil {
-						return "", wrapFileError(err, releasesDir, "CleanupOldApplicationVersions: could not remove commit path")
-					}
-				}
-			}
+		if err := removeReleaseCommit(fs, releasesDir, c.Application); err != nil {
+			return "", wrapFileError(err, releasesDir, "CleanupOldApplicationVersions: could not remove commit path")
 		}
 
 		err = fs.Remove(releasesDir)
@@ -1257,172 +1438,505 @@ func (c *CleanupOldApplicationVersions) Transform(
 	return msg, nil
 }
 
-func wrapFileError(e error, filename string, message string) error {
-	return fmt.Errorf("%s '%s': %w", message, filename, e)
-}
-
-type Authentication struct {
-	RBACConfig auth.RBACConfig
-}
-
-type CreateEnvironmentLock struct {
+type DeleteApplicationVersion struct {
 	Authentication `json:"-"`
-	Environment    string `json:"env"`
-	LockId         string `json:"lockId"`
-	Message        string `json:"message"`
-}
-
-func (c *CreateEnvironmentLock) GetDBEventType() db.EventType {
-	return db.EvtCreateEnvironmentLock
-}
-
-func (s *State) checkUserPermissions(ctx context.Context, env, application, action, team string, RBACConfig auth.RBACConfig) error {
-	if !RBACConfig.DexEnabled {
-		return nil
-	}
-	user, err := auth.ReadUserFromContext(ctx)
-	if err != nil {
-		return fmt.Errorf(fmt.Sprintf("checkUserPermissions: user not found: %v", err))
-	}
-
-	envs, err := s.GetEnvironmentConfigs()
-	if err != nil {
-		return err
-	}
-	var group string
-	for envName, config := range envs {
-		if envName == env {
-			group = mapper.DeriveGroupName(config, env)
-			break
-		}
-	}
-	if group == "" {
-		return fmt.Errorf("group not found for environment: %s", env)
-	}
-	return auth.CheckUserPermissions(RBACConfig, user, env, team, group, application, action)
+	Application    string `json:"app"`
+	Version        uint64 `json:"version"`
+	// Deletes the release even if it is deployed or queued. Requires the ForceDeleteRelease permission on those environments.
+	Force bool `json:"force"`
 }
 
-// checkUserPermissionsCreateEnvironment check the permission for the environment creation action.
-// This is a "special" case because the environment group is already provided on the request.
-func (s *State) checkUserPermissionsCreateEnvironment(ctx context.Context, RBACConfig auth.RBACConfig, envConfig config.EnvironmentConfig) error {
-	if !RBACConfig.DexEnabled {
-		return nil
-	}
-	user, err := auth.ReadUserFromContext(ctx)
-	if err != nil {
-		return fmt.Errorf(fmt.Sprintf("checkUserPermissions: user not found: %v", err))
-	}
-	envGroup := "*"
-	// If an env group is provided on the request, use it on the permission.
-	if envConfig.EnvironmentGroup != nil {
-		envGroup = *(envConfig.EnvironmentGroup)
-	}
-	return auth.CheckUserPermissions(RBACConfig, user, "*", "", envGroup, "*", auth.PermissionCreateEnvironment)
+func (c *DeleteApplicationVersion) GetDBEventType() db.EventType {
+	return db.EvtDeleteApplicationVersion
 }
 
-func (c *CreateEnvironmentLock) Transform(
+func (c *DeleteApplicationVersion) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionCreateLock, "", c.RBACConfig)
-	if err != nil {
-		return "", err
-	}
 	fs := state.Filesystem
-	envDir := fs.Join("environments", c.Environment)
-	if _, err := fs.Stat(envDir); err != nil {
-		return "", fmt.Errorf("error accessing dir %q: %w", envDir, err)
+	releaseDir := releasesDirectoryWithVersion(fs, c.Application, c.Version)
+	if _, err := fs.Stat(releaseDir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.PublicError(ctx, fmt.Errorf("release %d of application %q does not exist", c.Version, c.Application))
+		}
+		return "", err
 	}
-	chroot, err := fs.Chroot(envDir)
+	team, err := state.GetApplicationTeamOwner(c.Application)
 	if err != nil {
 		return "", err
 	}
-	if err := createLock(ctx, chroot, c.LockId, c.Message); err != nil {
+	releaseEnvs, err := names(fs, fs.Join(releaseDir, "environments"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return "", err
 	}
-	GaugeEnvLockMetric(fs, c.Environment)
-	return fmt.Sprintf("Created lock %q on environment %q", c.LockId, c.Environment), nil
-}
-
-func createLock(ctx context.Context, fs billy.Filesystem, lockId, message string) error {
-	locksDir := "locks"
-	if err := fs.MkdirAll(locksDir, 0777); err != nil {
-		return err
+	// the same permission as for creating the release is required
+	sort.Strings(releaseEnvs)
+	for _, env := range releaseEnvs {
+		err := state.checkUserPermissions(ctx, env, c.Application, auth.PermissionCreateRelease, team, c.RBACConfig)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	user, err := auth.ReadUserFromContext(ctx)
+	envConfigs, err := state.GetEnvironmentConfigs()
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	// create lock dir
-	newLockDir := fs.Join(locksDir, lockId)
-	if err := fs.MkdirAll(newLockDir, 0777); err != nil {
-		return err
+	envs := make([]string, 0, len(envConfigs))
+	for env := range envConfigs {
+		envs = append(envs, env)
 	}
-
-	// write message
-	if err := util.WriteFile(fs, fs.Join(newLockDir, "message"), []byte(message), 0666); err != nil {
-		return err
+	sort.Strings(envs)
+	deployedEnvs := []string{}
+	queuedEnvs := []string{}
+	for _, env := range envs {
+		deployed, err := state.GetEnvironmentApplicationVersion(ctx, env, c.Application, transaction)
+		if err != nil {
+			return "", err
+		}
+		queued, err := state.GetQueuedVersion(env, c.Application)
+		if err != nil {
+			return "", err
+		}
+		isDeployed := deployed != nil && *deployed == c.Version
+		isQueued := queued != nil && *queued == c.Version
+		if !isDeployed && !isQueued {
+			continue
+		}
+		if !c.Force {
+			if isDeployed {
+				return "", grpc.PublicError(ctx, fmt.Errorf("cannot delete release %d of application %q: it is deployed on environment %q", c.Version, c.Application, env))
+			}
+			return "", grpc.PublicError(ctx, fmt.Errorf("cannot delete release %d of application %q: it is queued on environment %q", c.Version, c.Application, env))
+		}
+		err = state.checkUserPermissions(ctx, env, c.Application, auth.PermissionForceDeleteRelease, team, c.RBACConfig)
+		if err != nil {
+			return "", err
+		}
+		if isDeployed {
+			deployedEnvs = append(deployedEnvs, env)
+		}
+		if isQueued {
+			queuedEnvs = append(queuedEnvs, env)
+		}
 	}
 
-	// write email
-	if err := util.WriteFile(fs, fs.Join(newLockDir, "created_by_email"), []byte(user.Email), 0666); err != nil {
-		return err
+	for _, env := range queuedEnvs {
+		if err := state.DeleteQueuedVersion(env, c.Application); err != nil {
+			return "", err
+		}
 	}
-
-	// write name
-	if err := util.WriteFile(fs, fs.Join(newLockDir, "created_by_name"), []byte(user.Name), 0666); err != nil {
-		return err
+	// a deleted release cannot stay deployed, so the application is removed from these environments
+	for _, env := range deployedEnvs {
+		if err := state.removeDeployment(ctx, transaction, env, c.Application); err != nil {
+			return "", err
+		}
+		t.AddAppEnv(c.Application, env, team)
 	}
+	if err := removeReleaseCommit(fs, releaseDir, c.Application); err != nil {
+		return "", wrapFileError(err, releaseDir, "DeleteApplicationVersion: could not remove commit path")
+	}
+	if err := fs.Remove(releaseDir); err != nil {
+		return "", fmt.Errorf("DeleteApplicationVersion: could not remove release %d of app %s: %w", c.Version, c.Application, err)
+	}
+	msg := fmt.Sprintf("deleted version %d of app %q", c.Version, c.Application)
+	if len(deployedEnvs) > 0 {
+		msg = fmt.Sprintf("%s and removed it from environments %s", msg, strings.Join(deployedEnvs, ", "))
+	}
+	return msg, nil
+}
 
-	// write date in iso format
-	if err := util.WriteFile(fs, fs.Join(newLockDir, fieldCreatedAt), []byte(getTimeNow(ctx).Format(time.RFC3339)), 0666); err != nil {
-		return err
+// removeDeployment removes the deployed version of an application on an environment, including the manifests for argocd.
+func (s *State) removeDeployment(ctx context.Context, transaction *sql.Tx, environment, application string) error {
+	fs := s.Filesystem
+	if s.DBHandler.ShouldUseOtherTables() {
+		existingDeployment, err := s.DBHandler.DBSelectDeployment(ctx, transaction, application, environment)
+		if err != nil {
+			return fmt.Errorf("could not find deployment for app %s and env %s: %w", application, environment, err)
+		}
+		if existingDeployment == nil {
+			return nil
+		}
+		user, err := auth.ReadUserFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		err = s.DBHandler.DBWriteDeployment(ctx, transaction, db.Deployment{
+			EslVersion: 0,
+			Created:    time.Time{},
+			App:        application,
+			Env:        environment,
+			Version:    nil,
+			Metadata: db.DeploymentMetadata{
+				DeployedByEmail: user.Email,
+				DeployedByName:  user.Name,
+			},
+		}, existingDeployment.EslVersion)
+		if err != nil {
+			return fmt.Errorf("could not write deployment for app %s and env %s: %w", application, environment, err)
+		}
+	}
+	applicationDir := environmentApplicationDirectory(fs, environment, application)
+	for _, file := range []string{"version", "manifests"} {
+		if err := fs.Remove(fs.Join(applicationDir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
 	return nil
 }
 
-type DeleteEnvironmentLock struct {
+type PinApplicationVersion struct {
 	Authentication `json:"-"`
-	Environment    string `json:"env"`
-	LockId         string `json:"lockId"`
+	Application    string `json:"app"`
+	Version        uint64 `json:"version"`
+	Pinned         bool   `json:"pinned"`
 }
 
-func (c *DeleteEnvironmentLock) GetDBEventType() db.EventType {
-	return db.EvtDeleteEnvironmentLock
+func (c *PinApplicationVersion) GetDBEventType() db.EventType {
+	return db.EvtPinApplicationVersion
 }
 
-func (c *DeleteEnvironmentLock) Transform(
+func (c *PinApplicationVersion) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionDeleteLock, "", c.RBACConfig)
-	if err != nil {
-		return "", err
-	}
 	fs := state.Filesystem
-	s := State{
-		Commit:                 nil,
-		BootstrapMode:          false,
-		EnvironmentConfigsPath: "",
-		Filesystem:             fs,
-		DBHandler:              state.DBHandler,
-		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
-		CloudRunClient:         state.CloudRunClient,
-	}
-	lockDir := s.GetEnvLockDir(c.Environment, c.LockId)
-	_, err = fs.Stat(lockDir)
-	if err != nil {
+	releaseDir := releasesDirectoryWithVersion(fs, c.Application, c.Version)
+	if _, err := fs.Stat(releaseDir); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for env lock does not exist", lockDir))
+			return "", grpc.PublicError(ctx, fmt.Errorf("release %d of application %q does not exist", c.Version, c.Application))
 		}
 		return "", err
 	}
+	envs, err := names(fs, fs.Join(releaseDir, "environments"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	team, err := state.GetApplicationTeamOwner(c.Application)
+	if err != nil {
+		return "", err
+	}
+	// the same permission as for creating the release is required
+	sort.Strings(envs)
+	for _, env := range envs {
+		err := state.checkUserPermissions(ctx, env, c.Application, auth.PermissionCreateRelease, team, c.RBACConfig)
+		if err != nil {
+			return "", err
+		}
+	}
+	pinnedFile := fs.Join(releaseDir, "pinned")
+	if c.Pinned {
+		if err := util.WriteFile(fs, pinnedFile, []byte(""), 0666); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("pinned version %d of app %q", c.Version, c.Application), nil
+	}
+	if err := fs.Remove(pinnedFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return fmt.Sprintf("unpinned version %d of app %q", c.Version, c.Application), nil
+}
+
+type SetApplicationRetentionPolicy struct {
+	Authentication `json:"-"`
+	Application    string `json:"app"`
+	// nil removes the retention policy, so that the global limit applies again
+	Policy *RetentionPolicy `json:"policy"`
+}
+
+func (c *SetApplicationRetentionPolicy) GetDBEventType() db.EventType {
+	return db.EvtSetApplicationRetentionPolicy
+}
+
+func (c *SetApplicationRetentionPolicy) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	fs := state.Filesystem
+	appDir := applicationDirectory(fs, c.Application)
+	if _, err := fs.Stat(appDir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.PublicError(ctx, fmt.Errorf("application %q does not exist", c.Application))
+		}
+		return "", err
+	}
+	if c.Policy != nil {
+		if err := ValidateRetentionPolicy(*c.Policy); err != nil {
+			return "", grpc.PublicError(ctx, err)
+		}
+	}
+	envConfigs, err := state.GetEnvironmentConfigs()
+	if err != nil {
+		return "", err
+	}
+	team, err := state.GetApplicationTeamOwner(c.Application)
+	if err != nil {
+		return "", err
+	}
+	// the policy affects the releases of all environments
+	envs := make([]string, 0, len(envConfigs))
+	for env := range envConfigs {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		if err := state.checkUserPermissions(ctx, env, c.Application, auth.PermissionCreateRelease, team, c.RBACConfig); err != nil {
+			return "", err
+		}
+	}
+	file := fs.Join(appDir, fieldRetentionPolicy)
+	if c.Policy == nil {
+		if err := fs.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		return fmt.Sprintf("removed retention policy of app %q", c.Application), nil
+	}
+	content, err := json.MarshalIndent(c.Policy, "", " ")
+	if err != nil {
+		return "", err
+	}
+	// util.WriteFile does not truncate existing files
+	if err := fs.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := util.WriteFile(fs, file, append(content, '\n'), 0666); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("set retention policy of app %q", c.Application), nil
+}
+
+func wrapFileError(e error, filename string, message string) error {
+	return fmt.Errorf("%s '%s': %w", message, filename, e)
+}
+
+type Authentication struct {
+	RBACConfig auth.RBACConfig
+}
+
+type CreateEnvironmentLock struct {
+	Authentication `json:"-"`
+	Environment    string     `json:"env"`
+	LockId         string     `json:"lockId"`
+	Message        string     `json:"message"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (c *CreateEnvironmentLock) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironmentLock
+}
+
+func (s *State) checkUserPermissions(ctx context.Context, env, application, action, team string, RBACConfig auth.RBACConfig) error {
+	if !RBACConfig.DexEnabled {
+		return nil
+	}
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf(fmt.Sprintf("checkUserPermissions: user not found: %v", err))
+	}
+	group, err := s.getEnvironmentGroup(env)
+	if err != nil {
+		return err
+	}
+	return auth.CheckUserPermissions(RBACConfig, user, env, team, group, application, action)
+}
+
+// checkUserCanDeleteLock checks the lock ownership policy for the lock in lockDir.
+// It must be called in addition to checkUserPermissions.
+func (s *State) checkUserCanDeleteLock(ctx context.Context, env, application, team, lockDir string, RBACConfig auth.RBACConfig) error {
+	if !RBACConfig.DexEnabled || !RBACConfig.LockOwnership {
+		return nil
+	}
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf(fmt.Sprintf("checkUserCanDeleteLock: user not found: %v", err))
+	}
+	group, err := s.getEnvironmentGroup(env)
+	if err != nil {
+		return err
+	}
+	lock, err := readLock(s.Filesystem, lockDir)
+	if err != nil {
+		return err
+	}
+	return auth.CheckUserCanDeleteLock(RBACConfig, user, env, team, group, application, lock.CreatedBy.Email)
+}
+
+func (s *State) getEnvironmentGroup(env string) (string, error) {
+	envs, err := s.GetEnvironmentConfigs()
+	if err != nil {
+		return "", err
+	}
+	var group string
+	for envName, config := range envs {
+		if envName == env {
+			group = mapper.DeriveGroupName(config, env)
+			break
+		}
+	}
+	if group == "" {
+		return "", fmt.Errorf("group not found for environment: %s", env)
+	}
+	return group, nil
+}
+
+// checkUserPermissionsNewEnvironment checks the permission for an environment that does not exist yet,
+// using the environment group of its config.
+func (s *State) checkUserPermissionsNewEnvironment(ctx context.Context, RBACConfig auth.RBACConfig, env string, envConfig config.EnvironmentConfig, action string) error {
+	if !RBACConfig.DexEnabled {
+		return nil
+	}
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf(fmt.Sprintf("checkUserPermissions: user not found: %v", err))
+	}
+	return auth.CheckUserPermissions(RBACConfig, user, env, "", mapper.DeriveGroupName(envConfig, env), "*", action)
+}
+
+// checkUserPermissionsCreateEnvironment check the permission for the environment creation action.
+// This is a "special" case because the environment group is already provided on the request.
+func (s *State) checkUserPermissionsCreateEnvironment(ctx context.Context, RBACConfig auth.RBACConfig, envConfig config.EnvironmentConfig) error {
+	if !RBACConfig.DexEnabled {
+		return nil
+	}
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf(fmt.Sprintf("checkUserPermissions: user not found: %v", err))
+	}
+	envGroup := "*"
+	// If an env group is provided on the request, use it on the permission.
+	if envConfig.EnvironmentGroup != nil {
+		envGroup = *(envConfig.EnvironmentGroup)
+	}
+	return auth.CheckUserPermissions(RBACConfig, user, "*", "", envGroup, "*", auth.PermissionCreateEnvironment)
+}
+
+func (c *CreateEnvironmentLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionCreateLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	envDir := fs.Join("environments", c.Environment)
+	if _, err := fs.Stat(envDir); err != nil {
+		return "", fmt.Errorf("error accessing dir %q: %w", envDir, err)
+	}
+	chroot, err := fs.Chroot(envDir)
+	if err != nil {
+		return "", err
+	}
+	if err := createLock(ctx, chroot, c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+	if err := state.writeLockCreatedEvent(ctx, transaction, c.Environment, "", "", "", c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+	GaugeEnvLockMetric(fs, c.Environment)
+	return fmt.Sprintf("Created lock %q on environment %q", c.LockId, c.Environment), nil
+}
+
+func createLock(ctx context.Context, fs billy.Filesystem, lockId, message string, expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(getTimeNow(ctx)) {
+		return grpc.PublicError(ctx, fmt.Errorf("cannot create lock %q: expiry date %s is not in the future", lockId, expiresAt.Format(time.RFC3339)))
+	}
+	locksDir := "locks"
+	if err := fs.MkdirAll(locksDir, 0777); err != nil {
+		return err
+	}
+
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// create lock dir
+	newLockDir := fs.Join(locksDir, lockId)
+	if err := fs.MkdirAll(newLockDir, 0777); err != nil {
+		return err
+	}
+
+	// write message
+	if err := util.WriteFile(fs, fs.Join(newLockDir, "message"), []byte(message), 0666); err != nil {
+		return err
+	}
+
+	// write email
+	if err := util.WriteFile(fs, fs.Join(newLockDir, "created_by_email"), []byte(user.Email), 0666); err != nil {
+		return err
+	}
+
+	// write name
+	if err := util.WriteFile(fs, fs.Join(newLockDir, "created_by_name"), []byte(user.Name), 0666); err != nil {
+		return err
+	}
+
+	// write date in iso format
+	if err := util.WriteFile(fs, fs.Join(newLockDir, fieldCreatedAt), []byte(getTimeNow(ctx).Format(time.RFC3339)), 0666); err != nil {
+		return err
+	}
+
+	// write expiry date in iso format, locks without this file never expire
+	if expiresAt != nil {
+		if err := util.WriteFile(fs, fs.Join(newLockDir, fieldExpiresAt), []byte(expiresAt.UTC().Format(time.RFC3339)), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type DeleteEnvironmentLock struct {
+	Authentication `json:"-"`
+	Environment    string `json:"env"`
+	LockId         string `json:"lockId"`
+}
+
+func (c *DeleteEnvironmentLock) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironmentLock
+}
+
+func (c *DeleteEnvironmentLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionDeleteLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	s := State{
+		Commit:                 nil,
+		BootstrapMode:          false,
+		EnvironmentConfigsPath: "",
+		Filesystem:             fs,
+		DBHandler:              state.DBHandler,
+		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
+		CloudRunClient:         state.CloudRunClient,
+		ManifestValidator:      state.ManifestValidator,
+	}
+	lockDir := s.GetEnvLockDir(c.Environment, c.LockId)
+	_, err = fs.Stat(lockDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for env lock does not exist", lockDir))
+		}
+		return "", err
+	}
+	if err := s.checkUserCanDeleteLock(ctx, c.Environment, "*", "", lockDir, c.RBACConfig); err != nil {
+		return "", err
+	}
 
 	if err := fs.Remove(lockDir); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return "", fmt.Errorf("failed to delete directory %q: %w", lockDir, err)
@@ -1430,15 +1944,478 @@ func (c *DeleteEnvironmentLock) Transform(
 	if err := s.DeleteEnvLockIfEmpty(ctx, c.Environment); err != nil {
 		return "", err
 	}
+	if err := s.writeLockDeletedEvent(ctx, transaction, c.Environment, "", "", "", c.LockId); err != nil {
+		return "", err
+	}
 
 	apps, err := s.GetEnvironmentApplications(ctx, transaction, c.Environment)
 	if err != nil {
 		return "", fmt.Errorf("environment applications for %q not found: %v", c.Environment, err.Error())
 	}
-
+
+	additionalMessageFromDeployment := ""
+	for _, appName := range apps {
+		queueMessage, err := s.ProcessQueue(ctx, transaction, fs, c.Environment, appName)
+		if err != nil {
+			return "", err
+		}
+		if queueMessage != "" {
+			additionalMessageFromDeployment = additionalMessageFromDeployment + "\n" + queueMessage
+		}
+	}
+	GaugeEnvLockMetric(fs, c.Environment)
+	return fmt.Sprintf("Deleted lock %q on environment %q%s", c.LockId, c.Environment, additionalMessageFromDeployment), nil
+}
+
+type CreateEnvironmentGroupLock struct {
+	Authentication   `json:"-"`
+	EnvironmentGroup string     `json:"env"`
+	LockId           string     `json:"lockId"`
+	Message          string     `json:"message"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (c *CreateEnvironmentGroupLock) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironmentGroupLock
+}
+
+func (c *CreateEnvironmentGroupLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.EnvironmentGroup, "*", auth.PermissionCreateLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	envNamesSorted, err := state.GetEnvironmentConfigsForGroup(c.EnvironmentGroup)
+	if err != nil {
+		return "", grpc.PublicError(ctx, err)
+	}
+	logger.FromContext(ctx).Sugar().Warnf("envNamesSorted: %v", envNamesSorted)
+	for index := range envNamesSorted {
+		envName := envNamesSorted[index]
+		x := CreateEnvironmentLock{
+			Authentication: c.Authentication,
+			Environment:    envName,
+			LockId:         c.LockId, // the IDs should be the same for all. See `useLocksSimilarTo` in store.tsx
+			Message:        c.Message,
+			ExpiresAt:      c.ExpiresAt,
+		}
+		if err := t.Execute(&x, transaction); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("Creating locks '%s' for environment group '%s':", c.LockId, c.EnvironmentGroup), nil
+}
+
+type DeleteEnvironmentGroupLock struct {
+	Authentication   `json:"-"`
+	EnvironmentGroup string `json:"envGroup"`
+	LockId           string `json:"lockId"`
+}
+
+func (c *DeleteEnvironmentGroupLock) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironmentGroupLock
+}
+
+func (c *DeleteEnvironmentGroupLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.EnvironmentGroup, "*", auth.PermissionDeleteLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	envNamesSorted, err := state.GetEnvironmentConfigsForGroup(c.EnvironmentGroup)
+	if err != nil {
+		return "", grpc.PublicError(ctx, err)
+	}
+	for index := range envNamesSorted {
+		envName := envNamesSorted[index]
+		x := DeleteEnvironmentLock{
+			Authentication: c.Authentication,
+			Environment:    envName,
+			LockId:         c.LockId,
+		}
+		if err := t.Execute(&x, transaction); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("Deleting locks '%s' for environment group '%s':", c.LockId, c.EnvironmentGroup), nil
+}
+
+type CreateEnvironmentApplicationLock struct {
+	Authentication `json:"-"`
+	Environment    string     `json:"env"`
+	Application    string     `json:"app"`
+	LockId         string     `json:"lockId"`
+	Message        string     `json:"message"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (c *CreateEnvironmentApplicationLock) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironmentApplicationLock
+}
+
+func (c *CreateEnvironmentApplicationLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	// Note: it's possible to lock an application BEFORE it's even deployed to the environment.
+	err := state.checkUserPermissions(ctx, c.Environment, c.Application, auth.PermissionCreateLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	envDir := fs.Join("environments", c.Environment)
+	if _, err := fs.Stat(envDir); err != nil {
+		return "", fmt.Errorf("error accessing dir %q: %w", envDir, err)
+	}
+
+	appDir := fs.Join(envDir, "applications", c.Application)
+	if err := fs.MkdirAll(appDir, 0777); err != nil {
+		return "", err
+	}
+	chroot, err := fs.Chroot(appDir)
+	if err != nil {
+		return "", err
+	}
+	if err := createLock(ctx, chroot, c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+	if err := state.writeLockCreatedEvent(ctx, transaction, c.Environment, c.Application, "", "", c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+	GaugeEnvAppLockMetric(fs, c.Environment, c.Application)
+	// locks are invisible to argoCd, so no changes here
+	return fmt.Sprintf("Created lock %q on environment %q for application %q", c.LockId, c.Environment, c.Application), nil
+}
+
+type DeleteEnvironmentApplicationLock struct {
+	Authentication `json:"-"`
+	Environment    string `json:"env"`
+	Application    string `json:"app"`
+	LockId         string `json:"lockId"`
+}
+
+func (c *DeleteEnvironmentApplicationLock) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironmentApplicationLock
+}
+
+func (c *DeleteEnvironmentApplicationLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, c.Application, auth.PermissionDeleteLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	lockDir := fs.Join("environments", c.Environment, "applications", c.Application, "locks", c.LockId)
+	_, err = fs.Stat(lockDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for app lock does not exist", lockDir))
+		}
+		return "", err
+	}
+	team, err := state.GetApplicationTeamOwner(c.Application)
+	if err != nil {
+		return "", err
+	}
+	if err := state.checkUserCanDeleteLock(ctx, c.Environment, c.Application, team, lockDir, c.RBACConfig); err != nil {
+		return "", err
+	}
+	if err := fs.Remove(lockDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to delete directory %q: %w", lockDir, err)
+	}
+	s := State{
+		Commit:                 nil,
+		BootstrapMode:          false,
+		EnvironmentConfigsPath: "",
+		Filesystem:             fs,
+		DBHandler:              state.DBHandler,
+		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
+		CloudRunClient:         state.CloudRunClient,
+		ManifestValidator:      state.ManifestValidator,
+	}
+	if err := s.DeleteAppLockIfEmpty(ctx, c.Environment, c.Application); err != nil {
+		return "", err
+	}
+	if err := s.writeLockDeletedEvent(ctx, transaction, c.Environment, c.Application, "", "", c.LockId); err != nil {
+		return "", err
+	}
+	queueMessage, err := s.ProcessQueue(ctx, transaction, fs, c.Environment, c.Application)
+	if err != nil {
+		return "", err
+	}
+	GaugeEnvAppLockMetric(fs, c.Environment, c.Application)
+	return fmt.Sprintf("Deleted lock %q on environment %q for application %q%s", c.LockId, c.Environment, c.Application, queueMessage), nil
+}
+
+type CreateEnvironmentTeamLock struct {
+	Authentication `json:"-"`
+	Environment    string     `json:"env"`
+	Team           string     `json:"team"`
+	LockId         string     `json:"lockId"`
+	Message        string     `json:"message"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (c *CreateEnvironmentTeamLock) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironmentTeamLock
+}
+
+func (c *CreateEnvironmentTeamLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	// Note: it's possible to lock an application BEFORE it's even deployed to the environment.
+	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionCreateLock, c.Team, c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+
+	if !valid.EnvironmentName(c.Environment) {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create environment team lock: invalid environment: '%s'", c.Environment))
+	}
+	if !valid.TeamName(c.Team) {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create environment team lock: invalid team: '%s'", c.Team))
+	}
+	if !valid.LockId(c.LockId) {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create environment team lock: invalid lock id: '%s'", c.LockId))
+	}
+
+	fs := state.Filesystem
+
+	foundTeam := false
+	if apps, err := state.GetApplicationsFromFile(); err == nil {
+		for _, currentApp := range apps {
+			currentTeamFile := fs.Join("applications", currentApp, "team")
+			if currentTeamName, err := util.ReadFile(fs, currentTeamFile); err == nil {
+				if c.Team == string(currentTeamName) {
+					foundTeam = true
+					break
+				}
+			} else {
+				logger.FromContext(ctx).Sugar().Warnf("CreateEnvironmentTeamLock: Could not find team for application: %s.", currentApp)
+			}
+		}
+	}
+	if err != nil || !foundTeam { //Not found team or apps dir doesn't exist
+		return "", &TeamNotFoundErr{err: fmt.Errorf("Team '%s' does not exist.", c.Team)}
+	}
+
+	envDir := fs.Join("environments", c.Environment)
+	if _, err := fs.Stat(envDir); err != nil {
+		return "", fmt.Errorf("error environment not found dir %q: %w", envDir, err)
+	}
+
+	teamDir := fs.Join(envDir, "teams", c.Team)
+	if err := fs.MkdirAll(teamDir, 0777); err != nil {
+		return "", fmt.Errorf("error could not create teams directory %q: %w", envDir, err)
+	}
+	chroot, err := fs.Chroot(teamDir)
+	if err != nil {
+		return "", fmt.Errorf("error changing root of fs to  %s: %w", teamDir, err)
+	}
+	if err := createLock(ctx, chroot, c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", fmt.Errorf("error creating lock. ID: %s Lock Message: %s. %w", c.LockId, c.Message, err)
+	}
+	if err := state.writeLockCreatedEvent(ctx, transaction, c.Environment, "", c.Team, "", c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Created lock %q on environment %q for team %q", c.LockId, c.Environment, c.Team), nil
+}
+
+type DeleteEnvironmentTeamLock struct {
+	Authentication `json:"-"`
+	Environment    string `json:"env"`
+	Team           string `json:"team"`
+	LockId         string `json:"lockId"`
+}
+
+func (c *DeleteEnvironmentTeamLock) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironmentTeamLock
+}
+
+func (c *DeleteEnvironmentTeamLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, "", auth.PermissionDeleteLock, c.Team, c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+
+	if !valid.EnvironmentName(c.Environment) {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment team lock: invalid environment: '%s'", c.Environment))
+	}
+	if !valid.TeamName(c.Team) {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment team lock: invalid team: '%s'", c.Team))
+	}
+	if !valid.LockId(c.LockId) {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment team lock: invalid lock id: '%s'", c.LockId))
+	}
+
+	fs := state.Filesystem
+	lockDir := fs.Join("environments", c.Environment, "teams", c.Team, "locks", c.LockId)
+	_, err = fs.Stat(lockDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for team lock does not exist", lockDir))
+		}
+		return "", err
+	}
+	if err := state.checkUserCanDeleteLock(ctx, c.Environment, "*", c.Team, lockDir, c.RBACConfig); err != nil {
+		return "", err
+	}
+	if err := fs.Remove(lockDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to delete directory %q: %w", lockDir, err)
+	}
+	s := State{
+		Commit:                 nil,
+		BootstrapMode:          false,
+		EnvironmentConfigsPath: "",
+		Filesystem:             fs,
+		DBHandler:              state.DBHandler,
+		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
+		CloudRunClient:         state.CloudRunClient,
+		ManifestValidator:      state.ManifestValidator,
+	}
+	if err := s.DeleteTeamLockIfEmpty(ctx, c.Environment, c.Team); err != nil {
+		return "", err
+	}
+	if err := s.writeLockDeletedEvent(ctx, transaction, c.Environment, "", c.Team, "", c.LockId); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Deleted lock %q on environment %q for team %q", c.LockId, c.Environment, c.Team), nil
+}
+
+type CreateEnvironmentSelectorLock struct {
+	Authentication `json:"-"`
+	Environment    string     `json:"env"`
+	Selector       string     `json:"selector"`
+	LockId         string     `json:"lockId"`
+	Message        string     `json:"message"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (c *CreateEnvironmentSelectorLock) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironmentSelectorLock
+}
+
+func (c *CreateEnvironmentSelectorLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	// The selector can match any application, so the permission is required for all applications
+	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionCreateLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateSelector(c.Selector); err != nil {
+		return "", grpc.PublicError(ctx, err)
+	}
+	fs := state.Filesystem
+	envDir := fs.Join("environments", c.Environment)
+	if _, err := fs.Stat(envDir); err != nil {
+		return "", fmt.Errorf("error accessing dir %q: %w", envDir, err)
+	}
+	selectorsDir := fs.Join(envDir, "selectors")
+	if err := fs.MkdirAll(selectorsDir, 0777); err != nil {
+		return "", err
+	}
+	chroot, err := fs.Chroot(selectorsDir)
+	if err != nil {
+		return "", err
+	}
+	if err := createLock(ctx, chroot, c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+	if err := util.WriteFile(fs, fs.Join(state.GetSelectorLocksDir(c.Environment), c.LockId, fieldSelector), []byte(c.Selector), 0666); err != nil {
+		return "", err
+	}
+	if err := state.writeLockCreatedEvent(ctx, transaction, c.Environment, "", "", c.Selector, c.LockId, c.Message, c.ExpiresAt); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Created lock %q on environment %q for applications matching %q", c.LockId, c.Environment, c.Selector), nil
+}
+
+type DeleteEnvironmentSelectorLock struct {
+	Authentication `json:"-"`
+	Environment    string `json:"env"`
+	LockId         string `json:"lockId"`
+}
+
+func (c *DeleteEnvironmentSelectorLock) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironmentSelectorLock
+}
+
+func (c *DeleteEnvironmentSelectorLock) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionDeleteLock, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	lockDir := fs.Join(state.GetSelectorLocksDir(c.Environment), c.LockId)
+	_, err = fs.Stat(lockDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for selector lock does not exist", lockDir))
+		}
+		return "", err
+	}
+	selector, err := readFile(fs, fs.Join(lockDir, fieldSelector))
+	if err != nil {
+		return "", err
+	}
+	// a selector lock on a team label is owned by that team
+	owningTeam := ""
+	if key, value, isLabel := strings.Cut(string(selector), "="); isLabel && key == selectorLabelTeam {
+		owningTeam = value
+	}
+	if err := state.checkUserCanDeleteLock(ctx, c.Environment, "*", owningTeam, lockDir, c.RBACConfig); err != nil {
+		return "", err
+	}
+	if err := fs.Remove(lockDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to delete directory %q: %w", lockDir, err)
+	}
+	if _, err := state.DeleteDirIfEmpty(state.GetSelectorLocksDir(c.Environment)); err != nil {
+		return "", err
+	}
+	if err := state.writeLockDeletedEvent(ctx, transaction, c.Environment, "", "", string(selector), c.LockId); err != nil {
+		return "", err
+	}
+
+	apps, err := state.GetEnvironmentApplications(ctx, transaction, c.Environment)
+	if err != nil {
+		return "", fmt.Errorf("environment applications for %q not found: %v", c.Environment, err.Error())
+	}
 	additionalMessageFromDeployment := ""
 	for _, appName := range apps {
-		queueMessage, err := s.ProcessQueue(ctx, transaction, fs, c.Environment, appName)
+		queueMessage, err := state.ProcessQueue(ctx, transaction, fs, c.Environment, appName)
 		if err != nil {
 			return "", err
 		}
@@ -1446,78 +2423,70 @@ func (c *DeleteEnvironmentLock) Transform(
 			additionalMessageFromDeployment = additionalMessageFromDeployment + "\n" + queueMessage
 		}
 	}
-	GaugeEnvLockMetric(fs, c.Environment)
-	return fmt.Sprintf("Deleted lock %q on environment %q%s", c.LockId, c.Environment, additionalMessageFromDeployment), nil
+	return fmt.Sprintf("Deleted lock %q on environment %q for applications matching %q%s", c.LockId, c.Environment, string(selector), additionalMessageFromDeployment), nil
 }
 
-type CreateEnvironmentGroupLock struct {
+type CreateEnvironmentGroupSelectorLock struct {
 	Authentication   `json:"-"`
-	EnvironmentGroup string `json:"env"`
-	LockId           string `json:"lockId"`
-	Message          string `json:"message"`
+	EnvironmentGroup string     `json:"envGroup"`
+	Selector         string     `json:"selector"`
+	LockId           string     `json:"lockId"`
+	Message          string     `json:"message"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
 }
 
-func (c *CreateEnvironmentGroupLock) GetDBEventType() db.EventType {
-	return db.EvtCreateEnvironmentGroupLock
+func (c *CreateEnvironmentGroupSelectorLock) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironmentGroupSelectorLock
 }
 
-func (c *CreateEnvironmentGroupLock) Transform(
+func (c *CreateEnvironmentGroupSelectorLock) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	err := state.checkUserPermissions(ctx, c.EnvironmentGroup, "*", auth.PermissionCreateLock, "", c.RBACConfig)
-	if err != nil {
-		return "", err
-	}
 	envNamesSorted, err := state.GetEnvironmentConfigsForGroup(c.EnvironmentGroup)
 	if err != nil {
 		return "", grpc.PublicError(ctx, err)
 	}
-	logger.FromContext(ctx).Sugar().Warnf("envNamesSorted: %v", envNamesSorted)
-	for index := range envNamesSorted {
-		envName := envNamesSorted[index]
-		x := CreateEnvironmentLock{
+	for _, envName := range envNamesSorted {
+		x := CreateEnvironmentSelectorLock{
 			Authentication: c.Authentication,
 			Environment:    envName,
-			LockId:         c.LockId, // the IDs should be the same for all. See `useLocksSimilarTo` in store.tsx
+			Selector:       c.Selector,
+			LockId:         c.LockId, // the IDs should be the same for all, like for environment group locks
 			Message:        c.Message,
+			ExpiresAt:      c.ExpiresAt,
 		}
 		if err := t.Execute(&x, transaction); err != nil {
 			return "", err
 		}
 	}
-	return fmt.Sprintf("Creating locks '%s' for environment group '%s':", c.LockId, c.EnvironmentGroup), nil
+	return fmt.Sprintf("Creating locks '%s' for applications matching '%s' in environment group '%s':", c.LockId, c.Selector, c.EnvironmentGroup), nil
 }
 
-type DeleteEnvironmentGroupLock struct {
+type DeleteEnvironmentGroupSelectorLock struct {
 	Authentication   `json:"-"`
 	EnvironmentGroup string `json:"envGroup"`
 	LockId           string `json:"lockId"`
 }
 
-func (c *DeleteEnvironmentGroupLock) GetDBEventType() db.EventType {
-	return db.EvtDeleteEnvironmentGroupLock
+func (c *DeleteEnvironmentGroupSelectorLock) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironmentGroupSelectorLock
 }
 
-func (c *DeleteEnvironmentGroupLock) Transform(
+func (c *DeleteEnvironmentGroupSelectorLock) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	err := state.checkUserPermissions(ctx, c.EnvironmentGroup, "*", auth.PermissionDeleteLock, "", c.RBACConfig)
-	if err != nil {
-		return "", err
-	}
 	envNamesSorted, err := state.GetEnvironmentConfigsForGroup(c.EnvironmentGroup)
 	if err != nil {
 		return "", grpc.PublicError(ctx, err)
 	}
-	for index := range envNamesSorted {
-		envName := envNamesSorted[index]
-		x := DeleteEnvironmentLock{
+	for _, envName := range envNamesSorted {
+		x := DeleteEnvironmentSelectorLock{
 			Authentication: c.Authentication,
 			Environment:    envName,
 			LockId:         c.LockId,
@@ -1529,282 +2498,430 @@ func (c *DeleteEnvironmentGroupLock) Transform(
 	return fmt.Sprintf("Deleting locks '%s' for environment group '%s':", c.LockId, c.EnvironmentGroup), nil
 }
 
-type CreateEnvironmentApplicationLock struct {
+type CreateEnvironment struct {
 	Authentication `json:"-"`
-	Environment    string `json:"env"`
-	Application    string `json:"app"`
-	LockId         string `json:"lockId"`
-	Message        string `json:"message"`
+	Environment    string                   `json:"env"`
+	Config         config.EnvironmentConfig `json:"config"`
+	// Rejects an upstream environment that does not exist. By default it is accepted, so that environments can be created before their upstream.
+	RequireExistingUpstream bool `json:"requireExistingUpstream,omitempty"`
 }
 
-func (c *CreateEnvironmentApplicationLock) GetDBEventType() db.EventType {
-	return db.EvtCreateEnvironmentApplicationLock
+func (c *CreateEnvironment) GetDBEventType() db.EventType {
+	return db.EvtCreateEnvironment
 }
 
-func (c *CreateEnvironmentApplicationLock) Transform(
+func (c *CreateEnvironment) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	// Note: it's possible to lock an application BEFORE it's even deployed to the environment.
-	err := state.checkUserPermissions(ctx, c.Environment, c.Application, auth.PermissionCreateLock, "", c.RBACConfig)
+	err := state.checkUserPermissionsCreateEnvironment(ctx, c.RBACConfig, c.Config)
 	if err != nil {
 		return "", err
 	}
 	fs := state.Filesystem
 	envDir := fs.Join("environments", c.Environment)
-	if _, err := fs.Stat(envDir); err != nil {
-		return "", fmt.Errorf("error accessing dir %q: %w", envDir, err)
+	// Creation of environment is possible, but configuring it is not if running in bootstrap mode.
+	// Configuration needs to be done by modifying config map in source repo
+	//exhaustruct:ignore
+	defaultConfig := config.EnvironmentConfig{}
+	if state.BootstrapMode && !reflect.DeepEqual(c.Config, defaultConfig) {
+		return "", fmt.Errorf("Cannot create or update configuration in bootstrap mode. Please update configuration in config map instead.")
 	}
-
-	appDir := fs.Join(envDir, "applications", c.Application)
-	if err := fs.MkdirAll(appDir, 0777); err != nil {
-		return "", err
+	if err := ValidateFreezeWindows(c.Config); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot create environment %q: %w", c.Environment, err))
 	}
-	chroot, err := fs.Chroot(appDir)
+	if err := ValidateAutoRollback(c.Config); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot create environment %q: %w", c.Environment, err))
+	}
+	if err := ValidatePromotion(c.Config); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot create environment %q: %w", c.Environment, err))
+	}
+	envConfigs, err := state.GetEnvironmentConfigs()
 	if err != nil {
 		return "", err
 	}
-	if err := createLock(ctx, chroot, c.LockId, c.Message); err != nil {
+	if err := validateEnvironmentUpstreams(envConfigs, c.Environment, c.Config, c.RequireExistingUpstream); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot create environment %q: %w", c.Environment, err))
+	}
+	if err := fs.MkdirAll(envDir, 0777); err != nil {
 		return "", err
 	}
-	GaugeEnvAppLockMetric(fs, c.Environment, c.Application)
-	// locks are invisible to argoCd, so no changes here
-	return fmt.Sprintf("Created lock %q on environment %q for application %q", c.LockId, c.Environment, c.Application), nil
+	configFile := fs.Join(envDir, "config.json")
+	file, err := fs.OpenFile(configFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return "", fmt.Errorf("error creating config: %w", err)
+	}
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.Config); err != nil {
+		return "", fmt.Errorf("error writing json: %w", err)
+	}
+	// we do not need to inform argoCd when creating an environment, as there are no apps yet
+	return fmt.Sprintf("create environment %q", c.Environment), file.Close()
 }
 
-type DeleteEnvironmentApplicationLock struct {
+type DeleteEnvironment struct {
 	Authentication `json:"-"`
 	Environment    string `json:"env"`
-	Application    string `json:"app"`
-	LockId         string `json:"lockId"`
+	// Undeploys all applications that are still deployed on the environment.
+	// Requires the DeleteEnvironmentApplication permission for these applications.
+	Force bool `json:"force"`
 }
 
-func (c *DeleteEnvironmentApplicationLock) GetDBEventType() db.EventType {
-	return db.EvtDeleteEnvironmentApplicationLock
+func (c *DeleteEnvironment) GetDBEventType() db.EventType {
+	return db.EvtDeleteEnvironment
 }
 
-func (c *DeleteEnvironmentApplicationLock) Transform(
+func (c *DeleteEnvironment) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	err := state.checkUserPermissions(ctx, c.Environment, c.Application, auth.PermissionDeleteLock, "", c.RBACConfig)
+	if state.BootstrapMode {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot delete environment %q in bootstrap mode, please update the config map instead", c.Environment))
+	}
+	envConfigs, err := state.GetEnvironmentConfigs()
 	if err != nil {
 		return "", err
 	}
-	fs := state.Filesystem
-	lockDir := fs.Join("environments", c.Environment, "applications", c.Application, "locks", c.LockId)
-	_, err = fs.Stat(lockDir)
+	if _, ok := envConfigs[c.Environment]; !ok {
+		return "", grpc.PublicError(ctx, fmt.Errorf("environment %q does not exist", c.Environment))
+	}
+	err = state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionDeleteEnvironment, "", c.RBACConfig)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for app lock does not exist", lockDir))
-		}
 		return "", err
 	}
-	if err := fs.Remove(lockDir); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return "", fmt.Errorf("failed to delete directory %q: %w", lockDir, err)
+	envs := make([]string, 0, len(envConfigs))
+	for env := range envConfigs {
+		envs = append(envs, env)
 	}
-	s := State{
-		Commit:                 nil,
-		BootstrapMode:          false,
-		EnvironmentConfigsPath: "",
-		Filesystem:             fs,
-		DBHandler:              state.DBHandler,
-		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
-		CloudRunClient:         state.CloudRunClient,
+	sort.Strings(envs)
+	for _, env := range envs {
+		upstream := envConfigs[env].Upstream
+		if upstream != nil && upstream.Environment == c.Environment {
+			return "", grpc.PublicError(ctx, fmt.Errorf("cannot delete environment %q: it is the upstream of environment %q", c.Environment, env))
+		}
 	}
-	if err := s.DeleteAppLockIfEmpty(ctx, c.Environment, c.Application); err != nil {
+
+	apps, err := state.GetEnvironmentApplications(ctx, transaction, c.Environment)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return "", err
 	}
-	queueMessage, err := s.ProcessQueue(ctx, transaction, fs, c.Environment, c.Application)
-	if err != nil {
+	sort.Strings(apps)
+	deployedApps := []string{}
+	for _, app := range apps {
+		version, err := state.GetEnvironmentApplicationVersion(ctx, c.Environment, app, transaction)
+		if err != nil {
+			return "", err
+		}
+		if version != nil {
+			deployedApps = append(deployedApps, app)
+		}
+	}
+	if len(deployedApps) > 0 && !c.Force {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot delete environment %q: applications %s are still deployed", c.Environment, strings.Join(deployedApps, ", ")))
+	}
+	for _, app := range deployedApps {
+		team, err := state.GetApplicationTeamOwner(app)
+		if err != nil {
+			return "", err
+		}
+		err = state.checkUserPermissions(ctx, c.Environment, app, auth.PermissionDeleteEnvironmentApplication, team, c.RBACConfig)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, app := range deployedApps {
+		if err := state.removeDeployment(ctx, transaction, c.Environment, app); err != nil {
+			return "", err
+		}
+	}
+
+	fs := state.Filesystem
+	envDir := fs.Join("environments", c.Environment)
+	if err := fs.Remove(envDir); err != nil {
+		return "", wrapFileError(err, envDir, "DeleteEnvironment: could not remove environment")
+	}
+	if err := removeRootApps(fs, c.Environment); err != nil {
 		return "", err
 	}
-	GaugeEnvAppLockMetric(fs, c.Environment, c.Application)
-	return fmt.Sprintf("Deleted lock %q on environment %q for application %q%s", c.LockId, c.Environment, c.Application, queueMessage), nil
+	t.DeleteRootApp(c.Environment)
+
+	msg := fmt.Sprintf("deleted environment %q", c.Environment)
+	if len(deployedApps) > 0 {
+		msg = fmt.Sprintf("%s and undeployed applications %s", msg, strings.Join(deployedApps, ", "))
+	}
+	return msg, nil
 }
 
-type CreateEnvironmentTeamLock struct {
+type UpdateEnvironmentConfig struct {
 	Authentication `json:"-"`
 	Environment    string `json:"env"`
-	Team           string `json:"team"`
-	LockId         string `json:"lockId"`
-	Message        string `json:"message"`
+	// Contains the new values of the fields in Fields, all other values are ignored.
+	Config config.EnvironmentConfig `json:"config"`
+	Fields []string                 `json:"fields"`
+	// If set, the update is refused if the config was changed in the meantime, see EnvironmentConfigHash.
+	PreviousConfigHash string `json:"previousConfigHash"`
 }
 
-func (c *CreateEnvironmentTeamLock) GetDBEventType() db.EventType {
-	return db.EvtCreateEnvironmentTeamLock
+func (c *UpdateEnvironmentConfig) GetDBEventType() db.EventType {
+	return db.EvtUpdateEnvironmentConfig
 }
 
-func (c *CreateEnvironmentTeamLock) Transform(
+func (c *UpdateEnvironmentConfig) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	// Note: it's possible to lock an application BEFORE it's even deployed to the environment.
-	err := state.checkUserPermissions(ctx, c.Environment, "*", auth.PermissionCreateLock, c.Team, c.RBACConfig)
+	if state.BootstrapMode {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q in bootstrap mode, please update the config map instead", c.Environment))
+	}
+	envConfigs, err := state.GetEnvironmentConfigs()
 	if err != nil {
 		return "", err
 	}
-
-	if !valid.EnvironmentName(c.Environment) {
-		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create environment team lock: invalid environment: '%s'", c.Environment))
+	current, ok := envConfigs[c.Environment]
+	if !ok {
+		return "", grpc.PublicError(ctx, fmt.Errorf("environment %q does not exist", c.Environment))
 	}
-	if !valid.TeamName(c.Team) {
-		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create environment team lock: invalid team: '%s'", c.Team))
+	if c.PreviousConfigHash != "" {
+		hash, err := EnvironmentConfigHash(current)
+		if err != nil {
+			return "", err
+		}
+		if hash != c.PreviousConfigHash {
+			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("cannot update environment %q: the config was changed in the meantime", c.Environment))
+		}
 	}
-	if !valid.LockId(c.LockId) {
-		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create environment team lock: invalid lock id: '%s'", c.LockId))
+	updated, err := updateEnvironmentConfig(current, c.Config, c.Fields)
+	if err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: %w", c.Environment, err))
 	}
-
-	fs := state.Filesystem
-
-	foundTeam := false
-	if apps, err := state.GetApplicationsFromFile(); err == nil {
-		for _, currentApp := range apps {
-			currentTeamFile := fs.Join("applications", currentApp, "team")
-			if currentTeamName, err := util.ReadFile(fs, currentTeamFile); err == nil {
-				if c.Team == string(currentTeamName) {
-					foundTeam = true
-					break
-				}
-			} else {
-				logger.FromContext(ctx).Sugar().Warnf("CreateEnvironmentTeamLock: Could not find team for application: %s.", currentApp)
-			}
+	// the permission is required for the old and the new environment group
+	for _, envConfig := range []config.EnvironmentConfig{current, updated} {
+		if err := state.checkUserPermissionsCreateEnvironment(ctx, c.RBACConfig, envConfig); err != nil {
+			return "", err
 		}
 	}
-	if err != nil || !foundTeam { //Not found team or apps dir doesn't exist
-		return "", &TeamNotFoundErr{err: fmt.Errorf("Team '%s' does not exist.", c.Team)}
+	if err := ValidateFreezeWindows(updated); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: %w", c.Environment, err))
 	}
-
-	envDir := fs.Join("environments", c.Environment)
-	if _, err := fs.Stat(envDir); err != nil {
-		return "", fmt.Errorf("error environment not found dir %q: %w", envDir, err)
+	if err := ValidateAutoRollback(updated); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: %w", c.Environment, err))
 	}
-
-	teamDir := fs.Join(envDir, "teams", c.Team)
-	if err := fs.MkdirAll(teamDir, 0777); err != nil {
-		return "", fmt.Errorf("error could not create teams directory %q: %w", envDir, err)
+	if err := ValidatePromotion(updated); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: %w", c.Environment, err))
 	}
-	chroot, err := fs.Chroot(teamDir)
-	if err != nil {
-		return "", fmt.Errorf("error changing root of fs to  %s: %w", teamDir, err)
+	if updated.Upstream != nil && updated.Upstream.Environment != "" {
+		if updated.Upstream.Environment == c.Environment {
+			return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: it cannot be its own upstream", c.Environment))
+		}
+		if !envExists(envConfigs, updated.Upstream.Environment) {
+			return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: upstream environment %q does not exist", c.Environment, updated.Upstream.Environment))
+		}
 	}
-	if err := createLock(ctx, chroot, c.LockId, c.Message); err != nil {
-		return "", fmt.Errorf("error creating lock. ID: %s Lock Message: %s. %w", c.LockId, c.Message, err)
+	if err := validateEnvironmentUpstreams(envConfigs, c.Environment, updated, false); err != nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot update environment %q: %w", c.Environment, err))
 	}
 
-	return fmt.Sprintf("Created lock %q on environment %q for team %q", c.LockId, c.Environment, c.Team), nil
-}
-
-type DeleteEnvironmentTeamLock struct {
-	Authentication `json:"-"`
-	Environment    string `json:"env"`
-	Team           string `json:"team"`
-	LockId         string `json:"lockId"`
-}
-
-func (c *DeleteEnvironmentTeamLock) GetDBEventType() db.EventType {
-	return db.EvtDeleteEnvironmentTeamLock
-}
-
-func (c *DeleteEnvironmentTeamLock) Transform(
-	ctx context.Context,
-	state *State,
-	t TransformerContext,
-	transaction *sql.Tx,
-) (string, error) {
-	err := state.checkUserPermissions(ctx, c.Environment, "", auth.PermissionDeleteLock, c.Team, c.RBACConfig)
+	before, err := json.MarshalIndent(current, "", "  ")
 	if err != nil {
 		return "", err
 	}
-
-	if !valid.EnvironmentName(c.Environment) {
-		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment team lock: invalid environment: '%s'", c.Environment))
-	}
-	if !valid.TeamName(c.Team) {
-		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment team lock: invalid team: '%s'", c.Team))
+	after, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return "", err
 	}
-	if !valid.LockId(c.LockId) {
-		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment team lock: invalid lock id: '%s'", c.LockId))
+	if bytes.Equal(before, after) {
+		return fmt.Sprintf("config of environment %q is unchanged", c.Environment), nil
 	}
-
 	fs := state.Filesystem
-	lockDir := fs.Join("environments", c.Environment, "teams", c.Team, "locks", c.LockId)
-	_, err = fs.Stat(lockDir)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return "", grpc.FailedPrecondition(ctx, fmt.Errorf("directory %s for team lock does not exist", lockDir))
-		}
+	configFile := fs.Join("environments", c.Environment, "config.json")
+	// util.WriteFile does not truncate existing files
+	if err := fs.Remove(configFile); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return "", err
 	}
-	if err := fs.Remove(lockDir); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return "", fmt.Errorf("failed to delete directory %q: %w", lockDir, err)
+	if err := util.WriteFile(fs, configFile, append(after, '\n'), 0666); err != nil {
+		return "", err
 	}
-	s := State{
-		Commit:                 nil,
-		BootstrapMode:          false,
-		EnvironmentConfigsPath: "",
-		Filesystem:             fs,
-		DBHandler:              state.DBHandler,
-		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
-		CloudRunClient:         state.CloudRunClient,
+	if _, err := state.GetEnvironmentConfigsAndValidate(ctx); err != nil {
+		return "", err
 	}
-	if err := s.DeleteTeamLockIfEmpty(ctx, c.Environment, c.Team); err != nil {
+	if current.ArgoCd != nil && updated.ArgoCd == nil {
+		if err := removeRootApps(fs, c.Environment); err != nil {
+			return "", err
+		}
+		t.DeleteRootApp(c.Environment)
+	} else if updated.ArgoCd != nil && !reflect.DeepEqual(current.ArgoCd, updated.ArgoCd) {
+		// afterTransform renders the argocd apps of the environment with the new config in the same commit,
+		// argocd is told about the changed root app here.
+		t.UpdateRootApp(c.Environment)
+	}
+	if err := state.writeEnvironmentConfigUpdatedEvent(ctx, transaction, c.Environment, before, after); err != nil {
 		return "", err
 	}
-
-	return fmt.Sprintf("Deleted lock %q on environment %q for team %q", c.LockId, c.Environment, c.Team), nil
+	return fmt.Sprintf("update %s of environment %q", strings.Join(c.Fields, ", "), c.Environment), nil
 }
 
-type CreateEnvironment struct {
-	Authentication `json:"-"`
-	Environment    string                   `json:"env"`
-	Config         config.EnvironmentConfig `json:"config"`
+type CloneEnvironment struct {
+	Authentication    `json:"-"`
+	SourceEnvironment string `json:"sourceEnv"`
+	Environment       string `json:"env"`
+	// Override the argocd destination of the source environment.
+	DestinationName      *string `json:"destinationName,omitempty"`
+	DestinationServer    *string `json:"destinationServer,omitempty"`
+	DestinationNamespace *string `json:"destinationNamespace,omitempty"`
+	// Deploys the versions of Applications (or of all applications, if empty) that are deployed on the source environment.
+	// The releases are not changed, the deployments use the manifests of the source environment, see getReleaseManifestPath.
+	CopyDeployments bool     `json:"copyDeployments"`
+	Applications    []string `json:"apps,omitempty"`
+	WriteCommitData bool     `json:"writeCommitData"`
+	// The environment is deleted by DeleteExpiredEnvironments once ExpiresAt is reached, on behalf of the user who cloned it.
+	// This requires the permission to delete the environment.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
-func (c *CreateEnvironment) GetDBEventType() db.EventType {
-	return db.EvtCreateEnvironment
+func (c *CloneEnvironment) GetDBEventType() db.EventType {
+	return db.EvtCloneEnvironment
 }
 
-func (c *CreateEnvironment) Transform(
+func (c *CloneEnvironment) Transform(
 	ctx context.Context,
 	state *State,
 	t TransformerContext,
 	transaction *sql.Tx,
 ) (string, error) {
-	err := state.checkUserPermissionsCreateEnvironment(ctx, c.RBACConfig, c.Config)
+	envConfigs, err := state.GetEnvironmentConfigs()
 	if err != nil {
 		return "", err
 	}
+	sourceConfig, ok := envConfigs[c.SourceEnvironment]
+	if !ok {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot clone environment %q: it does not exist", c.SourceEnvironment))
+	}
+	if envExists(envConfigs, c.Environment) {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot clone environment %q: environment %q already exists", c.SourceEnvironment, c.Environment))
+	}
+	envConfig := sourceConfig
+	if c.DestinationName != nil || c.DestinationServer != nil || c.DestinationNamespace != nil {
+		if sourceConfig.ArgoCd == nil {
+			return "", grpc.PublicError(ctx, fmt.Errorf("cannot clone environment %q: it has no argocd config, so the destination cannot be overridden", c.SourceEnvironment))
+		}
+		// the argocd config is copied, so that the config of the source environment is not changed
+		argoCd := *sourceConfig.ArgoCd
+		if c.DestinationName != nil {
+			argoCd.Destination.Name = *c.DestinationName
+		}
+		if c.DestinationServer != nil {
+			argoCd.Destination.Server = *c.DestinationServer
+		}
+		if c.DestinationNamespace != nil {
+			argoCd.Destination.Namespace = c.DestinationNamespace
+		}
+		envConfig.ArgoCd = &argoCd
+	}
+	if c.ExpiresAt != nil {
+		// the environment does not exist yet, so the permission is checked for the group of its config
+		if err := state.checkUserPermissionsNewEnvironment(ctx, c.RBACConfig, c.Environment, envConfig, auth.PermissionDeleteEnvironment); err != nil {
+			return "", err
+		}
+	}
+	if err := t.Execute(&CreateEnvironment{
+		Authentication: c.Authentication,
+		Environment:    c.Environment,
+		Config:         envConfig,
+		// the upstream of the source environment might not exist yet either
+		RequireExistingUpstream: false,
+	}, transaction); err != nil {
+		return "", err
+	}
 	fs := state.Filesystem
 	envDir := fs.Join("environments", c.Environment)
-	// Creation of environment is possible, but configuring it is not if running in bootstrap mode.
-	// Configuration needs to be done by modifying config map in source repo
-	//exhaustruct:ignore
-	defaultConfig := config.EnvironmentConfig{}
-	if state.BootstrapMode && c.Config != defaultConfig {
-		return "", fmt.Errorf("Cannot create or update configuration in bootstrap mode. Please update configuration in config map instead.")
-	}
-	if err := fs.MkdirAll(envDir, 0777); err != nil {
+	// deployments of releases without a manifest for the clone use the manifest of the source environment, see getReleaseManifestPath
+	if err := util.WriteFile(fs, fs.Join(envDir, fieldClonedFrom), []byte(c.SourceEnvironment), 0666); err != nil {
 		return "", err
 	}
-	configFile := fs.Join(envDir, "config.json")
-	file, err := fs.OpenFile(configFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
-	if err != nil {
-		return "", fmt.Errorf("error creating config: %w", err)
+	if c.ExpiresAt != nil {
+		if err := util.WriteFile(fs, fs.Join(envDir, fieldExpiresAt), []byte(c.ExpiresAt.UTC().Format(time.RFC3339)), 0666); err != nil {
+			return "", err
+		}
+		// the environment is deleted on behalf of this user once it expired
+		user, err := auth.ReadUserFromContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		if err := util.WriteFile(fs, fs.Join(envDir, "created_by_email"), []byte(user.Email), 0666); err != nil {
+			return "", err
+		}
+		if err := util.WriteFile(fs, fs.Join(envDir, "created_by_name"), []byte(user.Name), 0666); err != nil {
+			return "", err
+		}
 	}
-	enc := json.NewEncoder(file)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(c.Config); err != nil {
-		return "", fmt.Errorf("error writing json: %w", err)
+	msg := fmt.Sprintf("clone environment %q to %q", c.SourceEnvironment, c.Environment)
+	if !c.CopyDeployments {
+		return msg, nil
 	}
-	// we do not need to inform argoCd when creating an environment, as there are no apps yet
-	return fmt.Sprintf("create environment %q", c.Environment), file.Close()
+
+	apps := c.Applications
+	if len(apps) == 0 {
+		apps, err = state.GetEnvironmentApplications(ctx, transaction, c.SourceEnvironment)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		sort.Strings(apps)
+	}
+	copiedApps := []string{}
+	for _, app := range apps {
+		version, err := state.GetEnvironmentApplicationVersion(ctx, c.SourceEnvironment, app, transaction)
+		if err != nil {
+			return "", err
+		}
+		if version == nil {
+			if len(c.Applications) > 0 {
+				return "", grpc.PublicError(ctx, fmt.Errorf("cannot clone environment %q: application %q is not deployed there", c.SourceEnvironment, app))
+			}
+			continue
+		}
+		if err := t.Execute(&DeployApplicationVersion{
+			Authentication:    c.Authentication,
+			Environment:       c.Environment,
+			Application:       app,
+			Version:           *version,
+			LockBehaviour:     api.LockBehavior_FAIL,
+			WriteCommitData:   c.WriteCommitData,
+			SourceTrain:       nil,
+			Author:            "",
+			RolledBackVersion: nil,
+			Reason:            fmt.Sprintf("Copied from environment %s.", c.SourceEnvironment),
+		}, transaction); err != nil {
+			return "", err
+		}
+		copiedApps = append(copiedApps, app)
+	}
+	if len(copiedApps) > 0 {
+		msg = fmt.Sprintf("%s with the deployments of %s", msg, strings.Join(copiedApps, ", "))
+	}
+	return msg, nil
+}
+
+// removeRootApps removes the argocd apps of an environment.
+// afterTransform only writes the argocd apps of environments with an argocd config, so they are never removed there.
+func removeRootApps(fs billy.Filesystem, environment string) error {
+	apiVersions, err := names(fs, "argocd")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, apiVersion := range apiVersions {
+		rootApp := fs.Join("argocd", apiVersion, fmt.Sprintf("%s.yaml", environment))
+		if err := fs.Remove(rootApp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return wrapFileError(err, rootApp, "could not remove argocd app")
+		}
+	}
+	return nil
 }
 
 type QueueApplicationVersion struct {
@@ -1846,6 +2963,10 @@ type DeployApplicationVersion struct {
 	WriteCommitData bool                            `json:"writeCommitData"`
 	SourceTrain     *DeployApplicationVersionSource `json:"sourceTrain"`
 	Author          string                          `json:"author"`
+	// Set for rollbacks, the version that was deployed before.
+	RolledBackVersion *uint64 `json:"rolledBackVersion,omitempty"`
+	// Why the deployment happened, recorded in the deployment event.
+	Reason string `json:"reason,omitempty"`
 }
 
 func (c *DeployApplicationVersion) GetDBEventType() db.EventType {
@@ -1870,7 +2991,10 @@ func (c *DeployApplicationVersion) Transform(
 	fs := state.Filesystem
 	// Check that the release exist and fetch manifest
 	releaseDir := releasesDirectoryWithVersion(fs, c.Application, c.Version)
-	manifest := fs.Join(releaseDir, "environments", c.Environment, "manifests.yaml")
+	manifest, err := state.getReleaseManifestPath(c.Application, c.Version, c.Environment)
+	if err != nil {
+		return "", err
+	}
 	var manifestContent []byte
 	if file, err := fs.Open(manifest); err != nil {
 		return "", wrapFileError(err, manifest, fmt.Sprintf("deployment failed: could not open manifest for app %s with release %d on env %s", c.Application, c.Version, c.Environment))
@@ -1882,6 +3006,21 @@ func (c *DeployApplicationVersion) Transform(
 		}
 		file.Close()
 	}
+	if c.SourceTrain == nil {
+		// release trains check the dependencies of all apps together in their prognosis
+		unmet, err := state.GetUnmetDependencies(ctx, transaction, c.Environment, c.Application, c.Version)
+		if err != nil {
+			return "", err
+		}
+		if len(unmet) > 0 {
+			return "", &UnmetDependenciesError{
+				Environment:  c.Environment,
+				Application:  c.Application,
+				Version:      c.Version,
+				Dependencies: unmet,
+			}
+		}
+	}
 	lockPreventedDeployment := false
 	if c.LockBehaviour != api.LockBehavior_IGNORE {
 		// Check that the environment is not locked
@@ -1893,7 +3032,18 @@ func (c *DeployApplicationVersion) Transform(
 		if err != nil {
 			return "", err
 		}
-		appLocks, err = state.GetEnvironmentApplicationLocks(c.Environment, c.Application)
+		envConfig, err := state.GetEnvironmentConfig(c.Environment)
+		if err != nil {
+			return "", err
+		}
+		freezeLocks, err := getFreezeLocks(*envConfig, getTimeNow(ctx))
+		if err != nil {
+			return "", err
+		}
+		for lockId, lock := range freezeLocks {
+			envLocks[lockId] = lock
+		}
+		appLocks, err = state.getApplicationLocksWithSelectorLocks(c.Environment, c.Application)
 		if err != nil {
 			return "", err
 		}
@@ -1994,6 +3144,11 @@ func (c *DeployApplicationVersion) Transform(
 			return "", fmt.Errorf("could not find deployment for app %s and env %s", c.Application, c.Environment)
 		}
 		var v = int64(c.Version)
+		var rolledBackVersion *int64
+		if c.RolledBackVersion != nil {
+			rv := int64(*c.RolledBackVersion)
+			rolledBackVersion = &rv
+		}
 		newDeployment := db.Deployment{
 			EslVersion: 0,
 			Created:    time.Time{},
@@ -2001,8 +3156,9 @@ func (c *DeployApplicationVersion) Transform(
 			Env:        c.Environment,
 			Version:    &v,
 			Metadata: db.DeploymentMetadata{
-				DeployedByEmail: user.Email,
-				DeployedByName:  user.Name,
+				DeployedByEmail:   user.Email,
+				DeployedByName:    user.Name,
+				RolledBackVersion: rolledBackVersion,
 			},
 		}
 		var previousVersion db.EslId
@@ -2059,6 +3215,16 @@ func (c *DeployApplicationVersion) Transform(
 		if err := util.WriteFile(fs, fs.Join(applicationDir, "deployed_at_utc"), []byte(getTimeNow(ctx).UTC().String()), 0666); err != nil {
 			return "", err
 		}
+
+		rolledBackVersionFile := fs.Join(applicationDir, fieldRolledBackVersion)
+		if err := fs.Remove(rolledBackVersionFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if c.RolledBackVersion != nil {
+			if err := util.WriteFile(fs, rolledBackVersionFile, []byte(strconv.FormatUint(*c.RolledBackVersion, 10)), 0666); err != nil {
+				return "", err
+			}
+		}
 	}
 
 	s := State{
@@ -2069,6 +3235,7 @@ func (c *DeployApplicationVersion) Transform(
 		DBHandler:              state.DBHandler,
 		ReleaseVersionsLimit:   state.ReleaseVersionsLimit,
 		CloudRunClient:         state.CloudRunClient,
+		ManifestValidator:      state.ManifestValidator,
 	}
 	err = s.DeleteQueuedVersionIfExists(c.Environment, c.Application)
 	if err != nil {
@@ -2082,7 +3249,7 @@ func (c *DeployApplicationVersion) Transform(
 	}
 
 	if c.WriteCommitData { // write the corresponding event
-		deploymentEvent := createDeploymentEvent(c.Application, c.Environment, c.SourceTrain)
+		deploymentEvent := createDeploymentEvent(c.Application, c.Environment, c.SourceTrain, c.RolledBackVersion, c.Reason)
 		if s.DBHandler.ShouldUseOtherTables() {
 			newReleaseCommitId, err := getCommitIDFromReleaseDir(ctx, fs, releaseDir)
 			if err != nil {
@@ -2165,12 +3332,14 @@ func addEventForRelease(ctx context.Context, fs billy.Filesystem, releaseDir str
 	return nil
 }
 
-func createDeploymentEvent(application, environment string, sourceTrain *DeployApplicationVersionSource) *event.Deployment {
+func createDeploymentEvent(application, environment string, sourceTrain *DeployApplicationVersionSource, rolledBackVersion *uint64, reason string) *event.Deployment {
 	ev := event.Deployment{
 		SourceTrainEnvironmentGroup: nil,
 		SourceTrainUpstream:         nil,
 		Application:                 application,
 		Environment:                 environment,
+		RolledBackVersion:           nil,
+		Reason:                      nil,
 	}
 	if sourceTrain != nil {
 		if sourceTrain.TargetGroup != nil {
@@ -2178,6 +3347,13 @@ func createDeploymentEvent(application, environment string, sourceTrain *DeployA
 		}
 		ev.SourceTrainUpstream = &sourceTrain.Upstream
 	}
+	if rolledBackVersion != nil {
+		version := strconv.FormatUint(*rolledBackVersion, 10)
+		ev.RolledBackVersion = &version
+	}
+	if reason != "" {
+		ev.Reason = &reason
+	}
 	return &ev
 }
 
@@ -2190,6 +3366,282 @@ func createReplacedByEvent(application, environment, commitId string) *event.Rep
 	return &ev
 }
 
+type CreateScheduledDeployment struct {
+	Authentication `json:"-"`
+	Environment    string           `json:"env"`
+	Application    string           `json:"app"`
+	ScheduleId     string           `json:"scheduleId"`
+	Version        uint64           `json:"version"`
+	DeployAt       time.Time        `json:"deployAt"`
+	LockBehaviour  api.LockBehavior `json:"lockBehaviour"`
+}
+
+func (c *CreateScheduledDeployment) GetDBEventType() db.EventType {
+	return db.EvtCreateScheduledDeployment
+}
+
+func (c *CreateScheduledDeployment) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, c.Application, auth.PermissionDeployRelease, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	manifest, err := state.getReleaseManifestPath(c.Application, c.Version, c.Environment)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fs.Stat(manifest); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.PublicError(ctx, fmt.Errorf("cannot schedule deployment %q: release %d of app %q has no manifest for environment %q", c.ScheduleId, c.Version, c.Application, c.Environment))
+		}
+		return "", err
+	}
+	if !c.DeployAt.After(getTimeNow(ctx)) {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot schedule deployment %q: %s is not in the future", c.ScheduleId, c.DeployAt.UTC().Format(time.RFC3339)))
+	}
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	role := ""
+	if user.DexAuthContext != nil {
+		role = user.DexAuthContext.Role
+	}
+	content, err := json.MarshalIndent(&ScheduledDeployment{
+		Id:             c.ScheduleId,
+		Environment:    c.Environment,
+		Application:    c.Application,
+		Version:        c.Version,
+		DeployAt:       c.DeployAt.UTC(),
+		LockBehaviour:  c.LockBehaviour,
+		CreatedByName:  user.Name,
+		CreatedByEmail: user.Email,
+		CreatedByRole:  role,
+		CreatedAt:      getTimeNow(ctx).UTC(),
+	}, "", " ")
+	if err != nil {
+		return "", err
+	}
+	dir := scheduledDeploymentsDirectory(fs, c.Environment, c.Application)
+	if err := fs.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	file := fs.Join(dir, c.ScheduleId)
+	// util.WriteFile does not truncate existing files
+	if err := fs.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := util.WriteFile(fs, file, append(content, '\n'), 0666); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("scheduled deployment %q of version %d of app %q to %q at %s", c.ScheduleId, c.Version, c.Application, c.Environment, c.DeployAt.UTC().Format(time.RFC3339)), nil
+}
+
+type CancelScheduledDeployment struct {
+	Authentication `json:"-"`
+	Environment    string `json:"env"`
+	Application    string `json:"app"`
+	ScheduleId     string `json:"scheduleId"`
+}
+
+func (c *CancelScheduledDeployment) GetDBEventType() db.EventType {
+	return db.EvtCancelScheduledDeployment
+}
+
+func (c *CancelScheduledDeployment) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	err := state.checkUserPermissions(ctx, c.Environment, c.Application, auth.PermissionDeployRelease, "", c.RBACConfig)
+	if err != nil {
+		return "", err
+	}
+	fs := state.Filesystem
+	file := fs.Join(scheduledDeploymentsDirectory(fs, c.Environment, c.Application), c.ScheduleId)
+	if err := fs.Remove(file); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", grpc.PublicError(ctx, fmt.Errorf("scheduled deployment %q of app %q to %q does not exist", c.ScheduleId, c.Application, c.Environment))
+		}
+		return "", err
+	}
+	return fmt.Sprintf("cancelled scheduled deployment %q of app %q to %q", c.ScheduleId, c.Application, c.Environment), nil
+}
+
+// ExecuteScheduledDeployment deploys a due scheduled deployment and removes it.
+// It deploys with the permissions of the user that scheduled it.
+// Deployments that are prevented by locks, unmet dependencies or missing permissions, or whose release was deleted, are not retried.
+// The outcome is recorded as an event of the release.
+type ExecuteScheduledDeployment struct {
+	Authentication  `json:"-"`
+	Environment     string `json:"env"`
+	Application     string `json:"app"`
+	ScheduleId      string `json:"scheduleId"`
+	WriteCommitData bool   `json:"writeCommitData"`
+	// If set, the deployment is not attempted but recorded as failed with this message.
+	// This is used after an unexpected error, so that the scheduled deployment is not retried forever.
+	Failure string `json:"failure,omitempty"`
+}
+
+func (c *ExecuteScheduledDeployment) GetDBEventType() db.EventType {
+	return db.EvtExecuteScheduledDeployment
+}
+
+func (c *ExecuteScheduledDeployment) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	scheduled, err := state.GetScheduledDeployment(c.Environment, c.Application, c.ScheduleId)
+	if err != nil {
+		return "", err
+	}
+	if scheduled == nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("scheduled deployment %q of app %q to %q does not exist", c.ScheduleId, c.Application, c.Environment))
+	}
+	if scheduled.DeployAt.After(getTimeNow(ctx)) {
+		return "", grpc.PublicError(ctx, fmt.Errorf("scheduled deployment %q is not due before %s", c.ScheduleId, scheduled.DeployAt.UTC().Format(time.RFC3339)))
+	}
+	fs := state.Filesystem
+	if err := fs.Remove(fs.Join(scheduledDeploymentsDirectory(fs, c.Environment, c.Application), c.ScheduleId)); err != nil {
+		return "", err
+	}
+	outcome, failure, msg, err := c.deploy(ctx, state, t, transaction, scheduled)
+	if err != nil {
+		return "", err
+	}
+	if c.WriteCommitData {
+		releaseDir := releasesDirectoryWithVersion(fs, c.Application, scheduled.Version)
+		if err := addEventForRelease(ctx, fs, releaseDir, &event.ScheduledDeployment{
+			Environment: c.Environment,
+			Application: c.Application,
+			ScheduleId:  c.ScheduleId,
+			Outcome:     outcome,
+			Message:     failure,
+			AuthorName:  scheduled.CreatedByName,
+			AuthorEmail: scheduled.CreatedByEmail,
+		}); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("executed scheduled deployment %q: %s", c.ScheduleId, msg), nil
+}
+
+// deploy returns the outcome of the scheduled deployment and the failure message if it failed.
+// The deployment is done on behalf of the user that scheduled it, so it needs the permissions of this user.
+func (c *ExecuteScheduledDeployment) deploy(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+	scheduled *ScheduledDeployment,
+) (outcome, failure, msg string, err error) {
+	if c.Failure != "" {
+		return event.ScheduledDeploymentOutcomeFailed, c.Failure, fmt.Sprintf("could not deploy version %d of %q to %q: %s", scheduled.Version, c.Application, c.Environment, c.Failure), nil
+	}
+	creatorCtx := auth.WriteUserToContext(ctx, auth.User{
+		Email:          scheduled.CreatedByEmail,
+		Name:           scheduled.CreatedByName,
+		DexAuthContext: &auth.DexAuthContext{Role: scheduled.CreatedByRole},
+	})
+	deploy := &DeployApplicationVersion{
+		Authentication:    c.Authentication,
+		Environment:       c.Environment,
+		Application:       c.Application,
+		Version:           scheduled.Version,
+		LockBehaviour:     scheduled.LockBehaviour,
+		WriteCommitData:   c.WriteCommitData,
+		SourceTrain:       nil,
+		Author:            scheduled.CreatedByEmail,
+		RolledBackVersion: nil,
+		Reason:            "",
+	}
+	// the deployment is not run with t.Execute, because expected failures are recorded instead of failing the transformer
+	msg, err = deploy.Transform(creatorCtx, state, t, transaction)
+	if err != nil {
+		var lockedErr *LockedError
+		var unmetErr *UnmetDependenciesError
+		var permissionErr auth.PermissionError
+		if !errors.As(err, &lockedErr) && !errors.As(err, &unmetErr) && !errors.As(err, &permissionErr) && !errors.Is(err, os.ErrNotExist) {
+			return "", "", "", err
+		}
+		failure = err.Error()
+		return event.ScheduledDeploymentOutcomeFailed, failure, fmt.Sprintf("could not deploy version %d of %q to %q: %s", scheduled.Version, c.Application, c.Environment, failure), nil
+	}
+	queued, err := state.GetQueuedVersion(c.Environment, c.Application)
+	if err != nil {
+		return "", "", "", err
+	}
+	if queued != nil && *queued == scheduled.Version {
+		return event.ScheduledDeploymentOutcomeQueued, "", msg, nil
+	}
+	return event.ScheduledDeploymentOutcomeDeployed, "", msg, nil
+}
+
+// RollbackApplication deploys the version that was deployed before the currently deployed one, see GetRollbackVersion.
+// The deployment is tagged with the version that was rolled back.
+type RollbackApplication struct {
+	Authentication  `json:"-"`
+	Environment     string           `json:"env"`
+	Application     string           `json:"app"`
+	LockBehaviour   api.LockBehavior `json:"lockBehaviour"`
+	WriteCommitData bool             `json:"writeCommitData"`
+	// If set, only this version is rolled back.
+	Version *uint64 `json:"version,omitempty"`
+}
+
+func (c *RollbackApplication) GetDBEventType() db.EventType {
+	return db.EvtRollbackApplication
+}
+
+func (c *RollbackApplication) Transform(
+	ctx context.Context,
+	state *State,
+	t TransformerContext,
+	transaction *sql.Tx,
+) (string, error) {
+	current, err := state.GetEnvironmentApplicationVersion(ctx, c.Environment, c.Application, transaction)
+	if err != nil {
+		return "", err
+	}
+	if current == nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot roll back app %q on %q: no version is deployed", c.Application, c.Environment))
+	}
+	if c.Version != nil && *c.Version != *current {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot roll back version %d of app %q on %q: version %d is deployed", *c.Version, c.Application, c.Environment, *current))
+	}
+	target, err := state.GetRollbackVersion(ctx, transaction, c.Environment, c.Application, *current)
+	if err != nil {
+		return "", err
+	}
+	if target == nil {
+		return "", grpc.PublicError(ctx, fmt.Errorf("cannot roll back app %q on %q: no other version than %d was deployed before", c.Application, c.Environment, *current))
+	}
+	deploy := &DeployApplicationVersion{
+		Authentication:    c.Authentication,
+		Environment:       c.Environment,
+		Application:       c.Application,
+		Version:           *target,
+		LockBehaviour:     c.LockBehaviour,
+		WriteCommitData:   c.WriteCommitData,
+		SourceTrain:       nil,
+		Author:            "",
+		RolledBackVersion: current,
+		Reason:            "",
+	}
+	if err := t.Execute(deploy, transaction); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rolled back %q on %q from version %d to version %d", c.Application, c.Environment, *current, *target), nil
+}
+
 type ReleaseTrain struct {
 	Authentication  `json:"-"`
 	Target          string     `json:"target"`
@@ -2334,6 +3786,8 @@ type ReleaseTrainApplicationPrognosis struct {
 	SkipCause        *api.ReleaseTrainAppPrognosis_SkipCause
 	FirstLockMessage string // we just record the first lock's message for now, will be changed in SRX-7CBX2O
 	Version          uint64
+	// only set if the app is skipped because of APP_HAS_UNMET_DEPENDENCIES
+	UnmetDependencies []ReleaseDependency
 }
 
 type ReleaseTrainEnvironmentPrognosis struct {
@@ -2556,6 +4010,19 @@ func (c *envReleaseTrain) prognosis(
 			AppsPrognoses:    nil,
 		}
 	}
+	// the prognosis is also calculated outside of transformers, so there might not be a time in the context yet:
+	freezeLocks, err := getFreezeLocks(envConfig, getTimeNow(WithTimeNow(ctx, time.Now())))
+	if err != nil {
+		return ReleaseTrainEnvironmentPrognosis{
+			SkipCause:        nil,
+			Error:            grpc.PublicError(ctx, fmt.Errorf("could not evaluate freeze windows of environment %q: %w", c.Env, err)),
+			FirstLockMessage: "",
+			AppsPrognoses:    nil,
+		}
+	}
+	for lockId, lock := range freezeLocks {
+		envLocks[lockId] = lock
+	}
 
 	source := upstreamEnvName
 	if upstreamLatest {
@@ -2586,9 +4053,10 @@ func (c *envReleaseTrain) prognosis(
 
 		for _, appName := range apps {
 			appsPrognoses[appName] = ReleaseTrainApplicationPrognosis{
-				SkipCause:        nil,
-				FirstLockMessage: firstLock.Message,
-				Version:          0,
+				SkipCause:         nil,
+				FirstLockMessage:  firstLock.Message,
+				Version:           0,
+				UnmetDependencies: nil,
 			}
 		}
 		return ReleaseTrainEnvironmentPrognosis{
@@ -2657,8 +4125,9 @@ func (c *envReleaseTrain) prognosis(
 					SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
 						SkipCause: api.ReleaseTrainAppSkipCause_APP_HAS_NO_VERSION_IN_UPSTREAM_ENV,
 					},
-					FirstLockMessage: "",
-					Version:          0,
+					FirstLockMessage:  "",
+					Version:           0,
+					UnmetDependencies: nil,
 				}
 				continue
 			}
@@ -2669,13 +4138,14 @@ func (c *envReleaseTrain) prognosis(
 				SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
 					SkipCause: api.ReleaseTrainAppSkipCause_APP_ALREADY_IN_UPSTREAM_VERSION,
 				},
-				FirstLockMessage: "",
-				Version:          0,
+				FirstLockMessage:  "",
+				Version:           0,
+				UnmetDependencies: nil,
 			}
 			continue
 		}
 
-		appLocks, err := state.GetEnvironmentApplicationLocks(c.Env, appName)
+		appLocks, err := state.getApplicationLocksWithSelectorLocks(c.Env, appName)
 
 		if err != nil {
 			return ReleaseTrainEnvironmentPrognosis{
@@ -2700,24 +4170,33 @@ func (c *envReleaseTrain) prognosis(
 				SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
 					SkipCause: api.ReleaseTrainAppSkipCause_APP_IS_LOCKED,
 				},
-				FirstLockMessage: firstLock.Message,
-				Version:          0,
+				FirstLockMessage:  firstLock.Message,
+				Version:           0,
+				UnmetDependencies: nil,
 			}
 			continue
 		}
 
 		fs := state.Filesystem
 
-		releaseDir := releasesDirectoryWithVersion(fs, appName, versionToDeploy)
-		manifest := fs.Join(releaseDir, "environments", c.Env, "manifests.yaml")
+		manifest, err := state.getReleaseManifestPath(appName, versionToDeploy, c.Env)
+		if err != nil {
+			return ReleaseTrainEnvironmentPrognosis{
+				SkipCause:        nil,
+				Error:            err,
+				FirstLockMessage: "",
+				AppsPrognoses:    nil,
+			}
+		}
 
 		if _, err := fs.Stat(manifest); err != nil {
 			appsPrognoses[appName] = ReleaseTrainApplicationPrognosis{
 				SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
 					SkipCause: api.ReleaseTrainAppSkipCause_APP_DOES_NOT_EXIST_IN_ENV,
 				},
-				FirstLockMessage: "",
-				Version:          0,
+				FirstLockMessage:  "",
+				Version:           0,
+				UnmetDependencies: nil,
 			}
 			continue
 		}
@@ -2750,17 +4229,28 @@ func (c *envReleaseTrain) prognosis(
 					SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
 						SkipCause: api.ReleaseTrainAppSkipCause_TEAM_IS_LOCKED,
 					},
-					FirstLockMessage: firstLock.Message,
-					Version:          0,
+					FirstLockMessage:  firstLock.Message,
+					Version:           0,
+					UnmetDependencies: nil,
 				}
 				continue
 			}
 		}
 
 		appsPrognoses[appName] = ReleaseTrainApplicationPrognosis{
+			SkipCause:         nil,
+			FirstLockMessage:  "",
+			Version:           versionToDeploy,
+			UnmetDependencies: nil,
+		}
+	}
+
+	if err := skipUnmetDependencies(ctx, state, transaction, c.Env, appsPrognoses); err != nil {
+		return ReleaseTrainEnvironmentPrognosis{
 			SkipCause:        nil,
+			Error:            err,
 			FirstLockMessage: "",
-			Version:          versionToDeploy,
+			AppsPrognoses:    nil,
 		}
 	}
 
@@ -2772,6 +4262,41 @@ func (c *envReleaseTrain) prognosis(
 	}
 }
 
+// skipUnmetDependencies skips all apps whose dependencies are neither deployed
+// nor deployed by the same release train in the required version.
+// Skipping an app can break the dependencies of other apps, so this is repeated until nothing changes.
+func skipUnmetDependencies(ctx context.Context, state *State, transaction *sql.Tx, env string, appsPrognoses map[string]ReleaseTrainApplicationPrognosis) error {
+	for {
+		plannedVersions := map[string]uint64{}
+		for appName, appPrognosis := range appsPrognoses {
+			if appPrognosis.SkipCause == nil {
+				plannedVersions[appName] = appPrognosis.Version
+			}
+		}
+		changed := false
+		for _, appName := range sorting.SortKeys(plannedVersions) {
+			unmet, err := state.getUnmetDependencies(ctx, transaction, env, appName, plannedVersions[appName], plannedVersions)
+			if err != nil {
+				return err
+			}
+			if len(unmet) > 0 {
+				appsPrognoses[appName] = ReleaseTrainApplicationPrognosis{
+					SkipCause: &api.ReleaseTrainAppPrognosis_SkipCause{
+						SkipCause: api.ReleaseTrainAppSkipCause_APP_HAS_UNMET_DEPENDENCIES,
+					},
+					FirstLockMessage:  "",
+					Version:           0,
+					UnmetDependencies: unmet,
+				}
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+}
+
 func (c *envReleaseTrain) Transform(
 	ctx context.Context,
 	state *State,
@@ -2797,7 +4322,7 @@ func (c *envReleaseTrain) Transform(
 		}
 	}
 
-	renderApplicationSkipCause := func(SkipCause *api.ReleaseTrainAppPrognosis_SkipCause, appName string) string {
+	renderApplicationSkipCause := func(SkipCause *api.ReleaseTrainAppPrognosis_SkipCause, appName string, unmetDependencies []ReleaseDependency) string {
 		envConfig := c.EnvGroupConfigs[c.Env]
 		upstreamEnvName := envConfig.Upstream.Environment
 		currentlyDeployedVersion, _ := state.GetEnvironmentApplicationVersion(ctx, c.Env, appName, transaction)
@@ -2813,6 +4338,8 @@ func (c *envReleaseTrain) Transform(
 			return fmt.Sprintf("skipping application %q in environment %q because it doesn't exist there", appName, c.Env)
 		case api.ReleaseTrainAppSkipCause_TEAM_IS_LOCKED:
 			return fmt.Sprintf("skipping application %q in environment %q due to team lock on team %q", appName, c.Env, teamName)
+		case api.ReleaseTrainAppSkipCause_APP_HAS_UNMET_DEPENDENCIES:
+			return fmt.Sprintf("skipping application %q in environment %q because it requires %s", appName, c.Env, formatDependencies(unmetDependencies))
 		default:
 			return fmt.Sprintf("skipping application %q in environment %q for an unrecognized reason", appName, c.Env)
 		}
@@ -2865,7 +4392,7 @@ func (c *envReleaseTrain) Transform(
 	for _, appName := range appNames {
 		appPrognosis := prognosis.AppsPrognoses[appName]
 		if appPrognosis.SkipCause != nil {
-			skipped = append(skipped, renderApplicationSkipCause(appPrognosis.SkipCause, appName))
+			skipped = append(skipped, renderApplicationSkipCause(appPrognosis.SkipCause, appName, appPrognosis.UnmetDependencies))
 			continue
 		}
 		d := &DeployApplicationVersion{
@@ -2879,7 +4406,9 @@ func (c *envReleaseTrain) Transform(
 				Upstream:    upstreamEnvName,
 				TargetGroup: c.TrainGroup,
 			},
-			Author: "",
+			Author:            "",
+			RolledBackVersion: nil,
+			Reason:            "",
 		}
 		if err := t.Execute(d, transaction); err != nil {
 			return "", grpc.InternalError(ctx, fmt.Errorf("unexpected error while deploying app %q to env %q: %w", appName, c.Env, err))
@@ -28,6 +28,7 @@ import (
 
 	"io"
 	"math/rand"
+	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
@@ -49,9 +50,11 @@ import (
 	"github.com/freiheit-com/kuberpult/pkg/auth"
 	"github.com/freiheit-com/kuberpult/pkg/config"
 	"github.com/freiheit-com/kuberpult/pkg/event"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 	"github.com/freiheit-com/kuberpult/pkg/ptr"
 	"github.com/freiheit-com/kuberpult/pkg/testfs"
 	"github.com/freiheit-com/kuberpult/pkg/valid"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/schema"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/util"
 	"github.com/google/go-cmp/cmp"
@@ -4624,6 +4627,93 @@ func TestTransformer(t *testing.T) {
 				}
 			},
 		},
+		{
+			Name:                 "Create Versions and do not clean up pinned versions",
+			ReleaseVersionsLimit: 15,
+			Transformers: func() []Transformer {
+				res := makeTransformersForDelete(2)
+				res = append(res, &PinApplicationVersion{
+					Application: "test",
+					Version:     2,
+					Pinned:      true,
+				})
+				var v uint64
+				for v = 3; v <= 18; v++ {
+					res = append(res, &CreateApplicationVersion{
+						Application: "test",
+						Manifests: map[string]string{
+							envProduction: "productionmanifest",
+						},
+						WriteCommitData: true,
+					}, &DeployApplicationVersion{
+						Environment:   envProduction,
+						Application:   "test",
+						Version:       v,
+						LockBehaviour: api.LockBehavior_FAIL,
+					})
+				}
+				return res
+			}(),
+			Test: func(t *testing.T, s *State) {
+				if _, err := s.GetApplicationRelease("test", 1); err == nil {
+					t.Errorf("expected release 1 to be cleaned up")
+				}
+				release, err := s.GetApplicationRelease("test", 2)
+				if err != nil {
+					t.Fatalf("expected pinned release 2 to exist: %v", err)
+				}
+				if !release.Pinned {
+					t.Errorf("expected release 2 to be pinned")
+				}
+				if _, err := s.GetApplicationRelease("test", 3); err == nil {
+					t.Errorf("expected release 3 to be cleaned up")
+				}
+			},
+		},
+		{
+			Name:                 "Create Versions and clean up with the retention policy of the application",
+			ReleaseVersionsLimit: 15,
+			Transformers: func() []Transformer {
+				res := makeTransformersForDelete(1)
+				var maxCount uint = 3
+				res = append(res, &SetApplicationRetentionPolicy{
+					Application: "test",
+					Policy: &RetentionPolicy{
+						MaxCount:           &maxCount,
+						MaxAge:             "",
+						KeepPerEnvironment: 0,
+					},
+				})
+				var v uint64
+				for v = 2; v <= 5; v++ {
+					res = append(res, &CreateApplicationVersion{
+						Application: "test",
+						Manifests: map[string]string{
+							envProduction: "productionmanifest",
+						},
+						WriteCommitData: true,
+					}, &DeployApplicationVersion{
+						Environment:   envProduction,
+						Application:   "test",
+						Version:       v,
+						LockBehaviour: api.LockBehavior_FAIL,
+					})
+				}
+				return res
+			}(),
+			Test: func(t *testing.T, s *State) {
+				for _, v := range []uint64{1, 2} {
+					if _, err := s.GetApplicationRelease("test", v); err == nil {
+						t.Errorf("expected release %d to be cleaned up", v)
+					}
+				}
+				for _, v := range []uint64{3, 4, 5} {
+					if _, err := s.GetApplicationRelease("test", v); err != nil {
+						t.Errorf("expected release %d to exist: %v", v, err)
+					}
+				}
+			},
+		},
 		{
 			Name: "Release train",
 			Transformers: []Transformer{
@@ -7635,3 +7725,563 @@ func DBParseToEvents(rows []db.EventRow) ([]event.Event, error) {
 	}
 	return result, nil
 }
+
+func TestDeleteLockOwnership(t *testing.T) {
+	policy := &auth.RBACPolicies{
+		Permissions: map[string]auth.Permission{
+			"p,role:developer,DeleteLock,production:production,*,allow": {Role: "developer"},
+			"p,role:sre,DeleteLock,production:production,*,allow":       {Role: "sre"},
+			"p,role:admin,DeleteLock,production:production,*,allow":     {Role: "admin"},
+			"p,role:admin,DeleteAnyLock,production:production,*,allow":  {Role: "admin"},
+		},
+		Teams: map[string]auth.RBACTeam{
+			"t,sre-team,role:sre": {Team: "sre-team", Role: "sre"},
+		},
+	}
+	ownership := Authentication{RBACConfig: auth.RBACConfig{DexEnabled: true, Policy: policy, LockOwnership: true}}
+	userCtx := func(email, role string) context.Context {
+		return auth.WriteUserToContext(context.Background(), auth.User{
+			Email:          email,
+			Name:           email,
+			DexAuthContext: &auth.DexAuthContext{Role: role},
+		})
+	}
+	tcs := []struct {
+		Name          string
+		Ctx           context.Context
+		Transformer   Transformer
+		ExpectedError error
+	}{
+		{
+			Name:        "creator can delete the application lock",
+			Ctx:         userCtx("creator@example.com", "developer"),
+			Transformer: &DeleteEnvironmentApplicationLock{Environment: "production", Application: "test", LockId: "app-lock", Authentication: ownership},
+		},
+		{
+			Name:        "member of the owning team can delete the application lock",
+			Ctx:         userCtx("sre@example.com", "sre"),
+			Transformer: &DeleteEnvironmentApplicationLock{Environment: "production", Application: "test", LockId: "app-lock", Authentication: ownership},
+		},
+		{
+			Name:        "role with override permission can delete the environment lock",
+			Ctx:         userCtx("admin@example.com", "admin"),
+			Transformer: &DeleteEnvironmentLock{Environment: "production", LockId: "env-lock", Authentication: ownership},
+		},
+		{
+			Name:        "member of the owning team cannot delete the environment lock",
+			Ctx:         userCtx("sre@example.com", "sre"),
+			Transformer: &DeleteEnvironmentLock{Environment: "production", LockId: "env-lock", Authentication: ownership},
+			ExpectedError: &TransformerBatchApplyError{
+				Index: 0,
+				TransformerError: auth.PermissionError{
+					User:        "sre@example.com",
+					Role:        "sre",
+					Action:      auth.PermissionDeleteAnyLock,
+					Environment: "production",
+				},
+			},
+		},
+		{
+			Name:        "other user cannot delete the team lock",
+			Ctx:         userCtx("other@example.com", "developer"),
+			Transformer: &DeleteEnvironmentTeamLock{Environment: "production", Team: "sre-team", LockId: "team-lock", Authentication: ownership},
+			ExpectedError: &TransformerBatchApplyError{
+				Index: 0,
+				TransformerError: auth.PermissionError{
+					User:        "other@example.com",
+					Role:        "developer",
+					Action:      auth.PermissionDeleteAnyLock,
+					Environment: "production",
+					Team:        "sre-team",
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			err := repo.Apply(userCtx("creator@example.com", "developer"),
+				&CreateEnvironment{Environment: "production"},
+				&CreateApplicationVersion{
+					Application: "test",
+					Manifests: map[string]string{
+						"production": "productionmanifest",
+					},
+					Team: "sre-team",
+				},
+				&CreateEnvironmentLock{Environment: "production", LockId: "env-lock", Message: "env"},
+				&CreateEnvironmentApplicationLock{Environment: "production", Application: "test", LockId: "app-lock", Message: "app"},
+				&CreateEnvironmentTeamLock{Environment: "production", Team: "sre-team", LockId: "team-lock", Message: "team"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(tc.Ctx, tc.Transformer)
+			if diff := cmp.Diff(tc.ExpectedError, err, cmpopts.EquateErrors()); diff != "" {
+				t.Fatalf("error mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCreateApplicationVersionLabels(t *testing.T) {
+	tcs := []struct {
+		Name                   string
+		Labels                 map[string]string
+		ExpectedDifferingField *api.DifferingField
+	}{
+		{
+			Name:                   "same labels",
+			Labels:                 map[string]string{"risk": "low", "ticket": "SRE-1"},
+			ExpectedDifferingField: nil,
+		},
+		{
+			Name:                   "different labels",
+			Labels:                 map[string]string{"risk": "high"},
+			ExpectedDifferingField: api.DifferingField_LABELS.Enum(),
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx, &CreateApplicationVersion{
+				Version:     1,
+				Application: "test",
+				Manifests: map[string]string{
+					"production": "productionmanifest",
+				},
+				Labels: map[string]string{"risk": "low", "ticket": "SRE-1"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			release, err := repo.State().GetApplicationRelease("test", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(map[string]string{"risk": "low", "ticket": "SRE-1"}, release.Labels); diff != "" {
+				t.Errorf("labels mismatch (-want, +got):\n%s", diff)
+			}
+
+			err = repo.Apply(ctx, &CreateApplicationVersion{
+				Version:     1,
+				Application: "test",
+				Manifests: map[string]string{
+					"production": "productionmanifest",
+				},
+				Labels: tc.Labels,
+			})
+			var releaseErr *CreateReleaseError
+			if !errors.As(err, &releaseErr) {
+				t.Fatalf("expected create release error, got %v", err)
+			}
+			var actualDifferingField *api.DifferingField
+			if different := releaseErr.Response().GetAlreadyExistsDifferent(); different != nil {
+				actualDifferingField = different.FirstDifferingField.Enum()
+			}
+			if diff := cmp.Diff(tc.ExpectedDifferingField, actualDifferingField); diff != "" {
+				t.Errorf("differing field mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeleteApplicationVersion(t *testing.T) {
+	const commitID = "cafe1cafe2cafe1cafe2cafe1cafe2cafe1cafe2"
+	tcs := []struct {
+		Name            string
+		Version         uint64
+		Force           bool
+		ExpectedError   string
+		ExpectedDeleted bool
+		ExpectedVersion *uint64
+	}{
+		{
+			Name:            "delete release that is not deployed",
+			Version:         1,
+			Force:           false,
+			ExpectedError:   "",
+			ExpectedDeleted: true,
+			ExpectedVersion: ptr.Uint64(2),
+		},
+		{
+			Name:            "refuse to delete deployed release",
+			Version:         2,
+			Force:           false,
+			ExpectedError:   `cannot delete release 2 of application "test": it is deployed on environment "production"`,
+			ExpectedDeleted: false,
+			ExpectedVersion: ptr.Uint64(2),
+		},
+		{
+			Name:            "force delete deployed release",
+			Version:         2,
+			Force:           true,
+			ExpectedError:   "",
+			ExpectedDeleted: true,
+			ExpectedVersion: nil,
+		},
+		{
+			Name:            "release does not exist",
+			Version:         3,
+			Force:           false,
+			ExpectedError:   `release 3 of application "test" does not exist`,
+			ExpectedDeleted: true,
+			ExpectedVersion: ptr.Uint64(2),
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&CreateApplicationVersion{
+					Version:         1,
+					Application:     "test",
+					Manifests:       map[string]string{envProduction: "manifest 1"},
+					SourceCommitId:  commitID,
+					WriteCommitData: true,
+				},
+				&CreateApplicationVersion{
+					Version:         2,
+					Application:     "test",
+					Manifests:       map[string]string{envProduction: "manifest 2"},
+					WriteCommitData: true,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &DeleteApplicationVersion{
+				Application: "test",
+				Version:     tc.Version,
+				Force:       tc.Force,
+			})
+			if tc.ExpectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+				t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+			}
+			state := repo.State()
+			_, err = state.GetApplicationRelease("test", tc.Version)
+			if deleted := err != nil; deleted != tc.ExpectedDeleted {
+				t.Errorf("expected release %d to be deleted: %t, got error %v", tc.Version, tc.ExpectedDeleted, err)
+			}
+			version, err := state.GetEnvironmentApplicationVersion(ctx, envProduction, "test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedVersion, version); diff != "" {
+				t.Errorf("deployed version mismatch (-want, +got):\n%s", diff)
+			}
+			if tc.Version == 1 && tc.ExpectedDeleted {
+				if _, err := state.Filesystem.Stat(commitApplicationDirectory(state.Filesystem, commitID, "test")); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected commit data of release 1 to be removed, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteEnvironment(t *testing.T) {
+	const envDevelopment = "development"
+	tcs := []struct {
+		Name          string
+		Environment   string
+		Force         bool
+		ExpectedError string
+	}{
+		{
+			Name:          "delete environment without deployments",
+			Environment:   envProduction,
+			Force:         false,
+			ExpectedError: "",
+		},
+		{
+			Name:          "refuse to delete environment with deployments",
+			Environment:   envDevelopment,
+			Force:         false,
+			ExpectedError: `cannot delete environment "development": applications test are still deployed`,
+		},
+		{
+			Name:          "force delete environment with deployments",
+			Environment:   envDevelopment,
+			Force:         true,
+			ExpectedError: "",
+		},
+		{
+			Name:          "refuse to delete upstream environment",
+			Environment:   envAcceptance,
+			Force:         true,
+			ExpectedError: `cannot delete environment "acceptance": it is the upstream of environment "production"`,
+		},
+		{
+			Name:          "environment does not exist",
+			Environment:   "staging",
+			Force:         false,
+			ExpectedError: `environment "staging" does not exist`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envDevelopment,
+					Config: config.EnvironmentConfig{
+						Upstream: &config.EnvironmentConfigUpstream{Latest: true},
+						ArgoCd: &config.EnvironmentConfigArgoCd{
+							Destination: config.ArgoCdDestination{
+								Server: "localhost:8080",
+							},
+						},
+					},
+				},
+				&CreateEnvironment{
+					Environment: envAcceptance,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: envAcceptance}},
+				},
+				&CreateApplicationVersion{
+					Version:     1,
+					Application: "test",
+					Manifests: map[string]string{
+						envDevelopment: "manifest",
+						envAcceptance:  "manifest",
+						envProduction:  "manifest",
+					},
+					WriteCommitData: true,
+				},
+				&CreateEnvironmentLock{
+					Environment: envDevelopment,
+					LockId:      "l1",
+					Message:     "lock",
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.Apply(ctx, &DeleteEnvironment{
+				Environment: tc.Environment,
+				Force:       tc.Force,
+			})
+			if tc.ExpectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+					t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			state := repo.State()
+			configs, err := state.GetEnvironmentConfigs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := configs[tc.Environment]; ok {
+				t.Errorf("expected environment %q to be deleted", tc.Environment)
+			}
+			fs := state.Filesystem
+			for _, file := range []string{
+				fs.Join("environments", tc.Environment),
+				fs.Join("argocd", "v1alpha1", tc.Environment+".yaml"),
+			} {
+				if _, err := fs.Stat(file); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected %s to be removed, got %v", file, err)
+				}
+			}
+			// the other environments are not touched
+			version, err := state.GetEnvironmentApplicationVersion(ctx, envAcceptance, "test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(ptr.Uint64(1), version); diff != "" {
+				t.Errorf("deployed version mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCreateApplicationVersionManifestValidation(t *testing.T) {
+	const widgetCrd = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          apiVersion:
+            type: string
+          kind:
+            type: string
+          metadata:
+            type: object
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+`
+	tcs := []struct {
+		Name           string
+		Manifest       string
+		ExpectedErrors []*api.ManifestValidationError
+	}{
+		{
+			Name:           "valid manifest",
+			Manifest:       "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: widget\nspec:\n  size: 2\n",
+			ExpectedErrors: nil,
+		},
+		{
+			Name:     "invalid manifest",
+			Manifest: "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: widget\nspec:\n  size: big\n",
+			ExpectedErrors: []*api.ManifestValidationError{
+				{
+					Environment: envProduction,
+					Document:    0,
+					Kind:        "Widget",
+					Name:        "widget",
+					Field:       "spec.size",
+					Message:     "expected integer, got string",
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			schemaDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(schemaDir, "widgets.yaml"), []byte(widgetCrd), 0644); err != nil {
+				t.Fatal(err)
+			}
+			validator, err := schema.NewValidator(schemaDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo, err := setupRepository(t, RepositoryConfig{
+				ArgoCdGenerateFiles: true,
+				ManifestValidator:   validator,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := testutil.MakeTestContext()
+			err = repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&CreateApplicationVersion{
+					Version:     1,
+					Application: "test",
+					Manifests:   map[string]string{envProduction: tc.Manifest},
+				},
+			)
+			if tc.ExpectedErrors == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var createErr *CreateReleaseError
+			if !errors.As(err, &createErr) {
+				t.Fatalf("expected a CreateReleaseError, got %v", err)
+			}
+			if diff := cmp.Diff(tc.ExpectedErrors, createErr.Response().GetInvalidManifest().GetErrors(), cmpopts.IgnoreUnexported(api.ManifestValidationError{})); diff != "" {
+				t.Errorf("validation errors mismatch (-want, +got):\n%s", diff)
+			}
+			if _, err := repo.State().GetApplicationRelease("test", 1); err == nil {
+				t.Errorf("expected the invalid release not to be created")
+			}
+		})
+	}
+}
+
+func TestCreateApplicationVersionSecretPolicy(t *testing.T) {
+	const secret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: token
+data:
+  token: aHVudGVyMg==
+`
+	tcs := []struct {
+		Name           string
+		Manifest       string
+		ExpectedErrors []*api.ManifestValidationError
+	}{
+		{
+			Name:           "release without secrets",
+			Manifest:       "apiVersion: v1\nkind: ConfigMap\n",
+			ExpectedErrors: nil,
+		},
+		{
+			Name:     "release with plaintext secret",
+			Manifest: secret,
+			ExpectedErrors: []*api.ManifestValidationError{
+				{
+					Environment: envProduction,
+					Document:    0,
+					Kind:        "Secret",
+					Name:        "token",
+					Field:       "data",
+					Message:     "plaintext secret data is not allowed, use one of SealedSecret, ExternalSecret instead",
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := setupRepositoryTest(t)
+			ctx := testutil.MakeTestContext()
+			err := repo.Apply(ctx,
+				&CreateEnvironment{
+					Environment: envProduction,
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&CreateApplicationVersion{
+					Version:      1,
+					Application:  "test",
+					Manifests:    map[string]string{envProduction: tc.Manifest},
+					SecretPolicy: manifestpolicy.SecretPolicy{Mode: manifestpolicy.ModeReject, AllowedKinds: manifestpolicy.DefaultAllowedKinds},
+				},
+			)
+			if tc.ExpectedErrors == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var createErr *CreateReleaseError
+			if !errors.As(err, &createErr) {
+				t.Fatalf("expected a CreateReleaseError, got %v", err)
+			}
+			if diff := cmp.Diff(tc.ExpectedErrors, createErr.Response().GetInvalidManifest().GetErrors(), cmpopts.IgnoreUnexported(api.ManifestValidationError{})); diff != "" {
+				t.Errorf("validation errors mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
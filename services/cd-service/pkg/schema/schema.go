@@ -0,0 +1,412 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// GroupVersionKind identifies the type of a kubernetes object.
+type GroupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// Schema is the subset of an OpenAPI schema that is needed to validate kubernetes objects.
+type Schema struct {
+	Ref                   string                `json:"$ref,omitempty"`
+	Type                  string                `json:"type,omitempty"`
+	Format                string                `json:"format,omitempty"`
+	Properties            map[string]*Schema    `json:"properties,omitempty"`
+	AdditionalProperties  *AdditionalProperties `json:"additionalProperties,omitempty"`
+	Items                 *Schema               `json:"items,omitempty"`
+	Required              []string              `json:"required,omitempty"`
+	Enum                  []interface{}         `json:"enum,omitempty"`
+	AllOf                 []*Schema             `json:"allOf,omitempty"`
+	IntOrString           bool                  `json:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknownFields bool                  `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	GroupVersionKinds     []GroupVersionKind    `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+// AdditionalProperties is either a boolean or a schema.
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	//exhaustruct:ignore
+	a.Schema = &Schema{}
+	return json.Unmarshal(data, a.Schema)
+}
+
+// schemaFile is one of the supported schema files:
+// an OpenAPI v2 document (like the swagger.json of the kubernetes api server),
+// an OpenAPI v3 document or a CustomResourceDefinition.
+type schemaFile struct {
+	Kind        string             `json:"kind"`
+	Definitions map[string]*Schema `json:"definitions"`
+	Components  struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Versions []struct {
+			Name   string `json:"name"`
+			Schema struct {
+				OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+			} `json:"schema"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+// Validator validates kubernetes manifests against OpenAPI schemas.
+type Validator struct {
+	definitions map[string]*Schema
+	kinds       map[GroupVersionKind]*Schema
+}
+
+// NewValidator loads all schema files (*.json, *.yaml, *.yml) in dir.
+func NewValidator(dir string) (*Validator, error) {
+	v := &Validator{
+		definitions: map[string]*Schema{},
+		kinds:       map[GroupVersionKind]*Schema{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema directory %q: %w", dir, err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		if err := v.load(file); err != nil {
+			return nil, fmt.Errorf("could not load schema file %q: %w", file, err)
+		}
+	}
+	return v, nil
+}
+
+func (v *Validator) load(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if filepath.Ext(file) == ".json" {
+		return v.add(content)
+	}
+	// yaml files can contain several CustomResourceDefinitions
+	decoder := yaml3.NewDecoder(bytes.NewReader(content))
+	for {
+		var document interface{}
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if document == nil {
+			continue
+		}
+		data, err := json.Marshal(document)
+		if err != nil {
+			return err
+		}
+		if err := v.add(data); err != nil {
+			return err
+		}
+	}
+}
+
+func (v *Validator) add(data []byte) error {
+	//exhaustruct:ignore
+	file := schemaFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if file.Kind == "CustomResourceDefinition" {
+		for _, version := range file.Spec.Versions {
+			if version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			v.kinds[GroupVersionKind{Group: file.Spec.Group, Version: version.Name, Kind: file.Spec.Names.Kind}] = version.Schema.OpenAPIV3Schema
+		}
+		return nil
+	}
+	for _, definitions := range []map[string]*Schema{file.Definitions, file.Components.Schemas} {
+		for name, schema := range definitions {
+			v.definitions[name] = schema
+			for _, gvk := range schema.GroupVersionKinds {
+				v.kinds[gvk] = schema
+			}
+		}
+	}
+	return nil
+}
+
+// Error describes one problem in a manifest.
+type Error struct {
+	// Index of the yaml document in the manifest, starting at 0.
+	Document int
+	Kind     string
+	Name     string
+	// Path of the offending field, like "spec.template.spec.containers[0].image". Empty if the whole document is invalid.
+	Field   string
+	Message string
+}
+
+func (e Error) String() string {
+	if e.Field == "" {
+		return fmt.Sprintf("document %d (%s %q): %s", e.Document, e.Kind, e.Name, e.Message)
+	}
+	return fmt.Sprintf("document %d (%s %q): %s: %s", e.Document, e.Kind, e.Name, e.Field, e.Message)
+}
+
+// Validate checks all documents of a multi-document yaml manifest.
+// Objects of kinds without a schema are not validated.
+func (v *Validator) Validate(manifest string) []Error {
+	result := []Error{}
+	decoder := yaml3.NewDecoder(strings.NewReader(manifest))
+	for index := 0; ; index++ {
+		var document interface{}
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result
+			}
+			// the rest of the manifest cannot be parsed after a syntax error
+			return append(result, Error{Document: index, Kind: "", Name: "", Field: "", Message: fmt.Sprintf("invalid yaml: %v", err)})
+		}
+		if document == nil {
+			continue
+		}
+		result = append(result, v.validateObject(index, document)...)
+	}
+}
+
+func (v *Validator) validateObject(index int, document interface{}) []Error {
+	object, ok := document.(map[string]interface{})
+	if !ok {
+		return []Error{{Document: index, Kind: "", Name: "", Field: "", Message: "expected a kubernetes object"}}
+	}
+	apiVersion, _ := object["apiVersion"].(string)
+	kind, _ := object["kind"].(string)
+	name := ""
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		name, _ = metadata["name"].(string)
+	}
+	if apiVersion == "" || kind == "" {
+		return []Error{{Document: index, Kind: kind, Name: name, Field: "", Message: "apiVersion and kind must be set"}}
+	}
+	//exhaustruct:ignore
+	gvk := GroupVersionKind{Kind: kind}
+	if group, version, found := strings.Cut(apiVersion, "/"); found {
+		gvk.Group, gvk.Version = group, version
+	} else {
+		gvk.Version = apiVersion
+	}
+	schema, ok := v.kinds[gvk]
+	if !ok {
+		return nil
+	}
+	result := []Error{}
+	for _, fieldErr := range v.validateValue(schema, object, "") {
+		result = append(result, Error{Document: index, Kind: kind, Name: name, Field: fieldErr.field, Message: fieldErr.message})
+	}
+	return result
+}
+
+type fieldError struct {
+	field   string
+	message string
+}
+
+// resolve follows the reference of the schema. It returns nil if the reference cannot be resolved.
+func (v *Validator) resolve(schema *Schema) *Schema {
+	if schema.Ref == "" {
+		return schema
+	}
+	name := schema.Ref[strings.LastIndex(schema.Ref, "/")+1:]
+	if strings.HasSuffix(name, ".api.resource.Quantity") {
+		// quantities are strings in the schema, but the api server accepts numbers like "cpu: 1" as well
+		//exhaustruct:ignore
+		return &Schema{IntOrString: true}
+	}
+	return v.definitions[name]
+}
+
+func (v *Validator) validateValue(schema *Schema, value interface{}, path string) []fieldError {
+	schema = v.resolve(schema)
+	if schema == nil || value == nil {
+		return nil
+	}
+	result := []fieldError{}
+	for _, sub := range schema.AllOf {
+		result = append(result, v.validateValue(sub, value, path)...)
+	}
+	if len(schema.Enum) > 0 && !containsValue(schema.Enum, value) {
+		result = append(result, fieldError{field: path, message: fmt.Sprintf("unsupported value %v, expected one of %v", value, schema.Enum)})
+	}
+	if schema.IntOrString || schema.Format == "int-or-string" {
+		if _, ok := value.(string); ok || isInteger(value) {
+			return result
+		}
+		return append(result, fieldError{field: path, message: fmt.Sprintf("expected integer or string, got %s", typeName(value))})
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(result, fieldError{field: path, message: fmt.Sprintf("expected object, got %s", typeName(value))})
+		}
+		return append(result, v.validateObjectFields(schema, object, path)...)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return append(result, fieldError{field: path, message: fmt.Sprintf("expected array, got %s", typeName(value))})
+		}
+		if schema.Items != nil {
+			for i, item := range array {
+				result = append(result, v.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			result = append(result, fieldError{field: path, message: fmt.Sprintf("expected string, got %s", typeName(value))})
+		}
+	case "integer":
+		if !isInteger(value) {
+			result = append(result, fieldError{field: path, message: fmt.Sprintf("expected integer, got %s", typeName(value))})
+		}
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+		default:
+			result = append(result, fieldError{field: path, message: fmt.Sprintf("expected number, got %s", typeName(value))})
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			result = append(result, fieldError{field: path, message: fmt.Sprintf("expected boolean, got %s", typeName(value))})
+		}
+	case "":
+		// schemas without type (like allOf wrappers) can still describe the fields of an object
+		if object, ok := value.(map[string]interface{}); ok && len(schema.Properties) > 0 {
+			result = append(result, v.validateObjectFields(schema, object, path)...)
+		}
+	}
+	return result
+}
+
+func (v *Validator) validateObjectFields(schema *Schema, object map[string]interface{}, path string) []fieldError {
+	result := []fieldError{}
+	for _, required := range schema.Required {
+		if _, ok := object[required]; !ok {
+			result = append(result, fieldError{field: joinPath(path, required), message: "required field is missing"})
+		}
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field := joinPath(path, key)
+		if property, ok := schema.Properties[key]; ok {
+			result = append(result, v.validateValue(property, object[key], field)...)
+			continue
+		}
+		additional := schema.AdditionalProperties
+		switch {
+		case additional != nil && additional.Schema != nil:
+			result = append(result, v.validateValue(additional.Schema, object[key], field)...)
+		case additional != nil && !additional.Allowed:
+			result = append(result, fieldError{field: field, message: "unknown field"})
+		case additional == nil && len(schema.Properties) > 0 && !schema.PreserveUnknownFields:
+			// kubernetes drops unknown fields, which usually hides a typo
+			result = append(result, fieldError{field: field, message: "unknown field"})
+		}
+	}
+	return result
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInteger returns true for all values that the yaml and json decoders produce for integers,
+// including large integers and whole numbers like 1.0.
+func isInteger(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == math.Trunc(v) && !math.IsInf(v, 0)
+	default:
+		return false
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,235 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const swagger = `{
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+    },
+    "io.k8s.api.apps.v1.DeploymentSpec": {
+      "type": "object",
+      "required": ["template"],
+      "properties": {
+        "replicas": {"type": "integer"},
+        "template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}
+      }
+    },
+    "io.k8s.api.core.v1.PodTemplateSpec": {
+      "type": "object",
+      "properties": {
+        "spec": {
+          "type": "object",
+          "properties": {
+            "containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}}
+          }
+        }
+      }
+    },
+    "io.k8s.api.core.v1.Container": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "image": {"type": "string"},
+        "imagePullPolicy": {"type": "string", "enum": ["Always", "IfNotPresent", "Never"]},
+        "ports": {"type": "array", "items": {"type": "object", "properties": {"containerPort": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.util.intstr.IntOrString"}}}},
+        "resources": {"type": "object", "properties": {"limits": {"type": "object", "additionalProperties": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"}}}}
+      }
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "io.k8s.apimachinery.pkg.util.intstr.IntOrString": {"type": "string", "format": "int-or-string"},
+    "io.k8s.apimachinery.pkg.api.resource.Quantity": {"type": "string"}
+  }
+}`
+
+const crd = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          apiVersion:
+            type: string
+          kind:
+            type: string
+          metadata:
+            type: object
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "swagger.json"), []byte(swagger), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "widgets.yaml"), []byte(crd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	validator, err := NewValidator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		Name           string
+		Manifest       string
+		ExpectedErrors []Error
+	}{
+		{
+			Name: "valid deployment",
+			Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    team: a
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1
+        imagePullPolicy: Always
+        ports:
+        - containerPort: 8080
+        resources:
+          limits:
+            cpu: 1
+            memory: 1Gi
+`,
+			ExpectedErrors: []Error{},
+		},
+		{
+			Name: "invalid fields",
+			Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: two
+  template:
+    spec:
+      containers:
+      - image: app:1
+        imagePullPolicy: Sometimes
+        imagePullPolicyy: Always
+`,
+			ExpectedErrors: []Error{
+				{Document: 0, Kind: "Deployment", Name: "app", Field: "spec.replicas", Message: "expected integer, got string"},
+				{Document: 0, Kind: "Deployment", Name: "app", Field: "spec.template.spec.containers[0].name", Message: "required field is missing"},
+				{Document: 0, Kind: "Deployment", Name: "app", Field: "spec.template.spec.containers[0].imagePullPolicy", Message: "unsupported value Sometimes, expected one of [Always IfNotPresent Never]"},
+				{Document: 0, Kind: "Deployment", Name: "app", Field: "spec.template.spec.containers[0].imagePullPolicyy", Message: "unknown field"},
+			},
+		},
+		{
+			Name: "several documents",
+			Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unknown-kinds-are-not-validated
+data:
+  foo: bar
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+spec:
+  size: 1.5
+  config:
+    anything: goes
+---
+kind: Widget
+`,
+			ExpectedErrors: []Error{
+				{Document: 1, Kind: "Widget", Name: "widget", Field: "spec.size", Message: "expected integer, got number"},
+				{Document: 2, Kind: "Widget", Name: "", Field: "", Message: "apiVersion and kind must be set"},
+			},
+		},
+		{
+			Name: "integers that are not decoded as int",
+			Manifest: `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: large
+spec:
+  size: 18446744073709551615
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: whole-number
+spec:
+  size: 2.0
+`,
+			ExpectedErrors: []Error{},
+		},
+		{
+			Name:     "invalid yaml",
+			Manifest: "apiVersion: v1\nkind: [ConfigMap\n",
+			ExpectedErrors: []Error{
+				{Document: 0, Kind: "", Name: "", Field: "", Message: "invalid yaml: yaml: line 1: did not find expected ',' or ']'"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := validator.Validate(tc.Manifest)
+			if diff := cmp.Diff(tc.ExpectedErrors, actual); diff != "" {
+				t.Errorf("errors mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
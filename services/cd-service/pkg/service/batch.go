@@ -18,28 +18,36 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/freiheit-com/kuberpult/pkg/grpc"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 	"github.com/freiheit-com/kuberpult/pkg/valid"
 
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/auth"
-	"github.com/freiheit-com/kuberpult/pkg/config"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type BatchServerConfig struct {
 	WriteCommitData bool
+	SecretPolicy    manifestpolicy.SecretPolicy
+	// how long the responses of batches with an idempotency key are stored
+	IdempotencyWindow time.Duration
 }
 
 type BatchServer struct {
 	Repository repository.Repository
 	RBACConfig auth.RBACConfig
 	Config     BatchServerConfig
+
+	jobs batchJobs
 }
 
 // see maxBatchActions in store.tsx
@@ -87,6 +95,32 @@ func ValidateEnvironmentTeamLock(
 	return nil
 }
 
+func ValidateReleaseLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if !valid.ReleaseLabel(key, value) {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create release: invalid label: '%s=%s'", key, value))
+		}
+	}
+	return nil
+}
+
+// RedactSecrets removes plaintext secret data from the manifests if the policy is in redact mode.
+// This has to happen before the transformer is applied, so that the secrets are not stored in the event log.
+func RedactSecrets(policy manifestpolicy.SecretPolicy, manifests map[string]string) (map[string]string, error) {
+	if policy.Mode != manifestpolicy.ModeRedact {
+		return manifests, nil
+	}
+	result := make(map[string]string, len(manifests))
+	for env, manifest := range manifests {
+		redacted, _, err := policy.Redact(manifest)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create release: manifest for environment '%s' could not be checked for secrets: %v", env, err))
+		}
+		result[env] = redacted
+	}
+	return result, nil
+}
+
 func ValidateDeployment(
 	env string,
 	app string,
@@ -100,6 +134,24 @@ func ValidateDeployment(
 	return nil
 }
 
+func ValidateScheduledDeployment(
+	actionType string, // "create" | "cancel"
+	env string,
+	app string,
+	id string,
+) error {
+	if !valid.EnvironmentName(env) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("cannot %s scheduled deployment: invalid environment: '%s'", actionType, env))
+	}
+	if !valid.ApplicationName(app) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("cannot %s scheduled deployment: invalid application: '%s'", actionType, app))
+	}
+	if !valid.ScheduleId(id) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("cannot %s scheduled deployment: invalid schedule id: '%s'", actionType, id))
+	}
+	return nil
+}
+
 func ValidateApplication(
 	app string,
 ) error {
@@ -109,6 +161,14 @@ func ValidateApplication(
 	return nil
 }
 
+func transformExpiresAtToTime(expiresAt *timestamppb.Timestamp) *time.Time {
+	if expiresAt == nil {
+		return nil
+	}
+	result := expiresAt.AsTime()
+	return &result
+}
+
 func (d *BatchServer) processAction(
 	batchAction *api.BatchAction,
 ) (repository.Transformer, *api.BatchResult, error) {
@@ -122,6 +182,7 @@ func (d *BatchServer) processAction(
 			Environment:    act.Environment,
 			LockId:         act.LockId,
 			Message:        act.Message,
+			ExpiresAt:      transformExpiresAtToTime(act.ExpiresAt),
 			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
 		}, nil, nil
 	case *api.BatchAction_DeleteEnvironmentLock:
@@ -144,6 +205,7 @@ func (d *BatchServer) processAction(
 			Application:    act.Application,
 			LockId:         act.LockId,
 			Message:        act.Message,
+			ExpiresAt:      transformExpiresAtToTime(act.ExpiresAt),
 			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
 		}, nil, nil
 	case *api.BatchAction_DeleteEnvironmentApplicationLock:
@@ -167,6 +229,7 @@ func (d *BatchServer) processAction(
 			Team:           act.Team,
 			LockId:         act.LockId,
 			Message:        act.Message,
+			ExpiresAt:      transformExpiresAtToTime(act.ExpiresAt),
 			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
 		}, nil, nil
 	case *api.BatchAction_DeleteEnvironmentTeamLock:
@@ -211,14 +274,16 @@ func (d *BatchServer) processAction(
 			b = api.LockBehavior_IGNORE
 		}
 		return &repository.DeployApplicationVersion{
-			SourceTrain:     nil,
-			Environment:     act.Environment,
-			Application:     act.Application,
-			Version:         act.Version,
-			LockBehaviour:   b,
-			WriteCommitData: d.Config.WriteCommitData,
-			Authentication:  repository.Authentication{RBACConfig: d.RBACConfig},
-			Author:          "",
+			SourceTrain:       nil,
+			Environment:       act.Environment,
+			Application:       act.Application,
+			Version:           act.Version,
+			LockBehaviour:     b,
+			WriteCommitData:   d.Config.WriteCommitData,
+			Authentication:    repository.Authentication{RBACConfig: d.RBACConfig},
+			Author:            "",
+			RolledBackVersion: nil,
+			Reason:            act.Reason,
 		}, nil, nil
 	case *api.BatchAction_DeleteEnvFromApp:
 		act := action.DeleteEnvFromApp
@@ -249,11 +314,22 @@ func (d *BatchServer) processAction(
 			}, nil
 	case *api.BatchAction_CreateRelease:
 		in := action.CreateRelease
+		if err := ValidateReleaseLabels(in.Labels); err != nil {
+			return nil, nil, err
+		}
+		dependencies := repository.ReleaseDependenciesFromProto(in.Dependencies)
+		if err := repository.ValidateReleaseDependencies(in.Application, dependencies); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create release: %v", err))
+		}
+		manifests, err := RedactSecrets(d.Config.SecretPolicy, in.Manifests)
+		if err != nil {
+			return nil, nil, err
+		}
 		response := api.CreateReleaseResponseSuccess{}
 		return &repository.CreateApplicationVersion{
 				Version:         in.Version,
 				Application:     in.Application,
-				Manifests:       in.Manifests,
+				Manifests:       manifests,
 				SourceCommitId:  in.SourceCommitId,
 				SourceAuthor:    in.SourceAuthor,
 				SourceMessage:   in.SourceMessage,
@@ -263,6 +339,9 @@ func (d *BatchServer) processAction(
 				DisplayVersion:  in.DisplayVersion,
 				Authentication:  repository.Authentication{RBACConfig: d.RBACConfig},
 				WriteCommitData: d.Config.WriteCommitData,
+				Labels:          in.Labels,
+				Dependencies:    dependencies,
+				SecretPolicy:    d.Config.SecretPolicy,
 			}, &api.BatchResult{
 				Result: &api.BatchResult_CreateReleaseResponse{
 					CreateReleaseResponse: &api.CreateReleaseResponse{
@@ -274,42 +353,68 @@ func (d *BatchServer) processAction(
 			}, nil
 	case *api.BatchAction_CreateEnvironment:
 		in := action.CreateEnvironment
-		conf := in.Config
-		if conf == nil {
-			//exhaustruct:ignore
-			conf = &api.EnvironmentConfig{}
-		}
-		var argocd *config.EnvironmentConfigArgoCd
-		if conf.Argocd != nil {
-			syncWindows := transformSyncWindowsToConfig(conf.Argocd.SyncWindows)
-			clusterResourceWhitelist := transformAccessListToConfig(conf.Argocd.AccessList)
-			ignoreDifferences := transformIgnoreDifferencesToConfig(conf.Argocd.IgnoreDifferences)
-			argocd = &config.EnvironmentConfigArgoCd{
-				Destination:              transformDestinationToConfig(conf.Argocd.Destination),
-				SyncWindows:              syncWindows,
-				ClusterResourceWhitelist: clusterResourceWhitelist,
-				ApplicationAnnotations:   conf.Argocd.ApplicationAnnotations,
-				IgnoreDifferences:        ignoreDifferences,
-				SyncOptions:              conf.Argocd.SyncOptions,
-			}
-		}
-		upstream := transformUpstreamToConfig(conf.Upstream)
 		transformer := &repository.CreateEnvironment{
-			Environment: in.Environment,
-			Config: config.EnvironmentConfig{
-				Upstream:         upstream,
-				ArgoCd:           argocd,
-				EnvironmentGroup: conf.EnvironmentGroup,
-			},
-			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+			Environment:             in.Environment,
+			Config:                  transformEnvironmentConfigToConfig(in.Config),
+			RequireExistingUpstream: in.RequireExistingUpstream,
+			Authentication:          repository.Authentication{RBACConfig: d.RBACConfig},
 		}
 		return transformer, nil, nil
+	case *api.BatchAction_UpdateEnvironmentConfig:
+		act := action.UpdateEnvironmentConfig
+		if !valid.EnvironmentName(act.Environment) {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot update environment config: invalid environment: '%s'", act.Environment))
+		}
+		if err := repository.ValidateEnvironmentConfigFields(act.UpdateFields); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot update environment config: %v", err))
+		}
+		return &repository.UpdateEnvironmentConfig{
+			Environment:        act.Environment,
+			Config:             transformEnvironmentConfigToConfig(act.Config),
+			Fields:             act.UpdateFields,
+			PreviousConfigHash: act.PreviousConfigHash,
+			Authentication:     repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_CloneEnvironment:
+		act := action.CloneEnvironment
+		for _, env := range []string{act.SourceEnvironment, act.Environment} {
+			if !valid.EnvironmentName(env) {
+				return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot clone environment: invalid environment: '%s'", env))
+			}
+		}
+		for _, app := range act.Applications {
+			if !valid.ApplicationName(app) {
+				return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot clone environment: invalid application: '%s'", app))
+			}
+		}
+		var expiresAt *time.Time
+		if act.Ttl != "" {
+			ttl, err := time.ParseDuration(act.Ttl)
+			if err != nil || ttl <= 0 {
+				return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot clone environment: invalid ttl: '%s'", act.Ttl))
+			}
+			expires := time.Now().Add(ttl)
+			expiresAt = &expires
+		}
+		return &repository.CloneEnvironment{
+			SourceEnvironment:    act.SourceEnvironment,
+			Environment:          act.Environment,
+			DestinationName:      act.DestinationName,
+			DestinationServer:    act.DestinationServer,
+			DestinationNamespace: act.DestinationNamespace,
+			CopyDeployments:      act.CopyDeployments,
+			Applications:         act.Applications,
+			WriteCommitData:      d.Config.WriteCommitData,
+			ExpiresAt:            expiresAt,
+			Authentication:       repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
 	case *api.BatchAction_CreateEnvironmentGroupLock:
 		act := action.CreateEnvironmentGroupLock
 		return &repository.CreateEnvironmentGroupLock{
 			EnvironmentGroup: act.EnvironmentGroup,
 			LockId:           act.LockId,
 			Message:          act.Message,
+			ExpiresAt:        transformExpiresAtToTime(act.ExpiresAt),
 			Authentication:   repository.Authentication{RBACConfig: d.RBACConfig},
 		}, nil, nil
 	case *api.BatchAction_DeleteEnvironmentGroupLock:
@@ -319,6 +424,144 @@ func (d *BatchServer) processAction(
 			LockId:           act.LockId,
 			Authentication:   repository.Authentication{RBACConfig: d.RBACConfig},
 		}, nil, nil
+	case *api.BatchAction_CreateEnvironmentSelectorLock:
+		act := action.CreateEnvironmentSelectorLock
+		if err := ValidateEnvironmentLock("create", act.Environment, act.LockId); err != nil {
+			return nil, nil, err
+		}
+		if err := repository.ValidateSelector(act.Selector); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create selector lock: %v", err))
+		}
+		return &repository.CreateEnvironmentSelectorLock{
+			Environment:    act.Environment,
+			Selector:       act.Selector,
+			LockId:         act.LockId,
+			Message:        act.Message,
+			ExpiresAt:      transformExpiresAtToTime(act.ExpiresAt),
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_DeleteEnvironmentSelectorLock:
+		act := action.DeleteEnvironmentSelectorLock
+		if err := ValidateEnvironmentLock("delete", act.Environment, act.LockId); err != nil {
+			return nil, nil, err
+		}
+		return &repository.DeleteEnvironmentSelectorLock{
+			Environment:    act.Environment,
+			LockId:         act.LockId,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_CreateEnvironmentGroupSelectorLock:
+		act := action.CreateEnvironmentGroupSelectorLock
+		if err := repository.ValidateSelector(act.Selector); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create selector lock: %v", err))
+		}
+		return &repository.CreateEnvironmentGroupSelectorLock{
+			EnvironmentGroup: act.EnvironmentGroup,
+			Selector:         act.Selector,
+			LockId:           act.LockId,
+			Message:          act.Message,
+			ExpiresAt:        transformExpiresAtToTime(act.ExpiresAt),
+			Authentication:   repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_DeleteEnvironmentGroupSelectorLock:
+		act := action.DeleteEnvironmentGroupSelectorLock
+		return &repository.DeleteEnvironmentGroupSelectorLock{
+			EnvironmentGroup: act.EnvironmentGroup,
+			LockId:           act.LockId,
+			Authentication:   repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_PinRelease:
+		act := action.PinRelease
+		if !valid.ApplicationName(act.Application) {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot pin release: invalid application: '%s'", act.Application))
+		}
+		return &repository.PinApplicationVersion{
+			Application:    act.Application,
+			Version:        act.Version,
+			Pinned:         act.Pinned,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_DeleteRelease:
+		act := action.DeleteRelease
+		if !valid.ApplicationName(act.Application) {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete release: invalid application: '%s'", act.Application))
+		}
+		return &repository.DeleteApplicationVersion{
+			Application:    act.Application,
+			Version:        act.Version,
+			Force:          act.Force,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_SetRetentionPolicy:
+		act := action.SetRetentionPolicy
+		if !valid.ApplicationName(act.Application) {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot set retention policy: invalid application: '%s'", act.Application))
+		}
+		policy := repository.RetentionPolicyFromProto(act.Policy)
+		if policy != nil {
+			if err := repository.ValidateRetentionPolicy(*policy); err != nil {
+				return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot set retention policy: %v", err))
+			}
+		}
+		return &repository.SetApplicationRetentionPolicy{
+			Application:    act.Application,
+			Policy:         policy,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_CreateScheduledDeployment:
+		act := action.CreateScheduledDeployment
+		if err := ValidateScheduledDeployment("create", act.Environment, act.Application, act.ScheduleId); err != nil {
+			return nil, nil, err
+		}
+		if act.DeployAt == nil {
+			return nil, nil, status.Error(codes.InvalidArgument, "cannot create scheduled deployment: missing deploy_at")
+		}
+		if _, ok := api.LockBehavior_name[int32(act.LockBehavior)]; !ok {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot create scheduled deployment: invalid lock behavior: %d", act.LockBehavior))
+		}
+		return &repository.CreateScheduledDeployment{
+			Environment:    act.Environment,
+			Application:    act.Application,
+			ScheduleId:     act.ScheduleId,
+			Version:        act.Version,
+			DeployAt:       act.DeployAt.AsTime(),
+			LockBehaviour:  act.LockBehavior,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_CancelScheduledDeployment:
+		act := action.CancelScheduledDeployment
+		if err := ValidateScheduledDeployment("cancel", act.Environment, act.Application, act.ScheduleId); err != nil {
+			return nil, nil, err
+		}
+		return &repository.CancelScheduledDeployment{
+			Environment:    act.Environment,
+			Application:    act.Application,
+			ScheduleId:     act.ScheduleId,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
+	case *api.BatchAction_Rollback:
+		act := action.Rollback
+		if err := ValidateDeployment(act.Environment, act.Application); err != nil {
+			return nil, nil, err
+		}
+		return &repository.RollbackApplication{
+			Environment:     act.Environment,
+			Application:     act.Application,
+			LockBehaviour:   act.LockBehavior,
+			WriteCommitData: d.Config.WriteCommitData,
+			Authentication:  repository.Authentication{RBACConfig: d.RBACConfig},
+			Version:         act.Version,
+		}, nil, nil
+	case *api.BatchAction_DeleteEnvironment:
+		act := action.DeleteEnvironment
+		if !valid.EnvironmentName(act.Environment) {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot delete environment: invalid environment: '%s'", act.Environment))
+		}
+		return &repository.DeleteEnvironment{
+			Environment:    act.Environment,
+			Force:          act.Force,
+			Authentication: repository.Authentication{RBACConfig: d.RBACConfig},
+		}, nil, nil
 	}
 	return nil, nil, status.Error(codes.InvalidArgument, "processAction: cannot process action: invalid action type")
 }
@@ -327,13 +570,35 @@ func (d *BatchServer) ProcessBatch(
 	ctx context.Context,
 	in *api.BatchRequest,
 ) (*api.BatchResponse, error) {
+	ctx, transformers, results, err := d.prepareBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	if in.GetDryRun() {
+		return d.dryRun(ctx, transformers, results)
+	}
+	if in.GetIdempotencyKey() != "" {
+		return d.processIdempotentBatch(ctx, in, transformers, results)
+	}
+	err = d.Repository.Apply(ctx, transformers...)
+	if err != nil {
+		return batchApplyError(err)
+	}
+	return &api.BatchResponse{Results: results, DryRun: nil}, nil
+}
+
+// prepareBatch validates the batch and returns the transformers and results of its actions.
+func (d *BatchServer) prepareBatch(
+	ctx context.Context,
+	in *api.BatchRequest,
+) (context.Context, []repository.Transformer, []*api.BatchResult, error) {
 	user, err := auth.ReadUserFromContext(ctx)
 	if err != nil {
-		return nil, grpc.AuthError(ctx, fmt.Errorf("batch requires user to be provided %v", err))
+		return nil, nil, nil, grpc.AuthError(ctx, fmt.Errorf("batch requires user to be provided %v", err))
 	}
 	ctx = auth.WriteUserToContext(ctx, *user)
 	if len(in.GetActions()) > maxBatchActions {
-		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot process batch: too many actions. limit is %d", maxBatchActions))
+		return nil, nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot process batch: too many actions. limit is %d", maxBatchActions))
 	}
 
 	results := make([]*api.BatchResult, 0, len(in.GetActions()))
@@ -342,43 +607,161 @@ func (d *BatchServer) ProcessBatch(
 		transformer, result, err := d.processAction(batchAction)
 		if err != nil {
 			// Validation error
-			return nil, err
+			return nil, nil, nil, err
 		}
 		transformers = append(transformers, transformer)
 		results = append(results, result)
 	}
-	err = d.Repository.Apply(ctx, transformers...)
+	return ctx, transformers, results, nil
+}
+
+// ProcessBatchAsync queues the batch and returns a job that can be queried with GetBatchJob and StreamBatchJob.
+func (d *BatchServer) ProcessBatchAsync(
+	ctx context.Context,
+	in *api.BatchRequest,
+) (*api.BatchJob, error) {
+	if in.GetDryRun() {
+		return nil, status.Error(codes.InvalidArgument, "cannot process batch: dry runs cannot be processed asynchronously")
+	}
+	if in.GetIdempotencyKey() != "" {
+		return nil, status.Error(codes.InvalidArgument, "cannot process batch: idempotency keys are not supported for asynchronous batches")
+	}
+	ctx, transformers, results, err := d.prepareBatch(ctx, in)
 	if err != nil {
-		var applyErr *repository.TransformerBatchApplyError
-		if errors.Is(err, repository.ErrQueueFull) {
-			return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("Could not process ProcessBatch request. Err: %s", err.Error()))
-		}
-		if !errors.As(err, &applyErr) {
-			return nil, err
+		return nil, err
+	}
+	job := d.jobs.add(results)
+	errCh := d.Repository.ApplyAsync(ctx, job, transformers...)
+	select {
+	case err := <-errCh:
+		// the batch was not queued
+		job.finish(err)
+		if err != nil && errors.Is(err, repository.ErrQueueFull) {
+			return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("Could not process ProcessBatchAsync request. Err: %s", err.Error()))
 		}
-		switch transformerError := applyErr.TransformerError.(type) {
-		case *repository.CreateReleaseError:
-			{
-				errorResults := make([]*api.BatchResult, 1)
-				errorResults[0] = &api.BatchResult{
-					Result: &api.BatchResult_CreateReleaseResponse{
-						CreateReleaseResponse: transformerError.Response(),
-					},
-				}
-				return &api.BatchResponse{Results: errorResults}, nil
+	default:
+		go func() {
+			job.finish(<-errCh)
+		}()
+	}
+	return job.get(), nil
+}
+
+func (d *BatchServer) GetBatchJob(
+	ctx context.Context,
+	in *api.GetBatchJobRequest,
+) (*api.BatchJob, error) {
+	job := d.jobs.lookup(in.JobId)
+	if job == nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("batch job %q not found", in.JobId))
+	}
+	return job.get(), nil
+}
+
+func (d *BatchServer) StreamBatchJob(
+	in *api.GetBatchJobRequest,
+	stream api.BatchService_StreamBatchJobServer,
+) error {
+	job := d.jobs.lookup(in.JobId)
+	if job == nil {
+		return status.Error(codes.NotFound, fmt.Sprintf("batch job %q not found", in.JobId))
+	}
+	ch, unsubscribe := job.notify.Subscribe()
+	defer unsubscribe()
+	lastState := api.BatchJobState_BATCH_JOB_STATE_UNKNOWN
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ch:
+			current := job.get()
+			if current.State == lastState {
+				continue
+			}
+			lastState = current.State
+			if err := stream.Send(current); err != nil {
+				return err
 			}
-		case *repository.TeamNotFoundErr:
-			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Could not process ProcessBatch request. Err: %s", applyErr.TransformerError.Error()))
-		default:
-			tmp, ok := status.FromError(applyErr.TransformerError)
-			if tmp != nil && ok {
-				// in order to pass the right status code, we need to return the inner error:
-				return nil, applyErr.TransformerError
+			if current.State == api.BatchJobState_BATCH_JOB_STATE_PUSHED || current.State == api.BatchJobState_BATCH_JOB_STATE_FAILED {
+				return nil
 			}
+		}
+	}
+}
+
+// dryRun applies the transformers to a copy of the current state.
+// Database changes happen in a transaction that is always rolled back, and nothing is committed, pushed or deployed to Cloud Run.
+func (d *BatchServer) dryRun(
+	ctx context.Context,
+	transformers []repository.Transformer,
+	results []*api.BatchResult,
+) (*api.BatchResponse, error) {
+	var tx *sql.Tx = nil
+	dbHandler := d.Repository.State().DBHandler
+	if dbHandler.ShouldUseEslTable() {
+		var err error
+		tx, err = dbHandler.DB.BeginTx(ctx, nil)
+		if err != nil {
 			return nil, err
 		}
+		defer func(tx *sql.Tx) {
+			_ = tx.Rollback()
+		}(tx)
+	}
+	commitMessages, changes, applyErr := d.Repository.ApplyTransformersDryRun(ctx, tx, transformers...)
+	if applyErr != nil {
+		return batchApplyError(applyErr)
+	}
+	dryRun := &api.BatchDryRunResult{
+		CommitMessages:  commitMessages,
+		ChangedApps:     []*api.BatchDryRunResult_ChangedApp{},
+		DeletedRootApps: []string{},
+	}
+	combined := repository.CombineArray(changes)
+	for _, change := range combined.ChangedApps {
+		dryRun.ChangedApps = append(dryRun.ChangedApps, &api.BatchDryRunResult_ChangedApp{
+			Application: change.App,
+			Environment: change.Env,
+			Team:        change.Team,
+		})
+	}
+	for _, rootApp := range combined.DeletedRootApps {
+		dryRun.DeletedRootApps = append(dryRun.DeletedRootApps, rootApp.Env)
+	}
+	return &api.BatchResponse{Results: results, DryRun: dryRun}, nil
+}
+
+func batchApplyError(err error) (*api.BatchResponse, error) {
+	var applyErr *repository.TransformerBatchApplyError
+	if errors.Is(err, repository.ErrQueueFull) {
+		return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("Could not process ProcessBatch request. Err: %s", err.Error()))
+	}
+	if !errors.As(err, &applyErr) {
+		return nil, err
+	}
+	switch transformerError := applyErr.TransformerError.(type) {
+	case *repository.CreateReleaseError:
+		{
+			errorResults := make([]*api.BatchResult, 1)
+			errorResults[0] = &api.BatchResult{
+				Result: &api.BatchResult_CreateReleaseResponse{
+					CreateReleaseResponse: transformerError.Response(),
+				},
+			}
+			return &api.BatchResponse{Results: errorResults, DryRun: nil}, nil
+		}
+	case *repository.TeamNotFoundErr:
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Could not process ProcessBatch request. Err: %s", applyErr.TransformerError.Error()))
+	case *repository.UnmetDependenciesError:
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Could not process ProcessBatch request. Err: %s", applyErr.TransformerError.Error()))
+	default:
+		tmp, ok := status.FromError(applyErr.TransformerError)
+		if tmp != nil && ok {
+			// in order to pass the right status code, we need to return the inner error:
+			return nil, applyErr.TransformerError
+		}
+		return nil, err
 	}
-	return &api.BatchResponse{Results: results}, nil
 }
 
 var _ api.BatchServiceServer = (*BatchServer)(nil)
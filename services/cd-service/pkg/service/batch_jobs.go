@@ -0,0 +1,143 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package service
+
+import (
+	"sync"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/notify"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
+	"github.com/onokonem/sillyQueueServer/timeuuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// finished jobs are kept this long, so that clients can still query their result
+const batchJobRetention = time.Hour
+
+// batchJobs keeps track of the batches that are processed asynchronously.
+// The jobs are only kept in memory, so they are lost when the cd-service restarts.
+type batchJobs struct {
+	mx   sync.Mutex
+	jobs map[string]*batchJob
+}
+
+type batchJob struct {
+	mx       sync.Mutex
+	job      *api.BatchJob
+	finished time.Time
+	notify   notify.Notify
+}
+
+var _ repository.BatchProgress = (*batchJob)(nil)
+
+func (j *batchJobs) add(results []*api.BatchResult) *batchJob {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	if j.jobs == nil {
+		j.jobs = map[string]*batchJob{}
+	}
+	j.prune(time.Now())
+	id := timeuuid.TimeUUID().String()
+	job := &batchJob{
+		mx: sync.Mutex{},
+		job: &api.BatchJob{
+			JobId:     id,
+			State:     api.BatchJobState_BATCH_JOB_STATE_QUEUED,
+			Results:   results,
+			CommitId:  "",
+			Error:     "",
+			CreatedAt: timestamppb.Now(),
+		},
+		finished: time.Time{},
+		notify:   notify.Notify{},
+	}
+	j.jobs[id] = job
+	return job
+}
+
+func (j *batchJobs) lookup(id string) *batchJob {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	return j.jobs[id]
+}
+
+// prune removes the jobs that finished before the retention time.
+// The caller must hold the lock.
+func (j *batchJobs) prune(now time.Time) {
+	for id, job := range j.jobs {
+		job.mx.Lock()
+		finished := job.finished
+		job.mx.Unlock()
+		if !finished.IsZero() && now.Sub(finished) > batchJobRetention {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// get returns a copy of the job, so that it can be sent while the job is updated.
+func (j *batchJob) get() *api.BatchJob {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	return proto.Clone(j.job).(*api.BatchJob)
+}
+
+func (j *batchJob) update(f func(job *api.BatchJob)) {
+	j.mx.Lock()
+	f(j.job)
+	j.mx.Unlock()
+	j.notify.Notify()
+}
+
+func (j *batchJob) Applying() {
+	j.update(func(job *api.BatchJob) {
+		if job.State == api.BatchJobState_BATCH_JOB_STATE_QUEUED {
+			job.State = api.BatchJobState_BATCH_JOB_STATE_APPLYING
+		}
+	})
+}
+
+func (j *batchJob) Pushed(commitId string) {
+	j.update(func(job *api.BatchJob) {
+		job.CommitId = commitId
+	})
+}
+
+func (j *batchJob) finish(err error) {
+	j.mx.Lock()
+	if !j.finished.IsZero() {
+		j.mx.Unlock()
+		return
+	}
+	j.finished = time.Now()
+	j.mx.Unlock()
+	j.update(func(job *api.BatchJob) {
+		if err != nil {
+			job.State = api.BatchJobState_BATCH_JOB_STATE_FAILED
+			job.CommitId = ""
+			job.Error = err.Error()
+			// like ProcessBatch, a rejected release is answered with the response of the release
+			if resp, respErr := batchApplyError(err); respErr == nil && resp != nil {
+				job.Results = resp.Results
+			}
+		} else {
+			job.State = api.BatchJobState_BATCH_JOB_STATE_PUSHED
+		}
+	})
+}
@@ -28,6 +28,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/testing/protocmp"
 
@@ -35,6 +37,7 @@ import (
 	"github.com/freiheit-com/kuberpult/pkg/auth"
 	"github.com/freiheit-com/kuberpult/pkg/config"
 	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/cloudrun"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
 )
 
@@ -478,6 +481,24 @@ func TestBatchServiceErrors(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:  "update environment config without fields",
+			Setup: []repository.Transformer{},
+			Batch: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_UpdateEnvironmentConfig{
+						UpdateEnvironmentConfig: &api.UpdateEnvironmentConfigRequest{
+							Environment:        "dev",
+							Config:             nil,
+							UpdateFields:       nil,
+							PreviousConfigHash: "",
+						},
+					},
+				},
+			},
+			ExpectedResponse: nil,
+			ExpectedError:    status.Error(codes.InvalidArgument, "cannot update environment config: no fields to update"),
+		},
 	}
 	for _, tc := range tcs {
 		tc := tc
@@ -604,6 +625,391 @@ func TestBatchServiceLimit(t *testing.T) {
 	}
 }
 
+func TestBatchServiceDryRun(t *testing.T) {
+	setup := []repository.Transformer{
+		&repository.CreateEnvironment{
+			Environment: "production",
+			Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"}},
+		},
+		&repository.CreateApplicationVersion{
+			Application: "test",
+			Manifests: map[string]string{
+				"production": "manifest",
+			},
+			Team: "test-team",
+		},
+	}
+	tcs := []struct {
+		Name           string
+		Batch          []*api.BatchAction
+		ExpectedDryRun *api.BatchDryRunResult
+		ExpectedError  error
+	}{
+		{
+			Name: "valid batch",
+			Batch: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_Deploy{
+						Deploy: &api.DeployRequest{
+							Environment:  "production",
+							Application:  "test",
+							Version:      1,
+							LockBehavior: api.LockBehavior_FAIL,
+						},
+					},
+				},
+				{
+					Action: &api.BatchAction_CreateEnvironmentLock{
+						CreateEnvironmentLock: &api.CreateEnvironmentLockRequest{
+							Environment: "production",
+							LockId:      "envlock",
+							Message:     "please",
+						},
+					},
+				},
+			},
+			ExpectedDryRun: &api.BatchDryRunResult{
+				CommitMessages: []string{
+					"deployed version 1 of \"test\" to \"production\"",
+					"Created lock \"envlock\" on environment \"production\"",
+				},
+				ChangedApps: []*api.BatchDryRunResult_ChangedApp{
+					{
+						Application: "test",
+						Environment: "production",
+						Team:        "test-team",
+					},
+				},
+				DeletedRootApps: []string{},
+			},
+		},
+		{
+			Name: "version does not exist",
+			Batch: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_Deploy{
+						Deploy: &api.DeployRequest{
+							Environment:  "production",
+							Application:  "test",
+							Version:      2,
+							LockBehavior: api.LockBehavior_FAIL,
+						},
+					},
+				},
+			},
+			ExpectedError: &repository.TransformerBatchApplyError{
+				Index:            0,
+				TransformerError: errMatcher{"deployment failed: could not open manifest for app test with release 2 on env production 'applications/test/releases/2/environments/production/manifests.yaml': file does not exist"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo, err := setupRepositoryTest(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, tr := range setup {
+				if err := repo.Apply(testutil.MakeTestContext(), tr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			svc := &BatchServer{
+				Repository: repo,
+			}
+			resp, err := svc.ProcessBatch(
+				testutil.MakeTestContext(),
+				&api.BatchRequest{
+					Actions: tc.Batch,
+					DryRun:  true,
+				},
+			)
+			if diff := cmp.Diff(tc.ExpectedError, err, cmpopts.EquateErrors()); diff != "" {
+				t.Fatalf("error mismatch (-want, +got):\n%s", diff)
+			}
+			if tc.ExpectedError != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.ExpectedDryRun, resp.DryRun, protocmp.Transform()); diff != "" {
+				t.Errorf("dry run result mismatch (-want, +got):\n%s", diff)
+			}
+			// nothing was applied
+			version, err := svc.Repository.State().GetEnvironmentApplicationVersion(context.Background(), "production", "test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != nil {
+				t.Errorf("unexpected version: expected none, actual: %d", *version)
+			}
+			envLocks, err := svc.Repository.State().GetEnvironmentLocks("production")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, exists := envLocks["envlock"]; exists {
+				t.Error("lock was created")
+			}
+		})
+	}
+}
+
+type mockCloudRunServiceClient struct {
+	api.CloudRunServiceClient
+	deployed [][]byte
+}
+
+func (m *mockCloudRunServiceClient) Deploy(ctx context.Context, in *api.ServiceDeployRequest, opts ...grpc.CallOption) (*api.ServiceDeployResponse, error) {
+	m.deployed = append(m.deployed, in.Manifest)
+	return &api.ServiceDeployResponse{}, nil
+}
+
+func TestBatchServiceDryRunDoesNotDeployToCloudRun(t *testing.T) {
+	dir := t.TempDir()
+	remoteDir := path.Join(dir, "remote")
+	cmd := exec.Command("git", "init", "--bare", remoteDir)
+	cmd.Start()
+	cmd.Wait()
+	cloudRun := &mockCloudRunServiceClient{}
+	repo, err := repository.New(
+		testutil.MakeTestContext(),
+		repository.RepositoryConfig{
+			URL:                    remoteDir,
+			Path:                   path.Join(dir, "local"),
+			CommitterEmail:         "kuberpult@freiheit.com",
+			CommitterName:          "kuberpult",
+			EnvironmentConfigsPath: filepath.Join(remoteDir, "..", "environment_configs.json"),
+			ArgoCdGenerateFiles:    true,
+			CloudRunClient:         &cloudrun.CloudRunClient{Client: cloudRun},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := []repository.Transformer{
+		&repository.CreateEnvironment{
+			Environment: "production",
+			Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"}},
+		},
+		&repository.CreateApplicationVersion{
+			Application: "test",
+			Manifests: map[string]string{
+				"production": "manifest",
+			},
+			Team: "test-team",
+		},
+	}
+	for _, tr := range setup {
+		if err := repo.Apply(testutil.MakeTestContext(), tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &BatchServer{
+		Repository: repo,
+	}
+	request := func(dryRun bool) *api.BatchRequest {
+		return &api.BatchRequest{
+			Actions: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_Deploy{
+						Deploy: &api.DeployRequest{
+							Environment:  "production",
+							Application:  "test",
+							Version:      1,
+							LockBehavior: api.LockBehavior_FAIL,
+						},
+					},
+				},
+			},
+			DryRun: dryRun,
+		}
+	}
+	if _, err := svc.ProcessBatch(testutil.MakeTestContext(), request(true)); err != nil {
+		t.Fatal(err)
+	}
+	if len(cloudRun.deployed) != 0 {
+		t.Fatalf("dry run deployed %d manifests to cloud run", len(cloudRun.deployed))
+	}
+	// the same batch without dry run deploys to cloud run
+	if _, err := svc.ProcessBatch(testutil.MakeTestContext(), request(false)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]byte{[]byte("manifest")}, cloudRun.deployed); diff != "" {
+		t.Errorf("cloud run deployments mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+type mockBatchService_StreamBatchJobServer struct {
+	grpc.ServerStream
+	Results []*api.BatchJob
+	Ctx     context.Context
+}
+
+func (m *mockBatchService_StreamBatchJobServer) Send(msg *api.BatchJob) error {
+	m.Results = append(m.Results, msg)
+	return nil
+}
+
+func (m *mockBatchService_StreamBatchJobServer) Context() context.Context {
+	return m.Ctx
+}
+
+func TestBatchServiceAsync(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		Batch         []*api.BatchAction
+		ExpectedState api.BatchJobState
+		ExpectedError string
+		// only checked if set
+		ExpectedResults []*api.BatchResult
+	}{
+		{
+			Name: "job is pushed",
+			Batch: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_Deploy{
+						Deploy: &api.DeployRequest{
+							Environment:  "production",
+							Application:  "test",
+							Version:      1,
+							LockBehavior: api.LockBehavior_FAIL,
+						},
+					},
+				},
+			},
+			ExpectedState: api.BatchJobState_BATCH_JOB_STATE_PUSHED,
+		},
+		{
+			Name: "job fails",
+			Batch: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_Deploy{
+						Deploy: &api.DeployRequest{
+							Environment:  "production",
+							Application:  "test",
+							Version:      2,
+							LockBehavior: api.LockBehavior_FAIL,
+						},
+					},
+				},
+			},
+			ExpectedState: api.BatchJobState_BATCH_JOB_STATE_FAILED,
+			ExpectedError: "error at index 0 of transformer batch: deployment failed: could not open manifest for app test with release 2 on env production 'applications/test/releases/2/environments/production/manifests.yaml': file does not exist",
+		},
+		{
+			Name: "rejected release keeps the response",
+			Batch: []*api.BatchAction{
+				{
+					Action: &api.BatchAction_CreateRelease{
+						CreateRelease: &api.CreateReleaseRequest{
+							Application: "myappIsWayTooLongDontYouThink",
+							Team:        "team1",
+							Version:     666,
+						},
+					},
+				},
+			},
+			ExpectedState: api.BatchJobState_BATCH_JOB_STATE_FAILED,
+			ExpectedResults: []*api.BatchResult{
+				{
+					Result: &api.BatchResult_CreateReleaseResponse{
+						CreateReleaseResponse: &api.CreateReleaseResponse{
+							Response: &api.CreateReleaseResponse_TooLong{
+								TooLong: &api.CreateReleaseResponseAppNameTooLong{
+									AppName: "myappIsWayTooLongDontYouThink",
+									RegExp:  "\\A[a-z0-9]+(?:-[a-z0-9]+)*\\z",
+									MaxLen:  39,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo, err := setupRepositoryTest(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setup := []repository.Transformer{
+				&repository.CreateEnvironment{
+					Environment: "production",
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: "staging"}},
+				},
+				&repository.CreateApplicationVersion{
+					Application: "test",
+					Manifests: map[string]string{
+						"production": "manifest",
+					},
+					Team: "test-team",
+				},
+			}
+			for _, tr := range setup {
+				if err := repo.Apply(testutil.MakeTestContext(), tr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			svc := &BatchServer{
+				Repository: repo,
+			}
+			job, err := svc.ProcessBatchAsync(
+				testutil.MakeTestContext(),
+				&api.BatchRequest{
+					Actions: tc.Batch,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream := &mockBatchService_StreamBatchJobServer{
+				Results: nil,
+				Ctx:     testutil.MakeTestContext(),
+			}
+			// the stream ends when the job is finished
+			if err := svc.StreamBatchJob(&api.GetBatchJobRequest{JobId: job.JobId}, stream); err != nil {
+				t.Fatal(err)
+			}
+			last := stream.Results[len(stream.Results)-1]
+			if last.State != tc.ExpectedState {
+				t.Errorf("unexpected state: expected %v, actual: %v", tc.ExpectedState, last.State)
+			}
+			if tc.ExpectedResults != nil {
+				// the error contains the response in the proto text format, which is not stable
+				if last.Error == "" {
+					t.Error("expected an error")
+				}
+				if diff := cmp.Diff(tc.ExpectedResults, last.Results, protocmp.Transform()); diff != "" {
+					t.Errorf("results mismatch (-want, +got):\n%s", diff)
+				}
+			} else if diff := cmp.Diff(tc.ExpectedError, last.Error); diff != "" {
+				t.Errorf("error mismatch (-want, +got):\n%s", diff)
+			}
+			if tc.ExpectedState == api.BatchJobState_BATCH_JOB_STATE_PUSHED {
+				if last.CommitId != repo.State().Commit.Id().String() {
+					t.Errorf("unexpected commit id: expected %s, actual: %s", repo.State().Commit.Id().String(), last.CommitId)
+				}
+			}
+			actual, err := svc.GetBatchJob(testutil.MakeTestContext(), &api.GetBatchJobRequest{JobId: job.JobId})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(last, actual, protocmp.Transform()); diff != "" {
+				t.Errorf("job mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetBatchJobNotFound(t *testing.T) {
+	svc := &BatchServer{}
+	_, err := svc.GetBatchJob(testutil.MakeTestContext(), &api.GetBatchJobRequest{JobId: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found, got: %v", err)
+	}
+}
+
 func setupRepositoryTestWithDB(t *testing.T, dbConfig *db.DBConfig) (repository.Repository, error) {
 	dir := t.TempDir()
 	remoteDir := path.Join(dir, "remote")
@@ -0,0 +1,66 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/valid"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type DeploymentBlockerServer struct {
+	Repository repository.Repository
+	RBACConfig auth.RBACConfig
+}
+
+func (s *DeploymentBlockerServer) GetDeploymentBlockers(
+	ctx context.Context,
+	in *api.GetDeploymentBlockersRequest) (*api.GetDeploymentBlockersResponse, error) {
+	if !valid.EnvironmentName(in.Environment) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid environment: '%s'", in.Environment))
+	}
+	if !valid.ApplicationName(in.Application) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid application: '%s'", in.Application))
+	}
+	state := s.Repository.State()
+	var blockers []*api.DeploymentBlocker
+	getBlockers := func(ctx context.Context, transaction *sql.Tx) error {
+		var err error
+		blockers, err = state.GetDeploymentBlockers(ctx, transaction, in.Environment, in.Application, in.Version, time.Now(), s.RBACConfig)
+		return err
+	}
+	if state.DBHandler.ShouldUseOtherTables() {
+		if err := state.DBHandler.WithTransaction(ctx, getBlockers); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := getBlockers(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &api.GetDeploymentBlockersResponse{
+		Blockers: blockers,
+	}, nil
+}
@@ -0,0 +1,235 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package service
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	rp "github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
+)
+
+func TestGetDeploymentBlockers(t *testing.T) {
+	environmentSetup := []rp.Transformer{
+		&rp.CreateEnvironment{
+			Environment: "development",
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{
+					Latest: true,
+				},
+			},
+		},
+		&rp.CreateEnvironment{
+			Environment: "staging-1",
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{
+					Environment: "development",
+				},
+				EnvironmentGroup: ptr.FromString("staging"),
+			},
+		},
+		&rp.CreateEnvironment{
+			Environment: "staging-2",
+			Config: config.EnvironmentConfig{
+				Upstream: &config.EnvironmentConfigUpstream{
+					Environment: "development",
+				},
+				EnvironmentGroup: ptr.FromString("staging"),
+			},
+		},
+		&rp.CreateEnvironment{
+			Environment: "manual",
+			Config:      config.EnvironmentConfig{},
+		},
+		&rp.CreateApplicationVersion{
+			Application: "app",
+			Manifests: map[string]string{
+				"development": "development",
+				"staging-1":   "staging-1",
+				"manual":      "manual",
+			},
+			Team:            "team",
+			WriteCommitData: true,
+		},
+	}
+	type blocker struct {
+		Kind   api.DeploymentBlockerKind
+		LockId string
+	}
+	tcs := []struct {
+		Name             string
+		Setup            []rp.Transformer
+		Request          *api.GetDeploymentBlockersRequest
+		ExpectedBlockers []blocker
+		ExpectedError    codes.Code
+	}{
+		{
+			Name:  "nothing blocks the deployment",
+			Setup: []rp.Transformer{},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "development",
+				Application: "app",
+				Version:     1,
+			},
+			ExpectedBlockers: []blocker{},
+		},
+		{
+			Name:  "environment without upstream",
+			Setup: []rp.Transformer{},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "manual",
+				Application: "app",
+				Version:     1,
+			},
+			ExpectedBlockers: []blocker{},
+		},
+		{
+			Name: "dependency is not deployed",
+			Setup: []rp.Transformer{
+				&rp.CreateApplicationVersion{
+					Application: "app",
+					Version:     2,
+					Manifests: map[string]string{
+						"manual": "manual",
+					},
+					Dependencies: []rp.ReleaseDependency{
+						{Application: "api", MinVersion: 1},
+					},
+					Team:            "team",
+					WriteCommitData: true,
+				},
+			},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "manual",
+				Application: "app",
+				Version:     2,
+			},
+			ExpectedBlockers: []blocker{
+				{Kind: api.DeploymentBlockerKind_UNMET_DEPENDENCIES},
+			},
+		},
+		{
+			Name:  "invalid environment name",
+			Setup: []rp.Transformer{},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "not a valid name",
+				Application: "app",
+				Version:     1,
+			},
+			ExpectedError: codes.InvalidArgument,
+		},
+		{
+			Name:  "environment does not exist",
+			Setup: []rp.Transformer{},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "production",
+				Application: "app",
+				Version:     1,
+			},
+			ExpectedBlockers: []blocker{
+				{Kind: api.DeploymentBlockerKind_ENVIRONMENT_NOT_FOUND},
+			},
+		},
+		{
+			Name:  "release and manifest do not exist",
+			Setup: []rp.Transformer{},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "staging-2",
+				Application: "app",
+				Version:     2,
+			},
+			ExpectedBlockers: []blocker{
+				{Kind: api.DeploymentBlockerKind_RELEASE_NOT_FOUND},
+				{Kind: api.DeploymentBlockerKind_UPSTREAM_MISMATCH},
+			},
+		},
+		{
+			Name: "all kinds of locks",
+			Setup: []rp.Transformer{
+				&rp.CreateEnvironmentLock{
+					Environment: "staging-1",
+					LockId:      "env-lock",
+					Message:     "env",
+				},
+				&rp.CreateEnvironmentGroupLock{
+					EnvironmentGroup: "staging",
+					LockId:           "group-lock",
+					Message:          "group",
+				},
+				&rp.CreateEnvironmentApplicationLock{
+					Environment: "staging-1",
+					Application: "app",
+					LockId:      "app-lock",
+					Message:     "app",
+				},
+				&rp.CreateEnvironmentTeamLock{
+					Environment: "staging-1",
+					Team:        "team",
+					LockId:      "team-lock",
+					Message:     "team",
+				},
+			},
+			Request: &api.GetDeploymentBlockersRequest{
+				Environment: "staging-1",
+				Application: "app",
+				Version:     1,
+			},
+			ExpectedBlockers: []blocker{
+				{Kind: api.DeploymentBlockerKind_ENVIRONMENT_LOCK, LockId: "env-lock"},
+				{Kind: api.DeploymentBlockerKind_ENVIRONMENT_GROUP_LOCK, LockId: "group-lock"},
+				{Kind: api.DeploymentBlockerKind_APPLICATION_LOCK, LockId: "app-lock"},
+				{Kind: api.DeploymentBlockerKind_TEAM_LOCK, LockId: "team-lock"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo, err := setupRepositoryTest(t)
+			if err != nil {
+				t.Fatalf("error setting up repository test: %v", err)
+			}
+			err = repo.Apply(testutil.MakeTestContext(), append(environmentSetup, tc.Setup...)...)
+			if err != nil {
+				t.Fatalf("error during setup, error: %v", err)
+			}
+
+			sv := &DeploymentBlockerServer{Repository: repo}
+			resp, err := sv.GetDeploymentBlockers(testutil.MakeTestContext(), tc.Request)
+			if status.Code(err) != tc.ExpectedError {
+				t.Fatalf("expected error doesn't match actual error, expected %v, got code: %v, error: %v", tc.ExpectedError, status.Code(err), err)
+			}
+			if err != nil {
+				return
+			}
+			actual := []blocker{}
+			for _, b := range resp.Blockers {
+				actual = append(actual, blocker{Kind: b.Kind, LockId: b.LockId})
+			}
+			if diff := cmp.Diff(tc.ExpectedBlockers, actual); diff != "" {
+				t.Errorf("blockers mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -18,10 +18,18 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/freeze"
+	"github.com/freiheit-com/kuberpult/pkg/mapper"
+	"github.com/freiheit-com/kuberpult/pkg/valid"
 	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
 )
 
@@ -37,16 +45,136 @@ func (o *EnvironmentServiceServer) GetEnvironmentConfig(
 	if err != nil {
 		return nil, err
 	}
+	hash, err := repository.EnvironmentConfigHash(*config)
+	if err != nil {
+		return nil, err
+	}
 	var out api.GetEnvironmentConfigResponse
 	out.Config = TransformEnvironmentConfigToApi(*config)
+	out.ConfigHash = hash
 	return &out, nil
 }
 
+func (o *EnvironmentServiceServer) GetLockHistory(
+	ctx context.Context,
+	in *api.GetLockHistoryRequest) (*api.GetLockHistoryResponse, error) {
+	if !valid.EnvironmentName(in.Environment) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid environment: '%s'", in.Environment))
+	}
+	if in.Application != nil && !valid.ApplicationName(*in.Application) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid application: '%s'", *in.Application))
+	}
+	if in.Team != nil && !valid.TeamName(*in.Team) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid team: '%s'", *in.Team))
+	}
+	// without a time range, the whole history up to now is returned
+	from := time.Unix(0, 0)
+	if in.From != nil {
+		from = in.From.AsTime()
+	}
+	to := time.Now()
+	if in.To != nil {
+		to = in.To.AsTime()
+	}
+	if to.Before(from) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid time range: %s is before %s", to.Format(time.RFC3339), from.Format(time.RFC3339)))
+	}
+	state := o.Repository.State()
+	var events []*api.Event
+	getHistory := func(ctx context.Context, transaction *sql.Tx) error {
+		var err error
+		events, err = state.GetLockHistory(ctx, transaction, in.Environment, in.Application, in.Team, from, to)
+		return err
+	}
+	if state.DBHandler.ShouldUseOtherTables() {
+		if err := state.DBHandler.WithTransaction(ctx, getHistory); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := getHistory(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &api.GetLockHistoryResponse{
+		Events: events,
+	}, nil
+}
+
+func (o *EnvironmentServiceServer) ValidateEnvironmentConfigs(
+	ctx context.Context,
+	in *api.ValidateEnvironmentConfigsRequest) (*api.ValidateEnvironmentConfigsResponse, error) {
+	state := o.Repository.State()
+	envConfigs, err := state.GetEnvironmentConfigs()
+	if err != nil {
+		return nil, err
+	}
+	// the ui validates a new or changed environment before it is stored
+	if in.Environment != nil {
+		if !valid.EnvironmentName(*in.Environment) {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid environment: '%s'", *in.Environment))
+		}
+		envConfigs[*in.Environment] = transformEnvironmentConfigToConfig(in.Config)
+	}
+	return &api.ValidateEnvironmentConfigsResponse{
+		Problems: mapper.ValidateEnvironmentConfigs(envConfigs),
+	}, nil
+}
+
 func TransformEnvironmentConfigToApi(in config.EnvironmentConfig) *api.EnvironmentConfig {
 	return &api.EnvironmentConfig{
 		Upstream:         transformUpstreamToApi(in.Upstream),
 		Argocd:           transformArgoCdToApi(in.ArgoCd),
 		EnvironmentGroup: in.EnvironmentGroup,
+		FreezeWindows:    mapper.TransformFreezeWindows(in.FreezeWindows),
+		AutoRollback:     mapper.TransformAutoRollback(in.AutoRollback),
+		Promotion:        mapper.TransformPromotion(in.Promotion),
+	}
+}
+
+func transformEnvironmentConfigToConfig(conf *api.EnvironmentConfig) config.EnvironmentConfig {
+	if conf == nil {
+		//exhaustruct:ignore
+		conf = &api.EnvironmentConfig{}
+	}
+	var argocd *config.EnvironmentConfigArgoCd
+	if conf.Argocd != nil {
+		syncWindows := transformSyncWindowsToConfig(conf.Argocd.SyncWindows)
+		clusterResourceWhitelist := transformAccessListToConfig(conf.Argocd.AccessList)
+		ignoreDifferences := transformIgnoreDifferencesToConfig(conf.Argocd.IgnoreDifferences)
+		argocd = &config.EnvironmentConfigArgoCd{
+			Destination:              transformDestinationToConfig(conf.Argocd.Destination),
+			SyncWindows:              syncWindows,
+			ClusterResourceWhitelist: clusterResourceWhitelist,
+			ApplicationAnnotations:   conf.Argocd.ApplicationAnnotations,
+			IgnoreDifferences:        ignoreDifferences,
+			SyncOptions:              conf.Argocd.SyncOptions,
+		}
+	}
+	return config.EnvironmentConfig{
+		Upstream:         transformUpstreamToConfig(conf.Upstream),
+		ArgoCd:           argocd,
+		EnvironmentGroup: conf.EnvironmentGroup,
+		FreezeWindows:    freeze.WindowsFromApi(conf.FreezeWindows),
+		AutoRollback:     transformAutoRollbackToConfig(conf.AutoRollback),
+		Promotion:        transformPromotionToConfig(conf.Promotion),
+	}
+}
+
+func transformPromotionToConfig(promotion *api.EnvironmentConfig_Promotion) *config.EnvironmentConfigPromotion {
+	if promotion == nil {
+		return nil
+	}
+	return &config.EnvironmentConfigPromotion{
+		SoakTime: promotion.SoakTime,
+	}
+}
+
+func transformAutoRollbackToConfig(autoRollback *api.EnvironmentConfig_AutoRollback) *config.EnvironmentConfigAutoRollback {
+	if autoRollback == nil {
+		return nil
+	}
+	return &config.EnvironmentConfigAutoRollback{
+		UnhealthyDuration: autoRollback.UnhealthyDuration,
 	}
 }
 
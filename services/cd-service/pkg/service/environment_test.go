@@ -22,8 +22,13 @@ import (
 	"github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/config"
 	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
 )
 
 func TestEnnvironmentConfigToApi(t *testing.T) {
@@ -170,3 +175,97 @@ func TestEnnvironmentConfigToApi(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEnvironmentConfigs(t *testing.T) {
+	tcs := []struct {
+		Name             string
+		Request          *api.ValidateEnvironmentConfigsRequest
+		ExpectedError    codes.Code
+		ExpectedProblems []*api.EnvironmentConfigProblem
+	}{
+		{
+			Name:    "current configs",
+			Request: &api.ValidateEnvironmentConfigsRequest{},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_DANGLING_UPSTREAM,
+					Environments: []string{"canary"},
+					Message:      `environment "canary" has upstream "production", which does not exist`,
+				},
+			},
+		},
+		{
+			Name: "new environment fixes the dangling upstream",
+			Request: &api.ValidateEnvironmentConfigsRequest{
+				Environment: ptr.FromString("production"),
+				Config: &api.EnvironmentConfig{
+					Upstream: &api.EnvironmentConfig_Upstream{Environment: ptr.FromString("staging")},
+				},
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{},
+		},
+		{
+			Name: "changed environment adds a cycle",
+			Request: &api.ValidateEnvironmentConfigsRequest{
+				Environment: ptr.FromString("staging"),
+				Config: &api.EnvironmentConfig{
+					Upstream: &api.EnvironmentConfig_Upstream{Environment: ptr.FromString("staging")},
+				},
+			},
+			ExpectedProblems: []*api.EnvironmentConfigProblem{
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_DANGLING_UPSTREAM,
+					Environments: []string{"canary"},
+					Message:      `environment "canary" has upstream "production", which does not exist`,
+				},
+				{
+					Kind:         api.EnvironmentConfigProblem_KIND_UPSTREAM_CYCLE,
+					Environments: []string{"staging"},
+					Message:      "upstream cycle: staging -> staging",
+				},
+			},
+		},
+		{
+			Name: "invalid environment",
+			Request: &api.ValidateEnvironmentConfigsRequest{
+				Environment: ptr.FromString("-invalid-"),
+				Config:      &api.EnvironmentConfig{},
+			},
+			ExpectedError: codes.InvalidArgument,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			repo, err := setupRepositoryTest(t)
+			if err != nil {
+				t.Fatalf("error setting up repository test: %v", err)
+			}
+			err = repo.Apply(testutil.MakeTestContext(),
+				&repository.CreateEnvironment{
+					Environment: "staging",
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+				},
+				&repository.CreateEnvironment{
+					Environment: "canary",
+					Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Environment: "production"}},
+				},
+			)
+			if err != nil {
+				t.Fatalf("error during setup, error: %v", err)
+			}
+
+			sv := &EnvironmentServiceServer{Repository: repo}
+			resp, err := sv.ValidateEnvironmentConfigs(testutil.MakeTestContext(), tc.Request)
+			if status.Code(err) != tc.ExpectedError {
+				t.Fatalf("expected error doesn't match actual error, expected %v, got code: %v, error: %v", tc.ExpectedError, status.Code(err), err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.ExpectedProblems, resp.Problems, protocmp.Transform()); diff != "" {
+				t.Errorf("problems mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
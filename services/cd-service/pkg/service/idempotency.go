@@ -0,0 +1,144 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/db"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// processIdempotentBatch applies the batch, unless the same user sent a batch with the same idempotency key within the idempotency window.
+// In that case, the stored response is returned.
+// The key is reserved before the batch is applied, so that concurrent requests with the same key are aborted instead of applied twice.
+func (d *BatchServer) processIdempotentBatch(
+	ctx context.Context,
+	in *api.BatchRequest,
+	transformers []repository.Transformer,
+	results []*api.BatchResult,
+) (*api.BatchResponse, error) {
+	dbHandler := d.Repository.State().DBHandler
+	if !dbHandler.ShouldUseOtherTables() {
+		return nil, status.Error(codes.FailedPrecondition, "cannot process batch: idempotency keys require the database")
+	}
+	user, err := auth.ReadUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := in.GetIdempotencyKey()
+	requestHash, err := hashBatchRequest(in)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notBefore := now.Add(-d.Config.IdempotencyWindow)
+	stored, err := db.WithTransactionT(dbHandler, ctx, func(ctx context.Context, transaction *sql.Tx) (*db.IdempotencyKey, error) {
+		reserved, err := dbHandler.DBReserveIdempotencyKey(ctx, transaction, db.IdempotencyKey{
+			UserEmail:   user.Email,
+			Key:         key,
+			Created:     now,
+			RequestHash: requestHash,
+			Response:    "",
+		}, notBefore)
+		if err != nil || reserved {
+			return nil, err
+		}
+		stored, err := dbHandler.DBSelectIdempotencyKey(ctx, transaction, user.Email, key, notBefore)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil {
+			// the key was removed after the reservation failed
+			return nil, status.Error(codes.Aborted, fmt.Sprintf("cannot process batch: idempotency key %q was used concurrently, please retry", key))
+		}
+		return stored, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		if stored.RequestHash != requestHash {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot process batch: idempotency key %q was already used for a different batch", key))
+		}
+		if stored.Response == "" {
+			return nil, status.Error(codes.Aborted, fmt.Sprintf("cannot process batch: a batch with idempotency key %q is still being processed", key))
+		}
+		//exhaustruct:ignore
+		response := &api.BatchResponse{}
+		if err := protojson.Unmarshal([]byte(stored.Response), response); err != nil {
+			return nil, fmt.Errorf("could not unmarshal the stored response of idempotency key %q: %w", key, err)
+		}
+		return response, nil
+	}
+
+	err = d.Repository.Apply(ctx, transformers...)
+	if err != nil {
+		// failed batches are not stored, so that they can be retried
+		deleteErr := dbHandler.WithTransaction(ctx, func(ctx context.Context, transaction *sql.Tx) error {
+			return dbHandler.DBDeleteIdempotencyKey(ctx, transaction, user.Email, key)
+		})
+		if deleteErr != nil {
+			logger.FromContext(ctx).Sugar().Warnf("could not remove idempotency key %q of failed batch: %v", key, deleteErr)
+		}
+		return batchApplyError(err)
+	}
+	response := &api.BatchResponse{Results: results, DryRun: nil}
+	responseJson, err := protojson.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	err = dbHandler.WithTransaction(ctx, func(ctx context.Context, transaction *sql.Tx) error {
+		return dbHandler.DBUpdateIdempotencyKeyResponse(ctx, transaction, user.Email, key, string(responseJson))
+	})
+	if err != nil {
+		// the batch was applied already, so the caller must not retry it.
+		// Retries with this key are aborted until the key expires.
+		logger.FromContext(ctx).Sugar().Warnf("could not store the response of idempotency key %q: %v", key, err)
+	}
+	return response, nil
+}
+
+// hashBatchRequest returns a hash of the actions of the batch.
+func hashBatchRequest(in *api.BatchRequest) (string, error) {
+	data, err := proto.MarshalOptions{
+		AllowPartial:  false,
+		Deterministic: true,
+		UseCachedSize: false,
+	}.Marshal(&api.BatchRequest{
+		Actions:        in.GetActions(),
+		DryRun:         false,
+		IdempotencyKey: "",
+	})
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,250 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/config"
+	"github.com/freiheit-com/kuberpult/pkg/db"
+	"github.com/freiheit-com/kuberpult/pkg/testutil"
+	"github.com/freiheit-com/kuberpult/services/cd-service/pkg/repository"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func lockBatch(key string, lockIds ...string) *api.BatchRequest {
+	actions := []*api.BatchAction{}
+	for _, lockId := range lockIds {
+		actions = append(actions, &api.BatchAction{
+			Action: &api.BatchAction_CreateEnvironmentLock{
+				CreateEnvironmentLock: &api.CreateEnvironmentLockRequest{
+					Environment: "production",
+					LockId:      lockId,
+					Message:     "please",
+				},
+			},
+		})
+	}
+	return &api.BatchRequest{
+		Actions:        actions,
+		DryRun:         false,
+		IdempotencyKey: key,
+	}
+}
+
+func TestBatchServiceIdempotencyKey(t *testing.T) {
+	tcs := []struct {
+		Name     string
+		Requests []*api.BatchRequest
+		// if set, the second request is sent by this user
+		SecondUser    string
+		ExpectedLocks []string
+		ExpectedCode  codes.Code
+	}{
+		{
+			Name: "repeated key is not processed again",
+			Requests: []*api.BatchRequest{
+				lockBatch("key-1", "l1"),
+				lockBatch("key-1", "l1"),
+			},
+			ExpectedLocks: []string{},
+			ExpectedCode:  codes.OK,
+		},
+		{
+			Name: "different keys are processed",
+			Requests: []*api.BatchRequest{
+				lockBatch("key-1", "l1"),
+				lockBatch("key-2", "l1"),
+			},
+			ExpectedLocks: []string{"l1"},
+			ExpectedCode:  codes.OK,
+		},
+		{
+			Name: "same key of another user is processed",
+			Requests: []*api.BatchRequest{
+				lockBatch("key-1", "l1"),
+				lockBatch("key-1", "l1"),
+			},
+			SecondUser:    "other@example.com",
+			ExpectedLocks: []string{"l1"},
+			ExpectedCode:  codes.OK,
+		},
+		{
+			Name: "repeated key with different actions",
+			Requests: []*api.BatchRequest{
+				lockBatch("key-1", "l1"),
+				lockBatch("key-1", "l2"),
+			},
+			ExpectedLocks: []string{},
+			ExpectedCode:  codes.InvalidArgument,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := testutil.CreateMigrationsPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo, err := setupRepositoryTestWithDB(t, &db.DBConfig{
+				DriverName:     "sqlite3",
+				MigrationsPath: dir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := testutil.MakeTestContext()
+			err = repo.Apply(ctx, &repository.CreateEnvironment{
+				Environment: "production",
+				Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			svc := &BatchServer{
+				Repository: repo,
+				Config: BatchServerConfig{
+					IdempotencyWindow: time.Hour,
+				},
+			}
+			first, err := svc.ProcessBatch(ctx, tc.Requests[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			// remove the lock, so that we can see whether the second batch creates it again
+			err = repo.Apply(ctx, &repository.DeleteEnvironmentLock{
+				Environment: "production",
+				LockId:      "l1",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			secondCtx := ctx
+			if tc.SecondUser != "" {
+				secondCtx = userContext(tc.SecondUser)
+			}
+			second, err := svc.ProcessBatch(secondCtx, tc.Requests[1])
+			if status.Code(err) != tc.ExpectedCode {
+				t.Fatalf("unexpected error: expected code %v, got: %v", tc.ExpectedCode, err)
+			}
+			if err == nil {
+				if diff := cmp.Diff(first, second, protocmp.Transform()); diff != "" {
+					t.Errorf("response mismatch (-want, +got):\n%s", diff)
+				}
+			}
+			locks, err := repo.State().GetEnvironmentLocks("production")
+			if err != nil {
+				t.Fatal(err)
+			}
+			actualLocks := []string{}
+			for lockId := range locks {
+				actualLocks = append(actualLocks, lockId)
+			}
+			if diff := cmp.Diff(tc.ExpectedLocks, actualLocks); diff != "" {
+				t.Errorf("locks mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func userContext(email string) context.Context {
+	return auth.WriteUserToContext(context.Background(), auth.User{
+		DexAuthContext: nil,
+		Email:          email,
+		Name:           "other user",
+	})
+}
+
+func TestBatchServiceIdempotencyKeyInProgress(t *testing.T) {
+	dir, err := testutil.CreateMigrationsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := setupRepositoryTestWithDB(t, &db.DBConfig{
+		DriverName:     "sqlite3",
+		MigrationsPath: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testutil.MakeTestContext()
+	err = repo.Apply(ctx, &repository.CreateEnvironment{
+		Environment: "production",
+		Config:      config.EnvironmentConfig{Upstream: &config.EnvironmentConfigUpstream{Latest: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &BatchServer{
+		Repository: repo,
+		Config: BatchServerConfig{
+			IdempotencyWindow: time.Hour,
+		},
+	}
+	requestHash, err := hashBatchRequest(lockBatch("key-1", "l1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another request with the same key is being processed
+	dbHandler := repo.State().DBHandler
+	err = dbHandler.WithTransaction(ctx, func(ctx context.Context, transaction *sql.Tx) error {
+		_, err := dbHandler.DBReserveIdempotencyKey(ctx, transaction, db.IdempotencyKey{
+			UserEmail:   "testmail@example.com",
+			Key:         "key-1",
+			Created:     time.Now(),
+			RequestHash: requestHash,
+			Response:    "",
+		}, time.Now().Add(-time.Hour))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.ProcessBatch(ctx, lockBatch("key-1", "l1"))
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected aborted, got: %v", err)
+	}
+	locks, err := repo.State().GetEnvironmentLocks("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 0 {
+		t.Errorf("expected no locks, got %v", locks)
+	}
+}
+
+func TestBatchServiceIdempotencyKeyWithoutDatabase(t *testing.T) {
+	repo, err := setupRepositoryTest(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &BatchServer{
+		Repository: repo,
+	}
+	_, err = svc.ProcessBatch(testutil.MakeTestContext(), lockBatch("key-1", "l1"))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected failed precondition, got: %v", err)
+	}
+}
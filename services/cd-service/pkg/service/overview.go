@@ -25,6 +25,7 @@ import (
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/freiheit-com/kuberpult/pkg/grpc"
 	"github.com/freiheit-com/kuberpult/pkg/logger"
@@ -69,9 +70,41 @@ func (o *OverviewServiceServer) GetOverview(
 			}
 			return nil, err
 		}
-		return o.getOverviewDB(ctx, state)
+		return o.getFilteredOverview(ctx, state, in.ReleaseLabels)
 	}
-	return o.getOverviewDB(ctx, o.Repository.State())
+	return o.getFilteredOverview(ctx, o.Repository.State(), in.ReleaseLabels)
+}
+
+func (o *OverviewServiceServer) getFilteredOverview(
+	ctx context.Context,
+	s *repository.State,
+	releaseLabels map[string]string) (*api.GetOverviewResponse, error) {
+	response, err := o.getOverviewDB(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(releaseLabels) == 0 {
+		return response, nil
+	}
+	for _, app := range response.Applications {
+		releases := []*api.Release{}
+		for _, release := range app.Releases {
+			if releaseHasLabels(release, releaseLabels) {
+				releases = append(releases, release)
+			}
+		}
+		app.Releases = releases
+	}
+	return response, nil
+}
+
+func releaseHasLabels(release *api.Release, labels map[string]string) bool {
+	for key, value := range labels {
+		if actual, ok := release.Labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
 }
 
 func (o *OverviewServiceServer) getOverviewDB(
@@ -131,6 +164,9 @@ func (o *OverviewServiceServer) getOverview(
 					Upstream:         mapper.TransformUpstream(config.Upstream),
 					Argocd:           argocd,
 					EnvironmentGroup: &groupName,
+					FreezeWindows:    mapper.TransformFreezeWindows(config.FreezeWindows),
+					AutoRollback:     mapper.TransformAutoRollback(config.AutoRollback),
+					Promotion:        mapper.TransformPromotion(config.Promotion),
 				},
 				Locks:        map[string]*api.Lock{},
 				Applications: map[string]*api.Environment_Application{},
@@ -148,6 +184,8 @@ func (o *OverviewServiceServer) getOverview(
 							Name:  lock.CreatedBy.Name,
 							Email: lock.CreatedBy.Email,
 						},
+						ExpiresAt: expiresAtToProto(lock.ExpiresAt),
+						Selector:  "",
 					}
 				}
 				envInGroup.Locks = env.Locks
@@ -167,10 +205,12 @@ func (o *OverviewServiceServer) getOverview(
 						Name:            appName,
 						Locks:           map[string]*api.Lock{},
 						TeamLocks:       map[string]*api.Lock{},
+						SelectorLocks:   map[string]*api.Lock{},
 						Team:            teamName,
 						DeploymentMetaData: &api.Environment_Application_DeploymentMetaData{
-							DeployAuthor: "",
-							DeployTime:   "",
+							DeployAuthor:      "",
+							DeployTime:        "",
+							RolledBackVersion: 0,
 						},
 					}
 					if err == nil {
@@ -186,6 +226,8 @@ func (o *OverviewServiceServer) getOverview(
 										Name:  lock.CreatedBy.Name,
 										Email: lock.CreatedBy.Email,
 									},
+									ExpiresAt: expiresAtToProto(lock.ExpiresAt),
+									Selector:  "",
 								}
 							}
 						}
@@ -233,6 +275,25 @@ func (o *OverviewServiceServer) getOverview(
 									Name:  lock.CreatedBy.Name,
 									Email: lock.CreatedBy.Email,
 								},
+								ExpiresAt: expiresAtToProto(lock.ExpiresAt),
+								Selector:  "",
+							}
+						}
+					}
+					if selectorLocks, err := s.GetSelectorLocksForApplication(envName, appName); err != nil {
+						return nil, err
+					} else {
+						for lockId, lock := range selectorLocks {
+							app.SelectorLocks[lockId] = &api.Lock{
+								Message:   lock.Lock.Message,
+								LockId:    lockId,
+								CreatedAt: timestamppb.New(lock.Lock.CreatedAt),
+								CreatedBy: &api.Actor{
+									Name:  lock.Lock.CreatedBy.Name,
+									Email: lock.Lock.CreatedBy.Email,
+								},
+								ExpiresAt: expiresAtToProto(lock.Lock.ExpiresAt),
+								Selector:  lock.Selector,
 							}
 						}
 					}
@@ -245,15 +306,18 @@ func (o *OverviewServiceServer) getOverview(
 							}
 						}
 					}
-					deployAuthor, deployTime, err := s.GetDeploymentMetaData(ctx, envName, appName)
+					deployment, err := s.GetDeploymentMetaData(ctx, envName, appName)
 					if err != nil {
 						return nil, err
 					}
-					app.DeploymentMetaData.DeployAuthor = deployAuthor
-					if deployTime.IsZero() {
+					app.DeploymentMetaData.DeployAuthor = deployment.DeployAuthor
+					if deployment.DeployTime.IsZero() {
 						app.DeploymentMetaData.DeployTime = ""
 					} else {
-						app.DeploymentMetaData.DeployTime = fmt.Sprintf("%d", deployTime.Unix())
+						app.DeploymentMetaData.DeployTime = fmt.Sprintf("%d", deployment.DeployTime.Unix())
+					}
+					if deployment.RolledBackVersion != nil {
+						app.DeploymentMetaData.RolledBackVersion = *deployment.RolledBackVersion
 					}
 					env.Applications[appName] = &app
 				}
@@ -478,3 +542,10 @@ func (o *OverviewServiceServer) update(s *repository.State) {
 	o.response.Store(r)
 	o.notify.Notify()
 }
+
+func expiresAtToProto(expiresAt *time.Time) *timestamppb.Timestamp {
+	if expiresAt == nil {
+		return nil
+	}
+	return timestamppb.New(*expiresAt)
+}
@@ -72,6 +72,7 @@ func (s *ReleaseTrainPrognosisServer) GetReleaseTrainPrognosis(ctx context.Conte
 				retAppPrognosis := &api.ReleaseTrainAppPrognosis{}
 				if appPrognosis.SkipCause != nil {
 					retAppPrognosis.Outcome = appPrognosis.SkipCause
+					retAppPrognosis.UnmetDependencies = rp.ReleaseDependenciesToProto(appPrognosis.UnmetDependencies)
 				} else {
 					retAppPrognosis.Outcome = &api.ReleaseTrainAppPrognosis_DeployedVersion{
 						DeployedVersion: appPrognosis.Version,
@@ -24,6 +24,7 @@ import (
 	"strconv"
 
 	"github.com/freiheit-com/kuberpult/pkg/grpc"
+	"github.com/freiheit-com/kuberpult/pkg/valid"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -65,11 +66,11 @@ func (o *VersionServiceServer) GetVersion(
 	}
 	if version != nil {
 		res.Version = *version
-		_, deployedAt, err := state.GetDeploymentMetaData(ctx, in.Environment, in.Application)
+		deployment, err := state.GetDeploymentMetaData(ctx, in.Environment, in.Application)
 		if err != nil {
 			return nil, err
 		}
-		res.DeployedAt = timestamppb.New(deployedAt)
+		res.DeployedAt = timestamppb.New(deployment.DeployTime)
 		release, err := state.GetApplicationRelease(in.Application, *version)
 		if err != nil {
 			return nil, err
@@ -126,3 +127,84 @@ func (o *VersionServiceServer) GetManifests(ctx context.Context, req *api.GetMan
 		Manifests: manifests,
 	}, nil
 }
+
+func (o *VersionServiceServer) GetRetentionPolicy(ctx context.Context, req *api.GetRetentionPolicyRequest) (*api.GetRetentionPolicyResponse, error) {
+	if !valid.ApplicationName(req.Application) {
+		return nil, status.Error(codes.InvalidArgument, "invalid application")
+	}
+	state := o.Repository.State()
+	if _, err := state.Filesystem.Stat(state.Filesystem.Join("applications", req.Application)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Errorf(codes.NotFound, "application %s not found", req.Application)
+		}
+		return nil, err
+	}
+	policy, err := state.GetApplicationRetentionPolicy(req.Application)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := state.GetApplicationVersionsToCleanup(ctx, nil, req.Application)
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetRetentionPolicyResponse{
+		Policy:              policy.ToProto(),
+		NextDeletedVersions: versions,
+	}, nil
+}
+
+func (o *VersionServiceServer) GetScheduledDeployments(ctx context.Context, req *api.GetScheduledDeploymentsRequest) (*api.GetScheduledDeploymentsResponse, error) {
+	if !valid.ApplicationName(req.Application) {
+		return nil, status.Error(codes.InvalidArgument, "invalid application")
+	}
+	if req.Environment != nil && !valid.EnvironmentName(*req.Environment) {
+		return nil, status.Error(codes.InvalidArgument, "invalid environment")
+	}
+	scheduled, err := o.Repository.State().GetScheduledDeployments(req.Application, req.Environment)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*api.ScheduledDeployment, 0, len(scheduled))
+	for _, d := range scheduled {
+		result = append(result, d.ToProto())
+	}
+	return &api.GetScheduledDeploymentsResponse{
+		ScheduledDeployments: result,
+	}, nil
+}
+
+func (o *VersionServiceServer) GetManifestDiff(ctx context.Context, req *api.GetManifestDiffRequest) (*api.GetManifestDiffResponse, error) {
+	if !valid.ApplicationName(req.Application) {
+		return nil, status.Error(codes.InvalidArgument, "invalid application")
+	}
+	state := o.Repository.State()
+	var (
+		diff *repository.ManifestDiff
+		err  error
+	)
+	switch target := req.Target.(type) {
+	case *api.GetManifestDiffRequest_Releases:
+		if !valid.EnvironmentName(target.Releases.Environment) {
+			return nil, status.Error(codes.InvalidArgument, "invalid environment")
+		}
+		diff, err = state.GetReleaseManifestDiff(req.Application, target.Releases.Environment, target.Releases.FromVersion, target.Releases.ToVersion)
+	case *api.GetManifestDiffRequest_Environments:
+		if !valid.EnvironmentName(target.Environments.FromEnvironment) || !valid.EnvironmentName(target.Environments.ToEnvironment) {
+			return nil, status.Error(codes.InvalidArgument, "invalid environment")
+		}
+		diff, err = state.GetEnvironmentManifestDiff(ctx, nil, req.Application, target.Environments.FromEnvironment, target.Environments.ToEnvironment)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "either releases or environments must be specified")
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Error(codes.NotFound, "release not found")
+		}
+		return nil, err
+	}
+	return &api.GetManifestDiffResponse{
+		FromVersion: diff.FromVersion,
+		ToVersion:   diff.ToVersion,
+		Diff:        diff.Diff,
+	}, nil
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -39,6 +40,7 @@ import (
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/auth"
 	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 	"github.com/freiheit-com/kuberpult/pkg/setup"
 	"github.com/freiheit-com/kuberpult/pkg/tracing"
 	"github.com/freiheit-com/kuberpult/services/frontend-service/pkg/handler"
@@ -257,6 +259,10 @@ func runServer(ctx context.Context) error {
 		logger.FromContext(ctx).Fatal("pgp.read.error", zap.Error(err))
 		return err
 	}
+	secretPolicy, err := manifestpolicy.ParseSecretPolicy(c.SecretPolicy, c.SecretPolicyAllowedKinds)
+	if err != nil {
+		logger.FromContext(ctx).Fatal("secret.policy.error", zap.Error(err))
+	}
 	if c.AzureEnableAuth && pgpKeyRing == nil {
 		logger.FromContext(ctx).Fatal("azure.auth.error: pgpKeyRing is required to authenticate manifests when \"KUBERPULT_AZURE_ENABLE_AUTH\" is true")
 		return err
@@ -286,14 +292,17 @@ func runServer(ctx context.Context) error {
 	}
 
 	releaseTrainPrognosisClient := api.NewReleaseTrainPrognosisServiceClient(cdCon)
+	deploymentBlockerClient := api.NewDeploymentBlockerServiceClient(cdCon)
+	overviewClient := api.NewOverviewServiceClient(cdCon)
 
 	gproxy := &GrpcProxy{
-		OverviewClient:              api.NewOverviewServiceClient(cdCon),
+		OverviewClient:              overviewClient,
 		BatchClient:                 batchClient,
 		RolloutServiceClient:        rolloutClient,
 		GitClient:                   api.NewGitServiceClient(cdCon),
 		EnvironmentServiceClient:    api.NewEnvironmentServiceClient(cdCon),
 		ReleaseTrainPrognosisClient: releaseTrainPrognosisClient,
+		DeploymentBlockerClient:     deploymentBlockerClient,
 	}
 	api.RegisterOverviewServiceServer(gsrv, gproxy)
 	api.RegisterBatchServiceServer(gsrv, gproxy)
@@ -301,6 +310,7 @@ func runServer(ctx context.Context) error {
 	api.RegisterGitServiceServer(gsrv, gproxy)
 	api.RegisterEnvironmentServiceServer(gsrv, gproxy)
 	api.RegisterReleaseTrainPrognosisServiceServer(gsrv, gproxy)
+	api.RegisterDeploymentBlockerServiceServer(gsrv, gproxy)
 
 	frontendConfigService := &service.FrontendConfigServiceServer{
 		Config: config.FrontendConfig{
@@ -332,9 +342,12 @@ func runServer(ctx context.Context) error {
 		RolloutClient:               rolloutClient,
 		VersionClient:               api.NewVersionServiceClient(cdCon),
 		ReleaseTrainPrognosisClient: releaseTrainPrognosisClient,
+		DeploymentBlockerClient:     deploymentBlockerClient,
+		OverviewClient:              overviewClient,
 		Config:                      c,
 		KeyRing:                     pgpKeyRing,
 		AzureAuth:                   c.AzureEnableAuth,
+		SecretPolicy:                secretPolicy,
 	}
 	restHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		defer readAllAndClose(req.Body, 1024)
@@ -618,6 +631,7 @@ type GrpcProxy struct {
 	GitClient                   api.GitServiceClient
 	EnvironmentServiceClient    api.EnvironmentServiceClient
 	ReleaseTrainPrognosisClient api.ReleaseTrainPrognosisServiceClient
+	DeploymentBlockerClient     api.DeploymentBlockerServiceClient
 }
 
 func (p *GrpcProxy) ProcessBatch(
@@ -634,6 +648,47 @@ func (p *GrpcProxy) ProcessBatch(
 	return p.BatchClient.ProcessBatch(ctx, in)
 }
 
+func (p *GrpcProxy) ProcessBatchAsync(
+	ctx context.Context,
+	in *api.BatchRequest) (*api.BatchJob, error) {
+	for i := range in.Actions {
+		batchAction := in.GetActions()[i]
+		switch batchAction.Action.(type) {
+		case *api.BatchAction_CreateRelease:
+			return nil, grpcerrors.PublicError(ctx, fmt.Errorf("action create-release is only supported via http in the frontend-service"))
+		}
+	}
+
+	return p.BatchClient.ProcessBatchAsync(ctx, in)
+}
+
+func (p *GrpcProxy) GetBatchJob(
+	ctx context.Context,
+	in *api.GetBatchJobRequest) (*api.BatchJob, error) {
+	return p.BatchClient.GetBatchJob(ctx, in)
+}
+
+func (p *GrpcProxy) StreamBatchJob(
+	in *api.GetBatchJobRequest,
+	stream api.BatchService_StreamBatchJobServer) error {
+	if resp, err := p.BatchClient.StreamBatchJob(stream.Context(), in); err != nil {
+		return err
+	} else {
+		for {
+			if item, err := resp.Recv(); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			} else {
+				if err := stream.Send(item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
 func (p *GrpcProxy) GetOverview(
 	ctx context.Context,
 	in *api.GetOverviewRequest) (*api.GetOverviewResponse, error) {
@@ -664,6 +719,18 @@ func (p *GrpcProxy) GetEnvironmentConfig(
 	return p.EnvironmentServiceClient.GetEnvironmentConfig(ctx, in)
 }
 
+func (p *GrpcProxy) GetLockHistory(
+	ctx context.Context,
+	in *api.GetLockHistoryRequest) (*api.GetLockHistoryResponse, error) {
+	return p.EnvironmentServiceClient.GetLockHistory(ctx, in)
+}
+
+func (p *GrpcProxy) ValidateEnvironmentConfigs(
+	ctx context.Context,
+	in *api.ValidateEnvironmentConfigsRequest) (*api.ValidateEnvironmentConfigsResponse, error) {
+	return p.EnvironmentServiceClient.ValidateEnvironmentConfigs(ctx, in)
+}
+
 func (p *GrpcProxy) StreamOverview(
 	in *api.GetOverviewRequest,
 	stream api.OverviewService_StreamOverviewServer) error {
@@ -716,3 +783,7 @@ func (p *GrpcProxy) GetReleaseTrainPrognosis(ctx context.Context, in *api.Releas
 	}
 	return p.ReleaseTrainPrognosisClient.GetReleaseTrainPrognosis(ctx, in)
 }
+
+func (p *GrpcProxy) GetDeploymentBlockers(ctx context.Context, in *api.GetDeploymentBlockersRequest) (*api.GetDeploymentBlockersResponse, error) {
+	return p.DeploymentBlockerClient.GetDeploymentBlockers(ctx, in)
+}
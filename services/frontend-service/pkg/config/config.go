@@ -54,6 +54,8 @@ type ServerConfig struct {
 	ApiEnableDespiteNoAuth             bool          `default:"false" split_words:"true"`
 	IapEnabled                         bool          `default:"false" split_words:"true"`
 	GrpcMaxRecvMsgSize                 int           `default:"4" split_words:"true"`
+	SecretPolicy                       string        `default:"off" split_words:"true"`
+	SecretPolicyAllowedKinds           string        `default:"" split_words:"true"`
 }
 
 type FrontendConfig struct {
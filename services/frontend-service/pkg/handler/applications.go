@@ -18,12 +18,20 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/logger"
 	xpath "github.com/freiheit-com/kuberpult/pkg/path"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func (s Server) handleApplications(w http.ResponseWriter, req *http.Request, environment, tail string) {
@@ -37,6 +45,8 @@ func (s Server) handleApplications(w http.ResponseWriter, req *http.Request, env
 	switch function {
 	case "locks":
 		s.handleApplicationLocks(w, req, environment, application, tail)
+	case "rollback":
+		s.handleApplicationRollback(w, req, environment, application, tail)
 	default:
 		http.Error(w, fmt.Sprintf("unknown function '%s'", function), http.StatusNotFound)
 	}
@@ -76,13 +86,20 @@ func (s Server) handlePutApplicationLock(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	_, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+	expiresAt, err := body.expiresAt(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
 		{Action: &api.BatchAction_CreateEnvironmentApplicationLock{
 			CreateEnvironmentApplicationLock: &api.CreateEnvironmentApplicationLockRequest{
 				Environment: environment,
 				Application: application,
 				LockId:      lockID,
 				Message:     body.Message,
+				ExpiresAt:   expiresAt,
 			},
 		}},
 	}})
@@ -113,6 +130,72 @@ func (s Server) handleDeleteApplicationLock(w http.ResponseWriter, req *http.Req
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleApplicationRollback deploys the version that was deployed before the current one.
+// The body is optional, if a content type is set it must be json. With Azure authentication, it must contain a signature.
+func (s Server) handleApplicationRollback(w http.ResponseWriter, req *http.Request, environment, application, tail string) {
+	if tail != "/" {
+		http.Error(w, fmt.Sprintf("rollback does not accept additional path arguments, got: %s", tail), http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("rollback only accepts method POST, got: '%s'", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body postRollbackRequest
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		if contentType != "application/json" {
+			http.Error(w, fmt.Sprintf("body must be application/json, got: '%s'", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	lockBehavior, err := body.lockBehavior()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.AzureAuth {
+		signature := body.Signature
+		if len(signature) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Missing signature in request body")) //nolint:errcheck
+			return
+		}
+
+		if _, err := openpgp.CheckArmoredDetachedSignature(s.KeyRing, strings.NewReader(environment+application), strings.NewReader(signature), nil); err != nil {
+			if err != pgperrors.ErrUnknownIssuer {
+				w.WriteHeader(500)
+				fmt.Fprintf(w, "Internal: Invalid Signature: %s", err)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "Invalid signature")
+			return
+		}
+	}
+
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_Rollback{
+			Rollback: &api.RollbackRequest{
+				Environment:  environment,
+				Application:  application,
+				LockBehavior: lockBehavior,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 type ApplicationID = string
 
 func (s Server) handleApiApplication(w http.ResponseWriter, req *http.Request, tail string) {
@@ -127,6 +210,14 @@ func (s Server) handleApiApplication(w http.ResponseWriter, req *http.Request, t
 	switch group {
 	case "release":
 		s.handleApplicationRelease(w, req, tail, applicationID)
+	case "releases":
+		s.handleApplicationReleases(w, req, applicationID)
+	case "retention":
+		s.handleApplicationRetention(w, req, applicationID)
+	case "manifest-diff":
+		s.handleApplicationManifestDiff(w, req, applicationID)
+	case "scheduled-deployments":
+		s.handleApplicationScheduledDeployments(w, req, tail, applicationID)
 	default:
 		http.Error(w, fmt.Sprintf("unknown endpoint 'api/application/%s/%s'", applicationID, group), http.StatusNotFound)
 	}
@@ -141,14 +232,67 @@ func (s Server) handleApplicationRelease(w http.ResponseWriter, req *http.Reques
 	}
 
 	group, _ := xpath.Shift(tail)
+	// other methods on the release itself keep ending up in the default case
+	if group == "" && req.Method == http.MethodDelete {
+		s.handleDeleteApplicationRelease(w, req, applicationID, releaseNum)
+		return
+	}
 	switch group {
 	case "manifests":
 		s.handleApplicationReleaseManifests(w, req, applicationID, releaseNum)
+	case "blockers":
+		s.handleApplicationReleaseBlockers(w, req, applicationID, releaseNum)
+	case "pin":
+		s.handleApplicationReleasePin(w, req, applicationID, releaseNum)
 	default:
 		http.Error(w, fmt.Sprintf("unknown endpoint 'api/application/%s/%s'", releaseNum, group), http.StatusNotFound)
 	}
 }
 
+// handleApplicationReleases returns the releases of the application.
+// Releases can be filtered by labels with query parameters like "?label=risk=low&label=ticket=SRE-123".
+func (s Server) handleApplicationReleases(w http.ResponseWriter, req *http.Request, applicationID ApplicationID) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("releases only accepts method GET, got: '%s'", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	labels := map[string]string{}
+	for _, label := range req.URL.Query()["label"] {
+		key, value, found := strings.Cut(label, "=")
+		if !found || key == "" {
+			http.Error(w, fmt.Sprintf("invalid label '%s', expected 'key=value'", label), http.StatusBadRequest)
+			return
+		}
+		labels[key] = value
+	}
+	resp, err := s.OverviewClient.GetOverview(req.Context(), &api.GetOverviewRequest{
+		GitRevision:   "",
+		ReleaseLabels: labels,
+	})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	app, ok := resp.Applications[string(applicationID)]
+	if !ok {
+		http.Error(w, fmt.Sprintf("application '%s' not found", applicationID), http.StatusNotFound)
+		return
+	}
+	encoded, err := json.Marshal(app.Releases)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetOverview: encoding releases")
+		http.Error(w, "GetOverview: encoding releases", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(encoded)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetOverview: writing response")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
 func (s Server) handleApplicationReleaseManifests(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, releaseNum string) {
 	resp, err := s.VersionClient.GetManifests(req.Context(), &api.GetManifestsRequest{
 		Application: string(applicationID),
@@ -172,3 +316,348 @@ func (s Server) handleApplicationReleaseManifests(w http.ResponseWriter, req *ht
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 }
+
+func (s Server) handleApplicationReleaseBlockers(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, releaseNum string) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("blockers only accepts method GET, got: '%s'", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	environment := req.URL.Query().Get("environment")
+	if environment == "" {
+		http.Error(w, "missing query parameter 'environment'", http.StatusBadRequest)
+		return
+	}
+	version, err := strconv.ParseUint(releaseNum, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid release number '%s'", releaseNum), http.StatusBadRequest)
+		return
+	}
+	resp, err := s.DeploymentBlockerClient.GetDeploymentBlockers(req.Context(), &api.GetDeploymentBlockersRequest{
+		Environment: environment,
+		Application: string(applicationID),
+		Version:     version,
+	})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetDeploymentBlockers: encoding response")
+		http.Error(w, "GetDeploymentBlockers: encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(encoded)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetDeploymentBlockers: writing response")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// handleApplicationReleasePin pins (PUT) or unpins (DELETE) a release, pinned releases are never cleaned up.
+func (s Server) handleApplicationReleasePin(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, releaseNum string) {
+	var pinned bool
+	switch req.Method {
+	case http.MethodPut:
+		pinned = true
+	case http.MethodDelete:
+		pinned = false
+	default:
+		http.Error(w, fmt.Sprintf("unsupported method '%s'", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	version, err := strconv.ParseUint(releaseNum, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid release number '%s'", releaseNum), http.StatusBadRequest)
+		return
+	}
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_PinRelease{
+			PinRelease: &api.PinReleaseRequest{
+				Application: string(applicationID),
+				Version:     version,
+				Pinned:      pinned,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleApplicationRetention returns (GET), sets (PUT) or removes (DELETE) the retention policy of the application.
+// GET also returns the releases that will be deleted by the next cleanup.
+func (s Server) handleApplicationRetention(w http.ResponseWriter, req *http.Request, applicationID ApplicationID) {
+	switch req.Method {
+	case http.MethodGet:
+		s.handleGetApplicationRetention(w, req, applicationID)
+	case http.MethodPut:
+		contentType := req.Header.Get("Content-Type")
+		if contentType != "application/json" {
+			http.Error(w, fmt.Sprintf("body must be application/json, got: '%s'", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		var body putRetentionPolicyRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.processRetentionPolicy(w, req, applicationID, &api.RetentionPolicy{
+			MaxCount:           body.MaxCount,
+			MaxAge:             body.MaxAge,
+			KeepPerEnvironment: body.KeepPerEnvironment,
+		})
+	case http.MethodDelete:
+		s.processRetentionPolicy(w, req, applicationID, nil)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported method '%s'", req.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s Server) handleGetApplicationRetention(w http.ResponseWriter, req *http.Request, applicationID ApplicationID) {
+	resp, err := s.VersionClient.GetRetentionPolicy(req.Context(), &api.GetRetentionPolicyRequest{
+		Application: string(applicationID),
+	})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetRetentionPolicy: encoding response")
+		http.Error(w, "GetRetentionPolicy: encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(encoded)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetRetentionPolicy: writing response")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (s Server) processRetentionPolicy(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, policy *api.RetentionPolicy) {
+	_, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_SetRetentionPolicy{
+			SetRetentionPolicy: &api.SetRetentionPolicyRequest{
+				Application: string(applicationID),
+				Policy:      policy,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleDeleteApplicationRelease deletes a release. Deployed or queued releases are only deleted with "?force=true".
+func (s Server) handleDeleteApplicationRelease(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, releaseNum string) {
+	version, err := strconv.ParseUint(releaseNum, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid release number '%s'", releaseNum), http.StatusBadRequest)
+		return
+	}
+	force := false
+	if forceParam := req.URL.Query().Get("force"); forceParam != "" {
+		force, err = strconv.ParseBool(forceParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid value for query parameter 'force': '%s'", forceParam), http.StatusBadRequest)
+			return
+		}
+	}
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_DeleteRelease{
+			DeleteRelease: &api.DeleteReleaseRequest{
+				Application: string(applicationID),
+				Version:     version,
+				Force:       force,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleApplicationManifestDiff returns the diff between the manifests of two releases with "?environment=<env>&from=<version>&to=<version>",
+// or between the manifests deployed on two environments with "?fromEnvironment=<env>&toEnvironment=<env>".
+func (s Server) handleApplicationManifestDiff(w http.ResponseWriter, req *http.Request, applicationID ApplicationID) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("manifest-diff only accepts method GET, got: '%s'", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	diffRequest := &api.GetManifestDiffRequest{
+		Application: string(applicationID),
+		Target:      nil,
+	}
+	if fromEnvironment, toEnvironment := query.Get("fromEnvironment"), query.Get("toEnvironment"); fromEnvironment != "" || toEnvironment != "" {
+		diffRequest.Target = &api.GetManifestDiffRequest_Environments{
+			Environments: &api.ManifestDiffEnvironments{
+				FromEnvironment: fromEnvironment,
+				ToEnvironment:   toEnvironment,
+			},
+		}
+	} else {
+		from, err := strconv.ParseUint(query.Get("from"), 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid release number in query parameter 'from': '%s'", query.Get("from")), http.StatusBadRequest)
+			return
+		}
+		to, err := strconv.ParseUint(query.Get("to"), 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid release number in query parameter 'to': '%s'", query.Get("to")), http.StatusBadRequest)
+			return
+		}
+		diffRequest.Target = &api.GetManifestDiffRequest_Releases{
+			Releases: &api.ManifestDiffReleases{
+				Environment: query.Get("environment"),
+				FromVersion: from,
+				ToVersion:   to,
+			},
+		}
+	}
+	resp, err := s.VersionClient.GetManifestDiff(req.Context(), diffRequest)
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetManifestDiff: encoding response")
+		http.Error(w, "GetManifestDiff: encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(encoded)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetManifestDiff: writing response")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// handleApplicationScheduledDeployments lists the scheduled deployments of the application with GET on "scheduled-deployments",
+// or only the ones to one environment with GET on "scheduled-deployments/<env>".
+// A deployment is scheduled with PUT and cancelled with DELETE on "scheduled-deployments/<env>/<id>".
+func (s Server) handleApplicationScheduledDeployments(w http.ResponseWriter, req *http.Request, tail string, applicationID ApplicationID) {
+	environment, tail := xpath.Shift(tail)
+	scheduleID, tail := xpath.Shift(tail)
+	if tail != "/" {
+		http.Error(w, fmt.Sprintf("scheduled-deployments does not accept additional path arguments after the schedule ID, got: %s", tail), http.StatusNotFound)
+		return
+	}
+	if scheduleID == "" {
+		if req.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("scheduled-deployments without schedule ID only accepts method GET, got: '%s'", req.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleGetApplicationScheduledDeployments(w, req, applicationID, environment)
+		return
+	}
+	switch req.Method {
+	case http.MethodPut:
+		s.handlePutApplicationScheduledDeployment(w, req, applicationID, environment, scheduleID)
+	case http.MethodDelete:
+		s.handleDeleteApplicationScheduledDeployment(w, req, applicationID, environment, scheduleID)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported method '%s'", req.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s Server) handleGetApplicationScheduledDeployments(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, environment string) {
+	var environmentFilter *string
+	if environment != "" {
+		environmentFilter = &environment
+	}
+	resp, err := s.VersionClient.GetScheduledDeployments(req.Context(), &api.GetScheduledDeploymentsRequest{
+		Application: string(applicationID),
+		Environment: environmentFilter,
+	})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetScheduledDeployments: encoding response")
+		http.Error(w, "GetScheduledDeployments: encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(encoded)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("GetScheduledDeployments: writing response")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (s Server) handlePutApplicationScheduledDeployment(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, environment, scheduleID string) {
+	contentType := req.Header.Get("Content-Type")
+	if contentType != "application/json" {
+		http.Error(w, fmt.Sprintf("body must be application/json, got: '%s'", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body putScheduledDeploymentRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.DeployAt == nil {
+		http.Error(w, "missing deployAt", http.StatusBadRequest)
+		return
+	}
+	lockBehavior, err := body.lockBehavior()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_CreateScheduledDeployment{
+			CreateScheduledDeployment: &api.CreateScheduledDeploymentRequest{
+				Environment:  environment,
+				Application:  string(applicationID),
+				ScheduleId:   scheduleID,
+				Version:      body.Version,
+				DeployAt:     timestamppb.New(*body.DeployAt),
+				LockBehavior: lockBehavior,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s Server) handleDeleteApplicationScheduledDeployment(w http.ResponseWriter, req *http.Request, applicationID ApplicationID, environment, scheduleID string) {
+	_, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_CancelScheduledDeployment{
+			CancelScheduledDeployment: &api.CancelScheduledDeploymentRequest{
+				Environment: environment,
+				Application: string(applicationID),
+				ScheduleId:  scheduleID,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
@@ -31,12 +33,22 @@ const (
 	MAXIMUM_MULTIPART_SIZE = 12 * 1024 * 1024 // = 12Mi
 )
 
+// handleCreateEnvironment creates an environment. With "?requireExistingUpstream=true", the upstream environment must already exist.
 func (s Server) handleCreateEnvironment(w http.ResponseWriter, req *http.Request, environment, tail string) {
 
 	if tail != "/" {
 		http.Error(w, fmt.Sprintf("Create Environment does not accept additional path arguments, got: '%s'", tail), http.StatusNotFound)
 		return
 	}
+	requireExistingUpstream := false
+	if requireParam := req.URL.Query().Get("requireExistingUpstream"); requireParam != "" {
+		var err error
+		requireExistingUpstream, err = strconv.ParseBool(requireParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid value for query parameter 'requireExistingUpstream': '%s'", requireParam), http.StatusBadRequest)
+			return
+		}
+	}
 	if err := req.ParseMultipartForm(MAXIMUM_MULTIPART_SIZE); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "Invalid body: %s", err)
@@ -81,8 +93,9 @@ func (s Server) handleCreateEnvironment(w http.ResponseWriter, req *http.Request
 		&api.BatchRequest{Actions: []*api.BatchAction{
 			{Action: &api.BatchAction_CreateEnvironment{
 				CreateEnvironment: &api.CreateEnvironmentRequest{
-					Environment: environment,
-					Config:      &envConfig,
+					Environment:             environment,
+					Config:                  &envConfig,
+					RequireExistingUpstream: requireExistingUpstream,
 				}}},
 		},
 		})
@@ -93,3 +106,60 @@ func (s Server) handleCreateEnvironment(w http.ResponseWriter, req *http.Request
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// handleDeleteEnvironment deletes an environment. With "?force=true", applications that are still deployed on it are undeployed.
+func (s Server) handleDeleteEnvironment(w http.ResponseWriter, req *http.Request, environment string) {
+	force := false
+	if forceParam := req.URL.Query().Get("force"); forceParam != "" {
+		var err error
+		force, err = strconv.ParseBool(forceParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid value for query parameter 'force': '%s'", forceParam), http.StatusBadRequest)
+			return
+		}
+	}
+	if s.AzureAuth {
+		if req.Body == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "missing request body")
+			return
+		}
+		signature, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Can't read request body %s", err)
+			return
+		}
+
+		if len(signature) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Missing signature in request body")) //nolint:errcheck
+			return
+		}
+
+		if _, err := openpgp.CheckArmoredDetachedSignature(s.KeyRing, bytes.NewReader([]byte(environment)), bytes.NewReader(signature), nil); err != nil {
+			if err != pgperrors.ErrUnknownIssuer {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "Internal: Invalid Signature: %s", err)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "Invalid signature")
+			return
+		}
+	}
+
+	_, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_DeleteEnvironment{
+			DeleteEnvironment: &api.DeleteEnvironmentRequest{
+				Environment: environment,
+				Force:       force,
+			},
+		}},
+	}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -27,6 +27,7 @@ import (
 	"strings"
 
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 	xpath "github.com/freiheit-com/kuberpult/pkg/path"
 	"github.com/freiheit-com/kuberpult/services/frontend-service/pkg/config"
 )
@@ -36,9 +37,12 @@ type Server struct {
 	RolloutClient               api.RolloutServiceClient
 	VersionClient               api.VersionServiceClient
 	ReleaseTrainPrognosisClient api.ReleaseTrainPrognosisServiceClient
+	DeploymentBlockerClient     api.DeploymentBlockerServiceClient
+	OverviewClient              api.OverviewServiceClient
 	Config                      config.ServerConfig
 	KeyRing                     openpgp.KeyRing
 	AzureAuth                   bool
+	SecretPolicy                manifestpolicy.SecretPolicy
 }
 
 func (s Server) Handle(w http.ResponseWriter, req *http.Request) {
@@ -35,6 +35,8 @@ func (s Server) HandleEnvironmentGroups(w http.ResponseWriter, req *http.Request
 	switch function {
 	case "locks":
 		s.handleEnvironmentGroupLocks(w, req, envGroup, tail)
+	case "selector-locks":
+		s.handleSelectorLocks(w, req, envGroup, true, tail)
 	case "rollout-status":
 		s.handleEnvironmentGroupRolloutStatus(w, req, envGroup)
 	default:
@@ -56,11 +58,15 @@ func (s Server) HandleEnvironments(w http.ResponseWriter, req *http.Request, tai
 		s.handleApplications(w, req, environment, tail)
 	case "locks":
 		s.handleEnvironmentLocks(w, req, environment, tail)
+	case "selector-locks":
+		s.handleSelectorLocks(w, req, environment, false, tail)
 	case "releasetrain":
 		s.handleReleaseTrain(w, req, environment, tail)
 	case "":
 		if tail == "/" && req.Method == http.MethodPost {
 			s.handleCreateEnvironment(w, req, environment, tail)
+		} else if tail == "/" && req.Method == http.MethodDelete {
+			s.handleDeleteEnvironment(w, req, environment)
 		} else {
 			http.Error(w, fmt.Sprintf("unknown function '%s'", function), http.StatusNotFound)
 		}
@@ -36,7 +36,9 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type mockReleaseTrainPrognosisServiceClient struct {
@@ -84,6 +86,15 @@ func TestServer_Handle(t *testing.T) {
 		t.Fatal(err)
 	}
 	exampleConfigSignature := signatureBuffer.String()
+	signatureBuffer = bytes.Buffer{}
+	err = openpgp.ArmoredDetachSign(&signatureBuffer, exampleKey, bytes.NewReader([]byte(exampleEnvironment+"service")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollbackRequestJSON, _ := json.Marshal(postRollbackRequest{
+		LockBehavior: "",
+		Signature:    signatureBuffer.String(),
+	})
 	lockRequestJSON, _ := json.Marshal(putLockRequest{
 		Message:   "test message",
 		Signature: exampleLockSignature,
@@ -354,6 +365,69 @@ func TestServer_Handle(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "create environment requiring an existing upstream",
+			req: &http.Request{
+				Method: http.MethodPost,
+				Header: http.Header{
+					"Content-Type": []string{"multipart/form-data"},
+				},
+				URL: &url.URL{
+					Path:     "/environments/stg/",
+					RawQuery: "requireExistingUpstream=true",
+				},
+				MultipartForm: &multipart.Form{
+					Value: map[string][]string{
+						"config": []string{exampleConfig},
+					},
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_CreateEnvironment{
+							CreateEnvironment: &api.CreateEnvironmentRequest{
+								Environment: "stg",
+								Config: &api.EnvironmentConfig{
+									Upstream: &api.EnvironmentConfig_Upstream{
+										Environment: &exampleEnvironment,
+									},
+									Argocd:           nil,
+									EnvironmentGroup: nil,
+								},
+								RequireExistingUpstream: true,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "create environment - invalid requireExistingUpstream",
+			req: &http.Request{
+				Method: http.MethodPost,
+				Header: http.Header{
+					"Content-Type": []string{"multipart/form-data"},
+				},
+				URL: &url.URL{
+					Path:     "/environments/stg/",
+					RawQuery: "requireExistingUpstream=maybe",
+				},
+				MultipartForm: &multipart.Form{
+					Value: map[string][]string{
+						"config": []string{exampleConfig},
+					},
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "invalid value for query parameter 'requireExistingUpstream': 'maybe'\n",
+		},
 		{
 			name: "create environment  - more data version",
 			req: &http.Request{
@@ -418,6 +492,62 @@ func TestServer_Handle(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "delete environment",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path:     "/environments/stg/",
+					RawQuery: "force=true",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_DeleteEnvironment{
+							DeleteEnvironment: &api.DeleteEnvironmentRequest{
+								Environment: "stg",
+								Force:       true,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "delete environment with invalid force parameter",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path:     "/environments/stg/",
+					RawQuery: "force=maybe",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "invalid value for query parameter 'force': 'maybe'\n",
+		},
+		{
+			name:             "delete environment - Azure enabled without signature",
+			AzureAuthEnabled: true,
+			KeyRing:          exampleKeyRing,
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environments/stg/",
+				},
+				Body: io.NopCloser(strings.NewReader("")),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "Missing signature in request body",
+		},
 		{
 			name: "create environment but wrong method",
 			req: &http.Request{
@@ -716,12 +846,16 @@ func TestServer_Handle(t *testing.T) {
 			expectedBody: "Please provide lock message in body\n",
 		},
 		{
-			name: "unlock env",
+			name: "lock env with expiry date",
 			req: &http.Request{
-				Method: http.MethodDelete,
+				Method: http.MethodPut,
 				URL: &url.URL{
 					Path: "/environments/development/locks/test",
 				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","expiresAt":"2099-01-02T03:04:05Z"}`)),
 			},
 			expectedResp: &http.Response{
 				StatusCode: http.StatusOK,
@@ -730,10 +864,12 @@ func TestServer_Handle(t *testing.T) {
 			expectedBatchRequest: &api.BatchRequest{
 				Actions: []*api.BatchAction{
 					{
-						Action: &api.BatchAction_DeleteEnvironmentLock{
-							DeleteEnvironmentLock: &api.DeleteEnvironmentLockRequest{
+						Action: &api.BatchAction_CreateEnvironmentLock{
+							CreateEnvironmentLock: &api.CreateEnvironmentLockRequest{
 								Environment: "development",
 								LockId:      "test",
+								Message:     "test message",
+								ExpiresAt:   timestamppb.New(time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)),
 							},
 						},
 					},
@@ -741,133 +877,96 @@ func TestServer_Handle(t *testing.T) {
 			},
 		},
 		{
-			name: "unlock env but missing lock ID",
+			name: "lock env with invalid ttl",
 			req: &http.Request{
-				Method: http.MethodDelete,
+				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/environments/development/locks",
+					Path: "/environments/development/locks/test",
 				},
-			},
-			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
-			},
-			expectedBody: "missing ID for env lock\n",
-		},
-		{
-			name: "unlock env but additional path params",
-			req: &http.Request{
-				Method: http.MethodDelete,
-				URL: &url.URL{
-					Path: "/environments/development/locks/test/junk",
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
 				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","ttl":"two hours"}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
+				StatusCode: http.StatusBadRequest,
 			},
-			expectedBody: "env locks does not accept additional path arguments after the lock ID, got: '/junk'\n",
+			expectedBody: "invalid ttl \"two hours\": time: invalid duration \"two hours\"\n",
 		},
 		{
-			name: "lock env but wrong method",
+			name: "lock env with negative ttl",
 			req: &http.Request{
-				Method: http.MethodGet,
+				Method: http.MethodPut,
 				URL: &url.URL{
 					Path: "/environments/development/locks/test",
 				},
-			},
-			expectedResp: &http.Response{
-				StatusCode: http.StatusMethodNotAllowed,
-			},
-			expectedBody: "unsupported method 'GET'\n",
-		},
-		{
-			name: "app but missing app",
-			req: &http.Request{
-				Method: http.MethodPut,
-				URL: &url.URL{
-					Path: "/environments/development/applications",
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
 				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","ttl":"-1h"}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
+				StatusCode: http.StatusBadRequest,
 			},
-			expectedBody: "missing application ID\n",
+			expectedBody: "invalid ttl \"-1h\": must be positive\n",
 		},
 		{
-			name: "lock app",
+			name: "lock env with expiry date in the past",
 			req: &http.Request{
 				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks/test",
+					Path: "/environments/development/locks/test",
 				},
 				Header: http.Header{
 					"Content-Type": []string{"application/json"},
 				},
-				Body: io.NopCloser(strings.NewReader(`{"message":"test message"}`)),
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","expiresAt":"2001-01-02T03:04:05Z"}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusOK,
-			},
-			expectedBody: "",
-			expectedBatchRequest: &api.BatchRequest{
-				Actions: []*api.BatchAction{
-					{
-						Action: &api.BatchAction_CreateEnvironmentApplicationLock{
-							CreateEnvironmentApplicationLock: &api.CreateEnvironmentApplicationLockRequest{
-								Environment: "development",
-								Application: "service",
-								LockId:      "test",
-								Message:     "test message",
-							},
-						},
-					},
-				},
+				StatusCode: http.StatusBadRequest,
 			},
+			expectedBody: "invalid expiresAt 2001-01-02T03:04:05Z: must be in the future\n",
 		},
 		{
-			name: "lock app but missing lock ID",
+			name: "lock env with expiry date and ttl",
 			req: &http.Request{
 				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks",
+					Path: "/environments/development/locks/test",
 				},
-			},
-			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
-			},
-			expectedBody: "missing lock ID\n",
-		},
-		{
-			name: "lock app but additional path params",
-			req: &http.Request{
-				Method: http.MethodPut,
-				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks/test/junk",
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
 				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","expiresAt":"2099-01-02T03:04:05Z","ttl":"1h"}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
+				StatusCode: http.StatusBadRequest,
 			},
-			expectedBody: "locks does not accept additional path arguments after the lock ID, got: /junk\n",
+			expectedBody: "only one of expiresAt and ttl can be provided\n",
 		},
 		{
-			name: "lock app but wrong content type",
+			name: "lock env with invalid expiry date",
 			req: &http.Request{
 				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks/test",
+					Path: "/environments/development/locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
 				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","expiresAt":"tomorrow"}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusUnsupportedMediaType,
+				StatusCode: http.StatusBadRequest,
 			},
-			expectedBody: "body must be application/json, got: ''\n",
+			expectedBody: `parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"` + "\n",
 		},
 		{
-			name: "unlock app",
+			name: "unlock env",
 			req: &http.Request{
 				Method: http.MethodDelete,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks/test",
+					Path: "/environments/development/locks/test",
 				},
 			},
 			expectedResp: &http.Response{
@@ -877,10 +976,9 @@ func TestServer_Handle(t *testing.T) {
 			expectedBatchRequest: &api.BatchRequest{
 				Actions: []*api.BatchAction{
 					{
-						Action: &api.BatchAction_DeleteEnvironmentApplicationLock{
-							DeleteEnvironmentApplicationLock: &api.DeleteEnvironmentApplicationLockRequest{
+						Action: &api.BatchAction_DeleteEnvironmentLock{
+							DeleteEnvironmentLock: &api.DeleteEnvironmentLockRequest{
 								Environment: "development",
-								Application: "service",
 								LockId:      "test",
 							},
 						},
@@ -889,37 +987,37 @@ func TestServer_Handle(t *testing.T) {
 			},
 		},
 		{
-			name: "unlock app but missing lock ID",
+			name: "unlock env but missing lock ID",
 			req: &http.Request{
 				Method: http.MethodDelete,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks",
+					Path: "/environments/development/locks",
 				},
 			},
 			expectedResp: &http.Response{
 				StatusCode: http.StatusNotFound,
 			},
-			expectedBody: "missing lock ID\n",
+			expectedBody: "missing ID for env lock\n",
 		},
 		{
-			name: "unlock app but additional path params",
+			name: "unlock env but additional path params",
 			req: &http.Request{
 				Method: http.MethodDelete,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks/test/junk",
+					Path: "/environments/development/locks/test/junk",
 				},
 			},
 			expectedResp: &http.Response{
 				StatusCode: http.StatusNotFound,
 			},
-			expectedBody: "locks does not accept additional path arguments after the lock ID, got: /junk\n",
+			expectedBody: "env locks does not accept additional path arguments after the lock ID, got: '/junk'\n",
 		},
 		{
-			name: "lock app but wrong method",
+			name: "lock env but wrong method",
 			req: &http.Request{
 				Method: http.MethodGet,
 				URL: &url.URL{
-					Path: "/environments/development/applications/service/locks/test",
+					Path: "/environments/development/locks/test",
 				},
 			},
 			expectedResp: &http.Response{
@@ -928,11 +1026,24 @@ func TestServer_Handle(t *testing.T) {
 			expectedBody: "unsupported method 'GET'\n",
 		},
 		{
-			name: "lock team",
+			name: "app but missing app",
 			req: &http.Request{
 				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/api/environments/development/lock/team/sre-team/test",
+					Path: "/environments/development/applications",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "missing application ID\n",
+		},
+		{
+			name: "lock app",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks/test",
 				},
 				Header: http.Header{
 					"Content-Type": []string{"application/json"},
@@ -946,10 +1057,10 @@ func TestServer_Handle(t *testing.T) {
 			expectedBatchRequest: &api.BatchRequest{
 				Actions: []*api.BatchAction{
 					{
-						Action: &api.BatchAction_CreateEnvironmentTeamLock{
-							CreateEnvironmentTeamLock: &api.CreateEnvironmentTeamLockRequest{
+						Action: &api.BatchAction_CreateEnvironmentApplicationLock{
+							CreateEnvironmentApplicationLock: &api.CreateEnvironmentApplicationLockRequest{
 								Environment: "development",
-								Team:        "sre-team",
+								Application: "service",
 								LockId:      "test",
 								Message:     "test message",
 							},
@@ -959,7 +1070,294 @@ func TestServer_Handle(t *testing.T) {
 			},
 		},
 		{
-			name: "lock team but missing lock ID",
+			name: "rollback app",
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/rollback",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_Rollback{
+							Rollback: &api.RollbackRequest{
+								Environment:  "development",
+								Application:  "service",
+								LockBehavior: api.LockBehavior_RECORD,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "rollback app with lock behavior",
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/rollback",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"lockBehavior":"ignore"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_Rollback{
+							Rollback: &api.RollbackRequest{
+								Environment:  "development",
+								Application:  "service",
+								LockBehavior: api.LockBehavior_IGNORE,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "rollback app with invalid lock behavior",
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/rollback",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"lockBehavior":"sometimes"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "invalid lockBehavior \"sometimes\", expected one of 'record', 'fail' and 'ignore'\n",
+		},
+		{
+			name:             "rollback app - Azure enabled",
+			AzureAuthEnabled: true,
+			KeyRing:          exampleKeyRing,
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/rollback",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(bytes.NewReader(rollbackRequestJSON)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_Rollback{
+							Rollback: &api.RollbackRequest{
+								Environment:  "development",
+								Application:  "service",
+								LockBehavior: api.LockBehavior_RECORD,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:             "rollback app - Azure enabled - missing signature",
+			AzureAuthEnabled: true,
+			KeyRing:          exampleKeyRing,
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/rollback",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "Missing signature in request body",
+		},
+		{
+			name:             "rollback app - Azure enabled - wrong signature",
+			AzureAuthEnabled: true,
+			KeyRing:          exampleKeyRing,
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/environments/development/applications/other-service/rollback",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(bytes.NewReader(rollbackRequestJSON)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusInternalServerError,
+			},
+			expectedBody: "Internal: Invalid Signature: openpgp: invalid signature: RSA verification failure",
+		},
+		{
+			name: "rollback app with wrong method",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/rollback",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusMethodNotAllowed,
+			},
+			expectedBody: "rollback only accepts method POST, got: 'PUT'\n",
+		},
+		{
+			name: "lock app but missing lock ID",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "missing lock ID\n",
+		},
+		{
+			name: "lock app but additional path params",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks/test/junk",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "locks does not accept additional path arguments after the lock ID, got: /junk\n",
+		},
+		{
+			name: "lock app but wrong content type",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks/test",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusUnsupportedMediaType,
+			},
+			expectedBody: "body must be application/json, got: ''\n",
+		},
+		{
+			name: "unlock app",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks/test",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_DeleteEnvironmentApplicationLock{
+							DeleteEnvironmentApplicationLock: &api.DeleteEnvironmentApplicationLockRequest{
+								Environment: "development",
+								Application: "service",
+								LockId:      "test",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unlock app but missing lock ID",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "missing lock ID\n",
+		},
+		{
+			name: "unlock app but additional path params",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks/test/junk",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "locks does not accept additional path arguments after the lock ID, got: /junk\n",
+		},
+		{
+			name: "lock app but wrong method",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/environments/development/applications/service/locks/test",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusMethodNotAllowed,
+			},
+			expectedBody: "unsupported method 'GET'\n",
+		},
+		{
+			name: "lock team",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/api/environments/development/lock/team/sre-team/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_CreateEnvironmentTeamLock{
+							CreateEnvironmentTeamLock: &api.CreateEnvironmentTeamLockRequest{
+								Environment: "development",
+								Team:        "sre-team",
+								LockId:      "test",
+								Message:     "test message",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "lock team but missing lock ID",
 			req: &http.Request{
 				Method: http.MethodPut,
 				URL: &url.URL{
@@ -1039,51 +1437,541 @@ func TestServer_Handle(t *testing.T) {
 		{
 			name: "unlock team but additional path params",
 			req: &http.Request{
-				Method: http.MethodDelete,
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/api/environments/development/lock/team/sre-team/test/junk",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "locks does not accept additional path arguments after the lock ID, got: /junk\n",
+		},
+		{
+			name: "lock team but wrong method",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/api/environments/development/lock/team/sre-team/test",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusMethodNotAllowed,
+			},
+			expectedBody: "unsupported method 'GET'\n",
+		},
+		{
+			name: "unlock env group",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environment-groups/development/locks/test",
+				},
+			},
+			batchResponse: &api.BatchResponse{Results: []*api.BatchResult{
+				{},
+			}},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "{\"Result\":null}",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_DeleteEnvironmentGroupLock{
+							DeleteEnvironmentGroupLock: &api.DeleteEnvironmentGroupLockRequest{
+								EnvironmentGroup: "development",
+								LockId:           "test",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unlock env group but missing lock ID",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environment-groups/development/locks",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "missing ID for env group lock\n",
+		},
+		{
+			name: "unlock env group but additional path params",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environment-groups/development/locks/test/garbage",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "group locks does not accept additional path arguments after the lock ID, got: '/garbage'\n",
+		},
+		{
+			name: "selector lock env",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","selector":"payment-*"}`)),
+			},
+			batchResponse: &api.BatchResponse{Results: []*api.BatchResult{
+				{},
+			}},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusCreated,
+			},
+			expectedBody: "{\"Result\":null}",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_CreateEnvironmentSelectorLock{
+							CreateEnvironmentSelectorLock: &api.CreateEnvironmentSelectorLockRequest{
+								Environment: "development",
+								Selector:    "payment-*",
+								LockId:      "test",
+								Message:     "test message",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "selector lock env group with expiry date",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environment-groups/development/selector-locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","selector":"team=payments","expiresAt":"2099-01-02T03:04:05Z"}`)),
+			},
+			batchResponse: &api.BatchResponse{Results: []*api.BatchResult{
+				{},
+			}},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusCreated,
+			},
+			expectedBody: "{\"Result\":null}",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_CreateEnvironmentGroupSelectorLock{
+							CreateEnvironmentGroupSelectorLock: &api.CreateEnvironmentGroupSelectorLockRequest{
+								EnvironmentGroup: "development",
+								Selector:         "team=payments",
+								LockId:           "test",
+								Message:          "test message",
+								ExpiresAt:        timestamppb.New(time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "selector lock env but missing selector",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "Please provide lock message and selector in body\n",
+		},
+		{
+			name: "selector lock env but missing message",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"selector":"payment-*"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "Please provide lock message and selector in body\n",
+		},
+		{
+			name: "selector lock env with expiry date in the past",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","selector":"payment-*","expiresAt":"2000-01-02T03:04:05Z"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody: "invalid expiresAt 2000-01-02T03:04:05Z: must be in the future\n",
+		},
+		{
+			name: "selector lock env but cd-service returns no result",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"message":"test message","selector":"payment-*"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusInternalServerError,
+			},
+			expectedBody: "cd-service did not return a result",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_CreateEnvironmentSelectorLock{
+							CreateEnvironmentSelectorLock: &api.CreateEnvironmentSelectorLockRequest{
+								Environment: "development",
+								Selector:    "payment-*",
+								LockId:      "test",
+								Message:     "test message",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "delete selector lock env",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+			},
+			batchResponse: &api.BatchResponse{Results: []*api.BatchResult{
+				{},
+			}},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "{\"Result\":null}",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_DeleteEnvironmentSelectorLock{
+							DeleteEnvironmentSelectorLock: &api.DeleteEnvironmentSelectorLockRequest{
+								Environment: "development",
+								LockId:      "test",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "delete selector lock env group",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environment-groups/development/selector-locks/test",
+				},
+			},
+			batchResponse: &api.BatchResponse{Results: []*api.BatchResult{
+				{},
+			}},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "{\"Result\":null}",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_DeleteEnvironmentGroupSelectorLock{
+							DeleteEnvironmentGroupSelectorLock: &api.DeleteEnvironmentGroupSelectorLockRequest{
+								EnvironmentGroup: "development",
+								LockId:           "test",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "selector lock env but missing lock ID",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "missing ID for selector lock\n",
+		},
+		{
+			name: "selector lock env group but additional path params",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/environment-groups/development/selector-locks/test/garbage",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "selector locks does not accept additional path arguments after the lock ID, got: '/garbage'\n",
+		},
+		{
+			name: "selector lock env with wrong method",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/environments/development/selector-locks/test",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusMethodNotAllowed,
+			},
+			expectedBody: "unsupported method 'GET'\n",
+		},
+		{
+			name: "pin release",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/api/application/app1/release/3/pin",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_PinRelease{
+							PinRelease: &api.PinReleaseRequest{
+								Application: "app1",
+								Version:     3,
+								Pinned:      true,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unpin release",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path: "/api/application/app1/release/3/pin",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_PinRelease{
+							PinRelease: &api.PinReleaseRequest{
+								Application: "app1",
+								Version:     3,
+								Pinned:      false,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "force delete release",
+			req: &http.Request{
+				Method: http.MethodDelete,
+				URL: &url.URL{
+					Path:     "/api/application/app1/release/3",
+					RawQuery: "force=true",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_DeleteRelease{
+							DeleteRelease: &api.DeleteReleaseRequest{
+								Application: "app1",
+								Version:     3,
+								Force:       true,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "get release is not an endpoint",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/api/application/app1/release/3",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "unknown endpoint 'api/application/3/'\n",
+		},
+		{
+			name: "set retention policy",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/api/application/app1/retention",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"maxCount":5,"maxAge":"720h","keepPerEnvironment":2}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_SetRetentionPolicy{
+							SetRetentionPolicy: &api.SetRetentionPolicyRequest{
+								Application: "app1",
+								Policy: &api.RetentionPolicy{
+									MaxCount:           proto.Uint64(5),
+									MaxAge:             "720h",
+									KeepPerEnvironment: 2,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "schedule deployment",
+			req: &http.Request{
+				Method: http.MethodPut,
+				URL: &url.URL{
+					Path: "/api/application/app1/scheduled-deployments/production/morning",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"version":42,"deployAt":"2024-07-02T06:00:00Z","lockBehavior":"fail"}`)),
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_CreateScheduledDeployment{
+							CreateScheduledDeployment: &api.CreateScheduledDeploymentRequest{
+								Environment:  "production",
+								Application:  "app1",
+								ScheduleId:   "morning",
+								Version:      42,
+								DeployAt:     timestamppb.New(time.Date(2024, 7, 2, 6, 0, 0, 0, time.UTC)),
+								LockBehavior: api.LockBehavior_FAIL,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "schedule deployment with invalid lock behavior",
+			req: &http.Request{
+				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/api/environments/development/lock/team/sre-team/test/junk",
+					Path: "/api/application/app1/scheduled-deployments/production/morning",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
 				},
+				Body: io.NopCloser(strings.NewReader(`{"version":42,"deployAt":"2024-07-02T06:00:00Z","lockBehavior":"wait"}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
+				StatusCode: http.StatusBadRequest,
 			},
-			expectedBody: "locks does not accept additional path arguments after the lock ID, got: /junk\n",
+			expectedBody: "invalid lockBehavior \"wait\", expected one of 'record', 'fail' and 'ignore'\n",
 		},
 		{
-			name: "lock team but wrong method",
+			name: "schedule deployment without deployAt",
 			req: &http.Request{
-				Method: http.MethodGet,
+				Method: http.MethodPut,
 				URL: &url.URL{
-					Path: "/api/environments/development/lock/team/sre-team/test",
+					Path: "/api/application/app1/scheduled-deployments/production/morning",
+				},
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
 				},
+				Body: io.NopCloser(strings.NewReader(`{"version":42}`)),
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusMethodNotAllowed,
+				StatusCode: http.StatusBadRequest,
 			},
-			expectedBody: "unsupported method 'GET'\n",
+			expectedBody: "missing deployAt\n",
 		},
 		{
-			name: "unlock env group",
+			name: "cancel scheduled deployment",
 			req: &http.Request{
 				Method: http.MethodDelete,
 				URL: &url.URL{
-					Path: "/environment-groups/development/locks/test",
+					Path: "/api/application/app1/scheduled-deployments/production/morning",
 				},
 			},
-			batchResponse: &api.BatchResponse{Results: []*api.BatchResult{
-				{},
-			}},
 			expectedResp: &http.Response{
 				StatusCode: http.StatusOK,
 			},
-			expectedBody: "{\"Result\":null}",
+			expectedBody: "",
 			expectedBatchRequest: &api.BatchRequest{
 				Actions: []*api.BatchAction{
 					{
-						Action: &api.BatchAction_DeleteEnvironmentGroupLock{
-							DeleteEnvironmentGroupLock: &api.DeleteEnvironmentGroupLockRequest{
-								EnvironmentGroup: "development",
-								LockId:           "test",
+						Action: &api.BatchAction_CancelScheduledDeployment{
+							CancelScheduledDeployment: &api.CancelScheduledDeploymentRequest{
+								Environment: "production",
+								Application: "app1",
+								ScheduleId:  "morning",
 							},
 						},
 					},
@@ -1091,30 +1979,29 @@ func TestServer_Handle(t *testing.T) {
 			},
 		},
 		{
-			name: "unlock env group but missing lock ID",
+			name: "remove retention policy",
 			req: &http.Request{
 				Method: http.MethodDelete,
 				URL: &url.URL{
-					Path: "/environment-groups/development/locks",
+					Path: "/api/application/app1/retention",
 				},
 			},
 			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
+				StatusCode: http.StatusOK,
 			},
-			expectedBody: "missing ID for env group lock\n",
-		},
-		{
-			name: "unlock env group but additional path params",
-			req: &http.Request{
-				Method: http.MethodDelete,
-				URL: &url.URL{
-					Path: "/environment-groups/development/locks/test/garbage",
+			expectedBody: "",
+			expectedBatchRequest: &api.BatchRequest{
+				Actions: []*api.BatchAction{
+					{
+						Action: &api.BatchAction_SetRetentionPolicy{
+							SetRetentionPolicy: &api.SetRetentionPolicyRequest{
+								Application: "app1",
+								Policy:      nil,
+							},
+						},
+					},
 				},
 			},
-			expectedResp: &http.Response{
-				StatusCode: http.StatusNotFound,
-			},
-			expectedBody: "group locks does not accept additional path arguments after the lock ID, got: '/garbage'\n",
 		},
 		{
 			name: "lock env group but wrong method",
@@ -1347,7 +2234,348 @@ func TestServer_Rollout(t *testing.T) {
 	}
 }
 
+type mockOverviewClient struct {
+	api.OverviewServiceClient
+	request  *api.GetOverviewRequest
+	response *api.GetOverviewResponse
+}
+
+func (m *mockOverviewClient) GetOverview(_ context.Context, in *api.GetOverviewRequest, _ ...grpc.CallOption) (*api.GetOverviewResponse, error) {
+	m.request = in
+	return m.response, nil
+}
+
+func TestServer_ApplicationReleases(t *testing.T) {
+	tests := []struct {
+		name                    string
+		req                     *http.Request
+		overviewResponse        *api.GetOverviewResponse
+		expectedResp            *http.Response
+		expectedBody            string
+		expectedOverviewRequest *api.GetOverviewRequest
+	}{
+		{
+			name: "filters by labels",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path:     "/api/application/app1/releases",
+					RawQuery: "label=risk=low&label=ticket=SRE-1",
+				},
+			},
+			overviewResponse: &api.GetOverviewResponse{
+				Applications: map[string]*api.Application{
+					"app1": {
+						Name: "app1",
+						Releases: []*api.Release{
+							{
+								Version: 2,
+								Labels:  map[string]string{"risk": "low", "ticket": "SRE-1"},
+							},
+						},
+					},
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: `[{"version":2,"labels":{"risk":"low","ticket":"SRE-1"}}]`,
+			expectedOverviewRequest: &api.GetOverviewRequest{
+				ReleaseLabels: map[string]string{"risk": "low", "ticket": "SRE-1"},
+			},
+		},
+		{
+			name: "unknown application",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/api/application/app2/releases",
+				},
+			},
+			overviewResponse: &api.GetOverviewResponse{},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusNotFound,
+			},
+			expectedBody: "application 'app2' not found\n",
+			expectedOverviewRequest: &api.GetOverviewRequest{
+				ReleaseLabels: map[string]string{},
+			},
+		},
+		{
+			name: "invalid label",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path:     "/api/application/app1/releases",
+					RawQuery: "label=risk",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody:            "invalid label 'risk', expected 'key=value'\n",
+			expectedOverviewRequest: nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			overviewClient := &mockOverviewClient{response: tt.overviewResponse}
+			s := Server{
+				OverviewClient: overviewClient,
+			}
+
+			w := httptest.NewRecorder()
+			s.HandleAPI(w, tt.req)
+			resp := w.Result()
+
+			if d := cmp.Diff(tt.expectedResp, resp, cmpopts.IgnoreFields(http.Response{}, "Status", "Proto", "ProtoMajor", "ProtoMinor", "Header", "Body", "ContentLength")); d != "" {
+				t.Errorf("response mismatch: %s", d)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("error reading response body: %s", err)
+			}
+			if d := cmp.Diff(tt.expectedBody, string(body)); d != "" {
+				t.Errorf("response body mismatch:\ngot:  %s\nwant: %s\ndiff: \n%s", string(body), tt.expectedBody, d)
+			}
+			if d := cmp.Diff(tt.expectedOverviewRequest, overviewClient.request, protocmp.Transform()); d != "" {
+				t.Errorf("get overview request mismatch: %s", d)
+			}
+		})
+	}
+}
+
+type mockVersionClient struct {
+	api.VersionServiceClient
+	diffRequest       *api.GetManifestDiffRequest
+	diffResponse      *api.GetManifestDiffResponse
+	scheduledRequest  *api.GetScheduledDeploymentsRequest
+	scheduledResponse *api.GetScheduledDeploymentsResponse
+}
+
+func (m *mockVersionClient) GetManifestDiff(_ context.Context, in *api.GetManifestDiffRequest, _ ...grpc.CallOption) (*api.GetManifestDiffResponse, error) {
+	m.diffRequest = in
+	return m.diffResponse, nil
+}
+
+func TestServer_ApplicationManifestDiff(t *testing.T) {
+	tests := []struct {
+		name                string
+		req                 *http.Request
+		diffResponse        *api.GetManifestDiffResponse
+		expectedResp        *http.Response
+		expectedBody        string
+		expectedDiffRequest *api.GetManifestDiffRequest
+	}{
+		{
+			name: "diff between releases",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path:     "/api/application/app1/manifest-diff",
+					RawQuery: "environment=production&from=1&to=2",
+				},
+			},
+			diffResponse: &api.GetManifestDiffResponse{
+				FromVersion: 1,
+				ToVersion:   2,
+				Diff:        "-a\n+b\n",
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: `{"from_version":1,"to_version":2,"diff":"-a\n+b\n"}`,
+			expectedDiffRequest: &api.GetManifestDiffRequest{
+				Application: "app1",
+				Target: &api.GetManifestDiffRequest_Releases{
+					Releases: &api.ManifestDiffReleases{
+						Environment: "production",
+						FromVersion: 1,
+						ToVersion:   2,
+					},
+				},
+			},
+		},
+		{
+			name: "diff between environments",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path:     "/api/application/app1/manifest-diff",
+					RawQuery: "fromEnvironment=staging&toEnvironment=production",
+				},
+			},
+			diffResponse: &api.GetManifestDiffResponse{
+				FromVersion: 2,
+				ToVersion:   2,
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: `{"from_version":2,"to_version":2}`,
+			expectedDiffRequest: &api.GetManifestDiffRequest{
+				Application: "app1",
+				Target: &api.GetManifestDiffRequest_Environments{
+					Environments: &api.ManifestDiffEnvironments{
+						FromEnvironment: "staging",
+						ToEnvironment:   "production",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid release number",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path:     "/api/application/app1/manifest-diff",
+					RawQuery: "environment=production&from=latest&to=2",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusBadRequest,
+			},
+			expectedBody:        "invalid release number in query parameter 'from': 'latest'\n",
+			expectedDiffRequest: nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			versionClient := &mockVersionClient{diffResponse: tt.diffResponse}
+			s := Server{
+				VersionClient: versionClient,
+			}
+
+			w := httptest.NewRecorder()
+			s.HandleAPI(w, tt.req)
+			resp := w.Result()
+
+			if d := cmp.Diff(tt.expectedResp, resp, cmpopts.IgnoreFields(http.Response{}, "Status", "Proto", "ProtoMajor", "ProtoMinor", "Header", "Body", "ContentLength")); d != "" {
+				t.Errorf("response mismatch: %s", d)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("error reading response body: %s", err)
+			}
+			if d := cmp.Diff(tt.expectedBody, string(body)); d != "" {
+				t.Errorf("response body mismatch:\ngot:  %s\nwant: %s\ndiff: \n%s", string(body), tt.expectedBody, d)
+			}
+			if d := cmp.Diff(tt.expectedDiffRequest, versionClient.diffRequest, protocmp.Transform()); d != "" {
+				t.Errorf("get manifest diff request mismatch: %s", d)
+			}
+		})
+	}
+}
+
+func (m *mockVersionClient) GetScheduledDeployments(_ context.Context, in *api.GetScheduledDeploymentsRequest, _ ...grpc.CallOption) (*api.GetScheduledDeploymentsResponse, error) {
+	m.scheduledRequest = in
+	return m.scheduledResponse, nil
+}
+
+func TestServer_ApplicationScheduledDeployments(t *testing.T) {
+	environment := "production"
+	tests := []struct {
+		name                     string
+		req                      *http.Request
+		scheduledResponse        *api.GetScheduledDeploymentsResponse
+		expectedResp             *http.Response
+		expectedBody             string
+		expectedScheduledRequest *api.GetScheduledDeploymentsRequest
+	}{
+		{
+			name: "list scheduled deployments of all environments",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/api/application/app1/scheduled-deployments",
+				},
+			},
+			scheduledResponse: &api.GetScheduledDeploymentsResponse{
+				ScheduledDeployments: []*api.ScheduledDeployment{
+					{
+						ScheduleId:  "morning",
+						Environment: "production",
+						Application: "app1",
+						Version:     42,
+					},
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: `{"scheduled_deployments":[{"schedule_id":"morning","environment":"production","application":"app1","version":42}]}`,
+			expectedScheduledRequest: &api.GetScheduledDeploymentsRequest{
+				Application: "app1",
+				Environment: nil,
+			},
+		},
+		{
+			name: "list scheduled deployments of one environment",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/api/application/app1/scheduled-deployments/production",
+				},
+			},
+			scheduledResponse: &api.GetScheduledDeploymentsResponse{},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusOK,
+			},
+			expectedBody: `{}`,
+			expectedScheduledRequest: &api.GetScheduledDeploymentsRequest{
+				Application: "app1",
+				Environment: &environment,
+			},
+		},
+		{
+			name: "list with wrong method",
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL: &url.URL{
+					Path: "/api/application/app1/scheduled-deployments",
+				},
+			},
+			expectedResp: &http.Response{
+				StatusCode: http.StatusMethodNotAllowed,
+			},
+			expectedBody: "scheduled-deployments without schedule ID only accepts method GET, got: 'POST'\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			versionClient := &mockVersionClient{
+				scheduledResponse: tt.scheduledResponse,
+			}
+			s := Server{
+				VersionClient: versionClient,
+			}
+
+			w := httptest.NewRecorder()
+			s.HandleAPI(w, tt.req)
+			resp := w.Result()
+
+			if d := cmp.Diff(tt.expectedResp, resp, cmpopts.IgnoreFields(http.Response{}, "Status", "Proto", "ProtoMajor", "ProtoMinor", "Header", "Body", "ContentLength")); d != "" {
+				t.Errorf("response mismatch: %s", d)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("error reading response body: %s", err)
+			}
+			if d := cmp.Diff(tt.expectedBody, string(body)); d != "" {
+				t.Errorf("response body mismatch:\ngot:  %s\nwant: %s\ndiff: \n%s", string(body), tt.expectedBody, d)
+			}
+			if d := cmp.Diff(tt.expectedScheduledRequest, versionClient.scheduledRequest, protocmp.Transform()); d != "" {
+				t.Errorf("get scheduled deployments request mismatch: %s", d)
+			}
+		})
+	}
+}
+
 type mockBatchClient struct {
+	api.BatchServiceClient
 	batchRequest  *api.BatchRequest
 	batchResponse *api.BatchResponse
 }
@@ -24,6 +24,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
@@ -132,6 +133,12 @@ func (s Server) handlePutEnvironmentLock(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	expiresAt, err := body.expiresAt(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if s.AzureAuth {
 		signature := body.Signature
 		if len(signature) == 0 {
@@ -152,12 +159,13 @@ func (s Server) handlePutEnvironmentLock(w http.ResponseWriter, req *http.Reques
 		}
 	}
 
-	_, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
 		{Action: &api.BatchAction_CreateEnvironmentLock{
 			CreateEnvironmentLock: &api.CreateEnvironmentLockRequest{
 				Environment: environment,
 				LockId:      lockID,
 				Message:     body.Message,
+				ExpiresAt:   expiresAt,
 			},
 		}},
 	}})
@@ -239,6 +247,12 @@ func (s Server) handlePutEnvironmentGroupLock(w http.ResponseWriter, req *http.R
 		return
 	}
 
+	expiresAt, err := body.expiresAt(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	signature := body.Signature
 	if len(signature) == 0 && s.AzureAuth {
 		w.WriteHeader(http.StatusBadRequest)
@@ -269,6 +283,7 @@ func (s Server) handlePutEnvironmentGroupLock(w http.ResponseWriter, req *http.R
 				EnvironmentGroup: environmentGroup,
 				LockId:           lockID,
 				Message:          body.Message,
+				ExpiresAt:        expiresAt,
 			},
 		}},
 	}})
@@ -389,13 +404,20 @@ func (s Server) handlePutTeamLock(w http.ResponseWriter, req *http.Request, envi
 		return
 	}
 
-	_, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
+	expiresAt, err := body.expiresAt(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{
 		{Action: &api.BatchAction_CreateEnvironmentTeamLock{
 			CreateEnvironmentTeamLock: &api.CreateEnvironmentTeamLockRequest{
 				Environment: environment,
 				Team:        team,
 				LockId:      lockID,
 				Message:     body.Message,
+				ExpiresAt:   expiresAt,
 			},
 		}},
 	}})
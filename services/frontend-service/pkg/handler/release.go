@@ -24,6 +24,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -31,16 +32,44 @@ import (
 	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
 	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
 )
 
 var (
-	manifestFieldRx = regexp.MustCompile(`\Amanifests\[([^]]+)\]\z`)
+	manifestFieldRx   = regexp.MustCompile(`\Amanifests\[([^]]+)\]\z`)
+	labelFieldRx      = regexp.MustCompile(`\Alabels\[([^]]+)\]\z`)
+	dependencyFieldRx = regexp.MustCompile(`\Adependencies\[([^]]+)\]\z`)
 	// matches hex strings with 7 - 40 chars
 	commitIdRx = regexp.MustCompile(`\A[0-9a-f]{7,40}\z`)
 	// parses anything that looks like "name <mail@host.com>"
 	authorRx = regexp.MustCompile(`\A[^<\n]+( <[^@\n]+@[^>\n]+>)?\z`)
 )
 
+// applySecretPolicy rejects or redacts plaintext secrets in the manifest.
+// This happens after the signature check, because the signature covers the original manifest.
+func applySecretPolicy(policy manifestpolicy.SecretPolicy, manifest string) (string, error) {
+	switch policy.Mode {
+	case manifestpolicy.ModeReject:
+		violations, err := policy.Check(manifest)
+		if err != nil {
+			return "", err
+		}
+		if len(violations) > 0 {
+			messages := make([]string, 0, len(violations))
+			for _, violation := range violations {
+				messages = append(messages, violation.String())
+			}
+			return "", fmt.Errorf("plaintext secrets are not allowed, use one of %s instead: %s", strings.Join(policy.AllowedKinds, ", "), strings.Join(messages, "; "))
+		}
+		return manifest, nil
+	case manifestpolicy.ModeRedact:
+		redacted, _, err := policy.Redact(manifest)
+		return redacted, err
+	default:
+		return manifest, nil
+	}
+}
+
 func readMultipartFile(hdr *multipart.FileHeader) ([]byte, error) {
 	if file, err := hdr.Open(); err != nil {
 		return nil, err
@@ -93,6 +122,8 @@ func (s Server) HandleRelease(w http.ResponseWriter, r *http.Request, tail strin
 		PreviousCommitId: "",
 		DisplayVersion:   "",
 		Manifests:        map[string]string{},
+		Labels:           map[string]string{},
+		Dependencies:     nil,
 	}
 	if err := r.ParseMultipartForm(MAXIMUM_MULTIPART_SIZE); err != nil {
 		w.WriteHeader(400)
@@ -170,7 +201,13 @@ func (s Server) HandleRelease(w http.ResponseWriter, r *http.Request, tail strin
 			}
 
 			// TODO(HVG): validate that the manifest is valid yaml
-			tf.Manifests[environmentName] = string(content)
+			manifest, err := applySecretPolicy(s.SecretPolicy, string(content))
+			if err != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "Invalid manifest for environment %s: %s", environmentName, err)
+				return
+			}
+			tf.Manifests[environmentName] = manifest
 		}
 
 	}
@@ -241,6 +278,44 @@ func (s Server) HandleRelease(w http.ResponseWriter, r *http.Request, tail strin
 
 	}
 
+	for k, v := range form.Value {
+		match := labelFieldRx.FindStringSubmatch(k)
+		if match == nil {
+			continue
+		}
+		if len(v) != 1 {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "multiple values submitted for label %q", match[1])
+			return
+		}
+		tf.Labels[match[1]] = v[0]
+	}
+
+	for k, v := range form.Value {
+		match := dependencyFieldRx.FindStringSubmatch(k)
+		if match == nil {
+			continue
+		}
+		if len(v) != 1 {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "multiple values submitted for dependency %q", match[1])
+			return
+		}
+		minVersion, err := strconv.ParseUint(v[0], 10, 64)
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "Invalid version for dependency %q: %s", match[1], err)
+			return
+		}
+		tf.Dependencies = append(tf.Dependencies, &api.ReleaseDependency{
+			Application: match[1],
+			MinVersion:  minVersion,
+		})
+	}
+	sort.Slice(tf.Dependencies, func(i, j int) bool {
+		return tf.Dependencies[i].Application < tf.Dependencies[j].Application
+	})
+
 	response, err := s.BatchClient.ProcessBatch(ctx, &api.BatchRequest{Actions: []*api.BatchAction{
 		{
 			Action: &api.BatchAction_CreateRelease{
@@ -297,6 +372,11 @@ func (s Server) HandleRelease(w http.ResponseWriter, r *http.Request, tail strin
 			jsonBlob, err := json.Marshal(firstResponse)
 			writeReleaseResponse(w, r, jsonBlob, err, http.StatusBadRequest)
 		}
+	case *api.CreateReleaseResponse_InvalidManifest:
+		{
+			jsonBlob, err := json.Marshal(firstResponse)
+			writeReleaseResponse(w, r, jsonBlob, err, http.StatusBadRequest)
+		}
 	default:
 		{
 			msg := "unknown response type in /release"
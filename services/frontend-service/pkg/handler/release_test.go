@@ -0,0 +1,83 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/freiheit-com/kuberpult/pkg/manifestpolicy"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_applySecretPolicy(t *testing.T) {
+	const secret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: token
+stringData:
+  token: hunter2
+`
+	tests := []struct {
+		name             string
+		mode             manifestpolicy.Mode
+		manifest         string
+		expectedManifest string
+		expectedError    string
+	}{
+		{
+			name:             "policy disabled",
+			mode:             manifestpolicy.ModeOff,
+			manifest:         secret,
+			expectedManifest: secret,
+		},
+		{
+			name:          "reject plaintext secret",
+			mode:          manifestpolicy.ModeReject,
+			manifest:      secret,
+			expectedError: `plaintext secrets are not allowed, use one of SealedSecret, ExternalSecret instead: document 0 (Secret "token") contains plaintext secret data in "stringData"`,
+		},
+		{
+			name:     "redact plaintext secret",
+			mode:     manifestpolicy.ModeRedact,
+			manifest: secret,
+			expectedManifest: `apiVersion: v1
+kind: Secret
+metadata:
+  name: token
+`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			policy := manifestpolicy.SecretPolicy{Mode: tt.mode, AllowedKinds: manifestpolicy.DefaultAllowedKinds}
+			manifest, err := applySecretPolicy(policy, tt.manifest)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if d := cmp.Diff(tt.expectedManifest, manifest); d != "" {
+				t.Errorf("manifest mismatch (-want, +got):\n%s", d)
+			}
+		})
+	}
+}
@@ -16,7 +16,90 @@ Copyright freiheit.com*/
 
 package handler
 
+import (
+	"fmt"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
 type putLockRequest struct {
 	Message   string `json:"message"`
 	Signature string `json:"signature,omitempty"`
+	// Optional. The lock is deleted automatically after this point in time (RFC3339).
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Optional. Alternative to ExpiresAt, a duration like "2h30m" relative to now.
+	Ttl string `json:"ttl,omitempty"`
+}
+
+type putSelectorLockRequest struct {
+	putLockRequest
+	// Application name pattern like "payment-*" or label like "team=payments".
+	Selector string `json:"selector"`
+}
+
+// expiresAt returns the expiry date of the lock, or nil if the lock does not expire.
+func (r putLockRequest) expiresAt(now time.Time) (*timestamppb.Timestamp, error) {
+	if r.ExpiresAt != nil && r.Ttl != "" {
+		return nil, fmt.Errorf("only one of expiresAt and ttl can be provided")
+	}
+	if r.ExpiresAt != nil {
+		if !r.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("invalid expiresAt %s: must be in the future", r.ExpiresAt.Format(time.RFC3339))
+		}
+		return timestamppb.New(*r.ExpiresAt), nil
+	}
+	if r.Ttl == "" {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(r.Ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ttl %q: %w", r.Ttl, err)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid ttl %q: must be positive", r.Ttl)
+	}
+	return timestamppb.New(now.Add(ttl)), nil
+}
+
+type putRetentionPolicyRequest struct {
+	MaxCount           *uint64 `json:"maxCount,omitempty"`
+	MaxAge             string  `json:"maxAge,omitempty"`
+	KeepPerEnvironment uint64  `json:"keepPerEnvironment,omitempty"`
+}
+
+type putScheduledDeploymentRequest struct {
+	Version uint64 `json:"version"`
+	// The point in time when the release is deployed (RFC3339).
+	DeployAt *time.Time `json:"deployAt"`
+	// Optional. One of "record" (default), "fail" and "ignore".
+	LockBehavior string `json:"lockBehavior,omitempty"`
+}
+
+func (r putScheduledDeploymentRequest) lockBehavior() (api.LockBehavior, error) {
+	return parseLockBehavior(r.LockBehavior)
+}
+
+type postRollbackRequest struct {
+	// Optional. One of "record" (default), "fail" and "ignore".
+	LockBehavior string `json:"lockBehavior,omitempty"`
+	// Required with Azure authentication: signature of the environment name followed by the application name.
+	Signature string `json:"signature,omitempty"`
+}
+
+func (r postRollbackRequest) lockBehavior() (api.LockBehavior, error) {
+	return parseLockBehavior(r.LockBehavior)
+}
+
+func parseLockBehavior(lockBehavior string) (api.LockBehavior, error) {
+	switch lockBehavior {
+	case "", "record":
+		return api.LockBehavior_RECORD, nil
+	case "fail":
+		return api.LockBehavior_FAIL, nil
+	case "ignore":
+		return api.LockBehavior_IGNORE, nil
+	}
+	return api.LockBehavior_RECORD, fmt.Errorf("invalid lockBehavior %q, expected one of 'record', 'fail' and 'ignore'", lockBehavior)
 }
@@ -0,0 +1,85 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPutLockRequestExpiresAt(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	future := now.Add(time.Hour)
+	tcs := []struct {
+		Name          string
+		Request       putLockRequest
+		ExpectedTime  *timestamppb.Timestamp
+		ExpectedError string
+	}{
+		{
+			Name:    "no expiry",
+			Request: putLockRequest{Message: "msg"},
+		},
+		{
+			Name:         "ttl is relative to now",
+			Request:      putLockRequest{Message: "msg", Ttl: "2h30m"},
+			ExpectedTime: timestamppb.New(now.Add(2*time.Hour + 30*time.Minute)),
+		},
+		{
+			Name:         "expiry date",
+			Request:      putLockRequest{Message: "msg", ExpiresAt: &future},
+			ExpectedTime: timestamppb.New(future),
+		},
+		{
+			Name:          "expiry date is now",
+			Request:       putLockRequest{Message: "msg", ExpiresAt: &now},
+			ExpectedError: "invalid expiresAt 2024-05-06T07:08:09Z: must be in the future",
+		},
+		{
+			Name:          "zero ttl",
+			Request:       putLockRequest{Message: "msg", Ttl: "0s"},
+			ExpectedError: `invalid ttl "0s": must be positive`,
+		},
+		{
+			Name:          "ttl without unit",
+			Request:       putLockRequest{Message: "msg", Ttl: "10"},
+			ExpectedError: `invalid ttl "10": time: missing unit in duration "10"`,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := tc.Request.expiresAt(now)
+			if tc.ExpectedError != "" {
+				if err == nil || err.Error() != tc.ExpectedError {
+					t.Fatalf("expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if diff := cmp.Diff(tc.ExpectedTime, actual, protocmp.Transform()); diff != "" {
+				t.Errorf("expiry mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+	xpath "github.com/freiheit-com/kuberpult/pkg/path"
+)
+
+// handleSelectorLocks handles selector locks on an environment (isGroup=false) or on an environment group (isGroup=true).
+func (s Server) handleSelectorLocks(w http.ResponseWriter, req *http.Request, target string, isGroup bool, tail string) {
+	lockID, tail := xpath.Shift(tail)
+	if lockID == "" {
+		http.Error(w, "missing ID for selector lock", http.StatusNotFound)
+		return
+	}
+	if tail != "/" {
+		http.Error(w, fmt.Sprintf("selector locks does not accept additional path arguments after the lock ID, got: '%s'", tail), http.StatusNotFound)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodPut:
+		s.handlePutSelectorLock(w, req, target, isGroup, lockID)
+	case http.MethodDelete:
+		s.handleDeleteSelectorLock(w, req, target, isGroup, lockID)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported method '%s'", req.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s Server) handlePutSelectorLock(w http.ResponseWriter, req *http.Request, target string, isGroup bool, lockID string) {
+	if s.checkContentType(w, req) {
+		return
+	}
+
+	var body putSelectorLockRequest
+	invalidMessage := "Please provide lock message and selector in body"
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		decodeError := err.Error()
+		if errors.Is(err, io.EOF) {
+			decodeError = invalidMessage
+		}
+		http.Error(w, decodeError, http.StatusBadRequest)
+		return
+	}
+
+	if len(body.Message) == 0 || len(body.Selector) == 0 {
+		http.Error(w, invalidMessage, http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := body.expiresAt(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkSelectorLockSignature(w, req, body.Signature, target+lockID) {
+		return
+	}
+
+	var action *api.BatchAction
+	if isGroup {
+		action = &api.BatchAction{Action: &api.BatchAction_CreateEnvironmentGroupSelectorLock{
+			CreateEnvironmentGroupSelectorLock: &api.CreateEnvironmentGroupSelectorLockRequest{
+				EnvironmentGroup: target,
+				Selector:         body.Selector,
+				LockId:           lockID,
+				Message:          body.Message,
+				ExpiresAt:        expiresAt,
+			},
+		}}
+	} else {
+		action = &api.BatchAction{Action: &api.BatchAction_CreateEnvironmentSelectorLock{
+			CreateEnvironmentSelectorLock: &api.CreateEnvironmentSelectorLockRequest{
+				Environment: target,
+				Selector:    body.Selector,
+				LockId:      lockID,
+				Message:     body.Message,
+				ExpiresAt:   expiresAt,
+			},
+		}}
+	}
+	s.processSelectorLockAction(w, req, action, http.StatusCreated)
+}
+
+func (s Server) handleDeleteSelectorLock(w http.ResponseWriter, req *http.Request, target string, isGroup bool, lockID string) {
+	signature := ""
+	if req.Body != nil {
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Can't read request body %s", err)
+			return
+		}
+		signature = string(content)
+	}
+	if !s.checkSelectorLockSignature(w, req, signature, target+lockID) {
+		return
+	}
+
+	var action *api.BatchAction
+	if isGroup {
+		action = &api.BatchAction{Action: &api.BatchAction_DeleteEnvironmentGroupSelectorLock{
+			DeleteEnvironmentGroupSelectorLock: &api.DeleteEnvironmentGroupSelectorLockRequest{
+				EnvironmentGroup: target,
+				LockId:           lockID,
+			},
+		}}
+	} else {
+		action = &api.BatchAction{Action: &api.BatchAction_DeleteEnvironmentSelectorLock{
+			DeleteEnvironmentSelectorLock: &api.DeleteEnvironmentSelectorLockRequest{
+				Environment: target,
+				LockId:      lockID,
+			},
+		}}
+	}
+	s.processSelectorLockAction(w, req, action, http.StatusOK)
+}
+
+// checkSelectorLockSignature writes the error response and returns false if the signature is missing or invalid.
+// Like for environment group locks, the signature is optional unless azure auth is enabled.
+func (s Server) checkSelectorLockSignature(w http.ResponseWriter, req *http.Request, signature, signedData string) bool {
+	if len(signature) == 0 {
+		if s.AzureAuth {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Missing signature in request body - this is required with AzureAuth enabled")) //nolint:errcheck
+			return false
+		}
+		return true
+	}
+	if s.KeyRing == nil {
+		http.Error(w, "key ring is not configured", http.StatusNotFound)
+		return false
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(s.KeyRing, strings.NewReader(signedData), strings.NewReader(signature), nil); err != nil {
+		if err != pgperrors.ErrUnknownIssuer {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Internal: Invalid Signature: %s", err)
+			return false
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, "Invalid signature")
+		return false
+	}
+	return true
+}
+
+func (s Server) processSelectorLockAction(w http.ResponseWriter, req *http.Request, action *api.BatchAction, successStatus int) {
+	response, err := s.BatchClient.ProcessBatch(req.Context(), &api.BatchRequest{Actions: []*api.BatchAction{action}})
+	if err != nil {
+		handleGRPCError(req.Context(), w, err)
+		return
+	}
+
+	if response == nil || len(response.Results) == 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("cd-service did not return a result")) //nolint:errcheck
+		return
+	}
+	jsonResponse, err := json.Marshal(response.Results[0])
+	if err != nil {
+		return
+	}
+	w.WriteHeader(successStatus)
+	_, err = w.Write(jsonResponse)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("Failed while sending the response: " + err.Error())
+	}
+}
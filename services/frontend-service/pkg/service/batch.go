@@ -38,3 +38,22 @@ func (b *BatchServiceWithDefaultTimeout) ProcessBatch(ctx context.Context, req *
 	}
 	return b.Inner.ProcessBatch(ctx, req, options...)
 }
+
+func (b *BatchServiceWithDefaultTimeout) ProcessBatchAsync(ctx context.Context, req *api.BatchRequest, options ...grpc.CallOption) (*api.BatchJob, error) {
+	var cancel context.CancelFunc
+	_, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		ctx, cancel = context.WithTimeout(ctx, b.DefaultTimeout)
+		defer cancel()
+	}
+	return b.Inner.ProcessBatchAsync(ctx, req, options...)
+}
+
+func (b *BatchServiceWithDefaultTimeout) GetBatchJob(ctx context.Context, req *api.GetBatchJobRequest, options ...grpc.CallOption) (*api.BatchJob, error) {
+	return b.Inner.GetBatchJob(ctx, req, options...)
+}
+
+// StreamBatchJob has no default timeout, because the stream is open until the job is finished
+func (b *BatchServiceWithDefaultTimeout) StreamBatchJob(ctx context.Context, req *api.GetBatchJobRequest, options ...grpc.CallOption) (api.BatchService_StreamBatchJobClient, error) {
+	return b.Inner.StreamBatchJob(ctx, req, options...)
+}
@@ -15,7 +15,12 @@ along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>
 Copyright freiheit.com*/
 
 import { TopAppBar } from '../TopAppBar/TopAppBar';
-import { GetCommitInfoResponse, Event, LockPreventedDeploymentEvent_LockType } from '../../../api/api';
+import {
+    GetCommitInfoResponse,
+    Event,
+    LockPreventedDeploymentEvent_LockType,
+    ScheduledDeploymentEvent_Outcome,
+} from '../../../api/api';
 
 type CommitInfoProps = {
     commitInfo: GetCommitInfoResponse | undefined;
@@ -148,7 +153,22 @@ const eventDescription = (event: Event): [JSX.Element, string] => {
         case 'deploymentEvent':
             const de = tp.deploymentEvent;
             let description: JSX.Element;
-            if (de.releaseTrainSource === undefined)
+            if (de.rolledBackVersion !== undefined)
+                description = (
+                    <span>
+                        Rollback of application <b>{de.application}</b> on environment <b>{de.targetEnvironment}</b>{' '}
+                        from version <b>{de.rolledBackVersion}</b>
+                    </span>
+                );
+            else if (de.reason !== undefined)
+                // automatic deployments, e.g. by a promotion policy, record why they happened
+                description = (
+                    <span>
+                        Deployment of application <b>{de.application}</b> to environment <b>{de.targetEnvironment}</b>:{' '}
+                        {de.reason}
+                    </span>
+                );
+            else if (de.releaseTrainSource === undefined)
                 // if the releaseTrainSource is undefined, it could be either a
                 // manual deployment by the user or
                 // an automatic deployment because of the "upstream.latest" configuration of this environment
@@ -198,6 +218,52 @@ const eventDescription = (event: Event): [JSX.Element, string] => {
                 </span>,
                 tp.replacedByEvent.environment,
             ];
+        case 'lockCreatedEvent':
+            return [
+                <span>
+                    Lock <b>{tp.lockCreatedEvent.lockId}</b> was created by {tp.lockCreatedEvent.createdBy?.name} with
+                    message "{tp.lockCreatedEvent.message}"
+                </span>,
+                tp.lockCreatedEvent.environment,
+            ];
+        case 'lockDeletedEvent':
+            return [
+                <span>
+                    Lock <b>{tp.lockDeletedEvent.lockId}</b> was deleted by {tp.lockDeletedEvent.deletedBy?.name}
+                </span>,
+                tp.lockDeletedEvent.environment,
+            ];
+        case 'scheduledDeploymentEvent':
+            const scheduled = tp.scheduledDeploymentEvent;
+            return [
+                <span>
+                    Scheduled deployment <b>{scheduled.scheduleId}</b> of application <b>{scheduled.application}</b>{' '}
+                    by {scheduled.scheduledBy?.name} {scheduledOutcomeName(scheduled.outcome)}
+                    {scheduled.message !== '' ? ': ' + scheduled.message : ''}
+                </span>,
+                scheduled.environment,
+            ];
+        case 'environmentConfigUpdatedEvent':
+            return [
+                <span>
+                    The config of environment <b>{tp.environmentConfigUpdatedEvent.environment}</b> was updated by{' '}
+                    {tp.environmentConfigUpdatedEvent.updatedBy?.name}
+                </span>,
+                tp.environmentConfigUpdatedEvent.environment,
+            ];
+    }
+};
+
+const scheduledOutcomeName = (outcome: ScheduledDeploymentEvent_Outcome): string => {
+    switch (outcome) {
+        case ScheduledDeploymentEvent_Outcome.DEPLOYED:
+            return 'was deployed';
+        case ScheduledDeploymentEvent_Outcome.QUEUED:
+            return 'was queued because of a lock';
+        case ScheduledDeploymentEvent_Outcome.FAILED:
+            return 'failed';
+        case ScheduledDeploymentEvent_Outcome.UNRECOGNIZED:
+            return 'has an unknown outcome';
     }
 };
 
@@ -193,11 +193,13 @@ export const EnvironmentListItem: React.FC<EnvironmentListItemProps> = ({
         }
         const deployedBy = application.deploymentMetaData?.deployAuthor ?? 'unknown';
         const deployedUNIX = application.deploymentMetaData?.deployTime ?? '';
+        const rolledBackVersion = application.deploymentMetaData?.rolledBackVersion ?? 0;
+        const rollback = rolledBackVersion !== 0 ? ' (rollback from version ' + rolledBackVersion + ')' : '';
         if (deployedUNIX === '') {
-            return ['Deployed by &nbsp;' + deployedBy, <></>];
+            return ['Deployed by &nbsp;' + deployedBy + rollback, <></>];
         }
         const deployedDate = new Date(+deployedUNIX * 1000);
-        const returnString = 'Deployed by ' + deployedBy + ' ';
+        const returnString = 'Deployed by ' + deployedBy + rollback + ' ';
         const time = (
             <FormattedDate createdAt={deployedDate} className={classNames('release-dialog-createdAt', className)} />
         );
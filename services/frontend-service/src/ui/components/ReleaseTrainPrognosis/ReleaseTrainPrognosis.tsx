@@ -192,6 +192,13 @@ const AppPrognosisOutcomeSkipCell: React.FC<{ skipCause: ReleaseTrainAppSkipCaus
             );
         case ReleaseTrainAppSkipCause.TEAM_IS_LOCKED:
             return <p>Application release is skipped due to a team lock</p>;
+        case ReleaseTrainAppSkipCause.APP_HAS_UNMET_DEPENDENCIES:
+            return (
+                <p>
+                    Application release is skipped because it requires other applications in a version that is not
+                    deployed in the environment.
+                </p>
+            );
         case ReleaseTrainAppSkipCause.UNRECOGNIZED:
         default:
             return <p>Application release it skipped due to an unrecognized reason</p>;
@@ -1154,13 +1154,6 @@ func (s *State) GetTeamName(application string) (string, error) {
 
 var InvalidJson = errors.New("JSON file is not valid")
 
-func envExists(envConfigs map[string]config.EnvironmentConfig, envNameToSearchFor string) bool {
-	if _, found := envConfigs[envNameToSearchFor]; found {
-		return true
-	}
-	return false
-}
-
 func (s *State) GetEnvironmentConfigsAndValidate(ctx context.Context) (map[string]config.EnvironmentConfig, error) {
 	logger := logger.FromContext(ctx)
 	envConfigs, err := s.GetEnvironmentConfigs()
@@ -1170,14 +1163,8 @@ func (s *State) GetEnvironmentConfigsAndValidate(ctx context.Context) (map[strin
 	if len(envConfigs) == 0 {
 		logger.Warn("No environment configurations found. Check git settings like the branch name. Kuberpult cannot operate without environments.")
 	}
-	for envName, env := range envConfigs {
-		if env.Upstream == nil || env.Upstream.Environment == "" {
-			continue
-		}
-		upstreamEnv := env.Upstream.Environment
-		if !envExists(envConfigs, upstreamEnv) {
-			logger.Warn(fmt.Sprintf("The environment '%s' has upstream '%s' configured, but the environment '%s' does not exist.", envName, upstreamEnv, upstreamEnv))
-		}
+	for _, problem := range mapper.ValidateEnvironmentConfigs(envConfigs) {
+		logger.Warn(fmt.Sprintf("Invalid environment configuration: %s", problem.Message))
 	}
 	envGroups := mapper.MapEnvironmentsToGroups(envConfigs)
 	for _, group := range envGroups {
@@ -1294,6 +1281,10 @@ type Release struct {
 	SourceMessage   string
 	CreatedAt       time.Time
 	DisplayVersion  string
+	// arbitrary metadata provided by the CI, e.g. the build url
+	Labels map[string]string
+	// pinned releases are never deleted by the cleanup of old releases
+	Pinned bool
 }
 
 func (rel *Release) ToProto() *api.Release {
@@ -1309,6 +1300,8 @@ func (rel *Release) ToProto() *api.Release {
 		UndeployVersion: rel.UndeployVersion,
 		CreatedAt:       timestamppb.New(rel.CreatedAt),
 		DisplayVersion:  rel.DisplayVersion,
+		Labels:          rel.Labels,
+		Pinned:          rel.Pinned,
 	}
 }
 
@@ -1338,6 +1331,17 @@ func (s *State) IsUndeployVersion(application string, version uint64) (bool, err
 	return true, nil
 }
 
+func (s *State) IsPinnedVersion(application string, version uint64) (bool, error) {
+	base := releasesDirectoryWithVersion(s.Filesystem, application, version)
+	if _, err := readFile(s.Filesystem, s.Filesystem.Join(base, "pinned")); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
 func (s *State) GetApplicationRelease(application string, version uint64) (*Release, error) {
 	base := releasesDirectoryWithVersion(s.Filesystem, application, version)
 	_, err := s.Filesystem.Stat(base)
@@ -1352,6 +1356,8 @@ func (s *State) GetApplicationRelease(application string, version uint64) (*Rele
 		SourceMessage:   "",
 		CreatedAt:       time.Time{},
 		DisplayVersion:  "",
+		Labels:          nil,
+		Pinned:          false,
 	}
 	if cnt, err := readFile(s.Filesystem, s.Filesystem.Join(base, "source_commit_id")); err != nil {
 		if !os.IsNotExist(err) {
@@ -1387,6 +1393,11 @@ func (s *State) GetApplicationRelease(application string, version uint64) (*Rele
 		return nil, err
 	}
 	release.UndeployVersion = isUndeploy
+	isPinned, err := s.IsPinnedVersion(application, version)
+	if err != nil {
+		return nil, err
+	}
+	release.Pinned = isPinned
 	if cnt, err := readFile(s.Filesystem, s.Filesystem.Join(base, "created_at")); err != nil {
 		if !os.IsNotExist(err) {
 			return nil, err
@@ -1398,6 +1409,15 @@ func (s *State) GetApplicationRelease(application string, version uint64) (*Rele
 			release.CreatedAt = releaseTime
 		}
 	}
+	if cnt, err := readFile(s.Filesystem, s.Filesystem.Join(base, "labels")); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		if err := json.Unmarshal(cnt, &release.Labels); err != nil {
+			return nil, fmt.Errorf("could not parse labels of release %d of application %q: %w", version, application, err)
+		}
+	}
 	return &release, nil
 }
 
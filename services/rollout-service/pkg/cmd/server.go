@@ -33,7 +33,9 @@ import (
 	"github.com/freiheit-com/kuberpult/pkg/tracing"
 	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/metrics"
 	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/notifier"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/promotion"
 	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/revolution"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/rollback"
 	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/service"
 	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/versions"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
@@ -73,6 +75,15 @@ type Config struct {
 
 	ManifestRepoUrl string `default:"" split_words:"true"`
 	Branch          string `default:"" split_words:"true"`
+
+	AutoRollbackMaxAge        time.Duration `default:"1h" split_words:"true"`
+	AutoRollbackCheckInterval time.Duration `default:"30s" split_words:"true"`
+	AutoRollbackStateFile     string        `default:"" split_words:"true"`
+
+	PromotionCheckInterval time.Duration `default:"1m" split_words:"true"`
+
+	// The RBAC role of the rollout service for automatic rollbacks and promotions. Only needed if Dex is enabled in the cd-service.
+	RbacRole string `default:"" split_words:"true"`
 }
 
 func (config *Config) ClientConfig() (apiclient.ClientOptions, error) {
@@ -119,14 +130,14 @@ func RunServer() {
 	}
 }
 
-func getGrpcClients(ctx context.Context, config Config) (api.OverviewServiceClient, api.VersionServiceClient, error) {
+func getGrpcClients(ctx context.Context, config Config) (api.OverviewServiceClient, api.VersionServiceClient, api.BatchServiceClient, error) {
 	const megaBytes int = 1024 * 1024
 	var cred credentials.TransportCredentials = insecure.NewCredentials()
 	if config.CdServerSecure {
 		systemRoots, err := x509.SystemCertPool()
 		if err != nil {
 			msg := "failed to read CA certificates"
-			return nil, nil, fmt.Errorf(msg)
+			return nil, nil, nil, fmt.Errorf(msg)
 		}
 		//exhaustruct:ignore
 		cred = credentials.NewTLS(&tls.Config{
@@ -151,10 +162,10 @@ func getGrpcClients(ctx context.Context, config Config) (api.OverviewServiceClie
 
 	con, err := grpc.Dial(config.CdServer, grpcClientOpts...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error dialing %s: %w", config.CdServer, err)
+		return nil, nil, nil, fmt.Errorf("error dialing %s: %w", config.CdServer, err)
 	}
 
-	return api.NewOverviewServiceClient(con), api.NewVersionServiceClient(con), nil
+	return api.NewOverviewServiceClient(con), api.NewVersionServiceClient(con), api.NewBatchServiceClient(con), nil
 }
 
 func runServer(ctx context.Context, config Config) error {
@@ -203,7 +214,7 @@ func runServer(ctx context.Context, config Config) error {
 	}
 	defer argoio.Close(closer)
 
-	overviewGrpc, versionGrpc, err := getGrpcClients(ctx, config)
+	overviewGrpc, versionGrpc, batchGrpc, err := getGrpcClients(ctx, config)
 	if err != nil {
 		return fmt.Errorf("connecting to cd service %q: %w", config.CdServer, err)
 	}
@@ -275,6 +286,41 @@ func runServer(ctx context.Context, config Config) error {
 		})
 	}
 
+	if config.AutoRollbackCheckInterval <= 0 {
+		return fmt.Errorf("KUBERPULT_AUTO_ROLLBACK_CHECK_INTERVAL must be positive")
+	}
+	autoRollback, err := rollback.New(batchGrpc, rollback.Config{
+		MaxAge:        config.AutoRollbackMaxAge,
+		CheckInterval: config.AutoRollbackCheckInterval,
+		StateFile:     config.AutoRollbackStateFile,
+		Role:          config.RbacRole,
+	})
+	if err != nil {
+		return err
+	}
+	backgroundTasks = append(backgroundTasks, setup.BackgroundTaskConfig{
+		Shutdown: nil,
+		Name:     "auto rollback",
+		Run: func(ctx context.Context, health *setup.HealthReporter) error {
+			return autoRollback.Subscribe(ctx, broadcast, health)
+		},
+	})
+
+	if config.PromotionCheckInterval <= 0 {
+		return fmt.Errorf("KUBERPULT_PROMOTION_CHECK_INTERVAL must be positive")
+	}
+	promoter := promotion.New(versionC, batchGrpc, promotion.Config{
+		CheckInterval: config.PromotionCheckInterval,
+		Role:          config.RbacRole,
+	})
+	backgroundTasks = append(backgroundTasks, setup.BackgroundTaskConfig{
+		Shutdown: nil,
+		Name:     "promotion",
+		Run: func(ctx context.Context, health *setup.HealthReporter) error {
+			return promoter.Subscribe(ctx, broadcast, health)
+		},
+	})
+
 	backgroundTasks = append(backgroundTasks, setup.BackgroundTaskConfig{
 		Shutdown: nil,
 		Name:     "create metrics",
@@ -0,0 +1,214 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/freeze"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/pkg/setup"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/service"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/versions"
+	"go.uber.org/zap"
+)
+
+var errChannelClosed error = fmt.Errorf("promotion: channel closed")
+
+type Config struct {
+	// How often the promotion policies are evaluated.
+	CheckInterval time.Duration
+	// The RBAC role that is sent to the cd-service with the deployments.
+	Role string
+}
+
+// OverviewSource returns the latest overview that was streamed from the cd-service.
+type OverviewSource interface {
+	GetLatestOverview() *api.GetOverviewResponse
+}
+
+// Promoter deploys versions to environments with a promotion policy,
+// once they are healthy in the upstream environment and were deployed there at least the soak time of the policy ago.
+type Promoter struct {
+	overviews     OverviewSource
+	batchClient   api.BatchServiceClient
+	checkInterval time.Duration
+	role          string
+	healthy       map[service.Key]*healthState
+	// the last version that was promoted per application and downstream environment
+	promoted map[service.Key]uint64
+	// Used to simulate the current time in tests
+	now func() time.Time
+}
+
+type healthState struct {
+	version    uint64
+	deployedAt time.Time
+}
+
+func New(overviews OverviewSource, batchClient api.BatchServiceClient, config Config) *Promoter {
+	return &Promoter{
+		overviews:     overviews,
+		batchClient:   batchClient,
+		checkInterval: config.CheckInterval,
+		role:          config.Role,
+		healthy:       map[service.Key]*healthState{},
+		promoted:      map[service.Key]uint64{},
+		now:           time.Now,
+	}
+}
+
+func (p *Promoter) Subscribe(ctx context.Context, broadcast *service.Broadcast, health *setup.HealthReporter) error {
+	ticker := time.NewTicker(p.checkInterval)
+	defer ticker.Stop()
+	return health.Retry(ctx, func() error {
+		initial, ch, unsubscribe := broadcast.Start()
+		health.ReportReady("promoting")
+		defer unsubscribe()
+		for _, ev := range initial {
+			p.process(ev)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if err := p.promote(ctx); err != nil {
+					logger.FromContext(ctx).Warn("promotion.failed", zap.Error(err))
+				}
+			case ev, ok := <-ch:
+				if !ok {
+					select {
+					case <-ctx.Done():
+						return nil
+					default:
+						return errChannelClosed
+					}
+				}
+				p.process(ev)
+			}
+		}
+	})
+}
+
+// process records which version of an application is healthy and when it was deployed.
+// The deployment time comes from the cd-service, so that the soak time does not start again when the rollout-service restarts.
+func (p *Promoter) process(ev *service.BroadcastEvent) {
+	if ev.RolloutStatus != api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL || ev.KuberpultVersion == nil {
+		delete(p.healthy, ev.Key)
+		return
+	}
+	p.healthy[ev.Key] = &healthState{
+		version:    ev.KuberpultVersion.Version,
+		deployedAt: ev.KuberpultVersion.DeployedAt,
+	}
+}
+
+func (p *Promoter) promote(ctx context.Context) error {
+	ctx = versions.WriteRolloutServiceUserToGrpcContext(ctx, p.role)
+	overview := p.overviews.GetLatestOverview()
+	if overview == nil {
+		// no overview was received from the cd-service yet
+		return nil
+	}
+	environments := map[string]*api.Environment{}
+	promoting := []*api.Environment{}
+	for _, group := range overview.EnvironmentGroups {
+		for _, env := range group.Environments {
+			environments[env.Name] = env
+			if env.Config.GetPromotion() != nil {
+				promoting = append(promoting, env)
+			}
+		}
+	}
+	now := p.now()
+	for _, env := range promoting {
+		soakTime, err := time.ParseDuration(env.Config.Promotion.SoakTime)
+		if err != nil {
+			logger.FromContext(ctx).Warn("promotion.invalid", zap.String("environment", env.Name), zap.Error(err))
+			continue
+		}
+		upstream := environments[env.Config.GetUpstream().GetEnvironment()]
+		if upstream == nil {
+			continue
+		}
+		for appName, upstreamApp := range upstream.Applications {
+			app := env.Applications[appName]
+			if app == nil || upstreamApp.UndeployVersion || upstreamApp.Version <= app.Version {
+				// the application has no manifest for this environment, or nothing new to promote
+				continue
+			}
+			h := p.healthy[service.Key{Application: appName, Environment: upstream.Name}]
+			if h == nil || h.version != upstreamApp.Version || h.deployedAt.IsZero() || now.Sub(h.deployedAt) < soakTime {
+				continue
+			}
+			key := service.Key{Application: appName, Environment: env.Name}
+			if p.promoted[key] == upstreamApp.Version {
+				continue
+			}
+			if isLocked(env, app, now) {
+				// once the lock is removed, the version is promoted
+				continue
+			}
+			// a failed promotion is not retried, so that it doesn't fail over and over again
+			p.promoted[key] = upstreamApp.Version
+			reason := fmt.Sprintf("Promoted from %s, where version %d is healthy and was deployed more than %s ago.", upstream.Name, upstreamApp.Version, soakTime)
+			_, err := p.batchClient.ProcessBatch(ctx, &api.BatchRequest{Actions: []*api.BatchAction{
+				{Action: &api.BatchAction_Deploy{
+					Deploy: &api.DeployRequest{
+						Environment:    env.Name,
+						Application:    appName,
+						Version:        upstreamApp.Version,
+						IgnoreAllLocks: false,
+						LockBehavior:   api.LockBehavior_FAIL,
+						Reason:         reason,
+					},
+				}},
+			}})
+			l := logger.FromContext(ctx).With(
+				zap.String("environment", env.Name),
+				zap.String("application", appName),
+				zap.Uint64("version", upstreamApp.Version))
+			if err != nil {
+				l.Warn("promotion.deploy.failed", zap.Error(err))
+			} else {
+				l.Info("promotion.deploy", zap.String("reason", reason))
+			}
+		}
+	}
+	return nil
+}
+
+func isLocked(env *api.Environment, app *api.Environment_Application, now time.Time) bool {
+	if len(env.Locks) > 0 || len(app.Locks) > 0 || len(app.TeamLocks) > 0 || len(app.SelectorLocks) > 0 {
+		return true
+	}
+	freezes, err := freeze.GetFreezes(freeze.WindowsFromApi(env.Config.GetFreezeWindows()), now)
+	if err != nil {
+		// the cd-service rejects invalid freeze windows, so this is unexpected: better not promote
+		return true
+	}
+	for i := range freezes {
+		if freezes[i].IsActive(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,333 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/service"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/versions"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+type mockOverviewSource struct {
+	overview *api.GetOverviewResponse
+}
+
+func (m *mockOverviewSource) GetLatestOverview() *api.GetOverviewResponse {
+	return m.overview
+}
+
+type mockBatchClient struct {
+	api.BatchServiceClient
+	requests []*api.BatchRequest
+	// the roles that were sent with the requests
+	roles [][]string
+	err   error
+}
+
+func (m *mockBatchClient) ProcessBatch(ctx context.Context, in *api.BatchRequest, opts ...grpc.CallOption) (*api.BatchResponse, error) {
+	m.requests = append(m.requests, in)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	m.roles = append(m.roles, md.Get(auth.HeaderUserRole))
+	return &api.BatchResponse{}, m.err
+}
+
+func TestPromote(t *testing.T) {
+	deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	type step struct {
+		// time since the version was deployed to staging
+		At      time.Duration
+		Version uint64
+		Status  api.RolloutStatus
+	}
+	//exhaustruct:ignore
+	app := func(version uint64) *api.Environment_Application {
+		return &api.Environment_Application{Name: "app", Version: version}
+	}
+	//exhaustruct:ignore
+	environment := func(name string, config *api.EnvironmentConfig, application *api.Environment_Application) *api.Environment {
+		return &api.Environment{
+			Name:         name,
+			Config:       config,
+			Applications: map[string]*api.Environment_Application{"app": application},
+		}
+	}
+	//exhaustruct:ignore
+	productionConfig := &api.EnvironmentConfig{
+		Upstream: &api.EnvironmentConfig_Upstream{
+			Environment: ptr.FromString("staging"),
+		},
+		Promotion: &api.EnvironmentConfig_Promotion{
+			SoakTime: "2h",
+		},
+	}
+	//exhaustruct:ignore
+	overview := func(production *api.Environment) *api.GetOverviewResponse {
+		return &api.GetOverviewResponse{
+			EnvironmentGroups: []*api.EnvironmentGroup{
+				{Environments: []*api.Environment{
+					environment("staging", nil, app(3)),
+					production,
+				}},
+			},
+		}
+	}
+	deployRequest := func(version uint64) *api.BatchRequest {
+		return &api.BatchRequest{Actions: []*api.BatchAction{
+			{Action: &api.BatchAction_Deploy{
+				Deploy: &api.DeployRequest{
+					Environment:    "production",
+					Application:    "app",
+					Version:        version,
+					IgnoreAllLocks: false,
+					LockBehavior:   api.LockBehavior_FAIL,
+					Reason:         fmt.Sprintf("Promoted from staging, where version %d is healthy and was deployed more than 2h0m0s ago.", version),
+				},
+			}},
+		}}
+	}
+	//exhaustruct:ignore
+	lockedApp := &api.Environment_Application{
+		Name:    "app",
+		Version: 2,
+		Locks:   map[string]*api.Lock{"l1": {Message: "locked"}},
+	}
+	//exhaustruct:ignore
+	frozenConfig := &api.EnvironmentConfig{
+		Upstream:  productionConfig.Upstream,
+		Promotion: productionConfig.Promotion,
+		FreezeWindows: []*api.EnvironmentConfig_FreezeWindow{
+			{Schedule: "0 0 * * *", Duration: "24h", Message: "always frozen"},
+		},
+	}
+	frozen := environment("production", frozenConfig, app(2))
+	tcs := []struct {
+		Name             string
+		Steps            []step
+		Overview         *api.GetOverviewResponse
+		CheckAt          time.Duration
+		ExpectedRequests []*api.BatchRequest
+	}{
+		{
+			Name: "healthy version that was deployed the soak time ago is promoted",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview:         overview(environment("production", productionConfig, app(2))),
+			CheckAt:          2 * time.Hour,
+			ExpectedRequests: []*api.BatchRequest{deployRequest(3)},
+		},
+		{
+			Name: "version that was not deployed long enough ago is not promoted",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: overview(environment("production", productionConfig, app(2))),
+			CheckAt:  time.Hour,
+		},
+		{
+			Name: "unhealthy version is not promoted",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+				{At: time.Hour, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			Overview: overview(environment("production", productionConfig, app(2))),
+			CheckAt:  3 * time.Hour,
+		},
+		{
+			Name: "soak time is counted from the deployment, not from the first healthy event",
+			Steps: []step{
+				// e.g. the first event after a restart of the rollout-service
+				{At: 150 * time.Minute, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview:         overview(environment("production", productionConfig, app(2))),
+			CheckAt:          150 * time.Minute,
+			ExpectedRequests: []*api.BatchRequest{deployRequest(3)},
+		},
+		{
+			Name: "no overview received yet",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: nil,
+			CheckAt:  3 * time.Hour,
+		},
+		{
+			Name: "healthy state of an older version is not used",
+			Steps: []step{
+				{At: 0, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: overview(environment("production", productionConfig, app(2))),
+			CheckAt:  3 * time.Hour,
+		},
+		{
+			Name: "environment without policy",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: overview(environment("production", nil, app(2))),
+			CheckAt:  3 * time.Hour,
+		},
+		{
+			Name: "same version is not promoted again",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: overview(environment("production", productionConfig, app(3))),
+			CheckAt:  3 * time.Hour,
+		},
+		{
+			Name: "locked application is not promoted",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: overview(environment("production", productionConfig, lockedApp)),
+			CheckAt:  3 * time.Hour,
+		},
+		{
+			Name: "frozen environment is not promoted",
+			Steps: []step{
+				{At: 0, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+			},
+			Overview: overview(frozen),
+			CheckAt:  3 * time.Hour,
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			batchClient := &mockBatchClient{}
+			p := New(&mockOverviewSource{overview: tc.Overview}, batchClient, Config{
+				CheckInterval: time.Minute,
+			})
+			for _, st := range tc.Steps {
+				p.now = func() time.Time { return deployedAt.Add(st.At) }
+				version := &versions.VersionInfo{
+					Version:        st.Version,
+					SourceCommitId: "",
+					DeployedAt:     deployedAt,
+				}
+				p.process(&service.BroadcastEvent{
+					Key: service.Key{
+						Application: "app",
+						Environment: "staging",
+					},
+					ArgocdVersion:     version,
+					KuberpultVersion:  version,
+					RolloutStatus:     st.Status,
+					AutoRollbackAfter: 0,
+				})
+			}
+			p.now = func() time.Time { return deployedAt.Add(tc.CheckAt) }
+			if err := p.promote(ctx); err != nil {
+				t.Fatal(err)
+			}
+			// a version is only promoted once
+			if err := p.promote(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.ExpectedRequests, batchClient.requests, protocmp.Transform()); diff != "" {
+				t.Errorf("requests mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPromoteSendsRole(t *testing.T) {
+	deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	//exhaustruct:ignore
+	overview := &api.GetOverviewResponse{
+		EnvironmentGroups: []*api.EnvironmentGroup{
+			{Environments: []*api.Environment{
+				{
+					Name:         "staging",
+					Applications: map[string]*api.Environment_Application{"app": {Name: "app", Version: 3}},
+				},
+				{
+					Name: "production",
+					Config: &api.EnvironmentConfig{
+						Upstream:  &api.EnvironmentConfig_Upstream{Environment: ptr.FromString("staging")},
+						Promotion: &api.EnvironmentConfig_Promotion{SoakTime: "2h"},
+					},
+					Applications: map[string]*api.Environment_Application{"app": {Name: "app", Version: 2}},
+				},
+			}},
+		},
+	}
+	tcs := []struct {
+		Name          string
+		Role          string
+		ExpectedRoles []string
+	}{
+		{
+			Name:          "without a role",
+			Role:          "",
+			ExpectedRoles: nil,
+		},
+		{
+			Name:          "with a role",
+			Role:          "RolloutService",
+			ExpectedRoles: []string{auth.Encode64("RolloutService")},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			batchClient := &mockBatchClient{}
+			p := New(&mockOverviewSource{overview: overview}, batchClient, Config{
+				CheckInterval: time.Minute,
+				Role:          tc.Role,
+			})
+			version := &versions.VersionInfo{
+				Version:        3,
+				SourceCommitId: "",
+				DeployedAt:     deployedAt,
+			}
+			p.process(&service.BroadcastEvent{
+				Key: service.Key{
+					Application: "app",
+					Environment: "staging",
+				},
+				ArgocdVersion:     version,
+				KuberpultVersion:  version,
+				RolloutStatus:     api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL,
+				AutoRollbackAfter: 0,
+			})
+			p.now = func() time.Time { return deployedAt.Add(3 * time.Hour) }
+			if err := p.promote(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(batchClient.roles) != 1 {
+				t.Fatalf("expected one promotion, got %d requests", len(batchClient.roles))
+			}
+			if diff := cmp.Diff(tc.ExpectedRoles, batchClient.roles[0]); diff != "" {
+				t.Errorf("role mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
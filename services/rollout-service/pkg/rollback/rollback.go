@@ -0,0 +1,307 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package rollback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/logger"
+	"github.com/freiheit-com/kuberpult/pkg/setup"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/service"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/versions"
+	"go.uber.org/zap"
+)
+
+var errChannelClosed error = fmt.Errorf("rollback: channel closed")
+
+// Failed rollbacks are retried after the check interval, the delay doubles with every failure up to this maximum.
+const maxRetryDelay = 30 * time.Minute
+
+type Config struct {
+	// Versions that turn unhealthy later than this after they were deployed are not rolled back.
+	MaxAge time.Duration
+	// How often the unhealthy applications are checked.
+	CheckInterval time.Duration
+	// If set, the state of the applications is stored in this file, so that it survives restarts.
+	StateFile string
+	// The RBAC role that is sent to the cd-service with the rollbacks.
+	Role string
+}
+
+// Subscriber rolls back versions that stay unhealthy for longer than the auto rollback policy of their environment allows.
+// The version is rolled back by the cd-service and an application lock is created, so that it is not deployed again.
+type Subscriber struct {
+	batchClient   api.BatchServiceClient
+	maxAge        time.Duration
+	checkInterval time.Duration
+	stateFile     string
+	role          string
+	state         map[service.Key]*appState
+	// true if the state changed since it was stored
+	dirty bool
+	// Used to simulate the current time in tests
+	now func() time.Time
+}
+
+func New(batchClient api.BatchServiceClient, config Config) (*Subscriber, error) {
+	state, err := loadState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscriber{
+		batchClient:   batchClient,
+		maxAge:        config.MaxAge,
+		checkInterval: config.CheckInterval,
+		stateFile:     config.StateFile,
+		role:          config.Role,
+		state:         state,
+		dirty:         false,
+		now:           time.Now,
+	}, nil
+}
+
+type appState struct {
+	Version    uint64    `json:"version"`
+	DeployedAt time.Time `json:"deployedAt"`
+	// 0 if the environment has no auto rollback policy
+	AutoRollbackAfter time.Duration `json:"autoRollbackAfter"`
+	// zero if the version is not unhealthy
+	UnhealthySince time.Time `json:"unhealthySince"`
+	WasHealthy     bool      `json:"wasHealthy"`
+	RolledBack     bool      `json:"rolledBack"`
+	// Number of failed rollbacks of this version
+	Failures int `json:"failures"`
+	// zero if the rollback was not tried yet
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// storedAppState is the format of the state file.
+type storedAppState struct {
+	Environment string `json:"environment"`
+	Application string `json:"application"`
+	appState
+}
+
+func loadState(file string) (map[service.Key]*appState, error) {
+	result := map[service.Key]*appState{}
+	if file == "" {
+		return result, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, fmt.Errorf("could not read auto rollback state: %w", err)
+	}
+	var stored []storedAppState
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, fmt.Errorf("could not parse auto rollback state %q: %w", file, err)
+	}
+	for i := range stored {
+		result[service.Key{
+			Environment: stored[i].Environment,
+			Application: stored[i].Application,
+		}] = &stored[i].appState
+	}
+	return result, nil
+}
+
+func (s *Subscriber) storeState(ctx context.Context) {
+	if s.stateFile == "" || !s.dirty {
+		return
+	}
+	stored := make([]storedAppState, 0, len(s.state))
+	for key, st := range s.state {
+		stored = append(stored, storedAppState{
+			Environment: key.Environment,
+			Application: key.Application,
+			appState:    *st,
+		})
+	}
+	content, err := json.Marshal(stored)
+	if err == nil {
+		// the file is replaced atomically, so that a crash never leaves a partial state behind
+		tmp := s.stateFile + ".tmp"
+		if err = os.WriteFile(tmp, content, 0644); err == nil {
+			err = os.Rename(tmp, s.stateFile)
+		}
+	}
+	if err != nil {
+		logger.FromContext(ctx).Warn("rollback.state", zap.Error(err))
+		return
+	}
+	s.dirty = false
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, broadcast *service.Broadcast, health *setup.HealthReporter) error {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	return health.Retry(ctx, func() error {
+		initial, ch, unsubscribe := broadcast.Start()
+		health.ReportReady("watching")
+		defer unsubscribe()
+		for _, ev := range initial {
+			s.process(ev)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				s.rollbackUnhealthy(ctx)
+				s.storeState(ctx)
+			case ev, ok := <-ch:
+				if !ok {
+					select {
+					case <-ctx.Done():
+						return nil
+					default:
+						return errChannelClosed
+					}
+				}
+				s.process(ev)
+			}
+		}
+	})
+}
+
+func (s *Subscriber) process(ev *service.BroadcastEvent) {
+	s.dirty = true
+	if ev.KuberpultVersion == nil || ev.KuberpultVersion.Version == 0 {
+		delete(s.state, ev.Key)
+		return
+	}
+	st := s.state[ev.Key]
+	if st == nil || st.Version != ev.KuberpultVersion.Version {
+		st = &appState{
+			Version:           ev.KuberpultVersion.Version,
+			DeployedAt:        ev.KuberpultVersion.DeployedAt,
+			AutoRollbackAfter: 0,
+			UnhealthySince:    time.Time{},
+			WasHealthy:        false,
+			RolledBack:        false,
+			Failures:          0,
+			NextAttempt:       time.Time{},
+		}
+		s.state[ev.Key] = st
+	}
+	// the policy is taken from every event, so that changes of the policy apply to the current version as well
+	st.AutoRollbackAfter = ev.AutoRollbackAfter
+	switch ev.RolloutStatus {
+	case api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL:
+		st.WasHealthy = true
+		st.UnhealthySince = time.Time{}
+	case api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY, api.RolloutStatus_ROLLOUT_STATUS_ERROR:
+		if ev.ArgocdVersion == nil || ev.ArgocdVersion.Version != st.Version {
+			// the status is not about the version deployed by kuberpult
+			return
+		}
+		if st.UnhealthySince.IsZero() {
+			st.UnhealthySince = s.now()
+		}
+	default:
+		st.UnhealthySince = time.Time{}
+	}
+}
+
+func (a *appState) isDue(now time.Time, maxAge time.Duration) bool {
+	if a.AutoRollbackAfter == 0 || a.RolledBack || a.WasHealthy || a.UnhealthySince.IsZero() {
+		return false
+	}
+	// Only fresh versions are rolled back. A version that was running for a while and then turned unhealthy
+	// probably suffers from a problem that a rollback does not fix.
+	if a.DeployedAt.IsZero() || a.UnhealthySince.Sub(a.DeployedAt) > maxAge {
+		return false
+	}
+	if now.Before(a.NextAttempt) {
+		return false
+	}
+	return !now.Before(a.UnhealthySince.Add(a.AutoRollbackAfter))
+}
+
+// retryDelay returns how long to wait before the next attempt after the given number of failed rollbacks.
+func (s *Subscriber) retryDelay(failures int) time.Duration {
+	delay := s.checkInterval
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+func (s *Subscriber) rollbackUnhealthy(ctx context.Context) {
+	now := s.now()
+	for key, st := range s.state {
+		if !st.isDue(now, s.maxAge) {
+			continue
+		}
+		s.dirty = true
+		// a rollback usually fails because the environment or application is locked, so it is retried with an increasing delay
+		if err := s.rollback(ctx, key, st); err != nil {
+			st.Failures++
+			st.NextAttempt = now.Add(s.retryDelay(st.Failures))
+			logger.FromContext(ctx).Warn("rollback.failed",
+				zap.String("environment", key.Environment),
+				zap.String("application", key.Application),
+				zap.Uint64("version", st.Version),
+				zap.Int("failures", st.Failures),
+				zap.Time("nextAttempt", st.NextAttempt),
+				zap.Error(err))
+		} else {
+			st.RolledBack = true
+			logger.FromContext(ctx).Info("rollback.done",
+				zap.String("environment", key.Environment),
+				zap.String("application", key.Application),
+				zap.Uint64("version", st.Version))
+		}
+	}
+}
+
+func (s *Subscriber) rollback(ctx context.Context, key service.Key, st *appState) error {
+	ctx = versions.WriteRolloutServiceUserToGrpcContext(ctx, s.role)
+	version := st.Version
+	_, err := s.batchClient.ProcessBatch(ctx, &api.BatchRequest{Actions: []*api.BatchAction{
+		{Action: &api.BatchAction_Rollback{
+			Rollback: &api.RollbackRequest{
+				Environment: key.Environment,
+				Application: key.Application,
+				// locks are respected, whoever locked the application is already taking care of it
+				LockBehavior: api.LockBehavior_FAIL,
+				Version:      &version,
+			},
+		}},
+		{Action: &api.BatchAction_CreateEnvironmentApplicationLock{
+			CreateEnvironmentApplicationLock: &api.CreateEnvironmentApplicationLockRequest{
+				Environment: key.Environment,
+				Application: key.Application,
+				LockId:      fmt.Sprintf("auto-rollback-%d", version),
+				Message:     fmt.Sprintf("Version %d was rolled back automatically, because it was unhealthy for %s after it was deployed.", version, st.AutoRollbackAfter),
+				ExpiresAt:   nil,
+			},
+		}},
+	}})
+	return err
+}
@@ -0,0 +1,379 @@
+/*This file is part of kuberpult.
+
+Kuberpult is free software: you can redistribute it and/or modify
+it under the terms of the Expat(MIT) License as published by
+the Free Software Foundation.
+
+Kuberpult is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+MIT License for more details.
+
+You should have received a copy of the MIT License
+along with kuberpult. If not, see <https://directory.fsf.org/wiki/License:Expat>.
+
+Copyright freiheit.com*/
+
+package rollback
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/freiheit-com/kuberpult/pkg/api/v1"
+	"github.com/freiheit-com/kuberpult/pkg/auth"
+	"github.com/freiheit-com/kuberpult/pkg/ptr"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/service"
+	"github.com/freiheit-com/kuberpult/services/rollout-service/pkg/versions"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+type mockBatchClient struct {
+	api.BatchServiceClient
+	requests []*api.BatchRequest
+	// the roles that were sent with the requests
+	roles [][]string
+	err   error
+}
+
+func (m *mockBatchClient) ProcessBatch(ctx context.Context, in *api.BatchRequest, opts ...grpc.CallOption) (*api.BatchResponse, error) {
+	m.requests = append(m.requests, in)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	m.roles = append(m.roles, md.Get(auth.HeaderUserRole))
+	return &api.BatchResponse{}, m.err
+}
+
+func TestRollbackUnhealthy(t *testing.T) {
+	deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	type step struct {
+		// time since the deployment
+		At      time.Duration
+		Version uint64
+		Status  api.RolloutStatus
+	}
+	rollbackRequest := func(version uint64) *api.BatchRequest {
+		return &api.BatchRequest{Actions: []*api.BatchAction{
+			{Action: &api.BatchAction_Rollback{
+				Rollback: &api.RollbackRequest{
+					Environment:  "production",
+					Application:  "app",
+					LockBehavior: api.LockBehavior_FAIL,
+					Version:      ptr.Uint64(version),
+				},
+			}},
+			{Action: &api.BatchAction_CreateEnvironmentApplicationLock{
+				CreateEnvironmentApplicationLock: &api.CreateEnvironmentApplicationLockRequest{
+					Environment: "production",
+					Application: "app",
+					LockId:      fmt.Sprintf("auto-rollback-%d", version),
+					Message:     fmt.Sprintf("Version %d was rolled back automatically, because it was unhealthy for 10m0s after it was deployed.", version),
+				},
+			}},
+		}}
+	}
+	tcs := []struct {
+		Name              string
+		AutoRollbackAfter time.Duration
+		Steps             []step
+		CheckAt           time.Duration
+		ExpectedRequests  []*api.BatchRequest
+	}{
+		{
+			Name:              "version that stays unhealthy is rolled back",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_PROGRESSING},
+				{At: 2 * time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt:          12 * time.Minute,
+			ExpectedRequests: []*api.BatchRequest{rollbackRequest(2)},
+		},
+		{
+			Name:              "version with rollout error is rolled back",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_ERROR},
+			},
+			CheckAt:          11 * time.Minute,
+			ExpectedRequests: []*api.BatchRequest{rollbackRequest(2)},
+		},
+		{
+			Name:              "version that is not unhealthy for long enough is kept",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: 2 * time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt: 11 * time.Minute,
+		},
+		{
+			Name:              "unhealthy time starts again after the version recovered",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+				{At: 5 * time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_PROGRESSING},
+				{At: 6 * time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt: 12 * time.Minute,
+		},
+		{
+			Name:              "environment without policy",
+			AutoRollbackAfter: 0,
+			Steps: []step{
+				{At: time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt: 2 * time.Hour,
+		},
+		{
+			Name:              "version that was healthy before is kept",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+				{At: 2 * time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt: 20 * time.Minute,
+		},
+		{
+			Name:              "version that turns unhealthy long after the deployment is kept",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: 2 * time.Hour, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt: 3 * time.Hour,
+		},
+		{
+			Name:              "new version resets the state",
+			AutoRollbackAfter: 10 * time.Minute,
+			Steps: []step{
+				{At: time.Minute, Version: 2, Status: api.RolloutStatus_ROLLOUT_STATUS_SUCCESFUL},
+				{At: 2 * time.Minute, Version: 3, Status: api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY},
+			},
+			CheckAt:          15 * time.Minute,
+			ExpectedRequests: []*api.BatchRequest{rollbackRequest(3)},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			client := &mockBatchClient{}
+			s, err := New(client, Config{
+				MaxAge:        time.Hour,
+				CheckInterval: time.Minute,
+				StateFile:     "",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, st := range tc.Steps {
+				s.now = func() time.Time { return deployedAt.Add(st.At) }
+				version := &versions.VersionInfo{
+					Version:        st.Version,
+					SourceCommitId: "",
+					DeployedAt:     deployedAt,
+				}
+				s.process(&service.BroadcastEvent{
+					Key: service.Key{
+						Application: "app",
+						Environment: "production",
+					},
+					ArgocdVersion:     version,
+					KuberpultVersion:  version,
+					RolloutStatus:     st.Status,
+					AutoRollbackAfter: tc.AutoRollbackAfter,
+				})
+			}
+			s.now = func() time.Time { return deployedAt.Add(tc.CheckAt) }
+			s.rollbackUnhealthy(ctx)
+			// a version is only rolled back once
+			s.rollbackUnhealthy(ctx)
+			if diff := cmp.Diff(tc.ExpectedRequests, client.requests, protocmp.Transform()); diff != "" {
+				t.Errorf("requests mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func unhealthyEvent(deployedAt time.Time, autoRollbackAfter time.Duration) *service.BroadcastEvent {
+	version := &versions.VersionInfo{
+		Version:        2,
+		SourceCommitId: "",
+		DeployedAt:     deployedAt,
+	}
+	return &service.BroadcastEvent{
+		Key: service.Key{
+			Application: "app",
+			Environment: "production",
+		},
+		ArgocdVersion:     version,
+		KuberpultVersion:  version,
+		RolloutStatus:     api.RolloutStatus_ROLLOUT_STATUS_UNHEALTHY,
+		AutoRollbackAfter: autoRollbackAfter,
+	}
+}
+
+func TestRollbackPolicyChange(t *testing.T) {
+	ctx := context.Background()
+	deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	client := &mockBatchClient{}
+	s, err := New(client, Config{MaxAge: time.Hour, CheckInterval: time.Minute, StateFile: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return deployedAt.Add(time.Minute) }
+	s.process(unhealthyEvent(deployedAt, 0))
+	s.now = func() time.Time { return deployedAt.Add(20 * time.Minute) }
+	s.rollbackUnhealthy(ctx)
+	if len(client.requests) != 0 {
+		t.Fatalf("expected no rollback without a policy, got %d requests", len(client.requests))
+	}
+	// the policy is added to the environment while the same version is deployed
+	s.process(unhealthyEvent(deployedAt, 10*time.Minute))
+	s.rollbackUnhealthy(ctx)
+	if len(client.requests) != 1 {
+		t.Fatalf("expected one rollback after the policy was added, got %d requests", len(client.requests))
+	}
+}
+
+func TestRollbackSendsRole(t *testing.T) {
+	tcs := []struct {
+		Name          string
+		Role          string
+		ExpectedRoles []string
+	}{
+		{
+			Name:          "without a role",
+			Role:          "",
+			ExpectedRoles: nil,
+		},
+		{
+			Name:          "with a role",
+			Role:          "RolloutService",
+			ExpectedRoles: []string{auth.Encode64("RolloutService")},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+			client := &mockBatchClient{}
+			s, err := New(client, Config{MaxAge: time.Hour, CheckInterval: time.Minute, StateFile: "", Role: tc.Role})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.now = func() time.Time { return deployedAt.Add(time.Minute) }
+			s.process(unhealthyEvent(deployedAt, 10*time.Minute))
+			s.now = func() time.Time { return deployedAt.Add(20 * time.Minute) }
+			s.rollbackUnhealthy(context.Background())
+			if len(client.roles) != 1 {
+				t.Fatalf("expected one rollback, got %d requests", len(client.roles))
+			}
+			if diff := cmp.Diff(tc.ExpectedRoles, client.roles[0]); diff != "" {
+				t.Errorf("role mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRollbackRetry(t *testing.T) {
+	ctx := context.Background()
+	deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	client := &mockBatchClient{err: fmt.Errorf("environment is locked")}
+	s, err := New(client, Config{MaxAge: time.Hour, CheckInterval: time.Minute, StateFile: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return deployedAt.Add(time.Minute) }
+	s.process(unhealthyEvent(deployedAt, 10*time.Minute))
+
+	tcs := []struct {
+		// time since the deployment
+		At               time.Duration
+		Err              error
+		ExpectedRequests int
+	}{
+		{At: 11 * time.Minute, Err: fmt.Errorf("locked"), ExpectedRequests: 1},
+		// the first retry is after the check interval
+		{At: 11*time.Minute + 30*time.Second, Err: fmt.Errorf("locked"), ExpectedRequests: 1},
+		{At: 12 * time.Minute, Err: fmt.Errorf("locked"), ExpectedRequests: 2},
+		// the delay doubles
+		{At: 13 * time.Minute, Err: nil, ExpectedRequests: 2},
+		{At: 14 * time.Minute, Err: nil, ExpectedRequests: 3},
+		// successful rollbacks are not repeated
+		{At: time.Hour, Err: nil, ExpectedRequests: 3},
+	}
+	for _, tc := range tcs {
+		client.err = tc.Err
+		s.now = func() time.Time { return deployedAt.Add(tc.At) }
+		s.rollbackUnhealthy(ctx)
+		if len(client.requests) != tc.ExpectedRequests {
+			t.Fatalf("at %s: expected %d requests, got %d", tc.At, tc.ExpectedRequests, len(client.requests))
+		}
+	}
+}
+
+func TestRollbackRetryDelay(t *testing.T) {
+	s := &Subscriber{checkInterval: time.Minute}
+	tcs := []struct {
+		Failures int
+		Expected time.Duration
+	}{
+		{Failures: 1, Expected: time.Minute},
+		{Failures: 2, Expected: 2 * time.Minute},
+		{Failures: 4, Expected: 8 * time.Minute},
+		{Failures: 100, Expected: maxRetryDelay},
+	}
+	for _, tc := range tcs {
+		if got := s.retryDelay(tc.Failures); got != tc.Expected {
+			t.Errorf("retryDelay(%d) = %s, want %s", tc.Failures, got, tc.Expected)
+		}
+	}
+}
+
+func TestRollbackStateSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	deployedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	config := Config{
+		MaxAge:        time.Hour,
+		CheckInterval: time.Minute,
+		StateFile:     filepath.Join(t.TempDir(), "state.json"),
+	}
+	client := &mockBatchClient{}
+	s, err := New(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return deployedAt.Add(time.Minute) }
+	s.process(unhealthyEvent(deployedAt, 10*time.Minute))
+	s.storeState(ctx)
+
+	// after the restart the version is unhealthy since the first event
+	restarted, err := New(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.now = func() time.Time { return deployedAt.Add(11 * time.Minute) }
+	restarted.process(unhealthyEvent(deployedAt, 10*time.Minute))
+	restarted.rollbackUnhealthy(ctx)
+	restarted.storeState(ctx)
+	if len(client.requests) != 1 {
+		t.Fatalf("expected one rollback, got %d requests", len(client.requests))
+	}
+
+	// a rolled back version is not rolled back again after another restart
+	again, err := New(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.now = func() time.Time { return deployedAt.Add(20 * time.Minute) }
+	again.process(unhealthyEvent(deployedAt, 10*time.Minute))
+	again.rollbackUnhealthy(ctx)
+	if len(client.requests) != 1 {
+		t.Fatalf("expected no further rollback, got %d requests", len(client.requests))
+	}
+}
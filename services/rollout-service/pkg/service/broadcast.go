@@ -43,6 +43,8 @@ type appState struct {
 	environmentGroup string
 	isProduction     *bool
 	team             string
+	// 0 if the environment has no auto rollback policy
+	autoRollbackAfter time.Duration
 }
 
 func (a *appState) applyArgoEvent(ev *ArgoEvent) *BroadcastEvent {
@@ -56,11 +58,12 @@ func (a *appState) applyArgoEvent(ev *ArgoEvent) *BroadcastEvent {
 }
 
 func (a *appState) applyKuberpultEvent(ev *versions.KuberpultEvent) *BroadcastEvent {
-	if !a.argocdVersion.Equal(ev.Version) || a.isProduction == nil || *a.isProduction != ev.IsProduction {
+	if !a.argocdVersion.Equal(ev.Version) || a.isProduction == nil || *a.isProduction != ev.IsProduction || a.autoRollbackAfter != ev.AutoRollbackAfter {
 		a.kuberpultVersion = ev.Version
 		a.environmentGroup = ev.EnvironmentGroup
 		a.team = ev.Team
 		a.isProduction = ptr.Bool(ev.IsProduction)
+		a.autoRollbackAfter = ev.AutoRollbackAfter
 		return a.getEvent(ev.Application, ev.Environment)
 	}
 	return nil
@@ -80,12 +83,13 @@ func (a *appState) getEvent(application, environment string) *BroadcastEvent {
 			Environment: environment,
 			Application: application,
 		},
-		EnvironmentGroup: a.environmentGroup,
-		IsProduction:     a.isProduction,
-		ArgocdVersion:    a.argocdVersion,
-		RolloutStatus:    rs,
-		Team:             a.team,
-		KuberpultVersion: a.kuberpultVersion,
+		EnvironmentGroup:  a.environmentGroup,
+		IsProduction:      a.isProduction,
+		ArgocdVersion:     a.argocdVersion,
+		RolloutStatus:     rs,
+		Team:              a.team,
+		KuberpultVersion:  a.kuberpultVersion,
+		AutoRollbackAfter: a.autoRollbackAfter,
 	}
 }
 
@@ -315,6 +319,8 @@ type BroadcastEvent struct {
 	ArgocdVersion    *versions.VersionInfo
 	KuberpultVersion *versions.VersionInfo
 	RolloutStatus    api.RolloutStatus
+	// 0 if the environment has no auto rollback policy
+	AutoRollbackAfter time.Duration
 }
 
 func streamStatus(b *BroadcastEvent) *api.StreamStatusResponse {
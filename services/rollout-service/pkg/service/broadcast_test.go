@@ -468,6 +468,32 @@ func TestBroadcast(t *testing.T) {
 	}
 }
 
+func TestBroadcastAutoRollbackPolicyChange(t *testing.T) {
+	bc := New()
+	_, ch, unsubscribe := bc.Start()
+	defer unsubscribe()
+	ev := versions.KuberpultEvent{
+		Application: "foo",
+		Environment: "bar",
+		Version:     &versions.VersionInfo{Version: 1},
+	}
+	bc.ProcessKuberpultEvent(context.Background(), ev)
+	if msg := <-ch; msg.AutoRollbackAfter != 0 {
+		t.Fatalf("expected no auto rollback policy, got %s", msg.AutoRollbackAfter)
+	}
+	// the same version with a new policy is sent again
+	ev.AutoRollbackAfter = 10 * time.Minute
+	bc.ProcessKuberpultEvent(context.Background(), ev)
+	select {
+	case msg := <-ch:
+		if msg.AutoRollbackAfter != 10*time.Minute {
+			t.Errorf("expected the new auto rollback policy, got %s", msg.AutoRollbackAfter)
+		}
+	default:
+		t.Fatal("expected an event for the policy change")
+	}
+}
+
 func TestBroadcastDoesntGetStuck(t *testing.T) {
 	t.Parallel()
 	tcs := []struct {
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
@@ -36,17 +37,29 @@ import (
 )
 
 // This is a the user that the rollout service uses to query the versions.
-// It is not written to the repository.
+// It is written to the repository by automatic rollbacks and promotions.
 var RolloutServiceUser auth.User = auth.User{
 	DexAuthContext: nil,
 	Email:          "kuberpult-rollout-service@local",
 	Name:           "kuberpult-rollout-service",
 }
 
+// WriteRolloutServiceUserToGrpcContext adds the rollout service user to the GRPC context.
+// The role is only needed for changes to the repository if RBAC is enabled in the cd-service, and is not sent if it is empty.
+func WriteRolloutServiceUserToGrpcContext(ctx context.Context, role string) context.Context {
+	ctx = auth.WriteUserToGrpcContext(ctx, RolloutServiceUser)
+	if role != "" {
+		ctx = auth.WriteUserRoleToGrpcContext(ctx, role)
+	}
+	return ctx
+}
+
 type VersionClient interface {
 	GetVersion(ctx context.Context, revision, environment, application string) (*VersionInfo, error)
 	ConsumeEvents(ctx context.Context, processor VersionEventProcessor, hr *setup.HealthReporter) error
 	GetArgoProcessor() *argo.ArgoAppProcessor
+	// GetLatestOverview returns the last overview received by ConsumeEvents, or nil before the first one.
+	GetLatestOverview() *api.GetOverviewResponse
 }
 
 type versionClient struct {
@@ -54,6 +67,7 @@ type versionClient struct {
 	versionClient  api.VersionServiceClient
 	cache          *lru.Cache
 	ArgoProcessor  argo.ArgoAppProcessor
+	latest         atomic.Pointer[api.GetOverviewResponse]
 }
 
 type VersionInfo struct {
@@ -138,6 +152,17 @@ func deployedAt(app *api.Environment_Application) time.Time {
 	return time.Time{}
 }
 
+func autoRollbackAfter(env *api.Environment) time.Duration {
+	if env.Config == nil || env.Config.AutoRollback == nil {
+		return 0
+	}
+	d, err := time.ParseDuration(env.Config.AutoRollback.UnhealthyDuration)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
 func team(overview *api.GetOverviewResponse, app string) string {
 	a := overview.Applications[app]
 	if a == nil {
@@ -166,6 +191,8 @@ type KuberpultEvent struct {
 	IsProduction     bool
 	Team             string
 	Version          *VersionInfo
+	// 0 if the environment has no auto rollback policy
+	AutoRollbackAfter time.Duration
 }
 
 type VersionEventProcessor interface {
@@ -182,6 +209,7 @@ func (v *versionClient) ConsumeEvents(ctx context.Context, processor VersionEven
 	versions := map[key]uint64{}
 	environmentGroups := map[key]string{}
 	teams := map[key]string{}
+	autoRollbacks := map[key]time.Duration{}
 	return hr.Retry(ctx, func() error {
 		client, err := v.overviewClient.StreamOverview(ctx, &api.GetOverviewRequest{
 			GitRevision: "",
@@ -208,6 +236,7 @@ func (v *versionClient) ConsumeEvents(ctx context.Context, processor VersionEven
 			}
 			l := logger.FromContext(ctx).With(zap.String("git.revision", overview.GitRevision))
 			v.cache.Add(overview.GitRevision, overview)
+			v.latest.Store(overview)
 			l.Info("overview.get")
 			seen := make(map[key]uint64, len(versions))
 			for _, envGroup := range overview.EnvironmentGroups {
@@ -222,9 +251,12 @@ func (v *versionClient) ConsumeEvents(ctx context.Context, processor VersionEven
 						seen[k] = app.Version
 						environmentGroups[k] = envGroup.EnvironmentGroupName
 						teams[k] = tm
-						if versions[k] == app.Version {
+						rollbackAfter := autoRollbackAfter(env)
+						// changes of the policy are sent as well, so that they apply to the deployed version
+						if versions[k] == app.Version && autoRollbacks[k] == rollbackAfter {
 							continue
 						}
+						autoRollbacks[k] = rollbackAfter
 
 						processor.ProcessKuberpultEvent(ctx, KuberpultEvent{
 							Application:      app.Name,
@@ -237,6 +269,7 @@ func (v *versionClient) ConsumeEvents(ctx context.Context, processor VersionEven
 								SourceCommitId: sc,
 								DeployedAt:     dt,
 							},
+							AutoRollbackAfter: rollbackAfter,
 						})
 
 					}
@@ -248,6 +281,7 @@ func (v *versionClient) ConsumeEvents(ctx context.Context, processor VersionEven
 			// to apps getting deleted.
 			for k := range versions {
 				if seen[k] == 0 {
+					delete(autoRollbacks, k)
 					processor.ProcessKuberpultEvent(ctx, KuberpultEvent{
 						IsProduction:     false,
 						Application:      k.Application,
@@ -259,6 +293,7 @@ func (v *versionClient) ConsumeEvents(ctx context.Context, processor VersionEven
 							SourceCommitId: "",
 							DeployedAt:     time.Time{},
 						},
+						AutoRollbackAfter: 0,
 					})
 				}
 			}
@@ -273,10 +308,15 @@ func New(oclient api.OverviewServiceClient, vclient api.VersionServiceClient, ap
 		overviewClient: oclient,
 		versionClient:  vclient,
 		ArgoProcessor:  argo.New(appClient, manageArgoApplicationEnabled, manageArgoApplicationFilter),
+		latest:         atomic.Pointer[api.GetOverviewResponse]{},
 	}
 	return result
 }
 
+func (v *versionClient) GetLatestOverview() *api.GetOverviewResponse {
+	return v.latest.Load()
+}
+
 func (v *versionClient) GetArgoProcessor() *argo.ArgoAppProcessor {
 	return &v.ArgoProcessor
 }
@@ -137,6 +137,18 @@ func (m *mockVersionClient) GetManifests(ctx context.Context, in *api.GetManifes
 	return nil, status.Error(codes.Unimplemented, "unimplemented")
 }
 
+func (m *mockVersionClient) GetRetentionPolicy(ctx context.Context, in *api.GetRetentionPolicyRequest, opts ...grpc.CallOption) (*api.GetRetentionPolicyResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (m *mockVersionClient) GetManifestDiff(ctx context.Context, in *api.GetManifestDiffRequest, opts ...grpc.CallOption) (*api.GetManifestDiffResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (m *mockVersionClient) GetScheduledDeployments(ctx context.Context, in *api.GetScheduledDeploymentsRequest, opts ...grpc.CallOption) (*api.GetScheduledDeploymentsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
 type mockVersionEventProcessor struct {
 	events []KuberpultEvent
 }
@@ -182,6 +194,27 @@ func TestVersionClientStream(t *testing.T) {
 		},
 		GitRevision: "1234",
 	}
+	testOverviewWithAutoRollback := &api.GetOverviewResponse{
+		Applications: testOverview.Applications,
+		EnvironmentGroups: []*api.EnvironmentGroup{
+			{
+				EnvironmentGroupName: "staging-group",
+				Environments: []*api.Environment{
+					{
+						Name:         "staging",
+						Applications: testOverview.EnvironmentGroups[0].Environments[0].Applications,
+						Priority:     api.Priority_UPSTREAM,
+						Config: &api.EnvironmentConfig{
+							AutoRollback: &api.EnvironmentConfig_AutoRollback{
+								UnhealthyDuration: "15m",
+							},
+						},
+					},
+				},
+			},
+		},
+		GitRevision: "1235",
+	}
 	testOverviewWithDifferentEnvgroup := &api.GetOverviewResponse{
 		Applications: map[string]*api.Application{
 			"foo": {
@@ -381,6 +414,52 @@ func TestVersionClientStream(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "Notify again when the auto rollback policy changes",
+			Steps: []step{
+				{
+					Overview: testOverview,
+
+					ExpectReady: true,
+					ExpectedEvents: []KuberpultEvent{
+						{
+							Environment:      "staging",
+							Application:      "foo",
+							EnvironmentGroup: "staging-group",
+							Team:             "footeam",
+							Version: &VersionInfo{
+								Version:        1,
+								SourceCommitId: "00001",
+								DeployedAt:     time.Unix(123456789, 0).UTC(),
+							},
+						},
+					},
+				},
+				{
+					Overview: testOverviewWithAutoRollback,
+
+					ExpectReady: true,
+					ExpectedEvents: []KuberpultEvent{
+						{
+							Environment:      "staging",
+							Application:      "foo",
+							EnvironmentGroup: "staging-group",
+							Team:             "footeam",
+							Version: &VersionInfo{
+								Version:        1,
+								SourceCommitId: "00001",
+								DeployedAt:     time.Unix(123456789, 0).UTC(),
+							},
+							AutoRollbackAfter: 15 * time.Minute,
+						},
+					},
+				},
+				{
+					RecvErr:       status.Error(codes.Canceled, "context cancelled"),
+					CancelContext: true,
+				},
+			},
+		},
 		{
 			Name: "Notify for apps that are deleted",
 			Steps: []step{